@@ -81,14 +81,21 @@ type Instance struct {
 // Stop stops all servers contained in i. It does NOT
 // execute shutdown callbacks.
 func (i *Instance) Stop() error {
-	// stop the servers
+	// stop the servers; they drain their connections
+	// at the same time, so the grace periods don't add up
+	var wg sync.WaitGroup
 	for _, s := range i.servers {
 		if gs, ok := s.server.(GracefulServer); ok {
-			if err := gs.Stop(); err != nil {
-				log.Printf("[ERROR] Stopping %s: %v", gs.Address(), err)
-			}
+			wg.Add(1)
+			go func(gs GracefulServer) {
+				defer wg.Done()
+				if err := gs.Stop(); err != nil {
+					log.Printf("[ERROR] Stopping %s: %v", gs.Address(), err)
+				}
+			}(gs)
 		}
 	}
+	wg.Wait()
 
 	// splice i out of instance list, causing it to be garbage-collected
 	instancesMu.Lock()
@@ -22,6 +22,15 @@ type (
 		File string
 		Line int
 		Text string
+
+		imported *importLink // the import that brought in the token, if any
+	}
+
+	// importLink is an import of a file or snippet, linked
+	// to the import that brought in the import statement.
+	importLink struct {
+		name   string // absolute path of a file, or (name) of a snippet
+		parent *importLink
 	}
 )
 
@@ -1,9 +1,16 @@
 package caddyfile
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -33,9 +40,10 @@ func allTokens(input io.Reader) (tokens []Token) {
 
 type parser struct {
 	Dispenser
-	block           ServerBlock // current server block being parsed
-	validDirectives []string    // a directive must be valid or it's an error
-	eof             bool        // if we encounter a valid EOF in a hard place
+	block           ServerBlock        // current server block being parsed
+	validDirectives []string           // a directive must be valid or it's an error
+	eof             bool               // if we encounter a valid EOF in a hard place
+	snippets        map[string][]Token // the tokens of each snippet defined so far
 }
 
 func (p *parser) parseAll() ([]ServerBlock, error) {
@@ -75,6 +83,10 @@ func (p *parser) begin() error {
 		return err
 	}
 
+	if name, ok := p.snippetName(); ok {
+		return p.defineSnippet(name)
+	}
+
 	if p.eof {
 		// this happens if the Caddyfile consists of only
 		// a line of addresses and nothing else
@@ -93,7 +105,10 @@ func (p *parser) addresses() error {
 	var expectingAnother bool
 
 	for {
-		tkn := replaceEnvVars(p.Val())
+		tkn, err := replaceEnvVars(p.Val())
+		if err != nil {
+			return p.Errf("%v in '%s'", err, p.Val())
+		}
 
 		// special case: import directive replaces tokens during parse-time
 		if tkn == "import" && p.isNewLine() {
@@ -194,27 +209,61 @@ func (p *parser) directives() error {
 	return nil
 }
 
-// doImport swaps out the import directive and its argument
-// (a total of 2 tokens) with the tokens in the specified file
-// or globbing pattern. When the function returns, the cursor
-// is on the token before where the import directive was. In
-// other words, call Next() to access the first token that was
-// imported.
+// doImport swaps out the import directive and its arguments with
+// the tokens of the specified snippet, or else of the specified file
+// or globbing pattern. When the function returns, the cursor is on
+// the token before where the import directive was. In other words,
+// call Next() to access the first token that was imported.
 func (p *parser) doImport() error {
+	importToken := p.tokens[p.cursor]
+
 	// syntax check
 	if !p.NextArg() {
 		return p.ArgErr()
 	}
 	importPattern := p.Val()
-	if p.NextArg() {
-		return p.Err("Import takes only one argument (glob pattern or file)")
+	args := p.RemainingArgs()
+
+	var importedTokens []Token
+	if snippet, ok := p.snippets[importPattern]; ok {
+		link, err := p.importLink(importToken, "("+importPattern+")")
+		if err != nil {
+			return err
+		}
+		importedTokens, err = p.expandSnippet(importPattern, snippet, args, link)
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(args) > 0 {
+			return p.Err("Import takes only one argument (glob pattern or file)")
+		}
+		var err error
+		importedTokens, err = p.importFiles(importToken, importPattern)
+		if err != nil {
+			return err
+		}
 	}
 
+	// splice out the import directive and its arguments
+	// and splice the imported tokens in their place, then
+	// rewind cursor so Next() will land on first imported token
+	tokensBefore := p.tokens[:p.cursor-1-len(args)]
+	tokensAfter := p.tokens[p.cursor+1:]
+	p.tokens = append(tokensBefore, append(importedTokens, tokensAfter...)...)
+	p.cursor -= 1 + len(args)
+
+	return nil
+}
+
+// importFiles returns the tokens of the files matching importPattern,
+// which was imported by importToken.
+func (p *parser) importFiles(importToken Token, importPattern string) ([]Token, error) {
 	// make path relative to Caddyfile rather than current working directory (issue #867)
 	// and then use glob to get list of matching filenames
 	absFile, err := filepath.Abs(p.Dispenser.filename)
 	if err != nil {
-		return p.Errf("Failed to get absolute path of file: %s", p.Dispenser.filename)
+		return nil, p.Errf("Failed to get absolute path of file: %s", p.Dispenser.filename)
 	}
 
 	var matches []string
@@ -227,22 +276,60 @@ func (p *parser) doImport() error {
 	matches, err = filepath.Glob(globPattern)
 
 	if err != nil {
-		return p.Errf("Failed to use import pattern %s: %v", importPattern, err)
+		return nil, p.Errf("Failed to use import pattern %s: %v", importPattern, err)
 	}
+	isGlob := strings.ContainsAny(importPattern, "*?[")
 	if len(matches) == 0 {
-		return p.Errf("No files matching import pattern %s", importPattern)
+		if !isGlob {
+			return nil, p.Errf("No files matching import pattern %s", importPattern)
+		}
+		// an empty directory of configs (like sites-enabled/*) is fine
+		log.Printf("[WARNING] %s:%d - No files matching import pattern %s", p.File(), p.Line(), importPattern)
+		return nil, nil
 	}
 
-	// splice out the import directive and its argument (2 tokens total)
-	tokensBefore := p.tokens[:p.cursor-1]
-	tokensAfter := p.tokens[p.cursor+1:]
+	// a directory named by the pattern imports the files in it; the
+	// files are imported in lexical order, so reloads are reproducible
+	var importFiles []string
+	for _, match := range matches {
+		// like in a shell, globs don't match hidden files unless asked to
+		if isGlob && strings.HasPrefix(filepath.Base(match), ".") &&
+			!strings.HasPrefix(filepath.Base(importPattern), ".") {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, p.Errf("Could not import %s: %v", match, err)
+		}
+		if !info.IsDir() {
+			importFiles = append(importFiles, match)
+			continue
+		}
+		if isGlob {
+			continue // only files are meant
+		}
+		dirFiles, err := filesInDir(match)
+		if err != nil {
+			return nil, p.Errf("Could not import %s: %v", match, err)
+		}
+		importFiles = append(importFiles, dirFiles...)
+	}
+	sort.Strings(importFiles)
 
 	// collect all the imported tokens
 	var importedTokens []Token
-	for _, importFile := range matches {
+	for _, importFile := range importFiles {
+		absImport, err := filepath.Abs(importFile)
+		if err != nil {
+			return nil, p.Errf("Failed to get absolute path of file: %s", importFile)
+		}
+		link, err := p.importLink(importToken, absImport)
+		if err != nil {
+			return nil, err
+		}
 		newTokens, err := p.doSingleImport(importFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var importLine int
 		importDir := filepath.Dir(importFile)
@@ -265,17 +352,105 @@ func (p *parser) doImport() error {
 				}
 			}
 		}
+		for i := range newTokens {
+			newTokens[i].imported = link
+		}
 		importedTokens = append(importedTokens, newTokens...)
 	}
 
-	// splice the imported tokens in the place of the import statement
-	// and rewind cursor so Next() will land on first imported token
-	p.tokens = append(tokensBefore, append(importedTokens, tokensAfter...)...)
-	p.cursor--
+	return importedTokens, nil
+}
+
+// importLink returns the link for importing name with importToken.
+// It returns an error if name is already being imported, which would
+// never end.
+func (p *parser) importLink(importToken Token, name string) (*importLink, error) {
+	for link := importToken.imported; link != nil; link = link.parent {
+		if link.name == name {
+			return nil, p.Errf("Import cycle: %s imports itself", name)
+		}
+	}
+	if absFile, err := filepath.Abs(p.Dispenser.filename); err == nil && absFile == name {
+		return nil, p.Errf("Import cycle: %s imports itself", name)
+	}
+	return &importLink{name: name, parent: importToken.imported}, nil
+}
 
+// snippetName returns the name of the snippet that the server block
+// being parsed defines, if it is a snippet: one named in parentheses.
+func (p *parser) snippetName() (string, bool) {
+	if len(p.block.Keys) != 1 {
+		return "", false
+	}
+	key := p.block.Keys[0]
+	if len(key) < 3 || !strings.HasPrefix(key, "(") || !strings.HasSuffix(key, ")") {
+		return "", false
+	}
+	return key[1 : len(key)-1], true
+}
+
+// defineSnippet stores the tokens of the block that follows, which
+// define the snippet name, for importing them into server blocks.
+// The snippet itself is not a server block.
+func (p *parser) defineSnippet(name string) error {
+	p.block.Keys = nil
+	if _, ok := p.snippets[name]; ok {
+		return p.Errf("Redefinition of snippet %s", name)
+	}
+	if p.eof || p.openCurlyBrace() != nil {
+		return p.Errf("Snippet %s must be followed by a block", name)
+	}
+
+	var tokens []Token
+	nesting := 1
+	for p.Next() {
+		if p.Val() == "{" {
+			nesting++
+		} else if p.Val() == "}" {
+			nesting--
+			if nesting == 0 {
+				break
+			}
+		}
+		tokens = append(tokens, p.tokens[p.cursor])
+	}
+	if nesting > 0 {
+		return p.EOFErr()
+	}
+
+	if p.snippets == nil {
+		p.snippets = make(map[string][]Token)
+	}
+	p.snippets[name] = tokens
 	return nil
 }
 
+// snippetArg matches the placeholders of snippet arguments.
+var snippetArg = regexp.MustCompile(`\{args\.(\d+)\}`)
+
+// expandSnippet returns a copy of the tokens of the snippet name
+// with its {args.N} placeholders replaced by the import arguments.
+func (p *parser) expandSnippet(name string, snippet []Token, args []string, link *importLink) ([]Token, error) {
+	tokens := make([]Token, len(snippet))
+	for i, token := range snippet {
+		var err error
+		token.Text = snippetArg.ReplaceAllStringFunc(token.Text, func(placeholder string) string {
+			n, _ := strconv.Atoi(snippetArg.FindStringSubmatch(placeholder)[1])
+			if n >= len(args) {
+				err = p.Errf("Snippet %s uses %s, but was imported with %d arguments", name, placeholder, len(args))
+				return placeholder
+			}
+			return args[n]
+		})
+		if err != nil {
+			return nil, err
+		}
+		token.imported = link
+		tokens[i] = token
+	}
+	return tokens, nil
+}
+
 // doSingleImport lexes the individual file at importFile and returns
 // its tokens or an error, if any.
 func (p *parser) doSingleImport(importFile string) ([]Token, error) {
@@ -286,8 +461,16 @@ func (p *parser) doSingleImport(importFile string) ([]Token, error) {
 	defer file.Close()
 	importedTokens := allTokens(file)
 
-	// Tack the filename onto these tokens so errors show the imported file's name
-	filename := filepath.Base(importFile)
+	// Tack the filename onto these tokens so errors show the imported file's
+	// name; use its path relative to the Caddyfile (if it is in the same
+	// directory tree), since files in different directories may share a name
+	filename := importFile
+	if absFile, err := filepath.Abs(p.Dispenser.filename); err == nil {
+		rel, err := filepath.Rel(filepath.Dir(absFile), importFile)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			filename = rel
+		}
+	}
 	for i := 0; i < len(importedTokens); i++ {
 		importedTokens[i].File = filename
 	}
@@ -295,6 +478,24 @@ func (p *parser) doSingleImport(importFile string) ([]Token, error) {
 	return importedTokens, nil
 }
 
+// filesInDir returns the paths of the files in dir, in lexical
+// order. Hidden files, like editor backups, and subdirectories
+// are left out.
+func filesInDir(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, info.Name()))
+	}
+	return files, nil
+}
+
 // directive collects tokens until the directive's scope
 // closes (either end of line or end of curly brace block).
 // It expects the currently-loaded token to be a directive
@@ -324,7 +525,11 @@ func (p *parser) directive() error {
 		} else if p.Val() == "}" && nesting == 0 {
 			return p.Err("Unexpected '}' because no matching opening brace")
 		}
-		p.tokens[p.cursor].Text = replaceEnvVars(p.tokens[p.cursor].Text)
+		text, err := replaceEnvVars(p.Val())
+		if err != nil {
+			return p.Errf("%v in '%s'", err, p.Val())
+		}
+		p.tokens[p.cursor].Text = text
 		p.block.Tokens[dir] = append(p.block.Tokens[dir], p.tokens[p.cursor])
 	}
 
@@ -370,28 +575,54 @@ func (p *parser) validDirective(dir string) bool {
 }
 
 // replaceEnvVars replaces environment variables that appear in the token
-// and understands both the $UNIX and %WINDOWS% syntaxes.
-func replaceEnvVars(s string) string {
-	s = replaceEnvReferences(s, "{%", "%}")
-	s = replaceEnvReferences(s, "{$", "}")
-	return s
+// and understands both the $UNIX and %WINDOWS% syntaxes. A variable may
+// have a default value after a colon, like {$PORT:2015}, which is used
+// when it is not set; a variable that is not set and has no default is
+// an error. Environment variables are replaced once, when the Caddyfile
+// is loaded, unlike the placeholders some directives fill in per request.
+func replaceEnvVars(s string) (string, error) {
+	s, err := replaceEnvReferences(s, "{%", "%}")
+	if err != nil {
+		return "", err
+	}
+	return replaceEnvReferences(s, "{$", "}")
 }
 
 // replaceEnvReferences performs the actual replacement of env variables
 // in s, given the placeholder start and placeholder end strings.
-func replaceEnvReferences(s, refStart, refEnd string) string {
-	index := strings.Index(s, refStart)
-	for index != -1 {
-		endIndex := strings.Index(s, refEnd)
-		if endIndex != -1 {
-			ref := s[index : endIndex+len(refEnd)]
-			s = strings.Replace(s, ref, os.Getenv(ref[len(refStart):len(ref)-len(refEnd)]), -1)
-		} else {
-			return s
-		}
-		index = strings.Index(s, refStart)
-	}
-	return s
+func replaceEnvReferences(s, refStart, refEnd string) (string, error) {
+	var buf bytes.Buffer
+	for {
+		index := strings.Index(s, refStart)
+		if index == -1 {
+			break
+		}
+		endIndex := strings.Index(s[index+len(refStart):], refEnd)
+		if endIndex == -1 {
+			break
+		}
+		endIndex += index + len(refStart)
+
+		name := s[index+len(refStart) : endIndex]
+		var fallback string
+		hasDefault := false
+		if colon := strings.Index(name, ":"); colon != -1 {
+			name, fallback, hasDefault = name[:colon], name[colon+1:], true
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if !hasDefault {
+				return "", fmt.Errorf("environment variable %s is not set and has no default", name)
+			}
+			value = fallback
+		}
+
+		buf.WriteString(s[:index])
+		buf.WriteString(value)
+		s = s[endIndex+len(refEnd):]
+	}
+	buf.WriteString(s)
+	return buf.String(), nil
 }
 
 // ServerBlock associates any number of keys (usually addresses
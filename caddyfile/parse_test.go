@@ -1,7 +1,11 @@
 package caddyfile
 
 import (
+	"bytes"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -379,9 +383,8 @@ func TestEnvironmentReplacement(t *testing.T) {
 
 	// malformed (non-existent) env var (unix)
 	p = testParser(`:{$PORT$}`)
-	blocks, _ = p.parseAll()
-	if actual, expected := blocks[0].Keys[0], ":"; expected != actual {
-		t.Errorf("Expected key to be '%s' but was '%s'", expected, actual)
+	if _, err := p.parseAll(); err == nil || !strings.Contains(err.Error(), "PORT$") {
+		t.Errorf("Expected error naming the unset variable, got: %v", err)
 	}
 
 	// in quoted field
@@ -392,8 +395,166 @@ func TestEnvironmentReplacement(t *testing.T) {
 	}
 }
 
+func TestEnvironmentReplacementDefaults(t *testing.T) {
+	os.Setenv("UPSTREAM", "10.0.0.1:8080")
+	os.Setenv("EMPTY", "")
+	os.Unsetenv("NOT_SET")
+
+	for i, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"dir1 {$UPSTREAM:localhost:9000}", "10.0.0.1:8080"},
+		{"dir1 {$NOT_SET:localhost:9000}", "localhost:9000"},
+		{"dir1 {%NOT_SET:fallback%}", "fallback"},
+		{"dir1 {$NOT_SET:}", ""},
+		{"dir1 {$EMPTY:fallback}", ""}, // set, even if empty
+		{"dir1 {$NOT_SET:a}/{$NOT_SET:b}", "a/b"},
+	} {
+		p := testParser(":1234\n" + test.input)
+		blocks, err := p.parseAll()
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if actual := blocks[0].Tokens["dir1"][1].Text; actual != test.expected {
+			t.Errorf("Test %d: Expected argument to be '%s' but was '%s'", i, test.expected, actual)
+		}
+	}
+
+	// a missing variable without default is an error that
+	// points at the token, in addresses and in directives
+	for i, input := range []string{
+		"{$NOT_SET}",
+		":1234\ndir1 foo\ndir2 {$NOT_SET}/bar",
+		":1234\ndir1 {%NOT_SET%}",
+	} {
+		p := testParser(input)
+		_, err := p.parseAll()
+		if err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), "NOT_SET") {
+			t.Errorf("Test %d: Expected error to name the variable, got: %v", i, err)
+		}
+	}
+	p := testParser(":1234\ndir1 foo\ndir2 {$NOT_SET}/bar")
+	if _, err := p.parseAll(); err == nil || !strings.Contains(err.Error(), "Caddyfile:3") {
+		t.Errorf("Expected error to point at line 3, got: %v", err)
+	}
+}
+
 func testParser(input string) parser {
 	buf := strings.NewReader(input)
 	p := parser{Dispenser: NewDispenser("Caddyfile", buf)}
 	return p
 }
+
+func TestSnippets(t *testing.T) {
+	p := testParser(`(common) {
+		gzip
+		header / {
+			Cache-Control max-age=3600
+		}
+	}
+	(proxied) {
+		proxy / {args.0} {args.1}
+		import common
+	}
+	example.com {
+		import common
+		log access.log
+	}
+	example.net {
+		import proxied localhost:8080 localhost:8081
+	}`)
+	blocks, err := p.parseAll()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("Expected 2 server blocks (snippets aren't), got %d", len(blocks))
+	}
+	for i, block := range blocks {
+		if len(block.Tokens["gzip"]) != 1 || len(block.Tokens["header"]) != 6 {
+			t.Errorf("Block %d: Expected tokens of the common snippet, got %v", i, block.Tokens)
+		}
+	}
+	if len(blocks[0].Tokens["log"]) != 2 {
+		t.Errorf("Expected directives after the import to be kept, got %v", blocks[0].Tokens)
+	}
+	var proxyArgs []string
+	for _, token := range blocks[1].Tokens["proxy"] {
+		proxyArgs = append(proxyArgs, token.Text)
+	}
+	if expected := []string{"proxy", "/", "localhost:8080", "localhost:8081"}; !reflect.DeepEqual(proxyArgs, expected) {
+		t.Errorf("Expected snippet arguments to be replaced, got %v", proxyArgs)
+	}
+
+	for i, test := range []struct {
+		input string
+		err   string
+	}{
+		{"(a) {\n dir1 {args.1}\n}\nhost {\n import a x\n}", "{args.1}"},
+		{"(a) {\n dir1\n}\n(a) {\n dir2\n}", "Redefinition"},
+		{"(a)\nhost", "must be followed by a block"},
+		{"(a) {\n dir1", "EOF"},
+		{"(a) {\n import a\n}\nhost {\n import a\n}", "Import cycle"},
+		{"(a) {\n import b\n}\n(b) {\n import a\n}\nhost {\n import a\n}", "Import cycle"},
+		{"host {\n import testdata/import_recursive.txt\n}", "Import cycle"},
+		{"host {\n import undefined foo\n}", "only one argument"},
+	} {
+		p := testParser(test.input)
+		_, err := p.parseAll()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Test %d: Expected error containing '%s', got: %v", i, test.err, err)
+		}
+	}
+}
+
+func TestImportDirectoryAndGlob(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		keys  []string
+	}{
+		{`import testdata/import_dir`, []string{"dir.a", "dir.b"}},
+		{`import testdata/import_dir/`, []string{"dir.a", "dir.b"}},
+		{`import testdata/import_dir/*`, []string{"dir.a", "dir.b"}},
+		{`import testdata/import_dir/*.conf`, []string{"dir.a", "dir.b"}},
+		{`import testdata/import_dir/*/c.conf`, []string{"dir.sub"}},
+	} {
+		p := testParser(test.input)
+		blocks, err := p.parseAll()
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		var keys []string
+		for _, block := range blocks {
+			keys = append(keys, block.Keys...)
+		}
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("Test %d: Expected keys %v, got %v", i, test.keys, keys)
+		}
+	}
+
+	// errors in imported files name the file
+	p := testParser(`import testdata/import_dir/sub/broken.conf`)
+	_, err := p.parseAll()
+	if err == nil || !strings.Contains(err.Error(), filepath.Join("testdata", "import_dir", "sub", "broken.conf")+":") {
+		t.Errorf("Expected error naming the imported file, got: %v", err)
+	}
+
+	// a glob that matches nothing is only worth a warning
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	p = testParser("localhost\nimport testdata/import_dir/*.missing")
+	if _, err := p.parseAll(); err != nil {
+		t.Errorf("Expected no error for a glob without matches, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "[WARNING]") || !strings.Contains(buf.String(), "*.missing") {
+		t.Errorf("Expected a warning about the glob, got: %q", buf.String())
+	}
+}
@@ -11,14 +11,18 @@ import (
 	"crypto/subtle"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jimstudt/http-authentication/basic"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // BasicAuth is middleware to protect resources with a username and password.
@@ -33,35 +37,50 @@ type BasicAuth struct {
 }
 
 // ServeHTTP implements the httpserver.Handler interface.
+// Only the rules of the most specific resource that matches
+// the request are used to authenticate it.
 func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	var hasAuth bool
 	var isAuthenticated bool
 
+	// Find the longest protected resource matching the path
+	var scope string
 	for _, rule := range a.Rules {
 		for _, res := range rule.Resources {
-			if !httpserver.Path(r.URL.Path).Matches(res) {
-				continue
+			if httpserver.Path(r.URL.Path).Matches(res) && (!hasAuth || len(res) > len(scope)) {
+				scope = res
+				hasAuth = true
 			}
+		}
+	}
 
-			// Path matches; parse auth header
-			username, password, ok := r.BasicAuth()
-			hasAuth = true
+	var realm string
+	if hasAuth {
+		// Path matches; parse auth header
+		username, password, ok := r.BasicAuth()
 
-			// Check credentials
-			if !ok ||
-				username != rule.Username ||
-				!rule.Password(password) {
+		for _, rule := range a.Rules {
+			if !rule.protects(scope) {
 				continue
 			}
+			if realm == "" {
+				realm = rule.Realm
+			}
 
-			// Flag set only on successful authentication
-			isAuthenticated = true
+			// Check credentials; flag set only on successful authentication
+			if ok && rule.authenticate(username, password) {
+				isAuthenticated = true
+				break
+			}
 		}
 	}
 
 	if hasAuth {
 		if !isAuthenticated {
-			w.Header().Set("WWW-Authenticate", "Basic realm=\"Restricted\"")
+			if realm == "" {
+				realm = DefaultRealm
+			}
+			w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(realm))
 			return http.StatusUnauthorized, nil
 		}
 		// "It's an older code, sir, but it checks out. I was about to clear them."
@@ -72,13 +91,38 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	return a.Next.ServeHTTP(w, r)
 }
 
+// DefaultRealm is the realm of rules that don't set one.
+const DefaultRealm = "Restricted"
+
 // Rule represents a BasicAuth rule. A username and password
 // combination protect the associated resources, which are
-// file or directory paths.
+// file or directory paths. If Users is set, any user of that
+// htpasswd file is accepted instead. Realm is sent to clients
+// that fail to authenticate for one of the resources.
 type Rule struct {
 	Username  string
 	Password  func(string) bool
+	Users     *HtpasswdFile
 	Resources []string
+	Realm     string
+}
+
+// protects reports whether res is one of r's resources.
+func (r Rule) protects(res string) bool {
+	for _, v := range r.Resources {
+		if v == res {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate reports whether the given credentials satisfy r.
+func (r Rule) authenticate(username, password string) bool {
+	if r.Users != nil {
+		return r.Users.Match(username, password)
+	}
+	return username == r.Username && r.Password(password)
 }
 
 // PasswordMatcher determines whether a password matches a rule.
@@ -93,6 +137,7 @@ var (
 func GetHtpasswdMatcher(filename, username, siteRoot string) (PasswordMatcher, error) {
 	filename = filepath.Join(siteRoot, filename)
 	htpasswordsMu.Lock()
+	defer htpasswordsMu.Unlock()
 	if htpasswords == nil {
 		htpasswords = make(map[string]map[string]PasswordMatcher)
 	}
@@ -109,39 +154,151 @@ func GetHtpasswdMatcher(filename, username, siteRoot string) (PasswordMatcher, e
 		}
 		htpasswords[filename] = pm
 	}
-	htpasswordsMu.Unlock()
 	if pm[username] == nil {
 		return nil, fmt.Errorf("username %q not found in %q", username, filename)
 	}
 	return pm[username], nil
 }
 
+// HtpasswdFile authenticates the users listed in an htpasswd
+// file. The file is read again when it changes on disk.
+type HtpasswdFile struct {
+	Filename string
+
+	mu      sync.RWMutex
+	users   map[string]PasswordMatcher
+	decoy   PasswordMatcher
+	modTime time.Time
+	size    int64
+}
+
+// NewHtpasswdFile loads the htpasswd file filename. It returns
+// an error if the file can't be read or has an entry whose hash
+// format is not supported.
+func NewHtpasswdFile(filename string) (*HtpasswdFile, error) {
+	h := &HtpasswdFile{Filename: filename}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.load(info); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Match reports whether password is the password of username.
+// Unknown users are checked against a password of the file
+// anyway, so they take about as long to reject as known ones.
+func (h *HtpasswdFile) Match(username, password string) bool {
+	h.reloadIfChanged()
+
+	h.mu.RLock()
+	matcher, ok := h.users[username]
+	decoy := h.decoy
+	h.mu.RUnlock()
+
+	if !ok {
+		if decoy != nil {
+			decoy(password)
+		}
+		return false
+	}
+	return matcher(password)
+}
+
+// reloadIfChanged reads the file again if its modification
+// time or size changed. If that fails, the users it had
+// before are kept.
+func (h *HtpasswdFile) reloadIfChanged() {
+	info, err := os.Stat(h.Filename)
+	if err != nil {
+		return
+	}
+	h.mu.RLock()
+	changed := !info.ModTime().Equal(h.modTime) || info.Size() != h.size
+	h.mu.RUnlock()
+	if !changed {
+		return
+	}
+	if err := h.load(info); err != nil {
+		log.Printf("[ERROR] basicauth: reloading %s: %v", h.Filename, err)
+	}
+}
+
+// load reads the file, which info describes, and replaces the users.
+func (h *HtpasswdFile) load(info os.FileInfo) error {
+	users := make(map[string]PasswordMatcher)
+	fh, err := os.Open(h.Filename)
+	if err == nil {
+		err = parseHtpasswd(users, fh)
+		fh.Close()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// remember this version even if it is broken,
+	// so it isn't parsed again on every request
+	h.modTime, h.size = info.ModTime(), info.Size()
+	if err != nil {
+		return fmt.Errorf("parsing htpasswd %q: %v", h.Filename, err)
+	}
+	h.users = users
+	h.decoy = nil
+	for _, matcher := range users {
+		h.decoy = matcher
+		break
+	}
+	return nil
+}
+
 func parseHtpasswd(pm map[string]PasswordMatcher, r io.Reader) error {
 	scanner := bufio.NewScanner(r)
+	var lineNum int
 	for scanner.Scan() {
+		lineNum++
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.IndexByte(line, '#') == 0 {
 			continue
 		}
 		i := strings.IndexByte(line, ':')
 		if i <= 0 {
-			return fmt.Errorf("malformed line, no color: %q", line)
+			return fmt.Errorf("line %d: malformed line, no colon", lineNum)
 		}
 		user, encoded := line[:i], line[i+1:]
+		var matcher basic.EncodedPasswd
 		for _, p := range basic.DefaultSystems {
-			matcher, err := p(encoded)
+			var err error
+			matcher, err = p(encoded)
 			if err != nil {
-				return err
+				return fmt.Errorf("line %d: %v", lineNum, err)
 			}
 			if matcher != nil {
-				pm[user] = matcher.MatchesPassword
 				break
 			}
 		}
+		if matcher == nil {
+			return fmt.Errorf("line %d: unsupported password hash format for user %q", lineNum, user)
+		}
+		pm[user] = matcher.MatchesPassword
 	}
 	return scanner.Err()
 }
 
+// BcryptMatcher returns a PasswordMatcher that checks passwords
+// against the bcrypt hash. The comparison is constant-time, but
+// takes about 2^cost rounds of hashing for every request that
+// is checked, with cost being the one the hash was made with;
+// the default cost of 10 takes well under 100ms on most machines.
+func BcryptMatcher(hash string) (PasswordMatcher, error) {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, err
+	}
+	return func(pw string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
+	}, nil
+}
+
 // PlainMatcher returns a PasswordMatcher that does a constant-time
 // byte comparison against the password passw.
 func PlainMatcher(passw string) PasswordMatcher {
@@ -8,7 +8,9 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -79,7 +81,7 @@ func TestMultipleOverlappingRules(t *testing.T) {
 		cred   string
 	}{
 		{"/t", http.StatusOK, "t:p1"},
-		{"/t/t", http.StatusOK, "t:p1"},
+		{"/t/t", http.StatusUnauthorized, "t:p1"},
 		{"/t/t", http.StatusOK, "t1:p2"},
 		{"/a", http.StatusOK, "t1:p2"},
 		{"/t/t", http.StatusUnauthorized, "t1:p3"},
@@ -109,6 +111,56 @@ func TestMultipleOverlappingRules(t *testing.T) {
 
 }
 
+func TestRealmScopes(t *testing.T) {
+	rw := BasicAuth{
+		Next: httpserver.HandlerFunc(contentHandler),
+		Rules: []Rule{
+			{Username: "site", Password: PlainMatcher("p1"), Resources: []string{"/"}},
+			{Username: "admin", Password: PlainMatcher("p2"), Resources: []string{"/admin"}, Realm: "Admin Area"},
+			{Username: "root", Password: PlainMatcher("p3"), Resources: []string{"/admin"}},
+			{Username: "ops", Password: PlainMatcher("p4"), Resources: []string{"/admin/ops"}, Realm: `Ops "Team"`},
+		},
+	}
+
+	tests := []struct {
+		from        string
+		cred        string
+		expectCode  int
+		expectRealm string
+	}{
+		{"/index.html", "site:p1", http.StatusOK, ""},
+		{"/index.html", "admin:p2", http.StatusUnauthorized, `Basic realm="Restricted"`},
+		{"/admin/users", "admin:p2", http.StatusOK, ""},
+		{"/admin/users", "root:p3", http.StatusOK, ""},
+		{"/admin/users", "site:p1", http.StatusUnauthorized, `Basic realm="Admin Area"`},
+		{"/admin/ops/deploy", "ops:p4", http.StatusOK, ""},
+		{"/admin/ops/deploy", "admin:p2", http.StatusUnauthorized, `Basic realm="Ops \"Team\""`},
+		{"/admin/ops/deploy", "", http.StatusUnauthorized, `Basic realm="Ops \"Team\""`},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.from, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request %v", i, err)
+		}
+		if test.cred != "" {
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(test.cred)))
+		}
+
+		rec := httptest.NewRecorder()
+		result, err := rw.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatalf("Test %d: Could not ServeHTTP %v", i, err)
+		}
+		if result != test.expectCode {
+			t.Errorf("Test %d: Expected status %d but was %d", i, test.expectCode, result)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != test.expectRealm {
+			t.Errorf("Test %d: Expected WWW-Authenticate '%s' but was '%s'", i, test.expectRealm, got)
+		}
+	}
+}
+
 func contentHandler(w http.ResponseWriter, r *http.Request) (int, error) {
 	fmt.Fprintf(w, r.URL.String())
 	return http.StatusOK, nil
@@ -144,3 +196,112 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		}
 	}
 }
+
+func TestBcryptMatcher(t *testing.T) {
+	matcher, err := BcryptMatcher("$2a$04$dLPyPfemhw3SgHXlYJOe2.e8TqfsF4rcpoiZMuxy6psl.KOhY2aeS")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !matcher("pwd") {
+		t.Error("Expected password to match")
+	}
+	for _, pw := range []string{"", "pwd!", "PWD"} {
+		if matcher(pw) {
+			t.Errorf("Expected password '%s' not to match", pw)
+		}
+	}
+
+	if _, err := BcryptMatcher("pwd"); err == nil {
+		t.Error("Expected an error for a password that is not a bcrypt hash")
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	htpasswdPasswd := "IedFOuGmTpT8"
+	htpasswdFile := `# users
+sha1:{SHA}dcAUljwz99qFjYR0YLTXx0RqLww=`
+
+	htfh, err := ioutil.TempFile("", "basicauth-")
+	if err != nil {
+		t.Skipf("Error creating temp file (%v), will skip htpassword test", err)
+		return
+	}
+	defer os.Remove(htfh.Name())
+	if _, err = htfh.Write([]byte(htpasswdFile)); err != nil {
+		t.Fatalf("write htpasswd file %q: %v", htfh.Name(), err)
+	}
+	htfh.Close()
+
+	users, err := NewHtpasswdFile(htfh.Name())
+	if err != nil {
+		t.Fatalf("NewHtpasswdFile(%q): %v", htfh.Name(), err)
+	}
+	rw := BasicAuth{
+		Next:  httpserver.HandlerFunc(contentHandler),
+		Rules: []Rule{{Users: users, Resources: []string{"/testing"}}},
+	}
+	check := func(i int, cred string, expected int) {
+		req, err := http.NewRequest("GET", "/testing", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request %v", i, err)
+		}
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(cred)))
+		result, err := rw.ServeHTTP(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("Test %d: Could not ServeHTTP %v", i, err)
+		}
+		if result != expected {
+			t.Errorf("Test %d: Expected status %d but was %d", i, expected, result)
+		}
+	}
+
+	check(0, "sha1:"+htpasswdPasswd, http.StatusOK)
+	check(1, "sha1:"+htpasswdPasswd+"!", http.StatusUnauthorized)
+	check(2, "other:"+htpasswdPasswd, http.StatusUnauthorized)
+
+	// the file is read again once it changes
+	renamed := strings.Replace(htpasswdFile, "sha1:", "other:", 1)
+	if err = ioutil.WriteFile(htfh.Name(), []byte(renamed), 0600); err != nil {
+		t.Fatalf("rewrite htpasswd file %q: %v", htfh.Name(), err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(htfh.Name(), later, later); err != nil {
+		t.Fatal(err)
+	}
+	check(3, "sha1:"+htpasswdPasswd, http.StatusUnauthorized)
+	check(4, "other:"+htpasswdPasswd, http.StatusOK)
+
+	// a broken file keeps the users loaded before
+	if err = ioutil.WriteFile(htfh.Name(), []byte("broken"), 0600); err != nil {
+		t.Fatalf("rewrite htpasswd file %q: %v", htfh.Name(), err)
+	}
+	check(5, "other:"+htpasswdPasswd, http.StatusOK)
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectUsers int
+		expectErr   string
+	}{
+		{"sha1:{SHA}dcAUljwz99qFjYR0YLTXx0RqLww=\n\n# comment\n", 1, ""},
+		{"sha1:{SHA}dcAUljwz99qFjYR0YLTXx0RqLww=\nnocolon\n", 0, "line 2: malformed line, no colon"},
+		{"# users\nodd:$9$notahash\n", 0, `line 2: unsupported password hash format for user "odd"`},
+	}
+	for i, test := range tests {
+		pm := make(map[string]PasswordMatcher)
+		err := parseHtpasswd(pm, strings.NewReader(test.input))
+		if test.expectErr != "" {
+			if err == nil || err.Error() != test.expectErr {
+				t.Errorf("Test %d: Expected error '%s', got %v", i, test.expectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if len(pm) != test.expectUsers {
+			t.Errorf("Test %d: Expected %d users, got %d", i, test.expectUsers, len(pm))
+		}
+	}
+}
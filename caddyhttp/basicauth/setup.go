@@ -1,6 +1,8 @@
 package basicauth
 
 import (
+	"log"
+	"path/filepath"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -46,6 +48,35 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 		args := c.RemainingArgs()
 
 		switch len(args) {
+		case 1:
+			rule.Resources = append(rule.Resources, args[0])
+			for c.NextBlock() {
+				switch c.Val() {
+				case "htpasswd":
+					if !c.NextArg() {
+						return rules, c.ArgErr()
+					}
+					filename := c.Val()
+					if !filepath.IsAbs(filename) {
+						filename = filepath.Join(cfg.Root, filename)
+					}
+					if rule.Users, err = NewHtpasswdFile(filename); err != nil {
+						return rules, c.Errf("%v", err)
+					}
+					if c.NextArg() {
+						return rules, c.ArgErr()
+					}
+				case "realm":
+					if err = parseRealm(c, &rule); err != nil {
+						return rules, err
+					}
+				default:
+					return rules, c.Errf("Unknown basicauth subdirective '%s'", c.Val())
+				}
+			}
+			if rule.Users == nil {
+				return rules, c.Errf("No htpasswd file given for %s", args[0])
+			}
 		case 2:
 			rule.Username = args[0]
 			if rule.Password, err = passwordMatcher(rule.Username, args[1], cfg.Root); err != nil {
@@ -53,6 +84,12 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 			}
 
 			for c.NextBlock() {
+				if c.Val() == "realm" {
+					if err = parseRealm(c, &rule); err != nil {
+						return rules, err
+					}
+					continue
+				}
 				rule.Resources = append(rule.Resources, c.Val())
 				if c.NextArg() {
 					return rules, c.Errf("Expecting only one resource per line (extra '%s')", c.Val())
@@ -64,6 +101,15 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 			if rule.Password, err = passwordMatcher(rule.Username, args[2], cfg.Root); err != nil {
 				return rules, c.Errf("Get password matcher from %s: %v", c.Val(), err)
 			}
+
+			for c.NextBlock() {
+				if c.Val() != "realm" {
+					return rules, c.Errf("Unknown basicauth subdirective '%s'", c.Val())
+				}
+				if err = parseRealm(c, &rule); err != nil {
+					return rules, err
+				}
+			}
 		default:
 			return rules, c.ArgErr()
 		}
@@ -74,9 +120,29 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 	return rules, nil
 }
 
+// parseRealm parses the argument of a realm line into rule.
+func parseRealm(c *caddy.Controller, rule *Rule) error {
+	if !c.NextArg() {
+		return c.ArgErr()
+	}
+	rule.Realm = c.Val()
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+	return nil
+}
+
+// bcryptPrefix marks a password given as a bcrypt hash.
+const bcryptPrefix = "{bcrypt}"
+
 func passwordMatcher(username, passw, siteRoot string) (PasswordMatcher, error) {
-	if !strings.HasPrefix(passw, "htpasswd=") {
-		return PlainMatcher(passw), nil
+	switch {
+	case strings.HasPrefix(passw, "htpasswd="):
+		return GetHtpasswdMatcher(passw[9:], username, siteRoot)
+	case strings.HasPrefix(passw, bcryptPrefix):
+		return BcryptMatcher(passw[len(bcryptPrefix):])
 	}
-	return GetHtpasswdMatcher(passw[9:], username, siteRoot)
+	log.Printf("[WARNING] basicauth: Password of user %s is in plain text; "+
+		"consider giving a bcrypt hash as %s<hash> instead", username, bcryptPrefix)
+	return PlainMatcher(passw), nil
 }
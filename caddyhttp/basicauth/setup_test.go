@@ -85,6 +85,27 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		{`basicauth sha1 htpasswd=` + htfh.Name(), false, htpasswdPasswd, []Rule{
 			{Username: "sha1"},
 		}},
+		{`basicauth /resource user {bcrypt}$2a$04$dLPyPfemhw3SgHXlYJOe2.e8TqfsF4rcpoiZMuxy6psl.KOhY2aeS`, false, "pwd", []Rule{
+			{Username: "user", Resources: []string{"/resource"}},
+		}},
+		{`basicauth user {bcrypt}notahash`, true, "", []Rule{}},
+		{`basicauth user pwd {
+			realm "Admin Area"
+			/admin
+		}`, false, "pwd", []Rule{
+			{Username: "user", Resources: []string{"/admin"}, Realm: "Admin Area"},
+		}},
+		{`basicauth /admin user pwd {
+			realm Admin
+		}`, false, "pwd", []Rule{
+			{Username: "user", Resources: []string{"/admin"}, Realm: "Admin"},
+		}},
+		{`basicauth /admin user pwd {
+			realm
+		}`, true, "", []Rule{}},
+		{`basicauth /admin user pwd {
+			/other
+		}`, true, "", []Rule{}},
 	}
 
 	for i, test := range tests {
@@ -109,6 +130,11 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 					i, j, expectedRule.Username, actualRule.Username)
 			}
 
+			if actualRule.Realm != expectedRule.Realm {
+				t.Errorf("Test %d, rule %d: Expected realm '%s', got '%s'",
+					i, j, expectedRule.Realm, actualRule.Realm)
+			}
+
 			if strings.Contains(test.input, "htpasswd=") && skipHtpassword {
 				continue
 			}
@@ -130,3 +156,59 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		}
 	}
 }
+
+func TestBasicAuthParseHtpasswdFile(t *testing.T) {
+	htfh, err := ioutil.TempFile("", "basicauth-")
+	if err != nil {
+		t.Skipf("Error creating temp file (%v), will skip htpassword test", err)
+		return
+	}
+	defer os.Remove(htfh.Name())
+	if _, err = htfh.Write([]byte("sha1:{SHA}dcAUljwz99qFjYR0YLTXx0RqLww=")); err != nil {
+		t.Fatalf("write htpasswd file %q: %v", htfh.Name(), err)
+	}
+	htfh.Close()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`basicauth /admin {
+			htpasswd ` + htfh.Name() + `
+		}`, false},
+		{`basicauth /admin`, true},
+		{`basicauth /admin {
+			htpasswd
+		}`, true},
+		{`basicauth /admin {
+			htpasswd ` + htfh.Name() + ` extra
+		}`, true},
+		{`basicauth /admin {
+			htpasswd /does/not/exist
+		}`, true},
+		{`basicauth /admin {
+			password secret
+		}`, true},
+	}
+	for i, test := range tests {
+		rules, err := basicAuthParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if len(rules) != 1 || rules[0].Users == nil {
+			t.Fatalf("Test %d: Expected one rule with an htpasswd file, got %+v", i, rules)
+		}
+		if rules[0].Users.Filename != htfh.Name() {
+			t.Errorf("Test %d: Expected htpasswd file %s, got %s", i, htfh.Name(), rules[0].Users.Filename)
+		}
+		if fmt.Sprint(rules[0].Resources) != "[/admin]" {
+			t.Errorf("Test %d: Expected resources [/admin], got %v", i, rules[0].Resources)
+		}
+	}
+}
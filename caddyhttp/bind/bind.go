@@ -15,9 +15,12 @@ func init() {
 func setupBind(c *caddy.Controller) error {
 	config := httpserver.GetConfig(c)
 	for c.Next() {
-		if !c.Args(&config.ListenHost) {
+		hosts := c.RemainingArgs()
+		if len(hosts) == 0 {
 			return c.ArgErr()
 		}
+		config.ListenHost = hosts[0]
+		config.ListenHosts = hosts
 		config.TLS.ListenHost = config.ListenHost // necessary for ACME challenges, see issue #309
 	}
 	return nil
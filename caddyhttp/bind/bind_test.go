@@ -1,6 +1,7 @@
 package bind
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -22,3 +23,27 @@ func TestSetupBind(t *testing.T) {
 		t.Errorf("Expected the TLS config's ListenHost to be %s, was %s", want, got)
 	}
 }
+
+func TestSetupBindMultiple(t *testing.T) {
+	c := caddy.NewTestController("http", `bind 10.0.0.5 192.168.1.10`)
+	err := setupBind(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	cfg := httpserver.GetConfig(c)
+	if got, want := cfg.ListenHost, "10.0.0.5"; got != want {
+		t.Errorf("Expected the config's ListenHost to be %s, was %s", want, got)
+	}
+	if got, want := cfg.ListenHosts, []string{"10.0.0.5", "192.168.1.10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the config's ListenHosts to be %v, was %v", want, got)
+	}
+	if got, want := cfg.TLS.ListenHost, "10.0.0.5"; got != want {
+		t.Errorf("Expected the TLS config's ListenHost to be %s, was %s", want, got)
+	}
+
+	c = caddy.NewTestController("http", `bind`)
+	if err := setupBind(c); err == nil {
+		t.Error("Expected an error without an address, got none")
+	}
+}
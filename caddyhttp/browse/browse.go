@@ -26,6 +26,7 @@ type Browse struct {
 	Next          httpserver.Handler
 	Configs       []Config
 	IgnoreIndexes bool
+	IndexPages    []string // staticfiles.IndexPages if empty
 }
 
 // Config is a configuration for browsing in a particular path.
@@ -33,10 +34,13 @@ type Config struct {
 	PathScope string
 	Root      http.FileSystem
 	Variables interface{}
-	Template  *template.Template
+	Template  *template.Template // executed with a *Listing
 }
 
-// A Listing is the context used to fill out a template.
+// A Listing is the context used to fill out a template. Custom
+// templates can use all of its exported fields and methods, as
+// well as those of the FileInfo values in Items and the embedded
+// httpserver.Context.
 type Listing struct {
 	// The name of the directory (the last element of the path)
 	Name string
@@ -65,6 +69,14 @@ type Listing struct {
 	// If ≠0 then Items have been limited to that many elements
 	ItemsLimitedTo int
 
+	// The number of items of the sorted listing skipped before Items
+	Offset int
+
+	// Query strings linking to the previous and next pages of the
+	// listing with the same sorting, or empty if there is no such page
+	PrevPage string
+	NextPage string
+
 	// Optional custom variables for use in browse templates
 	User interface{}
 
@@ -101,12 +113,12 @@ func (l Listing) BreadcrumbMap() map[string]string {
 
 // FileInfo is the info about a particular file or directory
 type FileInfo struct {
-	IsDir   bool
-	Name    string
-	Size    int64
-	URL     string
-	ModTime time.Time
-	Mode    os.FileMode
+	IsDir   bool        `json:"is_dir"`
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	URL     string      `json:"url"`
+	ModTime time.Time   `json:"mod_time"`
+	Mode    os.FileMode `json:"mode"`
 }
 
 // HumanSize returns the size of the file as a human-readable string
@@ -186,7 +198,48 @@ func (l Listing) applySort() {
 	}
 }
 
-func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string) (Listing, bool) {
+// pageLink returns the query string of the page of l that starts
+// at offset and has at most limit items, keeping the sort order.
+func (l Listing) pageLink(offset, limit int) string {
+	query := url.Values{}
+	query.Set("sort", l.Sort)
+	query.Set("order", l.Order)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return "?" + query.Encode()
+}
+
+// paginate reduces the items of l to the page that starts at
+// offset and has at most limit items (if limit > 0), and sets
+// the links to the previous and next pages.
+func (l *Listing) paginate(offset, limit int) {
+	total := len(l.Items)
+	if offset > total {
+		offset = total
+	}
+	if offset > 0 {
+		l.Items = l.Items[offset:]
+		l.Offset = offset
+		prev := offset - limit
+		if limit <= 0 || prev < 0 {
+			prev = 0
+		}
+		l.PrevPage = l.pageLink(prev, limit)
+	}
+	if limit > 0 && limit <= len(l.Items) {
+		l.Items = l.Items[:limit]
+		l.ItemsLimitedTo = limit
+		if offset+limit < total {
+			l.NextPage = l.pageLink(offset+limit, limit)
+		}
+	}
+}
+
+func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, indexPages []string) (Listing, bool) {
 	var (
 		fileinfos           []FileInfo
 		dirCount, fileCount int
@@ -196,7 +249,7 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string) (Listin
 	for _, f := range files {
 		name := f.Name()
 
-		for _, indexName := range staticfiles.IndexPages {
+		for _, indexName := range indexPages {
 			if name == indexName {
 				hasIndexFile = true
 				break
@@ -246,6 +299,13 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	return b.Next.ServeHTTP(w, r)
 inScope:
 
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		scoped := *bc
+		scoped.Root = http.Dir(root)
+		bc = &scoped
+	}
+
 	// Browse works on existing directories; delegate everything else
 	requestedFilepath, err := bc.Root.Open(r.URL.Path)
 	if err != nil {
@@ -312,17 +372,22 @@ func (b Browse) loadDirectoryContents(requestedFilepath http.File, urlPath strin
 	}
 
 	// Assemble listing of directory contents
-	listing, hasIndex := directoryListing(files, canGoUp, urlPath)
+	indexPages := b.IndexPages
+	if len(indexPages) == 0 {
+		indexPages = staticfiles.IndexPages
+	}
+	listing, hasIndex := directoryListing(files, canGoUp, urlPath, indexPages)
 
 	return &listing, hasIndex, nil
 }
 
 // handleSortOrder gets and stores for a Listing the 'sort' and 'order',
-// and reads 'limit' if given. The latter is 0 if not given.
+// and reads 'limit' and 'offset' if given. These are 0 if not given.
 //
 // This sets Cookies.
-func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope string) (sort string, order string, limit int, err error) {
+func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope string) (sort string, order string, limit int, offset int, err error) {
 	sort, order, limitQuery := r.URL.Query().Get("sort"), r.URL.Query().Get("order"), r.URL.Query().Get("limit")
+	offsetQuery := r.URL.Query().Get("offset")
 
 	// If the query 'sort' or 'order' is empty, use defaults or any values previously saved in Cookies
 	switch sort {
@@ -331,7 +396,7 @@ func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope st
 		if sortCookie, sortErr := r.Cookie("sort"); sortErr == nil {
 			sort = sortCookie.Value
 		}
-	case "name", "size", "type":
+	case "name", "size", "time":
 		http.SetCookie(w, &http.Cookie{Name: "sort", Value: sort, Path: scope, Secure: r.TLS != nil})
 	}
 
@@ -352,6 +417,16 @@ func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope st
 		}
 	}
 
+	if offsetQuery != "" {
+		offset, err = strconv.Atoi(offsetQuery)
+		if err != nil {
+			return
+		}
+		if offset < 0 {
+			offset = 0
+		}
+	}
+
 	return
 }
 
@@ -379,29 +454,26 @@ func (b Browse) ServeListing(w http.ResponseWriter, r *http.Request, requestedFi
 	listing.User = bc.Variables
 
 	// Copy the query values into the Listing struct
-	var limit int
-	listing.Sort, listing.Order, limit, err = b.handleSortOrder(w, r, bc.PathScope)
+	var limit, offset int
+	listing.Sort, listing.Order, limit, offset, err = b.handleSortOrder(w, r, bc.PathScope)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 
 	listing.applySort()
-
-	if limit > 0 && limit <= len(listing.Items) {
-		listing.Items = listing.Items[:limit]
-		listing.ItemsLimitedTo = limit
-	}
+	listing.paginate(offset, limit)
 
 	var buf *bytes.Buffer
-	acceptHeader := strings.ToLower(strings.Join(r.Header["Accept"], ","))
+	_, jsonQuery := r.URL.Query()["json"]
+	w.Header().Add("Vary", "Accept")
 	switch {
-	case strings.Contains(acceptHeader, "application/json"):
+	case jsonQuery || httpserver.PrefersJSON(r):
 		if buf, err = b.formatAsJSON(listing, bc); err != nil {
 			return http.StatusInternalServerError, err
 		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	default: // There's no 'application/json' in the 'Accept' header; browse normally
+	default: // The client doesn't prefer JSON; browse normally
 		if buf, err = b.formatAsHTML(listing, bc); err != nil {
 			return http.StatusInternalServerError, err
 		}
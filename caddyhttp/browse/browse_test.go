@@ -1,6 +1,7 @@
 package browse
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -131,6 +132,35 @@ func TestBrowseHTTPMethods(t *testing.T) {
 	}
 }
 
+func TestBrowseRequestRoot(t *testing.T) {
+	tmpl, err := template.ParseFiles("testdata/photos.tpl")
+	if err != nil {
+		t.Fatalf("An error occured while parsing the template: %v", err)
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/photos",
+				Root:      http.Dir("./{host}"),
+				Template:  tmpl,
+			},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/photos/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), httpserver.RootCtxKey, "./testdata"))
+	if code, _ := b.ServeHTTP(httptest.NewRecorder(), req); code != http.StatusOK {
+		t.Errorf("Expected the directory in the root of the request to be listed with %d, got %d", http.StatusOK, code)
+	}
+	if b.Configs[0].Root != http.Dir("./{host}") {
+		t.Errorf("Expected the configured root to be kept, got '%s'", b.Configs[0].Root)
+	}
+}
+
 func TestBrowseTemplate(t *testing.T) {
 	tmpl, err := template.ParseFiles("testdata/photos.tpl")
 	if err != nil {
@@ -343,6 +373,130 @@ func TestBrowseJson(t *testing.T) {
 	}
 }
 
+func TestBrowseJSONNegotiation(t *testing.T) {
+	tmpl, err := template.New("test").Parse("HTML listing")
+	if err != nil {
+		t.Fatalf("An error occured while parsing the template: %v", err)
+	}
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			t.Fatalf("Next shouldn't be called")
+			return 0, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/photos/",
+				Root:      http.Dir("./testdata"),
+				Template:  tmpl,
+			},
+		},
+	}
+
+	const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	tests := []struct {
+		url          string
+		accept       string
+		expectedJSON bool
+	}{
+		{"/photos/", browserAccept, false},
+		{"/photos/", "", false},
+		{"/photos/?json", browserAccept, true},
+		{"/photos/", "application/json", true},
+		{"/photos/", "text/html, application/json;q=0.5", false},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create request: %v", i, err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+
+		code, err := b.ServeHTTP(rec, req)
+		if code != http.StatusOK || err != nil {
+			t.Fatalf("Test %d: Expected status %d and no error, got %d and %v", i, http.StatusOK, code, err)
+		}
+		if rec.HeaderMap.Get("Vary") != "Accept" {
+			t.Errorf("Test %d: Expected Vary: Accept, got '%s'", i, rec.HeaderMap.Get("Vary"))
+		}
+		if !test.expectedJSON {
+			if body := rec.Body.String(); body != "HTML listing" {
+				t.Errorf("Test %d: Expected HTML listing, got '%s'", i, body)
+			}
+			continue
+		}
+
+		var items []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("Test %d: Expected a JSON listing, got error: %v", i, err)
+		}
+		if len(items) == 0 {
+			t.Fatalf("Test %d: Expected items in the JSON listing", i)
+		}
+		for _, field := range []string{"name", "size", "url", "mod_time", "is_dir"} {
+			if _, ok := items[0][field]; !ok {
+				t.Errorf("Test %d: Expected field '%s' in JSON item, got %v", i, field, items[0])
+			}
+		}
+	}
+}
+
+func TestBrowsePagination(t *testing.T) {
+	tmpl, err := template.New("test").Parse("{{.PrevPage}}|{{.NextPage}}|{{range .Items}}{{.Name}},{{end}}")
+	if err != nil {
+		t.Fatalf("An error occured while parsing the template: %v", err)
+	}
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			t.Fatalf("Next shouldn't be called")
+			return 0, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/photos/",
+				Root:      http.Dir("./testdata"),
+				Template:  tmpl,
+			},
+		},
+	}
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"", http.StatusOK, "||test.html,test2.html,test3.html,"},
+		{"?limit=1", http.StatusOK, "|?limit=1&offset=1&order=asc&sort=name|test.html,"},
+		{"?limit=1&offset=1", http.StatusOK, "?limit=1&order=asc&sort=name|?limit=1&offset=2&order=asc&sort=name|test2.html,"},
+		{"?limit=2&offset=2", http.StatusOK, "?limit=2&order=asc&sort=name||test3.html,"},
+		{"?order=desc&limit=2&offset=1", http.StatusOK, "?limit=2&order=desc&sort=name||test2.html,test.html,"},
+		{"?offset=2", http.StatusOK, "?order=asc&sort=name||test3.html,"},
+		{"?offset=10", http.StatusOK, "?order=asc&sort=name||"},
+		{"?offset=-1", http.StatusOK, "||test.html,test2.html,test3.html,"},
+		{"?offset=two", http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "/photos/"+test.query, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create request: %v", i, err)
+		}
+		rec := httptest.NewRecorder()
+
+		code, _ := b.ServeHTTP(rec, req)
+		if code != test.expectedStatus {
+			t.Fatalf("Test %d: Expected status %d, got %d", i, test.expectedStatus, code)
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectedBody, body)
+		}
+	}
+}
+
 // "sort" package has "IsSorted" function, but no "IsReversed";
 func isReversed(data sort.Interface) bool {
 	n := data.Len()
@@ -353,3 +507,46 @@ func isReversed(data sort.Interface) bool {
 	}
 	return true
 }
+
+func TestBrowseIndexPages(t *testing.T) {
+	tmpl, err := template.New("test").Parse("listing")
+	if err != nil {
+		t.Fatalf("An error occured while parsing the template: %v", err)
+	}
+	var nextCalled bool
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			nextCalled = true
+			return 0, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/photos/",
+				Root:      http.Dir("./testdata"),
+				Template:  tmpl,
+			},
+		},
+	}
+
+	for i, test := range []struct {
+		indexPages []string
+		expectNext bool
+	}{
+		{nil, false},
+		{[]string{"test2.html"}, true}, // the directory has an index, so it isn't browsable
+		{[]string{"home.html"}, false},
+	} {
+		nextCalled = false
+		b.IndexPages = test.indexPages
+		req, err := http.NewRequest("GET", "/photos/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create request: %v", i, err)
+		}
+		if _, err := b.ServeHTTP(httptest.NewRecorder(), req); err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if nextCalled != test.expectNext {
+			t.Errorf("Test %d: Expected next handler to be called: %v, but it was: %v", i, test.expectNext, nextCalled)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"text/template"
 
 	"github.com/mholt/caddy"
@@ -29,8 +30,10 @@ func setup(c *caddy.Controller) error {
 		IgnoreIndexes: false,
 	}
 
-	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		b.Next = next
+		b.IndexPages = cfg.IndexPages
 		return b
 	})
 
@@ -62,32 +65,38 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 			bc.PathScope = "/"
 		}
 		bc.Root = http.Dir(cfg.Root)
-		theRoot, err := bc.Root.Open("/") // catch a missing path early
-		if err != nil {
-			return configs, err
-		}
-		defer theRoot.Close()
-		_, err = theRoot.Readdir(-1)
-		if err != nil {
-			return configs, err
+		// a root with placeholders is only known per request
+		if !strings.Contains(cfg.Root, "{") {
+			theRoot, err := bc.Root.Open("/") // catch a missing path early
+			if err != nil {
+				return configs, err
+			}
+			defer theRoot.Close()
+			_, err = theRoot.Readdir(-1)
+			if err != nil {
+				return configs, err
+			}
 		}
 
 		// Second argument would be the template file to use
-		var tplText string
+		tplFile := "default template"
+		tplText := defaultTemplate
 		if c.NextArg() {
-			tplBytes, err := ioutil.ReadFile(c.Val())
+			tplFile = c.Val()
+			tplBytes, err := ioutil.ReadFile(tplFile)
 			if err != nil {
-				return configs, err
+				return configs, c.Errf("loading browse template: %v", err)
 			}
 			tplText = string(tplBytes)
-		} else {
-			tplText = defaultTemplate
+		}
+		if c.NextArg() {
+			return configs, c.ArgErr()
 		}
 
-		// Build the template
+		// Build the template; it is executed with a Listing
 		tpl, err := template.New("listing").Parse(tplText)
 		if err != nil {
-			return configs, err
+			return configs, c.Errf("parsing browse template %s: %v", tplFile, err)
 		}
 		bc.Template = tpl
 
@@ -238,6 +247,16 @@ td .goup {
 	white-space: pre-wrap;
 }
 
+.pagination {
+	padding: 15px 0;
+	font-size: 14px;
+	text-align: center;
+}
+
+.pagination a {
+	margin: 0 1em;
+}
+
 footer {
 	padding: 40px 20px;
 	font-size: 12px;
@@ -402,6 +421,16 @@ footer {
 					</tbody>
 				</table>
 			</div>
+			{{- if or .PrevPage .NextPage}}
+			<div class="pagination">
+				{{- if .PrevPage}}
+				<a href="{{.PrevPage}}">&larr; Previous</a>
+				{{- end}}
+				{{- if .NextPage}}
+				<a href="{{.NextPage}}">Next &rarr;</a>
+				{{- end}}
+			</div>
+			{{- end}}
 		</main>
 		<footer>
 			Served with <a rel="noopener noreferrer" href="https://caddyserver.com">Caddy</a>.
@@ -28,6 +28,16 @@ func TestSetup(t *testing.T) {
 
 	tempTemplatePath := filepath.Join(".", tempTemplate.Name())
 
+	brokenTemplate, err := ioutil.TempFile(".", "brokenTemplate")
+	if err != nil {
+		t.Fatalf("BeforeTest: Failed to create a temporary file in the working directory! Error was: %v", err)
+	}
+	defer os.Remove(brokenTemplate.Name())
+	brokenTemplate.WriteString("{{range .Items}}")
+	brokenTemplate.Close()
+
+	brokenTemplatePath := filepath.Join(".", brokenTemplate.Name())
+
 	for i, test := range []struct {
 		input             string
 		expectedPathScope []string
@@ -47,6 +57,12 @@ func TestSetup(t *testing.T) {
 
 		// test case #4 tests detection of duplicate pathscopes
 		{"browse " + tempDirPath + "\n browse " + tempDirPath, nil, true},
+
+		// test case #5 tests detection of a template that doesn't parse
+		{"browse . " + brokenTemplatePath, nil, true},
+
+		// test case #6 tests detection of extra arguments
+		{"browse . " + tempTemplatePath + " extra", nil, true},
 	} {
 
 		c := caddy.NewTestController("http", test.input)
@@ -54,6 +70,9 @@ func TestSetup(t *testing.T) {
 		if err != nil && !test.shouldErr {
 			t.Errorf("Test case #%d recieved an error of %v", i, err)
 		}
+		if err == nil && test.shouldErr {
+			t.Errorf("Test case #%d expected an error, but got none", i)
+		}
 		if test.expectedPathScope == nil {
 			continue
 		}
@@ -66,4 +85,10 @@ func TestSetup(t *testing.T) {
 			}
 		}
 	}
+	// a root with placeholders is only known per request
+	c := caddy.NewTestController("http", "browse /")
+	httpserver.GetConfig(c).Root = filepath.Join(nonExistantDirPath, "{host}")
+	if err := setup(c); err != nil {
+		t.Errorf("Expected no error for a root with placeholders, got: %v", err)
+	}
 }
@@ -0,0 +1,384 @@
+// Package cache implements the cache directive, which keeps
+// cacheable responses to GET requests in memory for a while.
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+const (
+	// DefaultMaxEntries is the default maximum number of
+	// responses a rule keeps.
+	DefaultMaxEntries = 1024
+
+	// DefaultMaxBytes is the default maximum size of the
+	// response bodies a rule keeps.
+	DefaultMaxBytes = 64 << 20
+)
+
+// Cache is middleware that serves responses to GET requests from
+// memory while they are fresh, so they don't have to be generated
+// again by the next handlers.
+type Cache struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// Rule caches the responses to requests to paths under Path. If
+// TTL is greater than 0, responses are fresh for TTL, otherwise for
+// as long as their Cache-Control or Expires headers say. When there
+// are more than MaxEntries responses or more than MaxBytes of bodies,
+// the least recently used responses are evicted.
+type Rule struct {
+	Path       string
+	TTL        time.Duration
+	MaxEntries int
+	MaxBytes   int64
+
+	store *store
+}
+
+// BasePath satisfies httpserver.HandlerConfig.
+func (rule Rule) BasePath() string { return rule.Path }
+
+// Match satisfies httpserver.RequestMatcher.
+func (rule Rule) Match(r *http.Request) bool {
+	return httpserver.Path(r.URL.Path).Matches(rule.Path)
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (c Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rule, ok := httpserver.ConfigSelector(c.Rules).Select(r).(Rule)
+	if !ok || !cacheableRequest(r) {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	base := baseKey(r)
+	now := time.Now()
+	done := func() {}
+
+	// a client asking for no-cache bypasses the cache, but its
+	// fresh response still replaces the cached one
+	if !clientNoCache(r) {
+		e, wait, leader := rule.store.lookup(base, r, now)
+		if e != nil {
+			return serveEntry(w, e, now)
+		}
+		if wait != nil {
+			// the same response is already being generated; wait
+			// for it rather than asking the next handlers again
+			<-wait
+			if e := rule.store.get(base, r, time.Now()); e != nil {
+				return serveEntry(w, e, time.Now())
+			}
+		} else {
+			var once sync.Once
+			done = func() { once.Do(leader) }
+			defer done()
+		}
+	}
+
+	cw := &cacheWriter{
+		ResponseWriter: w,
+		outer:          cloneHeader(w.Header()),
+		ttl:            rule.TTL,
+		maxBytes:       rule.MaxBytes,
+		release:        done,
+	}
+	status, err := c.Next.ServeHTTP(cw, r)
+	if err == nil && cw.wroteHeader && cw.cacheable {
+		stored := time.Now()
+		rule.store.add(base, r, &entry{
+			status:  cw.status,
+			header:  cw.header,
+			body:    cw.buf.Bytes(),
+			stored:  stored,
+			expires: stored.Add(cw.lifetime),
+		})
+	}
+	return status, err
+}
+
+// serveEntry writes the cached response e. Its header only has
+// the fields set by the handlers after the cache, so the ones set
+// for this request by the middleware before it are kept.
+func serveEntry(w http.ResponseWriter, e *entry, now time.Time) (int, error) {
+	for field, vals := range e.header {
+		w.Header()[field] = append([]string(nil), vals...)
+	}
+	w.Header().Set("Age", strconv.Itoa(int(now.Sub(e.stored)/time.Second)))
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+	return 0, nil
+}
+
+// cacheableRequest returns true if the response to r may be
+// served from or stored in the cache.
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	_, noStore := parseCacheControl(r.Header)["no-store"]
+	return !noStore
+}
+
+// clientNoCache returns true if the client asked for a response
+// that is not served from a cache.
+func clientNoCache(r *http.Request) bool {
+	if _, ok := parseCacheControl(r.Header)["no-cache"]; ok {
+		return true
+	}
+	return r.Header.Get("Cache-Control") == "" && strings.Contains(r.Header.Get("Pragma"), "no-cache")
+}
+
+// baseKey returns the part of the cache key of r that doesn't
+// depend on the Vary headers of the response.
+func baseKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.EscapedPath() + "?" + r.URL.RawQuery
+}
+
+// varyKey returns the cache key of r for a response that varies
+// by the request headers fields.
+func varyKey(base string, fields []string, r *http.Request) string {
+	key := base
+	for _, field := range fields {
+		key += "\n" + field + ": " + strings.Join(r.Header[field], ", ")
+	}
+	return key
+}
+
+// varyFields returns the canonical names of the request headers
+// listed in the Vary header of a response.
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, val := range header["Vary"] {
+		for _, field := range strings.Split(val, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	return fields
+}
+
+// cacheableStatus lists the status codes of responses that
+// may be cached without explicit freshness (RFC 7231 6.1).
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// freshness returns how long a response with status and header is
+// fresh for, which is 0 if it must not be cached. If ttl is greater
+// than 0 it is used instead of the lifetime the response declares.
+func freshness(status int, header http.Header, ttl time.Duration, now time.Time) time.Duration {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	for _, field := range varyFields(header) {
+		if field == "*" {
+			return 0
+		}
+	}
+	cc := parseCacheControl(header)
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[directive]; ok {
+			return 0
+		}
+	}
+	if ttl > 0 {
+		return ttl
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if val, ok := cc[directive]; ok {
+			seconds, err := strconv.Atoi(val)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseCacheControl returns the directives of the Cache-Control
+// header fields in header, with their values if they have any.
+func parseCacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, val := range header["Cache-Control"] {
+		for _, part := range strings.Split(val, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				name, value = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return cc
+}
+
+// cloneHeader returns a copy of h.
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for field, vals := range h {
+		clone[field] = append([]string(nil), vals...)
+	}
+	return clone
+}
+
+// sameValues returns true if a and b hold the same values.
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheWriter writes the response to the client and keeps
+// a copy of it as long as it can be cached.
+type cacheWriter struct {
+	http.ResponseWriter
+	outer    http.Header // as set by the middleware before the cache
+	ttl      time.Duration
+	maxBytes int64
+	release  func() // lets other requests for the response go on
+
+	wroteHeader bool
+	cacheable   bool
+	status      int
+	header      http.Header
+	lifetime    time.Duration
+	buf         bytes.Buffer
+}
+
+// WriteHeader decides if the response can be cached and
+// writes the header.
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	cw.lifetime = freshness(status, cw.Header(), cw.ttl, time.Now())
+	cw.cacheable = cw.lifetime > 0
+	if cw.cacheable {
+		// keep only what the handlers after the cache set, since
+		// the rest belongs to this request rather than the response
+		cw.header = make(http.Header)
+		for field, vals := range cw.Header() {
+			if !sameValues(vals, cw.outer[field]) {
+				cw.header[field] = append([]string(nil), vals...)
+			}
+		}
+	} else {
+		cw.release()
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b to the response and, if it can be cached,
+// to the copy of the body.
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.cacheable {
+		if int64(cw.buf.Len()+len(b)) > cw.maxBytes {
+			cw.uncache()
+		} else {
+			cw.buf.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// uncache drops the copy of a response that can't be cached.
+func (cw *cacheWriter) uncache() {
+	cw.cacheable = false
+	cw.buf = bytes.Buffer{}
+	cw.release()
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+// A hijacked response is not cached.
+func (cw *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		cw.wroteHeader = true
+		cw.uncache()
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// Flush implements http.Flusher. It writes the header, if
+// it wasn't yet, and flushes the underlying ResponseWriter.
+func (cw *cacheWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (cw *cacheWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (cw *cacheWriter) CloseNotify() <-chan bool {
+	if cn, ok := cw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic("not a CloseNotifier")
+}
@@ -0,0 +1,371 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// counter returns a handler that answers with header and a body
+// counting its calls, and a pointer to the number of calls.
+func counter(header http.Header) (httpserver.Handler, *int32) {
+	calls := new(int32)
+	return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		n := atomic.AddInt32(calls, 1)
+		for field, vals := range header {
+			w.Header()[field] = vals
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "response %d", n)
+		return http.StatusOK, nil
+	}), calls
+}
+
+func newCache(next httpserver.Handler, rule Rule) Cache {
+	if rule.MaxEntries == 0 {
+		rule.MaxEntries = DefaultMaxEntries
+	}
+	if rule.MaxBytes == 0 {
+		rule.MaxBytes = DefaultMaxBytes
+	}
+	rule.store = newStore(rule.MaxEntries, rule.MaxBytes)
+	return Cache{Next: next, Rules: []httpserver.HandlerConfig{rule}}
+}
+
+func serve(t *testing.T, c Cache, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	status, err := c.ServeHTTP(w, r)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if status != 0 && status != w.Code {
+		t.Fatalf("Expected status %d to be written, got %d", status, w.Code)
+	}
+	return w
+}
+
+func TestCacheServeHTTP(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		header   http.Header
+		requests []*http.Request
+		bodies   []string
+	}{
+		// cached for max-age
+		{Rule{Path: "/"}, http.Header{"Cache-Control": {"max-age=60"}},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a?q=1", nil),
+				httptest.NewRequest("GET", "http://other/a", nil),
+				httptest.NewRequest("POST", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+			},
+			[]string{"response 1", "response 1", "response 2", "response 3", "response 4", "response 1"}},
+		// not cached without freshness
+		{Rule{Path: "/"}, http.Header{},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+			},
+			[]string{"response 1", "response 2"}},
+		// ttl gives freshness
+		{Rule{Path: "/", TTL: time.Minute}, http.Header{},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+			},
+			[]string{"response 1", "response 1"}},
+		// ttl doesn't override no-store
+		{Rule{Path: "/", TTL: time.Minute}, http.Header{"Cache-Control": {"no-store"}},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+			},
+			[]string{"response 1", "response 2"}},
+		// only under the rule's path
+		{Rule{Path: "/api"}, http.Header{"Cache-Control": {"max-age=60"}},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/api/a", nil),
+				httptest.NewRequest("GET", "/api/a", nil),
+			},
+			[]string{"response 1", "response 2", "response 3", "response 3"}},
+		// a body bigger than the store isn't cached
+		{Rule{Path: "/", MaxBytes: 5}, http.Header{"Cache-Control": {"max-age=60"}},
+			[]*http.Request{
+				httptest.NewRequest("GET", "/a", nil),
+				httptest.NewRequest("GET", "/a", nil),
+			},
+			[]string{"response 1", "response 2"}},
+	}
+	for i, test := range tests {
+		next, _ := counter(test.header)
+		c := newCache(next, test.rule)
+		for j, r := range test.requests {
+			w := serve(t, c, r)
+			if got := w.Body.String(); got != test.bodies[j] {
+				t.Errorf("Test %d, request %d: Expected body '%s', got '%s'", i, j, test.bodies[j], got)
+			}
+		}
+	}
+}
+
+func TestCacheHeaders(t *testing.T) {
+	next, _ := counter(http.Header{"Cache-Control": {"max-age=60"}, "X-Test": {"a", "b"}})
+	c := newCache(next, Rule{Path: "/"})
+
+	w := serve(t, c, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Age"); got != "" {
+		t.Errorf("Expected no Age header on a fresh response, got '%s'", got)
+	}
+	w = serve(t, c, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Age"); got != "0" {
+		t.Errorf("Expected Age header 0 on a cached response, got '%s'", got)
+	}
+	if got := w.Header()["X-Test"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected the cached X-Test headers, got %v", got)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestCacheOuterHeaders(t *testing.T) {
+	next, _ := counter(http.Header{"Cache-Control": {"max-age=60"}})
+	c := newCache(next, Rule{Path: "/"})
+
+	for _, id := range []string{"aaa", "bbb"} {
+		w := httptest.NewRecorder()
+		// set for this request only, like requestid does
+		w.Header().Set("X-Request-ID", id)
+		if _, err := c.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Header().Get("X-Request-ID"); got != id {
+			t.Errorf("Expected X-Request-ID %s, got %s", id, got)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "max-age=60" {
+			t.Errorf("Expected the Cache-Control header of the response, got '%s'", got)
+		}
+	}
+}
+
+func TestCacheClientNoCache(t *testing.T) {
+	next, calls := counter(http.Header{"Cache-Control": {"max-age=60"}})
+	c := newCache(next, Rule{Path: "/"})
+
+	noCache := httptest.NewRequest("GET", "/", nil)
+	noCache.Header.Set("Cache-Control", "no-cache")
+	pragma := httptest.NewRequest("GET", "/", nil)
+	pragma.Header.Set("Pragma", "no-cache")
+	noStore := httptest.NewRequest("GET", "/", nil)
+	noStore.Header.Set("Cache-Control", "no-store")
+	auth := httptest.NewRequest("GET", "/", nil)
+	auth.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+
+	for i, test := range []struct {
+		r    *http.Request
+		body string
+	}{
+		{httptest.NewRequest("GET", "/", nil), "response 1"},
+		{noCache, "response 2"},
+		{httptest.NewRequest("GET", "/", nil), "response 2"},
+		{pragma, "response 3"},
+		{noStore, "response 4"},
+		{auth, "response 5"},
+		{httptest.NewRequest("GET", "/", nil), "response 3"},
+	} {
+		if got := serve(t, c, test.r).Body.String(); got != test.body {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.body, got)
+		}
+	}
+	if *calls != 5 {
+		t.Errorf("Expected 5 calls to the next handler, got %d", *calls)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	next, _ := counter(http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}})
+	c := newCache(next, Rule{Path: "/"})
+
+	request := func(lang string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		if lang != "" {
+			r.Header.Set("Accept-Language", lang)
+		}
+		return r
+	}
+	for i, test := range []struct {
+		lang, body string
+	}{
+		{"en", "response 1"},
+		{"en", "response 1"},
+		{"de", "response 2"},
+		{"", "response 3"},
+		{"de", "response 2"},
+		{"en", "response 1"},
+	} {
+		if got := serve(t, c, request(test.lang)).Body.String(); got != test.body {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.body, got)
+		}
+	}
+}
+
+func TestCacheStampede(t *testing.T) {
+	for _, header := range []http.Header{
+		{"Cache-Control": {"max-age=60"}},
+		{"Cache-Control": {"no-store"}},
+	} {
+		var calls int32
+		entered, release := make(chan struct{}), make(chan struct{})
+		next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(entered)
+			}
+			for field, vals := range header {
+				w.Header()[field] = vals
+			}
+			w.WriteHeader(http.StatusOK)
+			<-release
+			w.Write([]byte("slow"))
+			return http.StatusOK, nil
+		})
+		c := newCache(next, Rule{Path: "/"})
+
+		var wg sync.WaitGroup
+		get := func() {
+			defer wg.Done()
+			if got := serve(t, c, httptest.NewRequest("GET", "/", nil)).Body.String(); got != "slow" {
+				t.Errorf("%s: Expected body 'slow', got '%s'", header, got)
+			}
+		}
+		wg.Add(1)
+		go get()
+		<-entered
+		wg.Add(9)
+		for i := 0; i < 9; i++ {
+			go get()
+		}
+		if header.Get("Cache-Control") == "no-store" {
+			// a response that can't be cached doesn't hold up the others
+			for atomic.LoadInt32(&calls) < 10 {
+				time.Sleep(time.Millisecond)
+			}
+		} else {
+			time.Sleep(20 * time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+
+		want := int32(1)
+		if header.Get("Cache-Control") == "no-store" {
+			want = 10
+		}
+		if calls != want {
+			t.Errorf("%s: Expected %d calls to the next handler, got %d", header, want, calls)
+		}
+	}
+}
+
+func TestCacheWriterInterfaces(t *testing.T) {
+	c := newCache(httpserver.HandlerFunc(httpserver.UseOptionalInterfaces), Rule{Path: "/"})
+	fw := &httpserver.FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	if _, err := c.ServeHTTP(fw, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status int
+		header http.Header
+		ttl    time.Duration
+		expect time.Duration
+	}{
+		{200, http.Header{}, 0, 0},
+		{200, http.Header{}, time.Minute, time.Minute},
+		{200, http.Header{"Cache-Control": {"public, max-age=30"}}, 0, 30 * time.Second},
+		{200, http.Header{"Cache-Control": {"max-age=30, s-maxage=60"}}, 0, time.Minute},
+		{200, http.Header{"Cache-Control": {"max-age=30"}}, time.Minute, time.Minute},
+		{200, http.Header{"Cache-Control": {"max-age=bad"}}, 0, 0},
+		{200, http.Header{"Cache-Control": {"max-age=60, private"}}, 0, 0},
+		{200, http.Header{"Cache-Control": {"No-Cache"}}, time.Minute, 0},
+		{200, http.Header{"Cache-Control": {"no-store"}}, time.Minute, 0},
+		{200, http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, 0, 0},
+		{200, http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, 0, 0},
+		{200, http.Header{"Expires": {"Sun, 01 Jan 2017 00:01:00 GMT"}}, 0, time.Minute},
+		{200, http.Header{"Expires": {"Sun, 01 Jan 2017 00:01:00 GMT"}, "Date": {"Sun, 01 Jan 2017 00:00:30 GMT"}}, 0, 30 * time.Second},
+		{200, http.Header{"Expires": {"0"}}, 0, 0},
+		{200, http.Header{"Expires": {"Sun, 01 Jan 2017 00:01:00 GMT"}, "Cache-Control": {"max-age=0"}}, 0, 0},
+		{404, http.Header{"Cache-Control": {"max-age=60"}}, 0, time.Minute},
+		{500, http.Header{"Cache-Control": {"max-age=60"}}, 0, 0},
+		{302, http.Header{}, time.Minute, 0},
+	}
+	for i, test := range tests {
+		if got := freshness(test.status, test.header, test.ttl, now); got != test.expect {
+			t.Errorf("Test %d: Expected freshness %v, got %v", i, test.expect, got)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.Now()
+	add := func(s *store, path, body string, ttl time.Duration) {
+		s.add(baseKey(httptest.NewRequest("GET", path, nil)), httptest.NewRequest("GET", path, nil), &entry{
+			status:  http.StatusOK,
+			header:  http.Header{},
+			body:    []byte(body),
+			stored:  now,
+			expires: now.Add(ttl),
+		})
+	}
+	get := func(s *store, path string, now time.Time) *entry {
+		r := httptest.NewRequest("GET", path, nil)
+		return s.get(baseKey(r), r, now)
+	}
+
+	// evicts the least recently used by number
+	s := newStore(2, 100)
+	add(s, "/a", "a", time.Minute)
+	add(s, "/b", "b", time.Minute)
+	get(s, "/a", now)
+	add(s, "/c", "c", time.Minute)
+	if get(s, "/a", now) == nil || get(s, "/b", now) != nil || get(s, "/c", now) == nil {
+		t.Error("Expected /b to be evicted")
+	}
+
+	// evicts the least recently used by size
+	s = newStore(10, 10)
+	add(s, "/a", "aaaa", time.Minute)
+	add(s, "/b", "bbbb", time.Minute)
+	add(s, "/c", "cccc", time.Minute)
+	if get(s, "/a", now) != nil || get(s, "/b", now) == nil || get(s, "/c", now) == nil {
+		t.Error("Expected /a to be evicted")
+	}
+	if s.size != 8 {
+		t.Errorf("Expected size 8, got %d", s.size)
+	}
+
+	// replaces responses
+	add(s, "/b", "b", time.Minute)
+	if e := get(s, "/b", now); e == nil || string(e.body) != "b" || s.size != 5 || s.lru.Len() != 2 {
+		t.Error("Expected /b to be replaced")
+	}
+
+	// drops expired responses
+	if get(s, "/b", now.Add(time.Minute)) != nil || s.lru.Len() != 1 || len(s.varies) != 1 {
+		t.Error("Expected /b to be expired and removed")
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cache", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Cache middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := cacheParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Cache{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// cacheParse parses the cache directives, which are like
+// "cache [path]" with an optional block:
+//
+//	cache /api {
+//	    ttl         duration
+//	    max_entries number
+//	    max_size    size
+//	}
+func cacheParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		rule := Rule{Path: "/", MaxEntries: DefaultMaxEntries, MaxBytes: DefaultMaxBytes}
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return rules, c.ArgErr()
+			}
+			val := c.Val()
+			switch what {
+			case "ttl":
+				ttl, err := time.ParseDuration(val)
+				if err != nil || ttl <= 0 {
+					return rules, c.Errf("Invalid ttl '%s'", val)
+				}
+				rule.TTL = ttl
+			case "max_entries":
+				n, err := strconv.Atoi(val)
+				if err != nil || n <= 0 {
+					return rules, c.Errf("Invalid max_entries '%s'", val)
+				}
+				rule.MaxEntries = n
+			case "max_size":
+				size, err := humanize.ParseBytes(val)
+				if err != nil || size == 0 || size > math.MaxInt64 {
+					return rules, c.Errf("Invalid max_size '%s'", val)
+				}
+				rule.MaxBytes = int64(size)
+			default:
+				return rules, c.Errf("Unknown cache subdirective '%s'", what)
+			}
+			if c.NextArg() {
+				return rules, c.ArgErr()
+			}
+		}
+
+		for _, other := range rules {
+			if other.BasePath() == rule.Path {
+				return rules, c.Errf("Duplicate cache rule for path '%s'", rule.Path)
+			}
+		}
+		rule.store = newStore(rule.MaxEntries, rule.MaxBytes)
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
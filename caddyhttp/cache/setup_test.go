@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `cache /api`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Cache)
+	if !ok {
+		t.Fatalf("Expected handler to be type Cache, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(myHandler.Rules) != 1 || myHandler.Rules[0].(Rule).store == nil {
+		t.Errorf("Expected one rule with a store, got: %#v", myHandler.Rules)
+	}
+}
+
+func TestCacheParse(t *testing.T) {
+	tests := []struct {
+		input      string
+		shouldErr  bool
+		path       string
+		ttl        time.Duration
+		maxEntries int
+		maxBytes   int64
+	}{
+		{`cache`, false, "/", 0, DefaultMaxEntries, DefaultMaxBytes},
+		{`cache /api`, false, "/api", 0, DefaultMaxEntries, DefaultMaxBytes},
+		{`cache /api {
+			ttl 30s
+			max_entries 100
+			max_size 1MB
+		}`, false, "/api", 30 * time.Second, 100, 1000000},
+		{`cache /a /b`, true, "", 0, 0, 0},
+		{`cache {
+			ttl
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			ttl forever
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			ttl -1s
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			max_entries 0
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			max_size lots
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			max_entries 10 20
+		}`, true, "", 0, 0, 0},
+		{`cache {
+			stale 1m
+		}`, true, "", 0, 0, 0},
+		{`cache /api
+		cache /api`, true, "", 0, 0, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		rules, err := cacheParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != 1 {
+			t.Fatalf("Test %d: Expected 1 rule, got %d", i, len(rules))
+		}
+		rule := rules[0].(Rule)
+		if got, want := fmt.Sprint(rule.Path, rule.TTL, rule.MaxEntries, rule.MaxBytes),
+			fmt.Sprint(test.path, test.ttl, test.maxEntries, test.maxBytes); got != want {
+			t.Errorf("Test %d: Expected rule %s, got %s", i, want, got)
+		}
+		if rule.store == nil || rule.store.maxEntries != test.maxEntries || rule.store.maxBytes != test.maxBytes {
+			t.Errorf("Test %d: Expected the store to have the rule's limits", i)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// entry is a cached response.
+type entry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+
+	key  string
+	base string
+}
+
+// vary holds the request headers that the responses to the
+// requests with the same base key vary by, and the number of
+// those responses that are cached.
+type vary struct {
+	fields []string
+	n      int
+}
+
+// store keeps the responses of a rule in least recently used
+// order, and the requests whose responses are being generated.
+type store struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	varies  map[string]*vary
+	calls   map[string]chan struct{}
+}
+
+// newStore returns a store that holds at most maxEntries
+// responses with at most maxBytes of bodies.
+func newStore(maxEntries int, maxBytes int64) *store {
+	return &store{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		varies:     make(map[string]*vary),
+		calls:      make(map[string]chan struct{}),
+	}
+}
+
+// key returns the cache key of r, given the Vary headers of the
+// responses cached for its base key so far. It must be called
+// with s.mu locked.
+func (s *store) key(base string, r *http.Request) string {
+	if v, ok := s.varies[base]; ok {
+		return varyKey(base, v.fields, r)
+	}
+	return base
+}
+
+// get returns the fresh response to r if there is one.
+func (s *store) get(base string, r *http.Request, now time.Time) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(s.key(base, r), now)
+}
+
+// getLocked returns the fresh response with key if there is
+// one. It must be called with s.mu locked.
+func (s *store) getLocked(key string, now time.Time) *entry {
+	el, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		s.remove(el)
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return e
+}
+
+// lookup returns the fresh response to r if there is one. If
+// not, and the response is being generated for another request,
+// it returns a channel that is closed when that is done.
+// Otherwise the caller should generate the response, and call
+// done when it is either stored or known not to be cacheable.
+func (s *store) lookup(base string, r *http.Request, now time.Time) (e *entry, wait <-chan struct{}, done func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.key(base, r)
+	if e := s.getLocked(key, now); e != nil {
+		return e, nil, nil
+	}
+	if ch, ok := s.calls[key]; ok {
+		return nil, ch, nil
+	}
+	ch := make(chan struct{})
+	s.calls[key] = ch
+	return nil, nil, func() {
+		s.mu.Lock()
+		delete(s.calls, key)
+		s.mu.Unlock()
+		close(ch)
+	}
+}
+
+// add stores e as the response to r, evicting the least
+// recently used responses to stay within the limits.
+func (s *store) add(base string, r *http.Request, e *entry) {
+	if int64(len(e.body)) > s.maxBytes {
+		return
+	}
+	fields := varyFields(e.header)
+	e.key, e.base = varyKey(base, fields, r), base
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[e.key]; ok {
+		s.remove(el)
+	}
+	v, ok := s.varies[base]
+	if !ok {
+		v = new(vary)
+		s.varies[base] = v
+	}
+	v.fields = fields
+	v.n++
+	s.entries[e.key] = s.lru.PushFront(e)
+	s.size += int64(len(e.body))
+
+	for s.lru.Len() > s.maxEntries || s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove removes the response in el. It must be called
+// with s.mu locked.
+func (s *store) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.key)
+	s.size -= int64(len(e.body))
+	if v := s.varies[e.base]; v != nil {
+		v.n--
+		if v.n == 0 {
+			delete(s.varies, e.base)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package cors implements the cors directive, which handles
+// Cross-Origin Resource Sharing requests.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// CORS is middleware that answers preflight requests and adds
+// the CORS headers to responses for cross-origin requests.
+type CORS struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// Rule is the CORS policy of the paths under Path.
+type Rule struct {
+	Path string
+
+	// Origins are the origins allowed to make requests. If empty,
+	// any origin is allowed.
+	Origins []string
+
+	// Methods are the methods allowed in preflight requests. If
+	// empty, the method asked for is allowed.
+	Methods []string
+
+	// AllowedHeaders are the request headers allowed in preflight
+	// requests. If empty, the headers asked for are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that scripts
+	// are allowed to read.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with cookies or
+	// other credentials. It needs a list of Origins
+	// without *, since the allowed origin is reflected.
+	AllowCredentials bool
+
+	// MaxAge is how long, in seconds, the result of a preflight
+	// request may be cached. It is left out if 0.
+	MaxAge int
+}
+
+// BasePath satisfies httpserver.HandlerConfig.
+func (rule Rule) BasePath() string { return rule.Path }
+
+// Match satisfies httpserver.RequestMatcher.
+func (rule Rule) Match(r *http.Request) bool {
+	return httpserver.Path(r.URL.Path).Matches(rule.Path)
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (c CORS) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := httpserver.ConfigSelector(c.Rules).Select(r)
+	origin := r.Header.Get("Origin")
+	if cfg == nil || origin == "" {
+		return c.Next.ServeHTTP(w, r)
+	}
+	rule := cfg.(Rule)
+
+	h := w.Header()
+	if len(rule.Origins) > 0 || rule.AllowCredentials {
+		// the allowed origin depends on the request
+		httpserver.AddVary(h, "Origin")
+	}
+	if !rule.allowsOrigin(origin) {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	if rule.AllowCredentials || len(rule.Origins) > 0 {
+		h.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+	if rule.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if r.Method != http.MethodOptions || method == "" {
+		if len(rule.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposedHeaders, ", "))
+		}
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	// preflight request; answer it here, since the
+	// handlers of the actual request don't know it
+	if len(rule.Methods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(rule.Methods, ", "))
+	} else {
+		h.Set("Access-Control-Allow-Methods", method)
+	}
+	if len(rule.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(rule.AllowedHeaders, ", "))
+	} else if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+		httpserver.AddVary(h, "Access-Control-Request-Headers")
+	}
+	if rule.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+// allowsOrigin returns true if requests from origin are allowed.
+func (rule Rule) allowsOrigin(origin string) bool {
+	if len(rule.Origins) == 0 {
+		return true
+	}
+	for _, o := range rule.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
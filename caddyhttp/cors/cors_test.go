@@ -0,0 +1,138 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	reached := false
+	c := CORS{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			reached = true
+			return http.StatusOK, nil
+		}),
+		Rules: []httpserver.HandlerConfig{Rule{
+			Path:             "/api",
+			Origins:          []string{"https://example.com"},
+			Methods:          []string{"GET", "POST"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		}},
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/api/items", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-Token")
+	rec := httptest.NewRecorder()
+	code, err := c.ServeHTTP(rec, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if code != 0 || rec.Code != http.StatusNoContent {
+		t.Errorf("Expected preflight answered with %d, got status %d and code %d", http.StatusNoContent, code, rec.Code)
+	}
+	if reached {
+		t.Error("Expected preflight request not to reach the next handler")
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "X-Token",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("Expected %s '%s', got '%s'", name, want, got)
+		}
+	}
+}
+
+func TestCORSRequests(t *testing.T) {
+	tests := []struct {
+		rule        Rule
+		method      string
+		origin      string
+		path        string
+		allowOrigin string
+		vary        string
+		reachesNext bool
+	}{
+		// any origin
+		{Rule{Path: "/"}, "GET", "https://a.example", "/", "*", "", true},
+		// allow-listed origin with credentials is reflected
+		{Rule{Path: "/", Origins: []string{"https://a.example"}, AllowCredentials: true}, "GET", "https://a.example", "/", "https://a.example", "Origin", true},
+		// allow-listed origin
+		{Rule{Path: "/", Origins: []string{"https://a.example"}}, "GET", "https://a.example", "/", "https://a.example", "Origin", true},
+		// origin not allowed
+		{Rule{Path: "/", Origins: []string{"https://a.example"}}, "GET", "https://b.example", "/", "", "Origin", true},
+		// not a cross-origin request
+		{Rule{Path: "/"}, "GET", "", "/", "", "", true},
+		// other path
+		{Rule{Path: "/api"}, "GET", "https://a.example", "/static", "", "", true},
+		// OPTIONS request that is not a preflight
+		{Rule{Path: "/"}, "OPTIONS", "https://a.example", "/", "*", "", true},
+		// preflight from an origin not allowed goes on as usual
+		{Rule{Path: "/", Origins: []string{"https://a.example"}}, "PREFLIGHT", "https://b.example", "/", "", "Origin", true},
+		// preflight for any method
+		{Rule{Path: "/"}, "PREFLIGHT", "https://b.example", "/", "*", "", false},
+	}
+
+	for i, test := range tests {
+		reached := false
+		c := CORS{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				reached = true
+				return http.StatusOK, nil
+			}),
+			Rules: []httpserver.HandlerConfig{test.rule},
+		}
+		method := test.method
+		if method == "PREFLIGHT" {
+			method = "OPTIONS"
+		}
+		req := httptest.NewRequest(method, test.path, nil)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.method == "PREFLIGHT" {
+			req.Header.Set("Access-Control-Request-Method", "DELETE")
+		}
+		rec := httptest.NewRecorder()
+		if _, err := c.ServeHTTP(rec, req); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+			t.Errorf("Test %d: Expected Access-Control-Allow-Origin '%s', got '%s'", i, test.allowOrigin, got)
+		}
+		if got := rec.Header().Get("Vary"); got != test.vary {
+			t.Errorf("Test %d: Expected Vary '%s', got '%s'", i, test.vary, got)
+		}
+		if reached != test.reachesNext {
+			t.Errorf("Test %d: Expected next handler reached to be %v", i, test.reachesNext)
+		}
+		if !reached && rec.Header().Get("Access-Control-Allow-Methods") != "DELETE" {
+			t.Errorf("Test %d: Expected the requested method to be allowed, got '%s'",
+				i, rec.Header().Get("Access-Control-Allow-Methods"))
+		}
+	}
+}
+
+func TestCORSExposedHeaders(t *testing.T) {
+	c := CORS{
+		Next:  httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) { return http.StatusOK, nil }),
+		Rules: []httpserver.HandlerConfig{Rule{Path: "/", ExposedHeaders: []string{"X-Total", "X-Page"}}},
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://a.example")
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	if got, want := rec.Header().Get("Access-Control-Expose-Headers"), "X-Total, X-Page"; got != want {
+		t.Errorf("Expected Access-Control-Expose-Headers '%s', got '%s'", want, got)
+	}
+}
@@ -0,0 +1,147 @@
+package cors
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cors", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new CORS middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := corsParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return CORS{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// corsParse parses the cors directives, which are like
+// "cors [path] [origins...]" with an optional block:
+//
+//	cors /api https://example.com {
+//	    origin            https://example.org
+//	    methods           GET,POST
+//	    allowed_headers   X-Token
+//	    exposed_headers   X-Total
+//	    allow_credentials true
+//	    max_age           3600
+//	}
+//
+// Lists may be separated by commas or spaces.
+func corsParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		args := c.RemainingArgs()
+		if len(args) > 0 {
+			rule.Path = args[0]
+			rule.Origins = splitList(args[1:])
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "origin":
+				origins := splitList(c.RemainingArgs())
+				if len(origins) == 0 {
+					return rules, c.ArgErr()
+				}
+				rule.Origins = append(rule.Origins, origins...)
+			case "methods":
+				rule.Methods = splitList(c.RemainingArgs())
+				if len(rule.Methods) == 0 {
+					return rules, c.ArgErr()
+				}
+				for i, m := range rule.Methods {
+					rule.Methods[i] = strings.ToUpper(m)
+				}
+			case "allowed_headers":
+				rule.AllowedHeaders = splitList(c.RemainingArgs())
+				if len(rule.AllowedHeaders) == 0 {
+					return rules, c.ArgErr()
+				}
+			case "exposed_headers":
+				rule.ExposedHeaders = splitList(c.RemainingArgs())
+				if len(rule.ExposedHeaders) == 0 {
+					return rules, c.ArgErr()
+				}
+			case "allow_credentials":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				allow, err := strconv.ParseBool(c.Val())
+				if err != nil {
+					return rules, c.Errf("allow_credentials must be true or false, got '%s'", c.Val())
+				}
+				rule.AllowCredentials = allow
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			case "max_age":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				maxAge, err := strconv.Atoi(c.Val())
+				if err != nil || maxAge < 0 {
+					return rules, c.Errf("max_age must be a number of seconds, got '%s'", c.Val())
+				}
+				rule.MaxAge = maxAge
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			default:
+				return rules, c.Errf("Unknown cors subdirective '%s'", c.Val())
+			}
+		}
+
+		// with credentials, the origin is reflected, so allowing
+		// any origin would let any site read the user's data
+		if rule.AllowCredentials {
+			if len(rule.Origins) == 0 {
+				return rules, c.Errf("allow_credentials requires a list of allowed origins")
+			}
+			for _, o := range rule.Origins {
+				if o == "*" {
+					return rules, c.Errf("allow_credentials can't be used with origin *")
+				}
+			}
+		}
+
+		for _, other := range rules {
+			if other.BasePath() == rule.Path {
+				return rules, c.Errf("Duplicate cors policy for path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// splitList returns the items of args, which may
+// themselves be comma-separated lists.
+func splitList(args []string) []string {
+	var items []string
+	for _, arg := range args {
+		for _, item := range strings.Split(arg, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,114 @@
+package cors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `cors`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(CORS)
+	if !ok {
+		t.Fatalf("Expected handler to be type CORS, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestCORSParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []httpserver.HandlerConfig
+	}{
+		{`cors`, false, []httpserver.HandlerConfig{Rule{Path: "/"}}},
+		{`cors /api https://a.example,https://b.example`, false, []httpserver.HandlerConfig{
+			Rule{Path: "/api", Origins: []string{"https://a.example", "https://b.example"}},
+		}},
+		{`cors /api https://a.example {
+			origin https://b.example https://c.example
+			methods get,POST
+			allowed_headers X-Token, Content-Type
+			exposed_headers X-Total
+			allow_credentials true
+			max_age 3600
+		}
+		cors /public`, false, []httpserver.HandlerConfig{
+			Rule{
+				Path:             "/api",
+				Origins:          []string{"https://a.example", "https://b.example", "https://c.example"},
+				Methods:          []string{"GET", "POST"},
+				AllowedHeaders:   []string{"X-Token", "Content-Type"},
+				ExposedHeaders:   []string{"X-Total"},
+				AllowCredentials: true,
+				MaxAge:           3600,
+			},
+			Rule{Path: "/public"},
+		}},
+		{`cors {
+			origin
+		}`, true, nil},
+		{`cors {
+			methods
+		}`, true, nil},
+		{`cors {
+			allow_credentials maybe
+		}`, true, nil},
+		{`cors {
+			allow_credentials true
+		}`, true, nil},
+		{`cors / * {
+			allow_credentials true
+		}`, true, nil},
+		{`cors / https://a.example {
+			origin *
+			allow_credentials true
+		}`, true, nil},
+		{`cors / * {
+			allow_credentials false
+		}`, false, []httpserver.HandlerConfig{Rule{Path: "/", Origins: []string{"*"}}}},
+		{`cors {
+			max_age soon
+		}`, true, nil},
+		{`cors {
+			max_age 10 20
+		}`, true, nil},
+		{`cors {
+			bogus
+		}`, true, nil},
+		{`cors /api
+		  cors /api`, true, nil},
+	}
+
+	for i, test := range tests {
+		rules, err := corsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
@@ -2,13 +2,21 @@
 package errors
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
+	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/mholt/caddy"
@@ -24,13 +32,31 @@ func init() {
 
 // ErrorHandler handles HTTP errors (and errors from other middleware).
 type ErrorHandler struct {
-	Next       httpserver.Handler
-	ErrorPages map[int]string // map of status code to filename
-	LogFile    string
-	Log        *log.Logger
-	LogRoller  *httpserver.LogRoller
-	Debug      bool     // if true, errors are written out to client rather than to a log
-	file       *os.File // a log file to close when done
+	Next             httpserver.Handler
+	ErrorPages       map[int]string   // map of status code to filename
+	RangeErrorPages  map[int]string   // map of status class (e.g. 4 for 4xx) to filename
+	GenericErrorPage string           // filename of page for any other error (the * wildcard)
+	PathErrorPages   []PathErrorPages // pages for paths, preferred over the ones above
+	LogFile          string
+	Log              *log.Logger
+	LogRoller        *httpserver.LogRoller
+	PanicLogFile     string
+	PanicLog         *log.Logger // where recovered panics are logged; defaults to Log
+	Debug            bool        // if true, errors are written out to client rather than to a log
+	HideStackTrace   bool        // if true, panic stack traces are logged instead of written out in debug mode
+	JSON             bool        // if true, errors are written as JSON to clients that prefer it
+	file             *os.File    // a log file to close when done
+	panicFile        *os.File    // a panic log file to close when done
+}
+
+// PathErrorPages are the error pages for requests to paths
+// under Path. Of the sets matching a request, the one with
+// the longest path is used.
+type PathErrorPages struct {
+	Path             string
+	ErrorPages       map[int]string
+	RangeErrorPages  map[int]string
+	GenericErrorPage string
 }
 
 func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -42,6 +68,10 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 		errMsg := fmt.Sprintf("%s [ERROR %d %s] %v", time.Now().Format(timeFormat), status, r.URL.Path, err)
 		if h.Debug {
 			// Write error to response instead of to log
+			if h.wantsJSON(r) {
+				writeJSONError(w, status, errMsg)
+				return 0, err
+			}
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(status)
 			fmt.Fprintln(w, errMsg)
@@ -62,8 +92,14 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 // code. If there is an error serving the error page, a plaintext error
 // message is written instead, and the extra error is logged.
 func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int) {
+	// API clients get a JSON body instead of a page, if enabled
+	if h.wantsJSON(r) {
+		writeJSONError(w, code, "")
+		return
+	}
+
 	// See if an error page for this status code was specified
-	if pagePath, ok := h.ErrorPages[code]; ok {
+	if pagePath, ok := h.pagePath(r, code); ok {
 		// Try to open it
 		errorPage, err := os.Open(pagePath)
 		if err != nil {
@@ -75,10 +111,31 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int
 		}
 		defer errorPage.Close()
 
-		// Copy the page body into the response
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		body, err := ioutil.ReadAll(errorPage)
+		if err != nil {
+			h.Log.Printf("%s [NOTICE %d %s] could not read error page: %v",
+				time.Now().Format(timeFormat), code, r.URL.String(), err)
+			httpserver.DefaultErrorFunc(w, r, code)
+			return
+		}
+
+		ctype := mime.TypeByExtension(filepath.Ext(pagePath))
+		if ctype == "" {
+			ctype = "text/html; charset=utf-8"
+		}
+
+		// Render the page as a template; serve it verbatim if that fails
+		if rendered, err := renderErrorPage(body, r, code, isHTML(ctype)); err != nil {
+			h.Log.Printf("%s [NOTICE %d %s] could not render error page %s: %v",
+				time.Now().Format(timeFormat), code, r.URL.String(), pagePath, err)
+		} else {
+			body = rendered
+		}
+
+		// Write the page body to the response
+		w.Header().Set("Content-Type", ctype)
 		w.WriteHeader(code)
-		_, err = io.Copy(w, errorPage)
+		_, err = w.Write(body)
 
 		if err != nil {
 			// Epic fail... sigh.
@@ -94,6 +151,96 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int
 	httpserver.DefaultErrorFunc(w, r, code)
 }
 
+// errorPageContext is the context with which error pages
+// are rendered as templates.
+type errorPageContext struct {
+	Status     int
+	StatusText string
+	Path       string
+	Method     string
+	Hostname   string
+}
+
+// executor is a parsed text or HTML template.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// renderErrorPage executes page as a template describing the
+// error with status code for request r. HTML pages are rendered
+// with html/template, so the values from the request are escaped.
+func renderErrorPage(page []byte, r *http.Request, code int, html bool) ([]byte, error) {
+	var tpl executor
+	var err error
+	if html {
+		tpl, err = htmltemplate.New("errorpage").Parse(string(page))
+	} else {
+		tpl, err = template.New("errorpage").Parse(string(page))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		hostname = r.Host // no port
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, errorPageContext{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Path:       r.URL.Path,
+		Method:     r.Method,
+		Hostname:   hostname,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isHTML returns true if ctype is the media type of an HTML page.
+func isHTML(ctype string) bool {
+	mediatype, _, err := mime.ParseMediaType(ctype)
+	return err == nil && (mediatype == "text/html" || mediatype == "application/xhtml+xml")
+}
+
+// pagePath returns the filename of the error page configured
+// for code, if any. The pages for the path of r are preferred
+// over the site-wide ones. Among either, an exact status code
+// match is preferred, followed by a status class (e.g. 4xx),
+// then the * wildcard.
+func (h ErrorHandler) pagePath(r *http.Request, code int) (string, bool) {
+	var scoped *PathErrorPages
+	for i, pages := range h.PathErrorPages {
+		if httpserver.Path(r.URL.Path).Matches(pages.Path) && (scoped == nil || len(pages.Path) > len(scoped.Path)) {
+			scoped = &h.PathErrorPages[i]
+		}
+	}
+	if scoped != nil {
+		if pagePath, ok := findPage(scoped.ErrorPages, scoped.RangeErrorPages, scoped.GenericErrorPage, code); ok {
+			return pagePath, true
+		}
+	}
+	return findPage(h.ErrorPages, h.RangeErrorPages, h.GenericErrorPage, code)
+}
+
+// findPage returns the page for code among pages, rangePages
+// and genericPage, in that order of preference.
+func findPage(pages, rangePages map[int]string, genericPage string, code int) (string, bool) {
+	if pagePath, ok := pages[code]; ok {
+		return pagePath, true
+	}
+	if pagePath, ok := rangePages[code/100]; ok {
+		return pagePath, true
+	}
+	if genericPage != "" {
+		return genericPage, true
+	}
+	return "", false
+}
+
 func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 	rec := recover()
 	if rec == nil {
@@ -126,16 +273,61 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	panicMsg := fmt.Sprintf("%s [PANIC %s] %s:%d - %v", time.Now().Format(timeFormat), r.URL.String(), file, line, rec)
-	if h.Debug {
+	if h.Debug && h.HideStackTrace {
+		// Log the stack trace, but only show the client a generic error
+		var stackBuf [4096]byte
+		stack := stackBuf[:runtime.Stack(stackBuf[:], false)]
+		h.panicLog().Printf("%s\n\n%s", panicMsg, stack)
+		h.errorPage(w, r, http.StatusInternalServerError)
+	} else if h.Debug {
 		// Write error and stack trace to the response rather than to a log
 		var stackBuf [4096]byte
 		stack := stackBuf[:runtime.Stack(stackBuf[:], false)]
+		if h.wantsJSON(r) {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s\n\n%s", panicMsg, stack))
+			return
+		}
 		httpserver.WriteTextResponse(w, http.StatusInternalServerError, fmt.Sprintf("%s\n\n%s", panicMsg, stack))
 	} else {
 		// Currently we don't use the function name, since file:line is more conventional
-		h.Log.Printf(panicMsg)
+		h.panicLog().Printf(panicMsg)
 		h.errorPage(w, r, http.StatusInternalServerError)
 	}
 }
 
+// panicLog returns the logger for recovered panics.
+func (h ErrorHandler) panicLog() *log.Logger {
+	if h.PanicLog != nil {
+		return h.PanicLog
+	}
+	return h.Log
+}
+
+// wantsJSON returns true if JSON error responses are enabled
+// and the client prefers application/json over HTML or plain
+// text according to its Accept header.
+func (h ErrorHandler) wantsJSON(r *http.Request) bool {
+	return h.JSON && httpserver.PrefersJSON(r)
+}
+
+// jsonError is the body of an error response written as JSON.
+type jsonError struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Details string `json:"details,omitempty"`
+}
+
+// writeJSONError writes a JSON error body with code status to w.
+// Details are only included when non-empty (e.g. in debug mode).
+func writeJSONError(w http.ResponseWriter, status int, details string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(jsonError{
+		Status:  status,
+		Error:   http.StatusText(status),
+		Details: details,
+	})
+}
+
 const timeFormat = "02/Jan/2006:15:04:05 -0700"
@@ -2,8 +2,10 @@ package errors
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -119,6 +121,207 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestErrorPageResolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pages := make(map[string]string)
+	for _, name := range []string{"404", "4xx", "5xx", "any"} {
+		path := filepath.Join(dir, name+".html")
+		if err := ioutil.WriteFile(path, []byte(name+" page"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pages[name] = path
+	}
+
+	tests := []struct {
+		handler      ErrorHandler
+		status       int
+		expectedBody string
+	}{
+		// exact match wins over range and wildcard
+		{ErrorHandler{
+			ErrorPages:       map[int]string{404: pages["404"]},
+			RangeErrorPages:  map[int]string{4: pages["4xx"]},
+			GenericErrorPage: pages["any"],
+		}, http.StatusNotFound, "404 page"},
+		// range wins over wildcard
+		{ErrorHandler{
+			ErrorPages:       map[int]string{404: pages["404"]},
+			RangeErrorPages:  map[int]string{4: pages["4xx"], 5: pages["5xx"]},
+			GenericErrorPage: pages["any"],
+		}, http.StatusForbidden, "4xx page"},
+		{ErrorHandler{
+			RangeErrorPages:  map[int]string{4: pages["4xx"], 5: pages["5xx"]},
+			GenericErrorPage: pages["any"],
+		}, http.StatusBadGateway, "5xx page"},
+		// wildcard catches everything else
+		{ErrorHandler{
+			ErrorPages:       map[int]string{404: pages["404"]},
+			RangeErrorPages:  map[int]string{4: pages["4xx"]},
+			GenericErrorPage: pages["any"],
+		}, http.StatusInternalServerError, "any page"},
+		// default generated text when nothing matches
+		{ErrorHandler{
+			ErrorPages:      map[int]string{404: pages["404"]},
+			RangeErrorPages: map[int]string{4: pages["4xx"]},
+		}, http.StatusServiceUnavailable, fmt.Sprintf("%d %s\n", http.StatusServiceUnavailable,
+			http.StatusText(http.StatusServiceUnavailable))},
+		{ErrorHandler{}, http.StatusNotFound, fmt.Sprintf("%d %s\n", http.StatusNotFound,
+			http.StatusText(http.StatusNotFound))},
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		test.handler.Log = log.New(&buf, "", 0)
+		test.handler.Next = genErrorHandler(test.status, nil, "")
+		rec := httptest.NewRecorder()
+
+		code, err := test.handler.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, but got %v", i, err)
+		}
+		if code != 0 {
+			t.Errorf("Test %d: Expected status code 0, but got %d", i, code)
+		}
+		if rec.Code != test.status {
+			t.Errorf("Test %d: Expected response status %d, but got %d", i, test.status, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, but got %q", i, test.expectedBody, body)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("Test %d: Expected no log output, but got %q", i, buf.String())
+		}
+	}
+}
+
+func TestPathErrorPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pages := make(map[string]string)
+	for name, content := range map[string]string{
+		"404.html":    "site 404",
+		"5xx.html":    "site 5xx",
+		"404.json":    `{"error":"not found"}`,
+		"v2-404.json": `{"error":"v2 not found"}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pages[name] = path
+	}
+
+	handler := ErrorHandler{
+		ErrorPages:      map[int]string{404: pages["404.html"]},
+		RangeErrorPages: map[int]string{5: pages["5xx.html"]},
+		PathErrorPages: []PathErrorPages{
+			{Path: "/api", ErrorPages: map[int]string{404: pages["404.json"]}},
+			{Path: "/api/v2", ErrorPages: map[int]string{404: pages["v2-404.json"]}},
+		},
+		Log: log.New(ioutil.Discard, "", 0),
+	}
+
+	tests := []struct {
+		path                string
+		status              int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{"/page", http.StatusNotFound, "site 404", "text/html; charset=utf-8"},
+		{"/api/users", http.StatusNotFound, `{"error":"not found"}`, "application/json"},
+		{"/api/v2/users", http.StatusNotFound, `{"error":"v2 not found"}`, "application/json"},
+		// no page for the status in the path's set
+		{"/api/users", http.StatusBadGateway, "site 5xx", "text/html; charset=utf-8"},
+	}
+	for i, test := range tests {
+		handler.Next = genErrorHandler(test.status, nil, "")
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("Test %d: Expected response status %d, but got %d", i, test.status, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, but got %q", i, test.expectedBody, body)
+		}
+		if ctype := rec.Header().Get("Content-Type"); ctype != test.expectedContentType {
+			t.Errorf("Test %d: Expected Content-Type %q, but got %q", i, test.expectedContentType, ctype)
+		}
+	}
+}
+
+func TestErrorPageTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goodPage := filepath.Join(dir, "good.html")
+	err = ioutil.WriteFile(goodPage, []byte("<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Method}} {{.Hostname}}{{.Path}}</p>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const badContent = "<h1>{{.Status</h1>"
+	badPage := filepath.Join(dir, "bad.html")
+	if err = ioutil.WriteFile(badPage, []byte(badContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	textPage := filepath.Join(dir, "page.txt")
+	if err = ioutil.WriteFile(textPage, []byte("{{.Status}} {{.Path}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page         string
+		path         string
+		expectedBody string
+		expectedLog  string
+	}{
+		{goodPage, "/foo/bar", "<h1>404 Not Found</h1><p>GET example.com/foo/bar</p>", ""},
+		{goodPage, "/<script>alert(1)</script>", "<h1>404 Not Found</h1><p>GET example.com/&lt;script&gt;alert(1)&lt;/script&gt;</p>", ""},
+		{textPage, "/<b>", "404 /<b>", ""},
+		{badPage, "/foo/bar", badContent, "[NOTICE 404 http://example.com:8080/foo/bar] could not render error page " + badPage},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+		eh := ErrorHandler{
+			ErrorPages: map[int]string{http.StatusNotFound: test.page},
+			Log:        log.New(&buf, "", 0),
+			Next:       genErrorHandler(http.StatusNotFound, nil, ""),
+		}
+		req, err := http.NewRequest("GET", "http://example.com:8080/foo/bar", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.URL.Path = test.path
+		rec := httptest.NewRecorder()
+		eh.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, but got %q", i, test.expectedBody, body)
+		}
+		if log := buf.String(); !strings.Contains(log, test.expectedLog) {
+			t.Errorf("Test %d: Expected log %q, but got %q", i, test.expectedLog, log)
+		}
+	}
+}
+
 func TestVisibleErrorWithPanic(t *testing.T) {
 	const panicMsg = "I'm a panic"
 	eh := ErrorHandler{
@@ -155,6 +358,166 @@ func TestVisibleErrorWithPanic(t *testing.T) {
 	if len(body) < 500 {
 		t.Errorf("Expected response body to contain stack trace, but it was too short: len=%d", len(body))
 	}
+
+	// With the stack trace hidden, it should be logged instead
+	var buf bytes.Buffer
+	eh.HideStackTrace = true
+	eh.Log = log.New(&buf, "", 0)
+	rec = httptest.NewRecorder()
+
+	code, err = eh.ServeHTTP(rec, req)
+
+	if code != 0 {
+		t.Errorf("Expected error handler to return 0 (it should write to response), got status %d", code)
+	}
+	if err != nil {
+		t.Errorf("Expected error handler to return nil error (it should panic!), but got '%v'", err)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	body = rec.Body.String()
+	expectedBody := fmt.Sprintf("%d %s\n", http.StatusInternalServerError,
+		http.StatusText(http.StatusInternalServerError))
+	if body != expectedBody {
+		t.Errorf("Expected response body %q without stack trace, but got:\n%s", expectedBody, body)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, "[PANIC /] caddyhttp/errors/errors_test.go") {
+		t.Errorf("Expected log to contain error log line, but it didn't:\n%s", logged)
+	}
+	if !strings.Contains(logged, "goroutine ") || len(logged) < 500 {
+		t.Errorf("Expected log to contain stack trace, but it didn't:\n%s", logged)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	testErr := errors.New("test error")
+	tests := []struct {
+		json         bool
+		debug        bool
+		accept       string
+		next         httpserver.Handler
+		expectedType string
+		expectedBody string
+	}{
+		{true, false, "application/json", genErrorHandler(http.StatusInternalServerError, testErr, ""),
+			"application/json; charset=utf-8", `{"status":500,"error":"Internal Server Error"}` + "\n"},
+		{true, false, "text/html;q=0.8, application/json", genErrorHandler(http.StatusNotFound, nil, ""),
+			"application/json; charset=utf-8", `{"status":404,"error":"Not Found"}` + "\n"},
+		{true, false, "text/html, application/json;q=0.9", genErrorHandler(http.StatusNotFound, nil, ""),
+			"text/plain; charset=utf-8", "404 Not Found\n"},
+		{true, false, "", genErrorHandler(http.StatusNotFound, nil, ""),
+			"text/plain; charset=utf-8", "404 Not Found\n"},
+		{false, false, "application/json", genErrorHandler(http.StatusNotFound, nil, ""),
+			"text/plain; charset=utf-8", "404 Not Found\n"},
+		{true, true, "application/json", genErrorHandler(http.StatusBadGateway, testErr, ""),
+			"application/json; charset=utf-8", `{"status":502,"error":"Bad Gateway","details":"`},
+	}
+
+	for i, test := range tests {
+		eh := ErrorHandler{
+			ErrorPages: make(map[int]string),
+			Log:        log.New(ioutil.Discard, "", 0),
+			JSON:       test.json,
+			Debug:      test.debug,
+			Next:       test.next,
+		}
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		eh.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Test %d: Expected Content-Type %q, but got %q", i, test.expectedType, ct)
+		}
+		if body := rec.Body.String(); !strings.HasPrefix(body, test.expectedBody) {
+			t.Errorf("Test %d: Expected body to start with %q, but got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestJSONErrorWithPanic(t *testing.T) {
+	const panicMsg = "I'm a panic"
+	eh := ErrorHandler{
+		ErrorPages: make(map[int]string),
+		Debug:      true,
+		JSON:       true,
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			panic(panicMsg)
+		}),
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+
+	eh.ServeHTTP(rec, req)
+
+	var body jsonError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected response body to be JSON, got error: %v", err)
+	}
+	if body.Status != http.StatusInternalServerError {
+		t.Errorf("Expected status %d in body, got %d", http.StatusInternalServerError, body.Status)
+	}
+	if !strings.Contains(body.Details, panicMsg) {
+		t.Errorf("Expected details to contain panic message, but it didn't:\n%s", body.Details)
+	}
+	if len(body.Details) < 500 {
+		t.Errorf("Expected details to contain stack trace, but it was too short: len=%d", len(body.Details))
+	}
+}
+
+func TestPanicLog(t *testing.T) {
+	const panicMsg = "I'm a panic"
+	panicNext := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic(panicMsg)
+	})
+
+	for i, separate := range []bool{false, true} {
+		var errBuf, panicBuf bytes.Buffer
+		eh := ErrorHandler{
+			ErrorPages: make(map[int]string),
+			Log:        log.New(&errBuf, "", 0),
+			Next:       panicNext,
+		}
+		if separate {
+			eh.PanicLog = log.New(&panicBuf, "", 0)
+		}
+
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		eh.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusInternalServerError, rec.Code)
+		}
+
+		want, other := &errBuf, &panicBuf
+		if separate {
+			want, other = &panicBuf, &errBuf
+		}
+		if !strings.Contains(want.String(), "[PANIC /] caddyhttp/errors/errors_test.go") {
+			t.Errorf("Test %d: Expected panic to be logged, but log was: %q", i, want.String())
+		}
+		if other.Len() > 0 {
+			t.Errorf("Test %d: Expected nothing in other log, but got: %q", i, other.String())
+		}
+	}
 }
 
 func genErrorHandler(status int, err error, body string) httpserver.Handler {
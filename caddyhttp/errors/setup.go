@@ -58,6 +58,30 @@ func setup(c *caddy.Controller) error {
 		}
 
 		handler.Log = log.New(writer, "", 0)
+
+		// Recovered panics may be logged separately
+		switch handler.PanicLogFile {
+		case "":
+			handler.PanicLog = handler.Log
+		case "stdout":
+			handler.PanicLog = log.New(os.Stdout, "", 0)
+		case "stderr":
+			handler.PanicLog = log.New(os.Stderr, "", 0)
+		case "syslog":
+			writer, err = gsyslog.NewLogger(gsyslog.LOG_CRIT, "LOCAL0", "caddy")
+			if err != nil {
+				return err
+			}
+			handler.PanicLog = log.New(writer, "", 0)
+		default:
+			file, err := os.OpenFile(handler.PanicLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			handler.panicFile = file
+			handler.PanicLog = log.New(file, "", 0)
+		}
+
 		return nil
 	})
 
@@ -66,6 +90,9 @@ func setup(c *caddy.Controller) error {
 		if handler.file != nil {
 			handler.file.Close()
 		}
+		if handler.panicFile != nil {
+			handler.panicFile.Close()
+		}
 		return nil
 	})
 
@@ -81,23 +108,47 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 	// Very important that we make a pointer because the startup
 	// function that opens the log file must have access to the
 	// same instance of the handler, not a copy.
-	handler := &ErrorHandler{ErrorPages: make(map[int]string)}
+	handler := &ErrorHandler{
+		ErrorPages:      make(map[int]string),
+		RangeErrorPages: make(map[int]string),
+	}
 
 	cfg := httpserver.GetConfig(c)
 
-	optionalBlock := func() (bool, error) {
+	// optionalBlock parses the block of the errors directive, if
+	// there is one. If scope is not nil, the block is for a path,
+	// and the error pages in it are added to scope.
+	optionalBlock := func(scope *PathErrorPages) (bool, error) {
 		var hadBlock bool
 
 		for c.NextBlock() {
 			hadBlock = true
 
 			what := c.Val()
+			if scope != nil && (what == "json" || what == "recover_log" || what == "stack_trace" || what == "log") {
+				return hadBlock, c.Errf("Only error pages can be set for path '%s', got '%s'", scope.Path, what)
+			}
+			if what == "json" {
+				handler.JSON = true
+				continue
+			}
 			if !c.NextArg() {
 				return hadBlock, c.ArgErr()
 			}
 			where := c.Val()
 
-			if what == "log" {
+			if what == "recover_log" {
+				handler.PanicLogFile = where
+			} else if what == "stack_trace" {
+				switch where {
+				case "on":
+					handler.HideStackTrace = false
+				case "off":
+					handler.HideStackTrace = true
+				default:
+					return hadBlock, c.Errf("stack_trace must be on or off, got '%s'", where)
+				}
+			} else if what == "log" {
 				if where == "visible" {
 					handler.Debug = true
 				} else {
@@ -122,11 +173,29 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 				}
 				f.Close()
 
+				pages, rangePages, genericPage := handler.ErrorPages, handler.RangeErrorPages, &handler.GenericErrorPage
+				if scope != nil {
+					pages, rangePages, genericPage = scope.ErrorPages, scope.RangeErrorPages, &scope.GenericErrorPage
+				}
+
+				if what == "*" {
+					*genericPage = where
+					continue
+				}
+				if len(what) == 3 && what[1:] == "xx" {
+					class, err := strconv.Atoi(what[:1])
+					if err != nil || class < 1 || class > 5 {
+						return hadBlock, c.Err("Expecting a status code range like 4xx or 5xx, got '" + what + "'")
+					}
+					rangePages[class] = where
+					continue
+				}
+
 				whatInt, err := strconv.Atoi(what)
 				if err != nil {
 					return hadBlock, c.Err("Expecting a numeric status code, got '" + what + "'")
 				}
-				handler.ErrorPages[whatInt] = where
+				pages[whatInt] = where
 			}
 		}
 		return hadBlock, nil
@@ -137,20 +206,40 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 		if c.Val() == "}" {
 			continue
 		}
-		// Configuration may be in a block
-		hadBlock, err := optionalBlock()
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return handler, c.ArgErr()
+		}
+
+		// Configuration may be in a block, which is for
+		// the error pages of a path if one is given
+		var scope *PathErrorPages
+		if len(args) == 1 {
+			scope = &PathErrorPages{
+				Path:            args[0],
+				ErrorPages:      make(map[int]string),
+				RangeErrorPages: make(map[int]string),
+			}
+		}
+		hadBlock, err := optionalBlock(scope)
 		if err != nil {
 			return handler, err
 		}
+		if hadBlock && scope != nil {
+			for _, pages := range handler.PathErrorPages {
+				if pages.Path == scope.Path {
+					return handler, c.Errf("Duplicate error pages for path '%s'", scope.Path)
+				}
+			}
+			handler.PathErrorPages = append(handler.PathErrorPages, *scope)
+		}
 
 		// Otherwise, the only argument would be an error log file name or 'visible'
-		if !hadBlock {
-			if c.NextArg() {
-				if c.Val() == "visible" {
-					handler.Debug = true
-				} else {
-					handler.LogFile = c.Val()
-				}
+		if !hadBlock && len(args) == 1 {
+			if args[0] == "visible" {
+				handler.Debug = true
+			} else {
+				handler.LogFile = args[0]
 			}
 		}
 	}
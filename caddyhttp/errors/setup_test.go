@@ -1,6 +1,8 @@
 package errors
 
 import (
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -103,6 +105,50 @@ func TestErrorsParse(t *testing.T) {
 				LocalTime:  true,
 			},
 		}},
+		{`errors { log errors.txt
+        404 404.html
+        4xx 4xx.html
+        5xx 5xx.html
+        * generic.html
+}`, false, ErrorHandler{
+			LogFile: "errors.txt",
+			ErrorPages: map[int]string{
+				404: "404.html",
+			},
+			RangeErrorPages: map[int]string{
+				4: "4xx.html",
+				5: "5xx.html",
+			},
+			GenericErrorPage: "generic.html",
+		}},
+		{`errors { log errors.txt
+        recover_log panics.log
+}`, false, ErrorHandler{
+			LogFile:      "errors.txt",
+			PanicLogFile: "panics.log",
+		}},
+		{`errors { log visible
+        stack_trace off
+}`, false, ErrorHandler{
+			Debug:          true,
+			HideStackTrace: true,
+		}},
+		{`errors { stack_trace maybe }`, true, ErrorHandler{}},
+		{`errors { json }`, false, ErrorHandler{
+			JSON: true,
+		}},
+		{`errors { log errors.txt
+        json
+        404 404.html
+}`, false, ErrorHandler{
+			LogFile: "errors.txt",
+			JSON:    true,
+			ErrorPages: map[int]string{
+				404: "404.html",
+			},
+		}},
+		{`errors { 6xx 6xx.html }`, true, ErrorHandler{}},
+		{`errors { 4x 4x.html }`, true, ErrorHandler{}},
 	}
 	for i, test := range tests {
 		actualErrorsRule, err := errorsParse(caddy.NewTestController("http", test.inputErrorsRules))
@@ -120,6 +166,18 @@ func TestErrorsParse(t *testing.T) {
 			t.Errorf("Test %d expected Debug to be %v, but got %v",
 				i, test.expectedErrorHandler.Debug, actualErrorsRule.Debug)
 		}
+		if actualErrorsRule.PanicLogFile != test.expectedErrorHandler.PanicLogFile {
+			t.Errorf("Test %d expected PanicLogFile to be %s, but got %s",
+				i, test.expectedErrorHandler.PanicLogFile, actualErrorsRule.PanicLogFile)
+		}
+		if actualErrorsRule.HideStackTrace != test.expectedErrorHandler.HideStackTrace {
+			t.Errorf("Test %d expected HideStackTrace to be %v, but got %v",
+				i, test.expectedErrorHandler.HideStackTrace, actualErrorsRule.HideStackTrace)
+		}
+		if actualErrorsRule.JSON != test.expectedErrorHandler.JSON {
+			t.Errorf("Test %d expected JSON to be %v, but got %v",
+				i, test.expectedErrorHandler.JSON, actualErrorsRule.JSON)
+		}
 		if actualErrorsRule.LogRoller != nil && test.expectedErrorHandler.LogRoller == nil || actualErrorsRule.LogRoller == nil && test.expectedErrorHandler.LogRoller != nil {
 			t.Fatalf("Test %d expected LogRoller to be %v, but got %v",
 				i, test.expectedErrorHandler.LogRoller, actualErrorsRule.LogRoller)
@@ -128,6 +186,14 @@ func TestErrorsParse(t *testing.T) {
 			t.Fatalf("Test %d expected %d no of Error pages, but got %d ",
 				i, len(test.expectedErrorHandler.ErrorPages), len(actualErrorsRule.ErrorPages))
 		}
+		if len(actualErrorsRule.RangeErrorPages) != len(test.expectedErrorHandler.RangeErrorPages) {
+			t.Fatalf("Test %d expected %d no of range Error pages, but got %d ",
+				i, len(test.expectedErrorHandler.RangeErrorPages), len(actualErrorsRule.RangeErrorPages))
+		}
+		if actualErrorsRule.GenericErrorPage != test.expectedErrorHandler.GenericErrorPage {
+			t.Fatalf("Test %d expected GenericErrorPage to be %s, but got %s",
+				i, test.expectedErrorHandler.GenericErrorPage, actualErrorsRule.GenericErrorPage)
+		}
 		if actualErrorsRule.LogRoller != nil && test.expectedErrorHandler.LogRoller != nil {
 			if actualErrorsRule.LogRoller.Filename != test.expectedErrorHandler.LogRoller.Filename {
 				t.Fatalf("Test %d expected LogRoller Filename to be %s, but got %s",
@@ -153,3 +219,54 @@ func TestErrorsParse(t *testing.T) {
 	}
 
 }
+
+func TestErrorsParsePathErrorPages(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []PathErrorPages
+	}{
+		{`errors /api {
+			404 api/404.json
+			5xx api/5xx.json
+			* api/error.json
+		}
+		errors {
+			404 404.html
+		}`, false, []PathErrorPages{{
+			Path:             "/api",
+			ErrorPages:       map[int]string{404: filepath.Join("api", "404.json")},
+			RangeErrorPages:  map[int]string{5: filepath.Join("api", "5xx.json")},
+			GenericErrorPage: filepath.Join("api", "error.json"),
+		}}},
+		{`errors /api { 404 404.json }
+		errors /api/v2 { 404 v2.json }`, false, []PathErrorPages{
+			{Path: "/api", ErrorPages: map[int]string{404: "404.json"}, RangeErrorPages: map[int]string{}},
+			{Path: "/api/v2", ErrorPages: map[int]string{404: "v2.json"}, RangeErrorPages: map[int]string{}},
+		}},
+		{`errors /api { log errors.txt }`, true, nil},
+		{`errors /api { json }`, true, nil},
+		{`errors /api { 404 a.json }
+		errors /api { 500 b.json }`, true, nil},
+		{`errors /api errors.txt { 404 a.json }`, true, nil},
+	}
+	for i, test := range tests {
+		handler, err := errorsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(handler.PathErrorPages, test.expected) {
+			t.Errorf("Test %d expected PathErrorPages %+v, but got %+v", i, test.expected, handler.PathErrorPages)
+		}
+		if handler.LogFile != "" {
+			t.Errorf("Test %d expected no LogFile, but got %s", i, handler.LogFile)
+		}
+	}
+}
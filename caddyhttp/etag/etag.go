@@ -0,0 +1,34 @@
+package etag
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("etag", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupETag,
+	})
+}
+
+// setupETag turns the ETags of the responses that the site
+// generates itself, like static files, on or off.
+func setupETag(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		var toggle string
+		if !c.Args(&toggle) || c.NextArg() {
+			return c.ArgErr()
+		}
+		switch toggle {
+		case "on":
+			config.DisableETags = false
+		case "off":
+			config.DisableETags = true
+		default:
+			return c.Errf("etag must be 'on' or 'off', got '%s'", toggle)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package etag
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupETag(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  bool
+	}{
+		{`etag off`, false, true},
+		{`etag on`, false, false},
+		{`etag`, true, false},
+		{`etag off on`, true, false},
+		{`etag weak`, true, false},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupETag(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if got := httpserver.GetConfig(c).DisableETags; got != test.expected {
+			t.Errorf("Test %d: expected DisableETags %v, got %v", i, test.expected, got)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package expvar
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -44,3 +45,24 @@ func contentHandler(w http.ResponseWriter, r *http.Request) (int, error) {
 	fmt.Fprintf(w, r.URL.String())
 	return http.StatusOK, nil
 }
+
+func TestExpVarTrafficMetrics(t *testing.T) {
+	publishExtraVars()
+	httpserver.CountUpstream("localhost:9000", true)
+
+	rec := httptest.NewRecorder()
+	expvarHandler(rec, nil)
+
+	var vars struct {
+		Caddy httpserver.Metrics `json:"caddy"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Expected JSON output, got error: %v", err)
+	}
+	if _, ok := vars.Caddy.Responses["2xx"]; !ok {
+		t.Errorf("Expected response counts by status class, got %+v", vars.Caddy)
+	}
+	if up := vars.Caddy.Upstreams["localhost:9000"]; up.Successes < 1 {
+		t.Errorf("Expected upstream successes to be published, got %+v", vars.Caddy.Upstreams)
+	}
+}
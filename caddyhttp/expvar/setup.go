@@ -62,6 +62,12 @@ func publishExtraVars() {
 		expvar.Publish("Goroutines", expvar.Func(func() interface{} {
 			return runtime.NumGoroutine()
 		}))
+
+		// the traffic of the HTTP servers and their upstreams
+		httpserver.EnableMetrics()
+		expvar.Publish("caddy", expvar.Func(func() interface{} {
+			return httpserver.CurrentMetrics()
+		}))
 	})
 }
 
@@ -30,6 +30,11 @@ type Ext struct {
 
 // ServeHTTP implements the httpserver.Handler interface.
 func (e Ext) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		e.Root = root
+	}
+
 	urlpath := strings.TrimSuffix(r.URL.Path, "/")
 	if path.Ext(urlpath) == "" && len(r.URL.Path) > 0 && r.URL.Path[len(r.URL.Path)-1] != '/' {
 		for _, ext := range e.Extensions {
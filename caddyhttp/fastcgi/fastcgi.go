@@ -6,12 +6,14 @@ package fastcgi
 import (
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -33,6 +35,15 @@ type Handler struct {
 
 // ServeHTTP satisfies the httpserver.Handler interface.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		h.Root, h.AbsRoot, h.FileSys = root, absRoot, http.Dir(root)
+	}
+
 	for _, rule := range h.Rules {
 
 		// First requirement: Base path must match and the path must be allowed.
@@ -73,10 +84,13 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 
 			// Connect to FastCGI gateway
 			network, address := rule.parseAddress()
-			fcgiBackend, err := Dial(network, address)
+			fcgiBackend, err := DialWithDialer(network, address, net.Dialer{Timeout: rule.ConnectTimeout})
 			if err != nil {
-				return http.StatusBadGateway, err
+				return gatewayStatus(err), err
 			}
+			defer fcgiBackend.Close()
+			fcgiBackend.SetReadTimeout(rule.ReadTimeout)
+			fcgiBackend.SetSendTimeout(rule.SendTimeout)
 
 			var resp *http.Response
 			contentLength, _ := strconv.Atoi(r.Header.Get("Content-Length"))
@@ -91,12 +105,12 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 				resp, err = fcgiBackend.Post(env, r.Method, r.Header.Get("Content-Type"), r.Body, contentLength)
 			}
 
-			if resp.Body != nil {
+			if resp != nil && resp.Body != nil {
 				defer resp.Body.Close()
 			}
 
 			if err != nil && err != io.EOF {
-				return http.StatusBadGateway, err
+				return gatewayStatus(err), err
 			}
 
 			// Write response header
@@ -105,7 +119,7 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 			// Write the response body
 			_, err = io.Copy(w, resp.Body)
 			if err != nil {
-				return http.StatusBadGateway, err
+				return gatewayStatus(err), err
 			}
 
 			// Log any stderr output from upstream
@@ -127,6 +141,15 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	return h.Next.ServeHTTP(w, r)
 }
 
+// gatewayStatus returns the status with which to fail
+// a request after talking to the FastCGI server failed.
+func gatewayStatus(err error) int {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
 // parseAddress returns the network and address of r.
 // The first string is the network, "tcp" or "unix", implied from the scheme and address.
 // The second string is r.Address, with scheme prefixes removed.
@@ -140,11 +163,11 @@ func (r Rule) parseAddress() (string, string) {
 	if strings.HasPrefix(r.Address, "fastcgi://") {
 		return "tcp", r.Address[len("fastcgi://"):]
 	}
-	// check if unix socket
-	if trim := strings.HasPrefix(r.Address, "unix"); strings.HasPrefix(r.Address, "/") || trim {
-		if trim {
-			return "unix", r.Address[len("unix:"):]
-		}
+	// check if unix socket; a host name may start with "unix" too
+	if strings.HasPrefix(r.Address, "unix:") {
+		return "unix", r.Address[len("unix:"):]
+	}
+	if strings.HasPrefix(r.Address, "/") {
 		return "unix", r.Address
 	}
 	// default case, a plain tcp address with no scheme
@@ -254,20 +277,24 @@ func (h Handler) buildEnv(r *http.Request, rule Rule, fpath string) (map[string]
 		env["HTTPS"] = "on"
 	}
 
-	replacer := httpserver.NewReplacer(r, nil, "")
-	// Add env variables from config
-	for _, envVar := range rule.EnvVars {
-		// replace request placeholders in environment variables
-		env[envVar[0]] = replacer.Replace(envVar[1])
-	}
-
-	// Add all HTTP headers to env variables
+	// Add all HTTP headers to env variables, without
+	// replacing any of the variables set above
 	for field, val := range r.Header {
 		header := strings.ToUpper(field)
 		header = headerNameReplacer.Replace(header)
+		if _, ok := env["HTTP_"+header]; ok {
+			continue
+		}
 		env["HTTP_"+header] = strings.Join(val, ", ")
 	}
 
+	replacer := httpserver.NewReplacer(r, nil, "")
+	// Add env variables from config last; they take precedence
+	for _, envVar := range rule.EnvVars {
+		// replace request placeholders in environment variables
+		env[envVar[0]] = replacer.Replace(envVar[1])
+	}
+
 	return env, nil
 }
 
@@ -297,6 +324,16 @@ type Rule struct {
 
 	// Ignored paths
 	IgnoredSubPaths []string
+
+	// How long to wait for a connection to the FastCGI server.
+	// Zero means no timeout.
+	ConnectTimeout time.Duration
+
+	// How long to wait for each read from, or write to, the FastCGI
+	// server, so a slow script only fails if it stays silent for
+	// this long. Zero means no timeout.
+	ReadTimeout time.Duration
+	SendTimeout time.Duration
 }
 
 // canSplit checks if path can split into two based on rule.SplitPath.
@@ -323,6 +360,36 @@ func (r Rule) AllowedPath(requestPath string) bool {
 	return true
 }
 
+// reservedEnv contains the names of the variables that buildEnv
+// computes for every request. Configured env variables can replace
+// them, but doing so is usually a mistake, so it is warned about.
+var reservedEnv = map[string]bool{
+	"AUTH_TYPE":         true,
+	"CONTENT_LENGTH":    true,
+	"CONTENT_TYPE":      true,
+	"GATEWAY_INTERFACE": true,
+	"PATH_INFO":         true,
+	"PATH_TRANSLATED":   true,
+	"QUERY_STRING":      true,
+	"REMOTE_ADDR":       true,
+	"REMOTE_HOST":       true,
+	"REMOTE_PORT":       true,
+	"REMOTE_IDENT":      true,
+	"REMOTE_USER":       true,
+	"REQUEST_METHOD":    true,
+	"SERVER_NAME":       true,
+	"SERVER_PORT":       true,
+	"SERVER_PROTOCOL":   true,
+	"SERVER_SOFTWARE":   true,
+	"DOCUMENT_ROOT":     true,
+	"DOCUMENT_URI":      true,
+	"HTTP_HOST":         true,
+	"HTTPS":             true,
+	"REQUEST_URI":       true,
+	"SCRIPT_FILENAME":   true,
+	"SCRIPT_NAME":       true,
+}
+
 var (
 	headerNameReplacer = strings.NewReplacer(" ", "_", "-", "_")
 	// ErrIndexMissingSplit describes an index configuration error.
@@ -1,13 +1,20 @@
 package fastcgi
 
 import (
+	"context"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/fcgi"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func TestServeHTTP(t *testing.T) {
@@ -50,6 +57,115 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestServeHTTPRequestRoot(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to create listener for test: %v", err)
+	}
+	defer listener.Close()
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := fcgi.ProcessEnv(r)
+		w.Write([]byte(env["SCRIPT_FILENAME"] + " " + env["DOCUMENT_ROOT"]))
+	}))
+
+	handler := Handler{
+		Rules:   []Rule{{Path: "/", Address: listener.Addr().String(), Ext: ".php", SplitPath: ".php"}},
+		Root:    "/sites/{host}/public",
+		AbsRoot: "/sites/{host}/public",
+		FileSys: http.Dir("/sites/{host}/public"),
+	}
+
+	// the server fills in the root for each request
+	for _, host := range []string{"a.example", "b.example"} {
+		root := filepath.Join(string(filepath.Separator), "sites", host, "public")
+		r := httptest.NewRequest("GET", "/index.php", nil)
+		r.Host = host
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.RootCtxKey, root))
+		w := httptest.NewRecorder()
+
+		if _, err := handler.ServeHTTP(w, r); err != nil {
+			t.Errorf("%s: Expected nil error, got: %v", host, err)
+		}
+		expected := filepath.Join(root, "index.php") + " " + root
+		if got := w.Body.String(); got != expected {
+			t.Errorf("%s: Expected SCRIPT_FILENAME and DOCUMENT_ROOT '%s', got '%s'", host, expected, got)
+		}
+	}
+}
+
+func TestServeHTTPUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_fastcgi_test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "php-fpm.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unable to create listener for test: %v", err)
+	}
+	defer listener.Close()
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fcgi.ProcessEnv(r)["SCRIPT_FILENAME"]))
+	}))
+
+	handler := Handler{
+		Next:    nil,
+		Rules:   []Rule{{Path: "/", Address: "unix:" + socket, Ext: ".php", SplitPath: ".php"}},
+		Root:    "/var/www",
+		AbsRoot: "/var/www",
+	}
+	r, err := http.NewRequest("GET", "/index.php", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+
+	status, err := handler.ServeHTTP(w, r)
+
+	if got, want := status, 0; got != want {
+		t.Errorf("Expected returned status code to be %d, got %d", want, got)
+	}
+	if err != nil {
+		t.Errorf("Expected nil error, got: %v", err)
+	}
+	if got, want := w.Body.String(), filepath.Join("/var/www", "index.php"); got != want {
+		t.Errorf("Expected SCRIPT_FILENAME to be '%s', got: '%s'", want, got)
+	}
+}
+
+func TestServeHTTPReadTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to create listener for test: %v", err)
+	}
+	defer listener.Close()
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("Too late"))
+	}))
+
+	handler := Handler{
+		Next:  nil,
+		Rules: []Rule{{Path: "/", Address: listener.Addr().String(), ReadTimeout: 20 * time.Millisecond}},
+	}
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+
+	status, err := handler.ServeHTTP(w, r)
+
+	if got, want := status, http.StatusGatewayTimeout; got != want {
+		t.Errorf("Expected returned status code to be %d, got %d", want, got)
+	}
+	if err == nil {
+		t.Error("Expected a timeout error, got nil")
+	}
+}
+
 func TestRuleParseAddress(t *testing.T) {
 	getClientTestTable := []struct {
 		rule            *Rule
@@ -61,6 +177,7 @@ func TestRuleParseAddress(t *testing.T) {
 		{&Rule{Address: "172.17.0.15"}, "tcp", "172.17.0.15"},
 		{&Rule{Address: "/my/unix/socket"}, "unix", "/my/unix/socket"},
 		{&Rule{Address: "unix:/second/unix/socket"}, "unix", "/second/unix/socket"},
+		{&Rule{Address: "unixhost:9000"}, "tcp", "unixhost:9000"},
 	}
 
 	for _, entry := range getClientTestTable {
@@ -196,4 +313,17 @@ func TestBuildEnv(t *testing.T) {
 	envExpected["CUSTOM_URI"] = "custom_uri/fgci_test.php?test=blabla"
 	envExpected["CUSTOM_QUERY"] = "custom=true&test=blabla"
 	testBuildEnv(r, rule, fpath, envExpected)
+
+	// 6. Test that request headers don't replace other variables
+	r = newReq()
+	r.Header = http.Header{"App-Env": {"development"}, "X-Forwarded-User": {"bob"}}
+	rule.EnvVars = [][2]string{
+		{"HTTP_APP_ENV", "production"},
+		{"REMOTE_USER", "{>X-Forwarded-User}"},
+	}
+	envExpected = newEnv()
+	envExpected["HTTP_APP_ENV"] = "production"
+	envExpected["HTTP_X_FORWARDED_USER"] = "bob"
+	envExpected["REMOTE_USER"] = "bob"
+	testBuildEnv(r, rule, fpath, envExpected)
 }
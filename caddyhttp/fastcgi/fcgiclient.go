@@ -28,6 +28,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // FCGIListenSockFileno describes listen socket file number.
@@ -160,13 +161,15 @@ func (rec *record) read(r io.Reader) (buf []byte, err error) {
 // FCGIClient implements a FastCGI client, which is a standard for
 // interfacing external applications with Web servers.
 type FCGIClient struct {
-	mutex     sync.Mutex
-	rwc       io.ReadWriteCloser
-	h         header
-	buf       bytes.Buffer
-	stderr    bytes.Buffer
-	keepAlive bool
-	reqID     uint16
+	mutex       sync.Mutex
+	rwc         io.ReadWriteCloser
+	h           header
+	buf         bytes.Buffer
+	stderr      bytes.Buffer
+	keepAlive   bool
+	reqID       uint16
+	readTimeout time.Duration
+	sendTimeout time.Duration
 }
 
 // DialWithDialer connects to the fcgi responder at the specified network address, using custom net.Dialer.
@@ -193,6 +196,18 @@ func Dial(network, address string) (fcgi *FCGIClient, err error) {
 	return DialWithDialer(network, address, net.Dialer{})
 }
 
+// SetReadTimeout sets how long to wait for each read from the fcgi
+// responder. A zero value means reads don't time out.
+func (c *FCGIClient) SetReadTimeout(t time.Duration) {
+	c.readTimeout = t
+}
+
+// SetSendTimeout sets how long to wait for each write to the fcgi
+// responder. A zero value means writes don't time out.
+func (c *FCGIClient) SetSendTimeout(t time.Duration) {
+	c.sendTimeout = t
+}
+
 // Close closes fcgi connnection
 func (c *FCGIClient) Close() {
 	c.rwc.Close()
@@ -212,6 +227,11 @@ func (c *FCGIClient) writeRecord(recType uint8, content []byte) (err error) {
 	if _, err := c.buf.Write(pad[:c.h.PaddingLength]); err != nil {
 		return err
 	}
+	if conn, ok := c.rwc.(net.Conn); ok && c.sendTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(c.sendTimeout)); err != nil {
+			return err
+		}
+	}
 	_, err = c.rwc.Write(c.buf.Bytes())
 	return err
 }
@@ -355,6 +375,11 @@ func (w *streamReader) Read(p []byte) (n int, err error) {
 
 			// filter outputs for error log
 			for {
+				if conn, ok := w.c.rwc.(net.Conn); ok && w.c.readTimeout > 0 {
+					if err = conn.SetReadDeadline(time.Now().Add(w.c.readTimeout)); err != nil {
+						return
+					}
+				}
 				rec := &record{}
 				var buf []byte
 				buf, err = rec.read(w.c.rwc)
@@ -397,9 +422,13 @@ func (c *FCGIClient) Do(p map[string]string, req io.Reader) (r io.Reader, err er
 
 	body := newWriter(c, Stdin)
 	if req != nil {
-		io.Copy(body, req)
+		if _, err = io.Copy(body, req); err != nil {
+			return
+		}
+	}
+	if err = body.Close(); err != nil {
+		return
 	}
-	body.Close()
 
 	r = &streamReader{c: c}
 	return
@@ -2,8 +2,10 @@ package fastcgi
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -50,7 +52,11 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 	var rules []Rule
 
 	for c.Next() {
-		var rule Rule
+		rule := Rule{
+			ConnectTimeout: 60 * time.Second,
+			ReadTimeout:    60 * time.Second,
+			SendTimeout:    60 * time.Second,
+		}
 
 		args := c.RemainingArgs()
 
@@ -92,9 +98,12 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 				rule.IndexFiles = args
 			case "env":
 				envArgs := c.RemainingArgs()
-				if len(envArgs) < 2 {
+				if len(envArgs) != 2 {
 					return rules, c.ArgErr()
 				}
+				if reservedEnv[envArgs[0]] {
+					log.Printf("[WARNING] fastcgi: env %s replaces the value computed for each request", envArgs[0])
+				}
 				rule.EnvVars = append(rule.EnvVars, [2]string{envArgs[0], envArgs[1]})
 			case "except":
 				ignoredPaths := c.RemainingArgs()
@@ -102,6 +111,26 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 					return rules, c.ArgErr()
 				}
 				rule.IgnoredSubPaths = ignoredPaths
+			case "connect_timeout", "read_timeout", "send_timeout":
+				what := c.Val()
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return rules, c.Errf("invalid %s '%s': %v", what, c.Val(), err)
+				}
+				if timeout < 0 {
+					return rules, c.Errf("%s must not be negative, got '%s'", what, c.Val())
+				}
+				switch what {
+				case "connect_timeout":
+					rule.ConnectTimeout = timeout
+				case "read_timeout":
+					rule.ReadTimeout = timeout
+				case "send_timeout":
+					rule.SendTimeout = timeout
+				}
 			}
 		}
 
@@ -3,6 +3,7 @@ package fastcgi
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -50,6 +51,32 @@ func TestFastcgiParse(t *testing.T) {
 				SplitPath:  ".php",
 				IndexFiles: []string{"index.php"},
 			}}},
+		{`fastcgi / unix:/run/php/php-fpm.sock php`,
+			false, []Rule{{
+				Path:       "/",
+				Address:    "unix:/run/php/php-fpm.sock",
+				Ext:        ".php",
+				SplitPath:  ".php",
+				IndexFiles: []string{"index.php"},
+			}}},
+		{`fastcgi / 127.0.0.1:9001 {
+	              env APP_ENV production
+	              env QUERY "{query}"
+	              }`,
+			false, []Rule{{
+				Path:       "/",
+				Address:    "127.0.0.1:9001",
+				IndexFiles: []string{},
+				EnvVars:    [][2]string{{"APP_ENV", "production"}, {"QUERY", "{query}"}},
+			}}},
+		{`fastcgi / 127.0.0.1:9001 {
+	              env APP_ENV
+	              }`,
+			true, []Rule{}},
+		{`fastcgi / 127.0.0.1:9001 {
+	              env APP_ENV production staging
+	              }`,
+			true, []Rule{}},
 		{`fastcgi / 127.0.0.1:9001 {
 	              split .html
 	              }`,
@@ -112,6 +139,11 @@ func TestFastcgiParse(t *testing.T) {
 					i, j, test.expectedFastcgiConfig[j].IndexFiles, actualFastcgiConfig.IndexFiles)
 			}
 
+			if fmt.Sprint(actualFastcgiConfig.EnvVars) != fmt.Sprint(test.expectedFastcgiConfig[j].EnvVars) {
+				t.Errorf("Test %d expected %dth FastCGI EnvVars to be  %s  , but got %s",
+					i, j, test.expectedFastcgiConfig[j].EnvVars, actualFastcgiConfig.EnvVars)
+			}
+
 			if fmt.Sprint(actualFastcgiConfig.IgnoredSubPaths) != fmt.Sprint(test.expectedFastcgiConfig[j].IgnoredSubPaths) {
 				t.Errorf("Test %d expected %dth FastCGI IgnoredSubPaths to be  %s  , but got %s",
 					i, j, test.expectedFastcgiConfig[j].IgnoredSubPaths, actualFastcgiConfig.IgnoredSubPaths)
@@ -120,3 +152,50 @@ func TestFastcgiParse(t *testing.T) {
 	}
 
 }
+
+func TestFastcgiParseTimeouts(t *testing.T) {
+	tests := []struct {
+		input                  string
+		shouldErr              bool
+		expectedConnectTimeout time.Duration
+		expectedReadTimeout    time.Duration
+		expectedSendTimeout    time.Duration
+	}{
+		{`fastcgi / 127.0.0.1:9000`, false, 60 * time.Second, 60 * time.Second, 60 * time.Second},
+		{`fastcgi / 127.0.0.1:9000 {
+			connect_timeout 5s
+			read_timeout 5m
+			send_timeout 0s
+		}`, false, 5 * time.Second, 5 * time.Minute, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			read_timeout
+		}`, true, 0, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			read_timeout forever
+		}`, true, 0, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			connect_timeout -1s
+		}`, true, 0, 0, 0},
+	}
+	for i, test := range tests {
+		rules, err := fastcgiParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if rules[0].ConnectTimeout != test.expectedConnectTimeout {
+			t.Errorf("Test %d: Expected ConnectTimeout %v, got %v", i, test.expectedConnectTimeout, rules[0].ConnectTimeout)
+		}
+		if rules[0].ReadTimeout != test.expectedReadTimeout {
+			t.Errorf("Test %d: Expected ReadTimeout %v, got %v", i, test.expectedReadTimeout, rules[0].ReadTimeout)
+		}
+		if rules[0].SendTimeout != test.expectedSendTimeout {
+			t.Errorf("Test %d: Expected SendTimeout %v, got %v", i, test.expectedSendTimeout, rules[0].SendTimeout)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package grace
+
+import (
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("grace", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupGrace,
+	})
+}
+
+// setupGrace sets how long the server of the site waits for
+// active connections to finish when it is stopped or reloaded.
+func setupGrace(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		var period string
+		if !c.Args(&period) || c.NextArg() {
+			return c.ArgErr()
+		}
+		d, err := time.ParseDuration(period)
+		if err != nil {
+			return c.Errf("invalid grace period '%s': %v", period, err)
+		}
+		if d <= 0 {
+			return c.Errf("grace period must be positive, got %s", period)
+		}
+		config.GracePeriod = d
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package grace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupGrace(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  time.Duration
+	}{
+		{`grace 30s`, false, 30 * time.Second},
+		{`grace 1m30s`, false, 90 * time.Second},
+		{`grace`, true, 0},
+		{`grace 30s 1m`, true, 0},
+		{`grace thirty`, true, 0},
+		{`grace 0s`, true, 0},
+		{`grace -5s`, true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupGrace(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if got := httpserver.GetConfig(c).GracePeriod; got != test.expected {
+			t.Errorf("Test %d: expected grace period %v, got %v", i, test.expected, got)
+		}
+	}
+}
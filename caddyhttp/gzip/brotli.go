@@ -0,0 +1,54 @@
+package gzip
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Brotli is a middleware type which compresses HTTP responses
+// with brotli for clients that prefer it to gzip. It accepts the
+// same configuration as Gzip. Requests it does not compress are
+// passed on unchanged, so gzip may still compress them.
+type Brotli struct {
+	Next    httpserver.Handler
+	Configs []Config
+}
+
+// ServeHTTP serves a brotli-compressed response if the client
+// supports it and does not prefer gzip.
+func (b Brotli) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !prefersBrotli(r.Header.Get("Accept-Encoding")) {
+		return b.Next.ServeHTTP(w, r)
+	}
+	return compress(w, r, b.Next, b.Configs, "br")
+}
+
+// prefersBrotli returns true if the Accept-Encoding header
+// value acceptEncoding accepts br with a q-value at least as
+// high as that of gzip.
+func prefersBrotli(acceptEncoding string) bool {
+	var brQ, gzipQ float64
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		switch coding {
+		case "br":
+			brQ = q
+		case "gzip":
+			gzipQ = q
+		}
+	}
+	return brQ > 0 && brQ >= gzipQ
+}
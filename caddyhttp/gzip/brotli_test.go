@@ -0,0 +1,90 @@
+package gzip
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestPrefersBrotli(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		{"", false},
+		{"gzip", false},
+		{"br", true},
+		{"gzip, deflate, br", true},
+		{"gzip;q=1.0, br;q=0.8", false},
+		{"gzip;q=0.5, br", true},
+		{"br;q=0", false},
+		{"BR ; q=0.9, gzip;q=0.9", true},
+	}
+	for i, test := range tests {
+		if actual := prefersBrotli(test.acceptEncoding); actual != test.expected {
+			t.Errorf("Test %d: prefersBrotli(%q) = %v, expected %v",
+				i, test.acceptEncoding, actual, test.expected)
+		}
+	}
+}
+
+func TestBrotliHandler(t *testing.T) {
+	const body = "brotli brotli brotli brotli brotli brotli brotli"
+	br := Brotli{
+		Configs: []Config{{RequestFilters: []RequestFilter{DefaultExtFilter()}}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(body))
+			return 0, nil
+		}),
+	}
+
+	tests := []struct {
+		acceptEncoding   string
+		expectedEncoding string
+	}{
+		{"gzip, br", "br"},
+		{"br;q=0.5, gzip", ""},
+		{"gzip", ""},
+	}
+	for i, test := range tests {
+		r, err := http.NewRequest("GET", "/file.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+
+		if _, err := br.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+
+		if got := w.Header().Get("Content-Encoding"); got != test.expectedEncoding {
+			t.Errorf("Test %d: Expected Content-Encoding %q, got %q", i, test.expectedEncoding, got)
+		}
+		if test.expectedEncoding == "" {
+			if r.Header.Get("Accept-Encoding") == "" {
+				t.Errorf("Test %d: Expected Accept-Encoding to be left for gzip", i)
+			}
+			if w.Body.String() != body {
+				t.Errorf("Test %d: Expected uncompressed body %q, got %q", i, body, w.Body.String())
+			}
+			continue
+		}
+
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Test %d: Expected Vary to be Accept-Encoding, got %q", i, got)
+		}
+		decoded, err := ioutil.ReadAll(brotli.NewReader(w.Body))
+		if err != nil {
+			t.Fatalf("Test %d: Could not decode brotli body: %v", i, err)
+		}
+		if string(decoded) != body {
+			t.Errorf("Test %d: Expected decoded body %q, got %q", i, body, decoded)
+		}
+	}
+}
@@ -1,19 +1,23 @@
 // Package gzip provides a middleware layer that performs
-// gzip compression on the response.
+// gzip (or brotli) compression on the response.
 package gzip
 
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 
+	"github.com/andybalholm/brotli"
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
 )
 
 func init() {
@@ -21,6 +25,10 @@ func init() {
 		ServerType: "http",
 		Action:     setup,
 	})
+	caddy.RegisterPlugin("brotli", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupBrotli,
+	})
 }
 
 // Gzip is a middleware type which gzips HTTP responses. It is
@@ -36,7 +44,8 @@ type Gzip struct {
 type Config struct {
 	RequestFilters  []RequestFilter
 	ResponseFilters []ResponseFilter
-	Level           int // Compression level
+	Level           int  // Compression level
+	Precompressed   bool // Serve pre-compressed sibling files if they exist
 }
 
 // ServeHTTP serves a gzipped response if the client supports it.
@@ -44,46 +53,59 @@ func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 		return g.Next.ServeHTTP(w, r)
 	}
+	return compress(w, r, g.Next, g.Configs, "gzip")
+}
+
+// compress serves a response compressed with encoding if one of
+// the configs permits it, otherwise it just calls next. If the
+// config allows it, the file server is told that it may serve
+// files that are already compressed with encoding.
+func compress(w http.ResponseWriter, r *http.Request, next httpserver.Handler,
+	configs []Config, encoding string) (int, error) {
 outer:
-	for _, c := range g.Configs {
+	for _, c := range configs {
 
-		// Check request filters to determine if gzipping is permitted for this request
+		// Check request filters to determine if compression is permitted for this request
 		for _, filter := range c.RequestFilters {
 			if !filter.ShouldCompress(r) {
 				continue outer
 			}
 		}
 
-		// Delete this header so gzipping is not repeated later in the chain
+		// Delete this header so compression is not repeated later in the chain
 		r.Header.Del("Accept-Encoding")
 
-		// gzipWriter modifies underlying writer at init,
-		// use a discard writer instead to leave ResponseWriter in
-		// original form.
-		gzipWriter, err := newWriter(c, ioutil.Discard)
-		if err != nil {
-			// should not happen
-			return http.StatusInternalServerError, err
+		// Let the file server prefer a file that was compressed ahead
+		// of time; it is served at the end of the chain, after the
+		// other middleware had its say, and passed through as is
+		if c.Precompressed {
+			r = r.WithContext(context.WithValue(r.Context(), staticfiles.PrecompressedCtxKey, encoding))
 		}
-		defer gzipWriter.Close()
-		gz := &gzipResponseWriter{Writer: gzipWriter, ResponseWriter: w}
+
+		// compressWriter modifies underlying writer at init,
+		// use a discard writer instead to leave ResponseWriter in
+		// original form. It is replaced with the ResponseWriter
+		// once the response turns out to be compressible.
+		compressWriter := newWriter(c, encoding, ioutil.Discard)
+		defer closeWriter(c, compressWriter)
+		gz := &gzipResponseWriter{Writer: compressWriter, ResponseWriter: w, encoding: encoding}
 
 		var rw http.ResponseWriter
 		// if no response filter is used
 		if len(c.ResponseFilters) == 0 {
-			// replace discard writer with ResponseWriter
-			gzipWriter.Reset(w)
 			rw = gz
 		} else {
-			// wrap gzip writer with ResponseFilterWriter
-			rw = NewResponseFilterWriter(c.ResponseFilters, gz)
+			// wrap compress writer with ResponseFilterWriter
+			rfw := NewResponseFilterWriter(c.ResponseFilters, gz)
+			defer rfw.Close()
+			rw = rfw
 		}
 
 		// Any response in forward middleware will now be compressed
-		status, err := g.Next.ServeHTTP(rw, r)
+		status, err := next.ServeHTTP(rw, r)
 
 		// If there was an error that remained unhandled, we need
-		// to send something back before gzipWriter gets closed at
+		// to send something back before compressWriter gets closed at
 		// the return of this method!
 		if status >= 400 {
 			httpserver.DefaultErrorFunc(w, r, status)
@@ -93,35 +115,112 @@ outer:
 	}
 
 	// no matching filter
-	return g.Next.ServeHTTP(w, r)
+	return next.ServeHTTP(w, r)
+}
+
+// weakenETag makes a strong ETag in h weak. A strong ETag promises
+// the same bytes for the same tag, which doesn't hold anymore when
+// the body is compressed, while a weak ETag only promises the same
+// content, so conditional requests still work with it.
+func weakenETag(h http.Header) {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+// compressWriter is a writer that compresses its output
+// and can be reset to write to a different destination.
+type compressWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+	Flush() error
 }
 
-// newWriter create a new Gzip Writer based on the compression level.
-// If the level is valid (i.e. between 1 and 9), it uses the level.
+// gzipWriterPools holds a pool of gzip.Writers for
+// each compression level.
+var gzipWriterPools = make(map[int]*sync.Pool)
+
+func init() {
+	levels := []int{gzip.DefaultCompression}
+	for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+		levels = append(levels, level)
+	}
+	for _, level := range levels {
+		level := level
+		gzipWriterPools[level] = &sync.Pool{
+			New: func() interface{} {
+				w, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+				return w
+			},
+		}
+	}
+}
+
+// gzipLevel returns the gzip compression level of c. If the
+// level is valid (i.e. between 1 and 9), it uses the level.
 // Otherwise, it uses default compression level.
-func newWriter(c Config, w io.Writer) (*gzip.Writer, error) {
+func gzipLevel(c Config) int {
 	if c.Level >= gzip.BestSpeed && c.Level <= gzip.BestCompression {
-		return gzip.NewWriterLevel(w, c.Level)
+		return c.Level
+	}
+	return gzip.DefaultCompression
+}
+
+// newWriter create a new Writer for encoding based on the compression
+// level. If the level is valid for the encoding (i.e. between 1 and 9
+// for gzip, or between 1 and 11 for brotli), it uses the level.
+// Otherwise, it uses default compression level. Gzip writers come
+// from a pool and should be released with closeWriter.
+func newWriter(c Config, encoding string, w io.Writer) compressWriter {
+	if encoding == "br" {
+		if c.Level >= 1 && c.Level <= brotli.BestCompression {
+			return brotli.NewWriterLevel(w, c.Level)
+		}
+		return brotli.NewWriter(w)
+	}
+	gw := gzipWriterPools[gzipLevel(c)].Get().(*gzip.Writer)
+	gw.Reset(w)
+	return gw
+}
+
+// closeWriter closes cw, which was obtained from newWriter
+// with c, and returns it to its pool if it has one.
+func closeWriter(c Config, cw compressWriter) {
+	cw.Close()
+	if gw, ok := cw.(*gzip.Writer); ok {
+		gzipWriterPools[gzipLevel(c)].Put(gw)
 	}
-	return gzip.NewWriter(w), nil
 }
 
 // gzipResponeWriter wraps the underlying Write method
-// with a gzip.Writer to compress the output.
+// with a gzip.Writer (or other compressWriter) to compress
+// the output.
 type gzipResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
 	statusCodeWritten bool
+	encoding          string // value of the Content-Encoding header
+	passThrough       bool   // true if the response is written as is
 }
 
 // WriteHeader wraps the underlying WriteHeader method to prevent
 // problems with conflicting headers from proxied backends. For
 // example, a backend system that calculates Content-Length would
-// be wrong because it doesn't know it's being gzipped.
+// be wrong because it doesn't know it's being gzipped. Responses
+// that must not be compressed are passed through untouched.
 func (w *gzipResponseWriter) WriteHeader(code int) {
-	w.Header().Del("Content-Length")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Add("Vary", "Accept-Encoding")
+	if mustNotCompress(w.Header()) {
+		w.passThrough = true
+	} else {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", w.encoding)
+		httpserver.AddVary(w.Header(), "Accept-Encoding")
+		weakenETag(w.Header())
+		// replace discard writer with ResponseWriter
+		if cw, ok := w.Writer.(compressWriter); ok {
+			cw.Reset(w.ResponseWriter)
+		}
+	}
 	w.ResponseWriter.WriteHeader(code)
 	w.statusCodeWritten = true
 }
@@ -134,10 +233,30 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	if !w.statusCodeWritten {
 		w.WriteHeader(http.StatusOK)
 	}
+	if w.passThrough {
+		return w.ResponseWriter.Write(b)
+	}
 	n, err := w.Writer.Write(b)
 	return n, err
 }
 
+// mustNotCompress returns true if the response with header h is
+// encoded already, or must not be transformed according to its
+// Cache-Control header, so compressing it would break it.
+func mustNotCompress(h http.Header) bool {
+	if ce := h.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+		return true
+	}
+	for _, line := range h["Cache-Control"] {
+		for _, directive := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-transform") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Hijack implements http.Hijacker. It simply wraps the underlying
 // ResponseWriter's Hijack method if there is one, or returns an error.
 func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -147,14 +266,35 @@ func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("not a Hijacker")
 }
 
-// Flush implements http.Flusher. It simply wraps the underlying
-// ResponseWriter's Flush method if there is one, or panics.
+// Flush implements http.Flusher. It flushes what the compressor
+// holds back, if the response is being compressed, and then the
+// underlying ResponseWriter if it is a Flusher, or panics.
 func (w *gzipResponseWriter) Flush() {
-	if f, ok := w.ResponseWriter.(http.Flusher); ok {
-		f.Flush()
-	} else {
+	f, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
 		panic("not a Flusher") // should be recovered at the beginning of middleware stack
 	}
+	if !w.statusCodeWritten {
+		// the header goes out with the flush, so it must say
+		// if the body is compressed first
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passThrough {
+		if cw, ok := w.Writer.(compressWriter); ok {
+			cw.Flush()
+		}
+	}
+	f.Flush()
+}
+
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (w *gzipResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
 }
 
 // CloseNotify implements http.CloseNotifier.
@@ -1,14 +1,23 @@
 package gzip
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/andybalholm/brotli"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
 )
 
 func TestGzipHandler(t *testing.T) {
@@ -120,3 +129,335 @@ func nextFunc(shouldGzip bool) httpserver.Handler {
 		return 0, nil
 	})
 }
+
+func TestGzipKeepsVary(t *testing.T) {
+	gz := Gzip{Configs: []Config{{}}}
+
+	tests := []struct {
+		vary     []string
+		expected []string
+	}{
+		{nil, []string{"Accept-Encoding"}},
+		{[]string{"Cookie"}, []string{"Cookie", "Accept-Encoding"}},
+		{[]string{"Cookie, accept-encoding"}, []string{"Cookie, accept-encoding"}},
+		{[]string{"Accept-Encoding", "Cookie"}, []string{"Accept-Encoding", "Cookie"}},
+		{[]string{"*"}, []string{"*"}},
+	}
+	for i, test := range tests {
+		gz.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			for _, v := range test.vary {
+				w.Header().Add("Vary", v)
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("compress me"))
+			return 0, nil
+		})
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if _, err := gz.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Test %d: Expected response to be compressed, got Content-Encoding %q", i, got)
+		}
+		if got := w.Header()["Vary"]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected Vary %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestGzipWeakensETag(t *testing.T) {
+	gz := Gzip{Configs: []Config{{}}}
+
+	tests := []struct {
+		etag     string
+		expected string
+	}{
+		{`"abc"`, `W/"abc"`},
+		{`W/"abc"`, `W/"abc"`},
+		{"", ""},
+	}
+	for i, test := range tests {
+		gz.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if test.etag != "" {
+				w.Header().Set("ETag", test.etag)
+			}
+			w.Write([]byte("compress me"))
+			return 0, nil
+		})
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if _, err := gz.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if got := w.Header().Get("ETag"); got != test.expected {
+			t.Errorf("Test %d: Expected ETag %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestGzipPassesThroughUntransformable(t *testing.T) {
+	var encoded bytes.Buffer
+	gw := gzip.NewWriter(&encoded)
+	gw.Write([]byte("compressed upstream"))
+	gw.Close()
+
+	tests := []struct {
+		header http.Header
+	}{
+		{http.Header{"Content-Encoding": {"gzip"}}},
+		{http.Header{"Content-Encoding": {"br"}}},
+		{http.Header{"Cache-Control": {"no-transform"}}},
+		{http.Header{"Cache-Control": {"public, No-Transform"}}},
+	}
+	for _, filters := range [][]ResponseFilter{nil, {LengthFilter(10)}} {
+		gz := Gzip{Configs: []Config{{ResponseFilters: filters}}}
+		for i, test := range tests {
+			gz.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				for k, v := range test.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(encoded.Len()))
+				w.WriteHeader(http.StatusOK)
+				w.Write(encoded.Bytes())
+				return 0, nil
+			})
+			r, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			if _, err := gz.ServeHTTP(w, r); err != nil {
+				t.Fatalf("Test %d: %v", i, err)
+			}
+			if !bytes.Equal(w.Body.Bytes(), encoded.Bytes()) {
+				t.Errorf("Test %d: Expected the body to be passed through untouched, got %q", i, w.Body.Bytes())
+			}
+			if got, want := w.Header().Get("Content-Encoding"), test.header.Get("Content-Encoding"); got != want {
+				t.Errorf("Test %d: Expected Content-Encoding %q, got %q", i, want, got)
+			}
+			if got, want := w.Header().Get("Content-Length"), strconv.Itoa(encoded.Len()); got != want {
+				t.Errorf("Test %d: Expected Content-Length %s to be kept, got %q", i, want, got)
+			}
+		}
+	}
+}
+
+func TestGzipFlush(t *testing.T) {
+	const event = "data: hello\n\n"
+	for _, encoding := range []string{"gzip", "br"} {
+		for _, filters := range [][]ResponseFilter{nil, {LengthFilter(5)}} {
+			w := httptest.NewRecorder()
+			var flushed []byte
+			next := httpserver.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) (int, error) {
+				rw.Header().Set("Content-Type", "text/event-stream")
+				rw.Write([]byte(event))
+				rw.(http.Flusher).Flush()
+
+				// the event must be readable before the response is done
+				var dec io.Reader = brotli.NewReader(bytes.NewReader(w.Body.Bytes()))
+				if encoding == "gzip" {
+					gr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+					if err != nil {
+						t.Errorf("%s, filters %v: Decoding flushed body: %v", encoding, filters, err)
+						return 0, nil
+					}
+					dec = gr
+				}
+				flushed = make([]byte, len(event))
+				if _, err := io.ReadFull(dec, flushed); err != nil {
+					t.Errorf("%s, filters %v: Reading flushed body: %v", encoding, filters, err)
+				}
+				return 0, nil
+			})
+
+			var h httpserver.Handler = Gzip{Next: next, Configs: []Config{{ResponseFilters: filters}}}
+			if encoding == "br" {
+				h = Brotli{Next: next, Configs: []Config{{ResponseFilters: filters}}}
+			}
+			r, err := http.NewRequest("GET", "/events", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept-Encoding", encoding)
+			if _, err := h.ServeHTTP(w, r); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Errorf("%s, filters %v: Expected Content-Encoding %s, got %q", encoding, filters, encoding, got)
+			}
+			if !w.Flushed {
+				t.Errorf("%s, filters %v: Expected the underlying writer to be flushed", encoding, filters)
+			}
+			if string(flushed) != event {
+				t.Errorf("%s, filters %v: Expected %q before the response was done, got %q", encoding, filters, event, flushed)
+			}
+		}
+	}
+}
+
+func TestGzipFlushBeforeWrite(t *testing.T) {
+	const body = "hello, flushed world"
+	for _, encoding := range []string{"gzip", "br"} {
+		for _, test := range []struct {
+			filters          []ResponseFilter
+			expectedEncoding string
+		}{
+			{nil, encoding},
+			{[]ResponseFilter{LengthFilter(5)}, ""}, // nothing to measure yet
+		} {
+			next := httpserver.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) (int, error) {
+				rw.Header().Set("Content-Type", "text/plain")
+				rw.(http.Flusher).Flush()
+				rw.Write([]byte(body))
+				return 0, nil
+			})
+			var h httpserver.Handler = Gzip{Next: next, Configs: []Config{{ResponseFilters: test.filters}}}
+			if encoding == "br" {
+				h = Brotli{Next: next, Configs: []Config{{ResponseFilters: test.filters}}}
+			}
+			r, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			if _, err := h.ServeHTTP(w, r); err != nil {
+				t.Fatal(err)
+			}
+
+			// the recorder keeps the header as it was when it was written
+			res := w.Result()
+			if got := res.Header.Get("Content-Encoding"); got != test.expectedEncoding {
+				t.Errorf("%s, filters %v: Expected Content-Encoding %q, got %q", encoding, test.filters, test.expectedEncoding, got)
+				continue
+			}
+			var dec io.Reader = res.Body
+			switch test.expectedEncoding {
+			case "gzip":
+				if dec, err = gzip.NewReader(res.Body); err != nil {
+					t.Fatalf("%s, filters %v: Decoding body: %v", encoding, test.filters, err)
+				}
+			case "br":
+				dec = brotli.NewReader(res.Body)
+			}
+			got, err := ioutil.ReadAll(dec)
+			if err != nil {
+				t.Errorf("%s, filters %v: Reading body: %v", encoding, test.filters, err)
+			}
+			if string(got) != body {
+				t.Errorf("%s, filters %v: Expected body %q, got %q", encoding, test.filters, body, got)
+			}
+		}
+	}
+}
+
+func TestGzipPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gzip_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const precompressed = "pretend this is gzipped"
+	files := map[string]string{
+		"app.js":    "console.log('hi')",
+		"app.js.gz": precompressed,
+		"app.css":   "compressed on the fly",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the precompressed file is served by the file server at the
+	// end of the chain, so the middleware in between still applies
+	gz := Gzip{
+		Configs: []Config{{RequestFilters: []RequestFilter{DefaultExtFilter()}, Precompressed: true}},
+		Next:    staticfiles.FileServer{Root: http.Dir(dir)},
+	}
+
+	// precompressed file exists
+	r, err := http.NewRequest("GET", "/app.js", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	if _, err := gz.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Body.String(); got != precompressed {
+		t.Errorf("Expected body %q, got %q", precompressed, got)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary to be Accept-Encoding, got %q", got)
+	}
+
+	// no precompressed file; fall back to compressing on the fly
+	r, err = http.NewRequest("GET", "/app.css", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	if _, err := gz.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got %q", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected gzipped body, got error: %v", err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != "compressed on the fly" {
+		t.Errorf("Expected decompressed body %q, got %q", "compressed on the fly", b)
+	}
+
+	// a handler before the file server still decides
+	gz.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusUnauthorized, nil
+	})
+	r, err = http.NewRequest("GET", "/app.js", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	gz.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), precompressed) {
+		t.Errorf("Expected the precompressed file not to be served past the handler, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestGzipWriterInterfaces(t *testing.T) {
+	for _, filters := range [][]ResponseFilter{nil, {LengthFilter(5)}} {
+		gz := Gzip{
+			Next:    httpserver.HandlerFunc(httpserver.UseOptionalInterfaces),
+			Configs: []Config{{ResponseFilters: filters}},
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		fw := &httpserver.FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+		if _, err := gz.ServeHTTP(fw, r); err != nil {
+			t.Fatalf("Filters %v: %v", filters, err)
+		}
+		if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+			t.Errorf("Filters %v: Expected the calls to reach the underlying writer: %s, got %s", filters, want, got)
+		}
+	}
+}
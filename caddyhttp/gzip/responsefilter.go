@@ -1,7 +1,7 @@
 package gzip
 
 import (
-	"compress/gzip"
+	"bytes"
 	"net/http"
 	"strconv"
 )
@@ -27,25 +27,56 @@ func (l LengthFilter) ShouldCompress(w http.ResponseWriter) bool {
 
 // ResponseFilterWriter validates ResponseFilters. It writes
 // gzip compressed data if ResponseFilters are satisfied or
-// uncompressed data otherwise.
+// uncompressed data otherwise. If a LengthFilter is used and
+// the response has no Content-Length, the body is buffered
+// until it reaches the minimum length before deciding.
 type ResponseFilterWriter struct {
 	filters           []ResponseFilter
 	shouldCompress    bool
 	statusCodeWritten bool
 	*gzipResponseWriter
+
+	minLength int64 // minimum length to compress, if filtered by length
+	buffering bool  // true while waiting for minLength bytes
+	code      int   // status code to write when buffering ends
+	buf       bytes.Buffer
 }
 
 // NewResponseFilterWriter creates and initializes a new ResponseFilterWriter.
 func NewResponseFilterWriter(filters []ResponseFilter, gz *gzipResponseWriter) *ResponseFilterWriter {
-	return &ResponseFilterWriter{filters: filters, gzipResponseWriter: gz}
+	rw := &ResponseFilterWriter{filters: filters, gzipResponseWriter: gz}
+	for _, filter := range filters {
+		if l, ok := filter.(LengthFilter); ok && int64(l) > rw.minLength {
+			rw.minLength = int64(l)
+		}
+	}
+	return rw
 }
 
 // WriteHeader wraps underlying WriteHeader method and
-// compresses if filters are satisfied.
+// compresses if filters are satisfied. If the length of
+// the response is not known yet, the decision is deferred
+// until enough of the body is written.
 func (r *ResponseFilterWriter) WriteHeader(code int) {
+	if r.minLength > 0 && r.Header().Get("Content-Length") == "" {
+		r.buffering = true
+		r.code = code
+		r.statusCodeWritten = true
+		return
+	}
+	r.writeHeader(code, false)
+}
+
+// writeHeader determines if compression should be used and
+// writes the header with code. If lengthOK is true, length
+// filters are considered satisfied by the buffered body.
+func (r *ResponseFilterWriter) writeHeader(code int, lengthOK bool) {
 	// Determine if compression should be used or not.
 	r.shouldCompress = true
 	for _, filter := range r.filters {
+		if _, ok := filter.(LengthFilter); ok && lengthOK {
+			continue
+		}
 		if !filter.ShouldCompress(r) {
 			r.shouldCompress = false
 			break
@@ -53,10 +84,6 @@ func (r *ResponseFilterWriter) WriteHeader(code int) {
 	}
 
 	if r.shouldCompress {
-		// replace discard writer with ResponseWriter
-		if gzWriter, ok := r.gzipResponseWriter.Writer.(*gzip.Writer); ok {
-			gzWriter.Reset(r.ResponseWriter)
-		}
 		// use gzip WriteHeader to include and delete
 		// necessary headers
 		r.gzipResponseWriter.WriteHeader(code)
@@ -72,8 +99,62 @@ func (r *ResponseFilterWriter) Write(b []byte) (int, error) {
 	if !r.statusCodeWritten {
 		r.WriteHeader(http.StatusOK)
 	}
+	if r.buffering {
+		n, _ := r.buf.Write(b)
+		if int64(r.buf.Len()) >= r.minLength {
+			return n, r.flushBuffer(true)
+		}
+		return n, nil
+	}
 	if r.shouldCompress {
 		return r.gzipResponseWriter.Write(b)
 	}
 	return r.ResponseWriter.Write(b)
 }
+
+// flushBuffer ends buffering by writing the header and the
+// buffered body. The body is compressed if lengthOK is true
+// and the other filters are satisfied.
+func (r *ResponseFilterWriter) flushBuffer(lengthOK bool) error {
+	r.buffering = false
+	if r.Header().Get("Content-Type") == "" {
+		r.Header().Set("Content-Type", http.DetectContentType(r.buf.Bytes()))
+	}
+	r.writeHeader(r.code, lengthOK)
+	var err error
+	if r.shouldCompress {
+		_, err = r.gzipResponseWriter.Write(r.buf.Bytes())
+	} else {
+		_, err = r.ResponseWriter.Write(r.buf.Bytes())
+	}
+	r.buf.Reset()
+	return err
+}
+
+// Flush implements http.Flusher. A body still being buffered
+// is written uncompressed since it is shorter than minLength.
+func (r *ResponseFilterWriter) Flush() {
+	if !r.statusCodeWritten {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.buffering {
+		r.flushBuffer(false)
+	}
+	if r.shouldCompress {
+		r.gzipResponseWriter.Flush()
+	} else if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Close writes out any body that is still being buffered
+// because it was shorter than the minimum length. It must
+// be called when the response is done.
+func (r *ResponseFilterWriter) Close() error {
+	if r.buffering {
+		return r.flushBuffer(false)
+	}
+	return nil
+}
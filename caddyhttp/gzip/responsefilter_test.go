@@ -3,8 +3,10 @@ package gzip
 import (
 	"compress/gzip"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -33,7 +35,7 @@ func TestLengthFilter(t *testing.T) {
 		for j, filter := range filters {
 			r := httptest.NewRecorder()
 			r.Header().Set("Content-Length", fmt.Sprint(ts.length))
-			wWriter := NewResponseFilterWriter([]ResponseFilter{filter}, &gzipResponseWriter{gzip.NewWriter(r), r, false})
+			wWriter := NewResponseFilterWriter([]ResponseFilter{filter}, &gzipResponseWriter{gzip.NewWriter(r), r, false, "gzip", false})
 			if filter.ShouldCompress(wWriter) != ts.shouldCompress[j] {
 				t.Errorf("Test %v: Expected %v found %v", i, ts.shouldCompress[j], filter.ShouldCompress(r))
 			}
@@ -87,3 +89,58 @@ func TestResponseFilterWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestResponseFilterWriterUnknownLength(t *testing.T) {
+	tests := []struct {
+		chunks         []string
+		shouldCompress bool
+	}{
+		{[]string{"Hello\t\t\t\n"}, false},
+		{[]string{"Hello", "\t\t\t\n"}, false},
+		{[]string{"Hello the \t\t\t world is\n\n\n great"}, true},
+		{[]string{"Hello ", "the \t\t\t ", "world is\n\n\n great"}, true},
+		{[]string{}, false},
+	}
+
+	server := Gzip{Configs: []Config{
+		{ResponseFilters: []ResponseFilter{LengthFilter(15)}},
+	}}
+
+	for i, ts := range tests {
+		server.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "text/plain")
+			for _, chunk := range ts.chunks {
+				w.Write([]byte(chunk))
+			}
+			return 200, nil
+		})
+
+		r := urlRequest("/")
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		w := httptest.NewRecorder()
+
+		server.ServeHTTP(w, r)
+
+		body := strings.Join(ts.chunks, "")
+		if !ts.shouldCompress {
+			if resp := w.Body.String(); resp != body {
+				t.Errorf("Test %v: No compression expected, found %q", i, resp)
+			}
+			if w.Header().Get("Content-Encoding") != "" {
+				t.Errorf("Test %v: Expected no Content-Encoding, found %q", i, w.Header().Get("Content-Encoding"))
+			}
+			continue
+		}
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("Test %v: Expected Content-Encoding gzip, found %q", i, w.Header().Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Test %v: Compression expected, got error: %v", i, err)
+		}
+		if resp, _ := ioutil.ReadAll(zr); string(resp) != body {
+			t.Errorf("Test %v: Expected decompressed body %q, found %q", i, body, resp)
+		}
+	}
+}
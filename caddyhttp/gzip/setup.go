@@ -1,14 +1,30 @@
 package gzip
 
 import (
+	"compress/gzip"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/andybalholm/brotli"
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
+// setupBrotli configures a new brotli middleware instance.
+func setupBrotli(c *caddy.Controller) error {
+	configs, err := brotliParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Brotli{Next: next, Configs: configs}
+	})
+
+	return nil
+}
+
 // setup configures a new gzip middleware instance.
 func setup(c *caddy.Controller) error {
 	configs, err := gzipParse(c)
@@ -24,6 +40,16 @@ func setup(c *caddy.Controller) error {
 }
 
 func gzipParse(c *caddy.Controller) ([]Config, error) {
+	return compressionParse(c, "gzip", gzip.BestCompression)
+}
+
+func brotliParse(c *caddy.Controller) ([]Config, error) {
+	return compressionParse(c, "brotli", brotli.BestCompression)
+}
+
+// compressionParse parses the configs of the directive name,
+// whose compression level may be between 1 and maxLevel.
+func compressionParse(c *caddy.Controller, name string, maxLevel int) ([]Config, error) {
 	var configs []Config
 
 	for c.Next() {
@@ -50,7 +76,7 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 				}
 				for _, e := range exts {
 					if !strings.HasPrefix(e, ".") && e != ExtWildCard && e != "" {
-						return configs, fmt.Errorf(`gzip: invalid extension "%v" (must start with dot)`, e)
+						return configs, fmt.Errorf(`%s: invalid extension "%v" (must start with dot)`, name, e)
 					}
 					extFilter.Exts.Add(e)
 				}
@@ -61,10 +87,10 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 				}
 				for _, p := range paths {
 					if p == "/" {
-						return configs, fmt.Errorf(`gzip: cannot exclude path "/" - remove directive entirely instead`)
+						return configs, fmt.Errorf(`%s: cannot exclude path "/" - remove directive entirely instead`, name)
 					}
 					if !strings.HasPrefix(p, "/") {
-						return configs, fmt.Errorf(`gzip: invalid path "%v" (must start with /)`, p)
+						return configs, fmt.Errorf(`%s: invalid path "%v" (must start with /)`, name, p)
 					}
 					pathFilter.IgnoredPaths.Add(p)
 				}
@@ -72,7 +98,10 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 				if !c.NextArg() {
 					return configs, c.ArgErr()
 				}
-				level, _ := strconv.Atoi(c.Val())
+				level, err := strconv.Atoi(c.Val())
+				if err != nil || level < 1 || level > maxLevel {
+					return configs, fmt.Errorf(`%s: invalid level "%v" (must be between 1 and %d)`, name, c.Val(), maxLevel)
+				}
 				config.Level = level
 			case "min_length":
 				if !c.NextArg() {
@@ -82,9 +111,11 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 				if err != nil {
 					return configs, err
 				} else if length == 0 {
-					return configs, fmt.Errorf(`gzip: min_length must be greater than 0`)
+					return configs, fmt.Errorf(`%s: min_length must be greater than 0`, name)
 				}
 				lengthFilter = LengthFilter(length)
+			case "precompressed":
+				config.Precompressed = true
 			default:
 				return configs, c.ArgErr()
 			}
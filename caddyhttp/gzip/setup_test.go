@@ -1,6 +1,8 @@
 package gzip
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -89,6 +91,11 @@ func TestSetup(t *testing.T) {
 		 min_length 1000
 		}
 		`, false},
+		{`gzip { precompressed }`, false},
+		{`gzip { level 10 }`, true},
+		{`gzip { level 0 }`, true},
+		{`gzip { level fast }`, true},
+		{`gzip { level }`, true},
 	}
 	for i, test := range tests {
 		_, err := gzipParse(caddy.NewTestController("http", test.input))
@@ -99,3 +106,51 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupBrotli(t *testing.T) {
+	c := caddy.NewTestController("http", `brotli { ext .html .css
+	 level 11
+	}`)
+	err := setupBrotli(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if mids == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Brotli)
+	if !ok {
+		t.Fatalf("Expected handler to be type Brotli, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(myHandler.Configs) != 1 || myHandler.Configs[0].Level != 11 {
+		t.Errorf("Expected one config with level 11, got: %#v", myHandler.Configs)
+	}
+
+	if _, err := brotliParse(caddy.NewTestController("http", `brotli { level 12 }`)); err == nil {
+		t.Error("Expected error for brotli level 12, but found nil")
+	}
+}
+
+func TestGzipParseLevel(t *testing.T) {
+	for level := 1; level <= 9; level++ {
+		configs, err := gzipParse(caddy.NewTestController("http", fmt.Sprintf("gzip { level %d }", level)))
+		if err != nil {
+			t.Fatalf("Level %d: Expected no error but found error: %v", level, err)
+		}
+		if len(configs) != 1 || configs[0].Level != level {
+			t.Errorf("Level %d: Expected one config with level %d, got: %#v", level, level, configs)
+		}
+	}
+
+	_, err := gzipParse(caddy.NewTestController("http", `gzip { level 10 }`))
+	if err == nil || !strings.Contains(err.Error(), "must be between 1 and 9") {
+		t.Errorf("Expected level range error, got: %v", err)
+	}
+}
@@ -4,7 +4,12 @@
 package header
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -21,24 +26,156 @@ type Headers struct {
 // setting headers on the response according to the configured rules.
 func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	replacer := httpserver.NewReplacer(r, nil, "")
+	var deferred []Header
 	for _, rule := range h.Rules {
 		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
 			for _, header := range rule.Headers {
-				// One can either delete a header, add multiple values to a header, or simply
-				// set a header.
-				if strings.HasPrefix(header.Name, "-") {
-					w.Header().Del(strings.TrimLeft(header.Name, "-"))
-				} else if strings.HasPrefix(header.Name, "+") {
-					w.Header().Add(strings.TrimLeft(header.Name, "+"), replacer.Replace(header.Value))
-				} else {
-					w.Header().Set(header.Name, replacer.Replace(header.Value))
+				// Deletions are applied again when the response is written,
+				// to also catch headers set by later handlers, and headers
+				// that depend on the response can only be applied then.
+				if strings.HasPrefix(header.Name, "-") || header.dependsOnResponse() {
+					deferred = append(deferred, header)
+				}
+				if !header.dependsOnResponse() {
+					applyHeader(w.Header(), header, replacer)
 				}
 			}
 		}
 	}
+	if len(deferred) > 0 {
+		w = &responseWriterWrapper{
+			ResponseWriter: w,
+			headers:        deferred,
+			replacer:       replacer,
+		}
+	}
 	return h.Next.ServeHTTP(w, r)
 }
 
+// applyHeader applies header to h. One can either delete a header,
+// add multiple values to a header, or simply set a header.
+func applyHeader(h http.Header, header Header, replacer httpserver.Replacer) {
+	if strings.HasPrefix(header.Name, "-") {
+		h.Del(strings.TrimLeft(header.Name, "-"))
+	} else if strings.HasPrefix(header.Name, "+") {
+		h.Add(strings.TrimLeft(header.Name, "+"), replaceValue(header.Value, replacer))
+	} else {
+		h.Set(header.Name, replaceValue(header.Value, replacer))
+	}
+}
+
+// replaceValue replaces each placeholder in value using replacer.
+// Placeholders replacer does not know are replaced with nothing.
+func replaceValue(value string, replacer httpserver.Replacer) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(value, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		buf.WriteString(value[:start])
+		placeholder := value[start:end]
+		if replaced := replacer.Replace(placeholder); replaced != placeholder {
+			buf.WriteString(replaced)
+		}
+		value = value[end:]
+	}
+	buf.WriteString(value)
+	return buf.String()
+}
+
+// responseWriterWrapper applies headers right before the
+// status is written: first all deletions, then the headers
+// whose status condition is met.
+type responseWriterWrapper struct {
+	http.ResponseWriter
+	headers     []Header
+	replacer    httpserver.Replacer
+	wroteHeader bool
+}
+
+// WriteHeader applies the deferred headers and writes status.
+// The response placeholders are filled in with status and, if
+// it is known, the length of the body.
+func (rww *responseWriterWrapper) WriteHeader(status int) {
+	if rww.wroteHeader {
+		return
+	}
+	rww.wroteHeader = true
+
+	rww.replacer.Set("status", strconv.Itoa(status))
+	if cl := rww.Header().Get("Content-Length"); cl != "" {
+		rww.replacer.Set("size", cl)
+	}
+
+	for _, header := range rww.headers {
+		if strings.HasPrefix(header.Name, "-") {
+			applyHeader(rww.Header(), header, rww.replacer)
+		}
+	}
+	for _, header := range rww.headers {
+		if !strings.HasPrefix(header.Name, "-") && header.matchesStatus(status) {
+			applyHeader(rww.Header(), header, rww.replacer)
+		}
+	}
+	rww.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b, writing the header with status 200 first if needed.
+func (rww *responseWriterWrapper) Write(b []byte) (int, error) {
+	if !rww.wroteHeader {
+		rww.WriteHeader(http.StatusOK)
+	}
+	return rww.ResponseWriter.Write(b)
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (rww *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := rww.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// Flush implements http.Flusher. It writes the header, if
+// it wasn't yet, and flushes the underlying ResponseWriter.
+func (rww *responseWriterWrapper) Flush() {
+	if !rww.wroteHeader {
+		rww.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rww.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (rww *responseWriterWrapper) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rww.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (rww *responseWriterWrapper) CloseNotify() <-chan bool {
+	if cn, ok := rww.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic("not a CloseNotifier")
+}
+
 type (
 	// Rule groups a slice of HTTP headers by a URL pattern.
 	// TODO: use http.Header type instead?
@@ -48,8 +185,31 @@ type (
 	}
 
 	// Header represents a single HTTP header, simply a name and value.
+	// If Status is not empty, the header is only set on responses
+	// with one of those status codes.
 	Header struct {
-		Name  string
-		Value string
+		Name   string
+		Value  string
+		Status []int
 	}
 )
+
+// dependsOnResponse returns true if h can only be applied once
+// the status of the response is known.
+func (h Header) dependsOnResponse() bool {
+	return len(h.Status) > 0 ||
+		strings.Contains(h.Value, "{status}") || strings.Contains(h.Value, "{size}")
+}
+
+// matchesStatus returns true if h applies to responses with status.
+func (h Header) matchesStatus(status int) bool {
+	if len(h.Status) == 0 {
+		return true
+	}
+	for _, s := range h.Status {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
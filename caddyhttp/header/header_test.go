@@ -1,6 +1,7 @@
 package header
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -58,6 +59,40 @@ func TestHeader(t *testing.T) {
 	}
 }
 
+func TestHeaderPlaceholders(t *testing.T) {
+	he := Headers{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Headers: []Header{
+				{Name: "X-Echo", Value: "{method} {path}?{query} from {>X-Client}"},
+				{Name: "X-Unknown", Value: "[{nonsense}]"},
+				{Name: "X-Unclosed", Value: "{not a placeholder"},
+			}},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "/a?b=c", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	req.Header.Set("X-Client", "tester")
+
+	rec := httptest.NewRecorder()
+	he.ServeHTTP(rec, req)
+
+	for name, expected := range map[string]string{
+		"X-Echo":     "GET /a?b=c from tester",
+		"X-Unknown":  "[]",
+		"X-Unclosed": "{not a placeholder",
+	} {
+		if got := rec.Header().Get(name); got != expected {
+			t.Errorf("Expected %s header to be %q but was %q", name, expected, got)
+		}
+	}
+}
+
 func TestMultipleHeaders(t *testing.T) {
 	he := Headers{
 		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -87,3 +122,104 @@ func TestMultipleHeaders(t *testing.T) {
 		t.Errorf("Expected header to contain: %v but got: %v", desiredHeaders, actualHeaders)
 	}
 }
+
+func TestHeaderWriteTime(t *testing.T) {
+	he := Headers{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			// like a proxied upstream setting headers of its own
+			w.Header().Set("X-Powered-By", "PHP")
+			w.Header().Set("Server", "upstream")
+			w.Header().Set("X-Override", "upstream")
+			w.Header().Set("Cache-Control", "no-cache")
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			w.Write([]byte("body"))
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Headers: []Header{
+				{Name: "+X-Added", Value: "one"},
+				{Name: "X-Override", Value: "rule"},
+				{Name: "-X-Powered-By"},
+				{Name: "-Server"},
+				{Name: "Cache-Control", Value: "max-age=3600", Status: []int{200}},
+			}},
+		},
+	}
+
+	for i, test := range []struct {
+		path   string
+		header string
+		value  string
+	}{
+		// added headers are kept
+		{"/", "X-Added", "one"},
+		// headers set before the handler runs can be overridden by it
+		{"/", "X-Override", "upstream"},
+		// deletions catch headers set by the handler
+		{"/", "X-Powered-By", ""},
+		{"/", "Server", ""},
+		// status-conditional headers win over the handler's
+		{"/", "Cache-Control", "max-age=3600"},
+		{"/missing", "Cache-Control", "no-cache"},
+		{"/missing", "Server", ""},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		rec := httptest.NewRecorder()
+		he.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(test.header); got != test.value {
+			t.Errorf("Test %d: Expected %s header to be %q but was %q",
+				i, test.header, test.value, got)
+		}
+	}
+}
+
+func TestHeaderResponsePlaceholders(t *testing.T) {
+	he := Headers{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Length", "5")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("hello"))
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Headers: []Header{
+				{Name: "X-Status", Value: "{status}"},
+				{Name: "X-Size", Value: "{size} bytes"},
+			}},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	he.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("X-Status"), "202"; got != want {
+		t.Errorf("Expected X-Status header to be %q but was %q", want, got)
+	}
+	if got, want := rec.Header().Get("X-Size"), "5 bytes"; got != want {
+		t.Errorf("Expected X-Size header to be %q but was %q", want, got)
+	}
+}
+
+func TestHeaderWriterInterfaces(t *testing.T) {
+	he := Headers{
+		Next:  httpserver.HandlerFunc(httpserver.UseOptionalInterfaces),
+		Rules: []Rule{{Path: "/", Headers: []Header{{Name: "-X-Powered-By"}}}}, // deferred, so w is wrapped
+	}
+	fw := &httpserver.FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	if _, err := he.ServeHTTP(fw, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
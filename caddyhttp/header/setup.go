@@ -1,6 +1,9 @@
 package header
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -55,6 +58,16 @@ func headersParse(c *caddy.Controller) ([]Rule, error) {
 		for c.NextBlock() {
 			// A block of headers was opened...
 
+			if c.Val() == "status" {
+				// ...with a nested block of headers for certain statuses
+				headers, err := statusHeadersParse(c)
+				if err != nil {
+					return rules, err
+				}
+				head.Headers = append(head.Headers, headers...)
+				continue
+			}
+
 			h := Header{Name: c.Val()}
 
 			if c.NextArg() {
@@ -91,3 +104,43 @@ func headersParse(c *caddy.Controller) ([]Rule, error) {
 
 	return rules, nil
 }
+
+// statusHeadersParse parses a block of headers that only apply
+// to responses with the listed status codes:
+//
+//	status 200 304 {
+//	    Cache-Control "max-age=3600"
+//	}
+func statusHeadersParse(c *caddy.Controller) ([]Header, error) {
+	var codes []int
+	for {
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+		if c.Val() == "{" {
+			break
+		}
+		status, err := strconv.Atoi(c.Val())
+		if err != nil || status < 100 || status > 599 {
+			return nil, c.Errf("invalid status code '%s'", c.Val())
+		}
+		codes = append(codes, status)
+	}
+	if len(codes) == 0 {
+		return nil, c.ArgErr()
+	}
+
+	var headers []Header
+	c.IncrNest()
+	for c.NextBlock() {
+		h := Header{Name: c.Val(), Status: codes}
+		if strings.HasPrefix(h.Name, "-") {
+			return nil, c.Errf("header %s can't be removed conditionally", h.Name)
+		}
+		if c.NextArg() {
+			h.Value = c.Val()
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
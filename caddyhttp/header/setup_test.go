@@ -50,6 +50,35 @@ func TestHeadersParse(t *testing.T) {
 					{Name: "Baz", Value: "Qux"},
 				}},
 			}},
+		{`header /static {
+			-Server
+			status 200 304 {
+				Cache-Control "max-age=3600"
+			}
+			X-Frame-Options DENY
+		}`,
+			false, []Rule{
+				{Path: "/static", Headers: []Header{
+					{Name: "-Server"},
+					{Name: "Cache-Control", Value: "max-age=3600", Status: []int{200, 304}},
+					{Name: "X-Frame-Options", Value: "DENY"},
+				}},
+			}},
+		{`header / {
+			status {
+				Cache-Control "max-age=3600"
+			}
+		}`, true, nil},
+		{`header / {
+			status ok {
+				Cache-Control "max-age=3600"
+			}
+		}`, true, nil},
+		{`header / {
+			status 200 {
+				-Server
+			}
+		}`, true, nil},
 	}
 
 	for i, test := range tests {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -53,6 +54,8 @@ const (
 	endsWithOp   = "ends_with"
 	matchOp      = "match"
 	notMatchOp   = "not_match"
+	greaterOp    = "greater_than"
+	lessOp       = "less_than"
 )
 
 func operatorError(operator string) error {
@@ -71,6 +74,8 @@ var ifConditions = map[string]ifCondition{
 	endsWithOp:   endsWithFunc,
 	matchOp:      matchFunc,
 	notMatchOp:   notMatchFunc,
+	greaterOp:    greaterFunc,
+	lessOp:       lessFunc,
 }
 
 // isFunc is condition for Is operator.
@@ -125,6 +130,24 @@ func notMatchFunc(a, b string) bool {
 	return !matched
 }
 
+// greaterFunc is condition for GreaterThan operator.
+// It checks if a is numerically greater than b; if either
+// is not a number, the condition is false.
+func greaterFunc(a, b string) bool {
+	x, err1 := strconv.ParseFloat(a, 64)
+	y, err2 := strconv.ParseFloat(b, 64)
+	return err1 == nil && err2 == nil && x > y
+}
+
+// lessFunc is condition for LessThan operator.
+// It checks if a is numerically less than b; if either
+// is not a number, the condition is false.
+func lessFunc(a, b string) bool {
+	x, err1 := strconv.ParseFloat(a, 64)
+	y, err2 := strconv.ParseFloat(b, 64)
+	return err1 == nil && err2 == nil && x < y
+}
+
 // ifCond is statement for a IfMatcher condition.
 type ifCond struct {
 	a  string
@@ -147,12 +170,20 @@ func newIfCond(a, operator, b string) (ifCond, error) {
 // True returns true if the condition is true and false otherwise.
 // If r is not nil, it replaces placeholders before comparison.
 func (i ifCond) True(r *http.Request) bool {
+	if r != nil {
+		return i.trueWith(NewReplacer(r, nil, ""))
+	}
+	return i.trueWith(nil)
+}
+
+// trueWith is like True, but replaces placeholders using
+// rep, if it is not nil.
+func (i ifCond) trueWith(rep Replacer) bool {
 	if c, ok := ifConditions[i.op]; ok {
 		a, b := i.a, i.b
-		if r != nil {
-			replacer := NewReplacer(r, nil, "")
-			a = replacer.Replace(i.a)
-			b = replacer.Replace(i.b)
+		if rep != nil {
+			a = rep.Replace(i.a)
+			b = rep.Replace(i.b)
 		}
 		return c(a, b)
 	}
@@ -194,6 +225,24 @@ func (m IfMatcher) Or(r *http.Request) bool {
 	return false
 }
 
+// MatchWith is like Match, but replaces placeholders using rep.
+// If rep was made with a ResponseRecorder, conditions can also
+// use response placeholders such as {status}. A matcher
+// without conditions matches everything.
+func (m IfMatcher) MatchWith(rep Replacer) bool {
+	if len(m.ifs) == 0 {
+		return true
+	}
+	for _, i := range m.ifs {
+		if i.trueWith(rep) == m.isOr {
+			// the first true condition decides 'or',
+			// the first false condition decides 'and'
+			return m.isOr
+		}
+	}
+	return !m.isOr
+}
+
 // IfMatcherKeyword checks if the next value in the dispenser is a keyword for 'if' config block.
 // If true, remaining arguments in the dispinser are cleard to keep the dispenser valid for use.
 func IfMatcherKeyword(c *caddy.Controller) bool {
@@ -3,6 +3,7 @@ package httpserver
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -56,6 +57,12 @@ func TestConditions(t *testing.T) {
 		{"b0a not_match b[a-z]", true},
 		{"b0a not_match b[a-z]+", true},
 		{"b0a not_match b[a-z0-9]+", false},
+		{"500 greater_than 399", true},
+		{"399 greater_than 399", false},
+		{"a greater_than 399", false},
+		{"200 less_than 400", true},
+		{"400 less_than 400", false},
+		{"200 less_than b", false},
 	}
 
 	for i, test := range tests {
@@ -287,3 +294,42 @@ func TestIfMatcherKeyword(t *testing.T) {
 		}
 	}
 }
+
+func TestIfMatcherWithReplacer(t *testing.T) {
+	r, err := http.NewRequest("GET", "/api/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := NewResponseRecorder(httptest.NewRecorder())
+	rr.WriteHeader(http.StatusNotFound)
+	rep := NewReplacer(r, rr, "")
+
+	tests := []struct {
+		conditions []string
+		isOr       bool
+		isTrue     bool
+	}{
+		{nil, false, true},
+		{nil, true, true},
+		{[]string{"{status} greater_than 399"}, false, true},
+		{[]string{"{status} greater_than 399", "{path} starts_with /api"}, false, true},
+		{[]string{"{status} greater_than 499", "{path} starts_with /api"}, false, false},
+		{[]string{"{status} greater_than 499", "{path} starts_with /api"}, true, true},
+		{[]string{"{status} greater_than 499", "{path} starts_with /web"}, true, false},
+	}
+
+	for i, test := range tests {
+		matcher := IfMatcher{isOr: test.isOr}
+		for _, condition := range test.conditions {
+			str := strings.Fields(condition)
+			ifCond, err := newIfCond(str[0], str[1], str[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			matcher.ifs = append(matcher.ifs, ifCond)
+		}
+		if isTrue := matcher.MatchWith(rep); isTrue != test.isTrue {
+			t.Errorf("Test %d: expected %v found %v", i, test.isTrue, isTrue)
+		}
+	}
+}
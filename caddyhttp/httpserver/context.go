@@ -192,16 +192,18 @@ func (c Context) Markdown(filename string) (string, error) {
 		return "", err
 	}
 	renderer := blackfriday.HtmlRenderer(0, "", "")
-	extns := 0
-	extns |= blackfriday.EXTENSION_TABLES
-	extns |= blackfriday.EXTENSION_FENCED_CODE
-	extns |= blackfriday.EXTENSION_STRIKETHROUGH
-	extns |= blackfriday.EXTENSION_DEFINITION_LISTS
-	markdown := blackfriday.Markdown([]byte(body), renderer, extns)
+	markdown := blackfriday.Markdown([]byte(body), renderer, MarkdownExtensions)
 
 	return string(markdown), nil
 }
 
+// MarkdownExtensions are the blackfriday extensions enabled
+// wherever Caddy renders Markdown.
+const MarkdownExtensions = blackfriday.EXTENSION_TABLES |
+	blackfriday.EXTENSION_FENCED_CODE |
+	blackfriday.EXTENSION_STRIKETHROUGH |
+	blackfriday.EXTENSION_DEFINITION_LISTS
+
 // ContextInclude opens filename using fs and executes a template with the context ctx.
 // This does the same thing that Context.Include() does, but with the ability to provide
 // your own context so that the included files can have access to additional fields your
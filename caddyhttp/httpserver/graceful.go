@@ -1,80 +1,91 @@
 package httpserver
 
 import (
+	"context"
 	"net"
 	"sync"
-	"syscall"
+	"time"
 )
 
-// TODO: Should this be a generic graceful listener available in its own package or something?
-// Also, passing in a WaitGroup is a little awkward. Why can't this listener just keep
-// the waitgroup internal to itself?
+// drainPollInterval is how often a draining listener checks
+// whether its connections are all closed.
+const drainPollInterval = 100 * time.Millisecond
 
-// newGracefulListener returns a gracefulListener that wraps l and
-// uses wg (stored in the host server) to count connections.
-func newGracefulListener(l net.Listener, wg *sync.WaitGroup) *gracefulListener {
-	gl := &gracefulListener{Listener: l, stop: make(chan error), connWg: wg}
-	go func() {
-		<-gl.stop
-		gl.Lock()
-		gl.stopped = true
-		gl.Unlock()
-		gl.stop <- gl.Listener.Close()
-	}()
-	return gl
+// newGracefulListener returns a gracefulListener that wraps l.
+func newGracefulListener(l net.Listener) *gracefulListener {
+	return &gracefulListener{Listener: l, conns: make(map[*gracefulConn]struct{})}
 }
 
-// gracefuListener is a net.Listener which can
-// count the number of connections on it. Its
-// methods mainly wrap net.Listener to be graceful.
+// gracefulListener is a net.Listener which keeps track of
+// the connections it accepted, so that the ones still open
+// at the end of a graceful shutdown can be closed. Unlike
+// http.Server, it also knows about hijacked connections,
+// like websockets and streams being proxied.
 type gracefulListener struct {
 	net.Listener
-	stop       chan error
-	stopped    bool
-	sync.Mutex                 // protects the stopped flag
-	connWg     *sync.WaitGroup // pointer to the host's wg used for counting connections
+	mu    sync.Mutex // protects conns
+	conns map[*gracefulConn]struct{}
 }
 
 // Accept accepts a connection.
-func (gl *gracefulListener) Accept() (c net.Conn, err error) {
-	c, err = gl.Listener.Accept()
+func (gl *gracefulListener) Accept() (net.Conn, error) {
+	c, err := gl.Listener.Accept()
 	if err != nil {
-		return
+		return nil, err
 	}
-	c = gracefulConn{Conn: c, connWg: gl.connWg}
-	gl.connWg.Add(1)
-	return
+	gc := &gracefulConn{Conn: c, listener: gl}
+	gl.mu.Lock()
+	gl.conns[gc] = struct{}{}
+	gl.mu.Unlock()
+	return gc, nil
 }
 
-// Close immediately closes the listener.
-func (gl *gracefulListener) Close() error {
-	gl.Lock()
-	if gl.stopped {
-		gl.Unlock()
-		return syscall.EINVAL
+// openConns returns the number of connections of gl that
+// haven't been closed yet.
+func (gl *gracefulListener) openConns() int {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	return len(gl.conns)
+}
+
+// drain waits for all connections of gl to be closed. When ctx
+// is done first, the connections that are still open are closed
+// forcefully. gl should be closed already, so that it doesn't
+// accept new connections in the meantime.
+func (gl *gracefulListener) drain(ctx context.Context) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for gl.openConns() > 0 {
+		select {
+		case <-ctx.Done():
+			gl.mu.Lock()
+			conns := make([]*gracefulConn, 0, len(gl.conns))
+			for c := range gl.conns {
+				conns = append(conns, c)
+			}
+			gl.mu.Unlock()
+			for _, c := range conns {
+				c.Close()
+			}
+			return
+		case <-ticker.C:
+		}
 	}
-	gl.Unlock()
-	gl.stop <- nil
-	return <-gl.stop
 }
 
 // gracefulConn represents a connection on a
 // gracefulListener so that we can keep track
-// of the number of connections, thus facilitating
+// of the open connections, thus facilitating
 // a graceful shutdown.
 type gracefulConn struct {
 	net.Conn
-	connWg *sync.WaitGroup // pointer to the host server's connection waitgroup
+	listener *gracefulListener
 }
 
-// Close closes c's underlying connection while updating the wg count.
-func (c gracefulConn) Close() error {
-	err := c.Conn.Close()
-	if err != nil {
-		return err
-	}
-	// close can fail on http2 connections (as of Oct. 2015, before http2 in std lib)
-	// so don't decrement count unless close succeeds
-	c.connWg.Done()
-	return nil
+// Close closes c's underlying connection and stops tracking it.
+func (c *gracefulConn) Close() error {
+	c.listener.mu.Lock()
+	delete(c.listener.conns, c)
+	c.listener.mu.Unlock()
+	return c.Conn.Close()
 }
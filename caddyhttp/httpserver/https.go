@@ -100,11 +100,13 @@ func enableAutoHTTPS(configs []*SiteConfig, loadCertificates bool) error {
 // hosts. You must pass in all configs, not just configs that qualify, since
 // we must know whether the same host already exists on port 80, and those would
 // not be in a list of configs that qualify for automatic HTTPS. This function will
-// only set up redirects for configs that qualify. It returns the updated list of
+// only set up redirects for configs that qualify and don't turn them off with
+// "redir off" in their tls block; without a redirect, nothing listens on port 80
+// for the host unless another config does. It returns the updated list of
 // all configs.
 func makePlaintextRedirects(allConfigs []*SiteConfig) []*SiteConfig {
 	for i, cfg := range allConfigs {
-		if cfg.TLS.Managed &&
+		if cfg.TLS.Managed && !cfg.TLS.DisableHTTPRedirect &&
 			!hostHasOtherPort(allConfigs, i, "80") &&
 			(cfg.Addr.Port == "443" || !hostHasOtherPort(allConfigs, i, "443")) {
 			allConfigs = append(allConfigs, redirPlaintextHost(cfg))
@@ -154,9 +156,10 @@ func redirPlaintextHost(cfg *SiteConfig) *SiteConfig {
 	port := "80"
 	addr := net.JoinHostPort(host, port)
 	return &SiteConfig{
-		Addr:       Address{Original: addr, Host: host, Port: port},
-		ListenHost: cfg.ListenHost,
-		middleware: []Middleware{redirMiddleware},
-		TLS:        &caddytls.Config{AltHTTPPort: cfg.TLS.AltHTTPPort},
+		Addr:        Address{Original: addr, Host: host, Port: port},
+		ListenHost:  cfg.ListenHost,
+		ListenHosts: cfg.ListenHosts,
+		middleware:  []Middleware{redirMiddleware},
+		TLS:         &caddytls.Config{AltHTTPPort: cfg.TLS.AltHTTPPort},
 	}
 }
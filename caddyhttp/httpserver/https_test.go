@@ -114,6 +114,9 @@ func TestMakePlaintextRedirects(t *testing.T) {
 		// Can redirect from 80 to either 443 or 5001, but choose 443
 		{Addr: Address{Host: "sub3.example.com", Port: "443"}, TLS: &caddytls.Config{Managed: true}},
 		{Addr: Address{Host: "sub3.example.com", Port: "5001", Scheme: "https"}, TLS: &caddytls.Config{Managed: true}},
+
+		// Redirect turned off
+		{Addr: Address{Host: "sub4.example.com"}, TLS: &caddytls.Config{Managed: true, DisableHTTPRedirect: true}},
 	}
 
 	result := makePlaintextRedirects(configs)
@@ -0,0 +1,113 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics is a snapshot of the traffic of all the HTTP servers
+// in the process, as counted since metrics were enabled.
+type Metrics struct {
+	Requests    int64                      `json:"requests"`
+	Responses   map[string]int64           `json:"responses"` // by status class, like "2xx"
+	BytesServed int64                      `json:"bytes_served"`
+	Upstreams   map[string]UpstreamMetrics `json:"upstreams"` // by upstream host name
+}
+
+// UpstreamMetrics counts the requests that were proxied to an
+// upstream host, by whether the upstream could handle them.
+type UpstreamMetrics struct {
+	Successes int64 `json:"successes"`
+	Failures  int64 `json:"failures"`
+}
+
+// The counters behind Metrics. They are only updated when metricsOn,
+// so servers that nobody collects metrics of don't pay for them.
+var (
+	metricsOn   int32
+	requests    int64
+	bytesServed int64
+	responses   [5]int64 // 1xx through 5xx
+
+	upstreamsMu sync.RWMutex
+	upstreams   = make(map[string]*UpstreamMetrics)
+)
+
+// EnableMetrics makes the HTTP servers count their traffic for
+// CurrentMetrics. There is no way to turn metrics off again.
+func EnableMetrics() {
+	atomic.StoreInt32(&metricsOn, 1)
+}
+
+func metricsEnabled() bool {
+	return atomic.LoadInt32(&metricsOn) == 1
+}
+
+// CurrentMetrics returns the traffic counted so far.
+func CurrentMetrics() Metrics {
+	m := Metrics{
+		Requests:    atomic.LoadInt64(&requests),
+		Responses:   make(map[string]int64, len(responses)),
+		BytesServed: atomic.LoadInt64(&bytesServed),
+		Upstreams:   make(map[string]UpstreamMetrics),
+	}
+	for i := range responses {
+		m.Responses[string('1'+byte(i))+"xx"] = atomic.LoadInt64(&responses[i])
+	}
+	upstreamsMu.RLock()
+	for name, u := range upstreams {
+		m.Upstreams[name] = UpstreamMetrics{
+			Successes: atomic.LoadInt64(&u.Successes),
+			Failures:  atomic.LoadInt64(&u.Failures),
+		}
+	}
+	upstreamsMu.RUnlock()
+	return m
+}
+
+// countResponse counts a response with the given status
+// and body size.
+func countResponse(status, size int) {
+	atomic.AddInt64(&requests, 1)
+	atomic.AddInt64(&bytesServed, int64(size))
+	if class := status/100 - 1; class >= 0 && class < len(responses) {
+		atomic.AddInt64(&responses[class], 1)
+	}
+}
+
+// CountUpstream counts a request that was proxied to the upstream
+// host named name, which either handled it or failed. It does
+// nothing unless metrics are enabled.
+func CountUpstream(name string, success bool) {
+	if !metricsEnabled() {
+		return
+	}
+	upstreamsMu.RLock()
+	u, ok := upstreams[name]
+	upstreamsMu.RUnlock()
+	if !ok {
+		upstreamsMu.Lock()
+		if u, ok = upstreams[name]; !ok {
+			u = new(UpstreamMetrics)
+			upstreams[name] = u
+		}
+		upstreamsMu.Unlock()
+	}
+	if success {
+		atomic.AddInt64(&u.Successes, 1)
+	} else {
+		atomic.AddInt64(&u.Failures, 1)
+	}
+}
+
+// metricsRecorder returns w wrapped to record the response for the
+// metrics, and a function to count it once it is written. If metrics
+// are not enabled, w is returned as is.
+func metricsRecorder(w http.ResponseWriter) (http.ResponseWriter, func()) {
+	if !metricsEnabled() {
+		return w, func() {}
+	}
+	rec := NewResponseRecorder(w)
+	return rec, func() { countResponse(rec.Status(), rec.Size()) }
+}
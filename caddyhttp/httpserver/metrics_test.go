@@ -0,0 +1,56 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	before := CurrentMetrics()
+
+	// nothing is counted until metrics are enabled
+	if !metricsEnabled() {
+		w, count := metricsRecorder(httptest.NewRecorder())
+		if _, ok := w.(*ResponseRecorder); ok {
+			t.Error("Expected response writer not to be wrapped while metrics are off")
+		}
+		count()
+		CountUpstream("localhost:8080", true)
+		if after := CurrentMetrics(); after.Requests != before.Requests || len(after.Upstreams) != len(before.Upstreams) {
+			t.Errorf("Expected nothing to be counted, got %+v", after)
+		}
+	}
+
+	EnableMetrics()
+	for _, status := range []int{http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusBadGateway} {
+		w, count := metricsRecorder(httptest.NewRecorder())
+		w.WriteHeader(status)
+		w.Write([]byte("hello"))
+		count()
+	}
+	CountUpstream("localhost:8080", true)
+	CountUpstream("localhost:8080", false)
+	CountUpstream("localhost:8081", true)
+
+	after := CurrentMetrics()
+	if got := after.Requests - before.Requests; got != 4 {
+		t.Errorf("Expected 4 requests, got %d", got)
+	}
+	if got := after.BytesServed - before.BytesServed; got != 20 {
+		t.Errorf("Expected 20 bytes served, got %d", got)
+	}
+	for class, expected := range map[string]int64{"1xx": 0, "2xx": 2, "3xx": 0, "4xx": 1, "5xx": 1} {
+		if got := after.Responses[class] - before.Responses[class]; got != expected {
+			t.Errorf("Expected %d %s responses, got %d", expected, class, got)
+		}
+	}
+	up := after.Upstreams["localhost:8080"]
+	prev := before.Upstreams["localhost:8080"]
+	if up.Successes-prev.Successes != 1 || up.Failures-prev.Failures != 1 {
+		t.Errorf("Expected 1 success and 1 failure for localhost:8080, got %+v", up)
+	}
+	if up := after.Upstreams["localhost:8081"]; up.Successes-before.Upstreams["localhost:8081"].Successes != 1 {
+		t.Errorf("Expected 1 success for localhost:8081, got %+v", up)
+	}
+}
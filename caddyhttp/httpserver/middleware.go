@@ -1,10 +1,15 @@
 package httpserver
 
 import (
+	"bytes"
 	"fmt"
+	"hash/fnv"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -135,6 +140,142 @@ func SetLastModifiedHeader(w http.ResponseWriter, modTime time.Time) {
 	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
 }
 
+// AddVary adds value to the Vary header in h, keeping the values
+// that are there already, unless value is listed already or the
+// response varies on everything anyway.
+func AddVary(h http.Header, value string) {
+	for _, line := range h["Vary"] {
+		for _, v := range strings.Split(line, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.EqualFold(v, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// ServeGeneratedContent serves content, which was generated from
+// files last modified at modTime, with http.ServeContent, so that
+// range and conditional requests work for it like for static files.
+// If etag is true, a strong ETag is derived from content. name is
+// used to determine the Content-Type if it isn't set already.
+func ServeGeneratedContent(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, content []byte, etag bool) {
+	// see SetLastModifiedHeader
+	if now := currentTime(); modTime.After(now) {
+		modTime = now
+	}
+	if etag {
+		h := fnv.New64a()
+		h.Write(content)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, len(content), h.Sum64()))
+	}
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+}
+
+// PrefersJSON returns true if the client prefers application/json
+// (or another +json type) over HTML or plain text according to the
+// Accept header of r. Ties go to JSON, since a client that lists it
+// explicitly is likely asking for it.
+func PrefersJSON(r *http.Request) bool {
+	var jsonQ, otherQ float64
+	for _, accept := range r.Header["Accept"] {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, q := parseMediaRange(part)
+			switch {
+			case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+				if q > jsonQ {
+					jsonQ = q
+				}
+			case mediaType == "text/html" || mediaType == "text/plain" ||
+				mediaType == "text/*" || mediaType == "*/*":
+				if q > otherQ {
+					otherQ = q
+				}
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ >= otherQ
+}
+
+// parseMediaRange splits a single media range from an Accept
+// header into its lowercased media type and quality value.
+func parseMediaRange(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return mediaType, q
+}
+
+// ForwardedClientIP returns the ip of the client that made r. If r
+// came from one of the trusted networks, the addresses listed in
+// header (in X-Forwarded-For format) are walked from right to left
+// and the first one that isn't trusted is used. The header of an
+// untrusted peer is ignored, since anyone could have set it.
+func ForwardedClientIP(r *http.Request, header string, trusted []*net.IPNet) string {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	if !IPInNetworks(clientIP, trusted) {
+		return clientIP
+	}
+	forwarded := strings.Split(strings.Join(r.Header[http.CanonicalHeaderKey(header)], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+		if net.ParseIP(ip) == nil {
+			break // garbage; keep the last address we could trust
+		}
+		clientIP = ip
+		if !IPInNetworks(ip, trusted) {
+			break
+		}
+	}
+	return clientIP
+}
+
+// IPInNetworks returns true if ip is in one of networks.
+func IPInNetworks(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetwork parses s, which is either a network in CIDR
+// notation or a single IP address.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: s}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
 // CaseSensitivePath determines if paths should be case sensitive.
 // This is configurable via CASE_SENSITIVE_PATH environment variable.
 var CaseSensitivePath = true
@@ -171,6 +312,24 @@ func (m requestMatchers) Match(r *http.Request) bool {
 	return true
 }
 
+// CtxKey is the type of the keys under which middleware
+// stores values in the context of a request.
+type CtxKey string
+
+// RequestIDCtxKey is the context key for the unique ID
+// of a request, which is set by the requestid middleware.
+const RequestIDCtxKey CtxKey = "request_id"
+
+// RootCtxKey is the context key for the root directory of a
+// request to a site whose root has placeholders, which are
+// filled in for every request.
+const RootCtxKey CtxKey = "root"
+
+// ResponseRecorderCtxKey is the context key for the
+// ResponseRecorder which the server wraps around the
+// ResponseWriter of every request.
+const ResponseRecorderCtxKey CtxKey = "response_recorder"
+
 // currentTime, as it is defined here, returns time.Now().
 // It's defined as a variable for mocking time in tests.
 var currentTime = func() time.Time { return time.Now() }
@@ -1,7 +1,10 @@
 package httpserver
 
 import (
+	"net"
+	"net/http"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -56,3 +59,118 @@ func TestPathCaseSensitiveEnv(t *testing.T) {
 		}
 	}
 }
+
+func TestPrefersJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"text/html;q=0.5, application/json", true},
+		{"application/json;q=0.5, text/html", false},
+		{"application/json, */*", true},
+		{"application/json;q=0", false},
+	}
+	for i, test := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create request: %v", i, err)
+		}
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if actual := PrefersJSON(r); actual != test.expected {
+			t.Errorf("Test %d: Expected PrefersJSON to be %v for Accept '%s', got %v", i, test.expected, test.accept, actual)
+		}
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		shouldError bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{"10.1.2.3", "10.1.2.3/32", false},
+		{"::1", "::1/128", false},
+		{"fd00::/8", "fd00::/8", false},
+		{"10.0.0.0/33", "", true},
+		{"localhost", "", true},
+		{"", "", true},
+	}
+	for i, test := range tests {
+		network, err := ParseNetwork(test.input)
+		if test.shouldError {
+			if err == nil {
+				t.Errorf("Test %d: Expected error for '%s', got %v", i, test.input, network)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error for '%s', got: %v", i, test.input, err)
+			continue
+		}
+		if network.String() != test.expected {
+			t.Errorf("Test %d: Expected network %s, got %s", i, test.expected, network)
+		}
+	}
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"172.0.0.1:80", "", "172.0.0.1"},
+		{"172.0.0.1:80", "192.168.0.1", "172.0.0.1"}, // untrusted peer
+		{"10.0.0.1:80", "192.168.0.1", "192.168.0.1"},
+		{"10.0.0.1:80", "1.2.3.4, 192.168.0.1, 10.0.0.2", "192.168.0.1"},
+		{"10.0.0.1:80", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:80", "192.168.0.1, garbage", "10.0.0.1"},
+		{"10.0.0.1:80", "", "10.0.0.1"},
+	}
+	for i, test := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if ip := ForwardedClientIP(r, "X-Forwarded-For", []*net.IPNet{trusted}); ip != test.expectedIP {
+			t.Errorf("Test %d: Expected client ip %s, got %s", i, test.expectedIP, ip)
+		}
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		vary     []string
+		expected []string
+	}{
+		{nil, []string{"Origin"}},
+		{[]string{"Cookie"}, []string{"Cookie", "Origin"}},
+		{[]string{"Cookie, origin"}, []string{"Cookie, origin"}},
+		{[]string{"Origin", "Cookie"}, []string{"Origin", "Cookie"}},
+		{[]string{"*"}, []string{"*"}},
+	}
+	for i, test := range tests {
+		h := http.Header{}
+		if test.vary != nil {
+			h["Vary"] = test.vary
+		}
+		AddVary(h, "Origin")
+		if got := h["Vary"]; !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected Vary %q, got %q", i, test.expected, got)
+		}
+	}
+}
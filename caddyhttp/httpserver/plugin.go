@@ -20,7 +20,7 @@ func init() {
 	flag.StringVar(&Host, "host", DefaultHost, "Default host")
 	flag.StringVar(&Port, "port", DefaultPort, "Default port")
 	flag.StringVar(&Root, "root", DefaultRoot, "Root path of default site")
-	flag.DurationVar(&GracefulTimeout, "grace", 5*time.Second, "Maximum duration of graceful shutdown") // TODO
+	flag.DurationVar(&GracefulTimeout, "grace", 5*time.Second, "Maximum duration of graceful shutdown")
 	flag.BoolVar(&HTTP2, "http2", true, "Use HTTP/2")
 	flag.BoolVar(&QUIC, "quic", false, "Use experimental QUIC")
 
@@ -214,12 +214,18 @@ func groupSiteConfigsByListenAddr(configs []*SiteConfig) (map[string][]*SiteConf
 		if conf.Addr.Port == "" {
 			conf.Addr.Port = Port
 		}
-		addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(conf.ListenHost, conf.Addr.Port))
-		if err != nil {
-			return nil, err
+		listenHosts := conf.ListenHosts
+		if len(listenHosts) == 0 {
+			listenHosts = []string{conf.ListenHost}
+		}
+		for _, host := range listenHosts {
+			addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, conf.Addr.Port))
+			if err != nil {
+				return nil, fmt.Errorf("%s: bind address %s: %v", conf.Addr, host, err)
+			}
+			addrstr := addr.String()
+			groups[addrstr] = append(groups[addrstr], conf)
 		}
-		addrstr := addr.String()
-		groups[addrstr] = append(groups[addrstr], conf)
 	}
 
 	return groups, nil
@@ -334,33 +340,48 @@ var directives = []string{
 	"root",
 	"tls",
 	"bind",
+	"grace",
+	"etag",
+	"server_header",
+	"index",
+	"timeouts",
+	"proxy_protocol",
 
 	// services/utilities, or other directives that don't necessarily inject handlers
 	"startup",
 	"shutdown",
-	"realip", // github.com/captncraig/caddy-realip
-	"git",    // github.com/abiosoft/caddy-git
+	"realip",
+	"requestid",
+	"git", // github.com/abiosoft/caddy-git
 
 	// directives that add middleware to the stack
+	"metrics",
 	"locale", // github.com/simia-tech/caddy-locale
 	"log",
 	"rewrite",
+	"try_files",
 	"ext",
+	"push",
+	"brotli",
 	"gzip",
 	"errors",
-	"minify",    // github.com/hacdias/caddy-minify
-	"ipfilter",  // github.com/pyed/ipfilter
-	"ratelimit", // github.com/xuqingfeng/caddy-rate-limit
-	"search",    // github.com/pedronasser/caddy-search
+	"maintenance",
+	"limit",
+	"minify", // github.com/hacdias/caddy-minify
+	"ipfilter",
+	"ratelimit",
+	"search", // github.com/pedronasser/caddy-search
 	"header",
 	"redir",
-	"cors", // github.com/captncraig/cors/caddy
+	"cors",
+	"methods",
 	"mime",
 	"basicauth",
 	"jwt",    // github.com/BTBurke/caddy-jwt
 	"jsonp",  // github.com/pschlump/caddy-jsonp
 	"upload", // blitznote.com/src/caddy.upload
 	"internal",
+	"cache",
 	"pprof",
 	"expvar",
 	"proxy",
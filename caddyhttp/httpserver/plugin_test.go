@@ -137,3 +137,35 @@ func TestInspectServerBlocksWithCustomDefaultPort(t *testing.T) {
 		t.Errorf("Expected the port on the address to be set, but got: %#v", addr)
 	}
 }
+
+func TestGroupSiteConfigsByListenAddr(t *testing.T) {
+	lan := &SiteConfig{Addr: Address{Host: "example.com", Port: "80"},
+		ListenHost: "10.0.0.5", ListenHosts: []string{"10.0.0.5", "192.168.1.10"}}
+	single := &SiteConfig{Addr: Address{Host: "example.net", Port: "80"}, ListenHost: "10.0.0.5"}
+	all := &SiteConfig{Addr: Address{Host: "example.org", Port: "80"}}
+
+	groups, err := groupSiteConfigsByListenAddr([]*SiteConfig{lan, single, all})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := map[string][]*SiteConfig{
+		"10.0.0.5:80":     {lan, single},
+		"192.168.1.10:80": {lan},
+		":80":             {all},
+	}
+	if len(groups) != len(expected) {
+		t.Errorf("Expected %d groups, got %d: %v", len(expected), len(groups), groups)
+	}
+	for addr, sites := range expected {
+		if got := groups[addr]; len(got) != len(sites) || got[0] != sites[0] || got[len(got)-1] != sites[len(sites)-1] {
+			t.Errorf("Expected sites %v on %s, got %v", sites, addr, got)
+		}
+	}
+
+	bad := &SiteConfig{Addr: Address{Host: "example.com", Port: "80"},
+		ListenHost: "10.0.0.5", ListenHosts: []string{"10.0.0.5", "no-such-host.invalid"}}
+	_, err = groupSiteConfigsByListenAddr([]*SiteConfig{bad})
+	if err == nil || !strings.Contains(err.Error(), "no-such-host.invalid") {
+		t.Errorf("Expected error naming the failed bind address, got: %v", err)
+	}
+}
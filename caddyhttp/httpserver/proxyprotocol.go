@@ -0,0 +1,190 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout is how long a connection may take to send its
+// PROXY protocol header, if the server has no read header timeout.
+const proxyHeaderTimeout = 10 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolListener is a net.Listener for connections from load
+// balancers that convey the address of the client with the PROXY
+// protocol (version 1 or 2), which it sets as the remote address of
+// the connections. Only connections from the trusted networks may
+// send a header; the header is optional for them, and the others
+// are left alone.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+// Accept accepts a connection.
+func (l proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil || !IPInNetworks(host, l.trusted) {
+		return c, nil
+	}
+	return &proxyProtocolConn{Conn: c, r: bufio.NewReader(c), timeout: l.timeout}, nil
+}
+
+// proxyProtocolConn is a connection that may start with a PROXY
+// protocol header. The header is read when the connection is
+// first used, which keeps it from blocking the accept loop.
+type proxyProtocolConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	remote  net.Addr
+	err     error
+}
+
+// Read reads from c after the header.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client conveyed by
+// the header, or the address of the peer if there is none.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads the header, if there is one. The HTTP server
+// asks for the remote address before it sets any deadlines, so
+// the header is read with its own deadline.
+func (c *proxyProtocolConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	if ok, err := peekPrefix(c.r, proxyV1Prefix); err != nil {
+		c.err = err
+		return
+	} else if ok {
+		c.remote, c.err = readProxyV1(c.r)
+		return
+	}
+	if ok, err := peekPrefix(c.r, proxyV2Signature); err != nil {
+		c.err = err
+		return
+	} else if ok {
+		c.remote, c.err = readProxyV2(c.r)
+	}
+}
+
+// peekPrefix returns true if r starts with prefix. It only
+// waits for as many bytes as it takes to tell.
+func peekPrefix(r *bufio.Reader, prefix []byte) (bool, error) {
+	for i := 1; i <= len(prefix); i++ {
+		b, err := r.Peek(i)
+		if err == io.EOF && len(b) < i {
+			return false, nil // too short to be a header
+		}
+		if err != nil {
+			return false, err
+		}
+		if b[i-1] != prefix[i-1] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// readProxyV1 reads a version 1 (text) header from r, like
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", and
+// returns the source address, or nil for "PROXY UNKNOWN".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// the longest header is 107 bytes
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("PROXY protocol header is not terminated")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY protocol header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("malformed PROXY protocol header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 reads a version 2 (binary) header from r, and
+// returns the source address, or nil for LOCAL connections,
+// such as health checks, and unsupported address families.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+	cmd, family := hdr[12]&0xf, hdr[13]
+	addrs := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, err
+	}
+	if cmd == 0 {
+		return nil, nil // LOCAL
+	}
+	if cmd != 1 {
+		return nil, fmt.Errorf("unsupported PROXY protocol command %d", cmd)
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(addrs) < 12 {
+			return nil, fmt.Errorf("PROXY protocol addresses are too short")
+		}
+		return &net.TCPAddr{IP: net.IP(addrs[0:4]), Port: int(binary.BigEndian.Uint16(addrs[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(addrs) < 36 {
+			return nil, fmt.Errorf("PROXY protocol addresses are too short")
+		}
+		return &net.TCPAddr{IP: net.IP(addrs[0:16]), Port: int(binary.BigEndian.Uint16(addrs[32:34]))}, nil
+	}
+	return nil, nil
+}
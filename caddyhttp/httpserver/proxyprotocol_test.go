@@ -0,0 +1,132 @@
+package httpserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestProxyProtocolListener(t *testing.T) {
+	v2 := func(cmd, family byte, addrs []byte) string {
+		hdr := append([]byte{}, proxyV2Signature...)
+		hdr = append(hdr, 0x20|cmd, family, 0, 0)
+		binary.BigEndian.PutUint16(hdr[14:], uint16(len(addrs)))
+		return string(append(hdr, addrs...))
+	}
+	v2IPv4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	v2IPv6 := append(append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0x01, 0xbb), 0x03, 0x00, 0x00) // with a TLV
+
+	loopback := mustParseCIDRs(t, "127.0.0.0/8", "::1/128")
+	tests := []struct {
+		trusted      []*net.IPNet
+		sent         string
+		expectRemote string // empty for the address of the peer
+		expectData   string
+		expectErr    bool
+	}{
+		{loopback, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello", "192.0.2.1:56324", "hello", false},
+		{loopback, "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nhello", "[2001:db8::1]:56324", "hello", false},
+		{loopback, "PROXY UNKNOWN\r\nhello", "", "hello", false},
+		{loopback, v2(1, 0x11, v2IPv4) + "hello", "192.0.2.1:56324", "hello", false},
+		{loopback, v2(1, 0x21, v2IPv6) + "hello", "[2001:db8::1]:56324", "hello", false},
+		{loopback, v2(0, 0x00, nil) + "hello", "", "hello", false}, // LOCAL
+		{loopback, "GET / HTTP/1.1\r\n", "", "GET / HTTP/1.1\r\n", false},
+		{loopback, "POST / HTTP/1.1\r\n", "", "POST / HTTP/1.1\r\n", false},
+		{loopback, "PROXY TCP4 192.0.2.1\r\nhello", "", "", true},
+		{loopback, "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\nhello", "", "", true},
+		{loopback, "PROXY TCP4 192.0.2.1 198.51.100.1 99999 443\r\nhello", "", "", true},
+		{loopback, v2(1, 0x11, v2IPv4[:8]) + "hello", "", "", true},
+		// the header is only read from trusted networks
+		{mustParseCIDRs(t, "10.0.0.0/8"), "PROXY UNKNOWN\r\nhello", "", "PROXY UNKNOWN\r\nhello", false},
+	}
+	for i, test := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pln := proxyProtocolListener{Listener: ln, trusted: test.trusted, timeout: time.Second}
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Write([]byte(test.sent))
+		client.Close()
+
+		conn, err := pln.Accept()
+		if err != nil {
+			t.Fatalf("Test %d: Accepting: %v", i, err)
+		}
+		expectRemote := test.expectRemote
+		if expectRemote == "" {
+			expectRemote = client.LocalAddr().String()
+		}
+		if got := conn.RemoteAddr().String(); !test.expectErr && got != expectRemote {
+			t.Errorf("Test %d: Expected remote address %s, got %s", i, expectRemote, got)
+		}
+		data, err := ioutil.ReadAll(conn)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error reading a malformed header, got data %q", i, data)
+			}
+		} else if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		} else if string(data) != test.expectData {
+			t.Errorf("Test %d: Expected data %q, got %q", i, test.expectData, data)
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func TestServeProxyProtocol(t *testing.T) {
+	site := &SiteConfig{TLS: new(caddytls.Config), ProxyProtocol: mustParseCIDRs(t, "127.0.0.0/8")}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Creating server: %v", err)
+	}
+	s.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 80\r\nGET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Reading response: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got, want := string(body), "192.0.2.1:56324"; got != want {
+		t.Errorf("Expected the remote address of the request to be %s, got %s", want, got)
+	}
+}
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Parsing %s: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -42,6 +42,15 @@ func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
 	}
 }
 
+// RequestRecorder returns the ResponseRecorder of the response to
+// r, which the server records for every request so the response
+// placeholders work anywhere in the middleware chain. It returns
+// nil if there is none, e.g. when middleware is called directly.
+func RequestRecorder(r *http.Request) *ResponseRecorder {
+	rr, _ := r.Context().Value(ResponseRecorderCtxKey).(*ResponseRecorder)
+	return rr
+}
+
 // WriteHeader records the status code and calls the
 // underlying ResponseWriter's WriteHeader method.
 func (r *ResponseRecorder) WriteHeader(status int) {
@@ -88,6 +97,16 @@ func (r *ResponseRecorder) Flush() {
 	}
 }
 
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (r *ResponseRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 // CloseNotify implements http.CloseNotifier.
 // It just inherits the underlying ResponseWriter's CloseNotify method.
 func (r *ResponseRecorder) CloseNotify() <-chan bool {
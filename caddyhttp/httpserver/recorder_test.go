@@ -1,9 +1,12 @@
 package httpserver
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 func TestNewResponseRecorder(t *testing.T) {
@@ -38,3 +41,49 @@ func TestWrite(t *testing.T) {
 		t.Fatalf("Expected Response Body to be %s , but found %s\n", responseTestString, w.Body.String())
 	}
 }
+
+func TestPushNotSupported(t *testing.T) {
+	recordRequest := NewResponseRecorder(httptest.NewRecorder())
+	if err := recordRequest.Push("/app.css", nil); err != http.ErrNotSupported {
+		t.Errorf("Expected http.ErrNotSupported from a writer that can't push, got %v", err)
+	}
+}
+
+func TestRequestRecorder(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if rr := RequestRecorder(req); rr != nil {
+		t.Errorf("Expected no recorder for a request that isn't served, got %v", rr)
+	}
+
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{TLS: new(caddytls.Config)}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var rep Replacer
+	s.sites[0].middlewareChain = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if RequestRecorder(r) == nil {
+			t.Error("Expected the server to record the response")
+		}
+		// wrap w, like compressing middleware does
+		w = struct{ http.ResponseWriter }{w}
+		rep = NewReplacer(r, nil, "-")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+		return 0, nil
+	})
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got, want := rep.Replace("{status} {size}"), "418 15"; got != want {
+		t.Errorf("Expected response placeholders to be replaced with %q, got %q", want, got)
+	}
+}
+
+func TestResponseRecorderInterfaces(t *testing.T) {
+	fw := &FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	if _, err := UseOptionalInterfaces(NewResponseRecorder(fw), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
@@ -1,6 +1,10 @@
 package httpserver
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -10,6 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 // requestReplacer is a strings.Replacer which is used to
@@ -41,17 +47,23 @@ type replacer struct {
 	customReplacements map[string]func() string
 	emptyValue         string
 	responseRecorder   *ResponseRecorder
+	request            *http.Request
 }
 
 // NewReplacer makes a new replacer based on r and rr which
 // are used for request and response placeholders, respectively.
 // Request placeholders are created immediately, whereas
 // response placeholders are not created until Replace()
-// is invoked. rr may be nil if it is not available.
+// is invoked. If rr is nil, the recorder of the response to r
+// is used, if the server records it.
 // emptyValue should be the string that is used in place
 // of empty string (can still be empty string).
 func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Replacer {
+	if rr == nil && r != nil {
+		rr = RequestRecorder(r)
+	}
 	rep := &replacer{
+		request:            r,
 		responseRecorder:   rr,
 		customReplacements: make(map[string]func() string),
 		replacements: map[string]func() string{
@@ -84,21 +96,19 @@ func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Repla
 			"{fragment}":      func() string { return r.URL.Fragment },
 			"{proto}":         func() string { return r.Proto },
 			"{remote}": func() string {
-				if fwdFor := r.Header.Get("X-Forwarded-For"); fwdFor != "" {
-					return fwdFor
-				}
 				host, _, err := net.SplitHostPort(r.RemoteAddr)
 				if err != nil {
 					return r.RemoteAddr
 				}
 				return host
 			},
-			"{port}": func() string {
-				_, port, err := net.SplitHostPort(r.RemoteAddr)
-				if err != nil {
-					return ""
+			"{port}":        func() string { return addrPort(r.RemoteAddr) },
+			"{remote_port}": func() string { return addrPort(r.RemoteAddr) },
+			"{local_port}": func() string {
+				if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+					return addrPort(addr.String())
 				}
-				return port
+				return ""
 			},
 			"{uri}":         func() string { return r.URL.RequestURI() },
 			"{uri_escaped}": func() string { return url.QueryEscape(r.URL.RequestURI()) },
@@ -111,6 +121,48 @@ func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Repla
 				dir, _ := path.Split(r.URL.Path)
 				return dir
 			},
+			"{tls_version}": func() string {
+				if r.TLS == nil {
+					return ""
+				}
+				return caddytls.ProtocolName(r.TLS.Version)
+			},
+			"{tls_cipher}": func() string {
+				if r.TLS == nil {
+					return ""
+				}
+				return caddytls.CipherName(r.TLS.CipherSuite)
+			},
+			"{tls_client_subject}": func() string {
+				if cert := verifiedClientCert(r); cert != nil {
+					return cert.Subject.String()
+				}
+				return ""
+			},
+			"{tls_client_serial}": func() string {
+				if cert := verifiedClientCert(r); cert != nil {
+					return cert.SerialNumber.Text(16)
+				}
+				return ""
+			},
+			"{tls_client_san}": func() string {
+				if cert := verifiedClientCert(r); cert != nil {
+					return strings.Join(subjectAltNames(cert), ",")
+				}
+				return ""
+			},
+			"{tls_client_fingerprint}": func() string {
+				if cert := verifiedClientCert(r); cert != nil {
+					return fmt.Sprintf("%x", sha256.Sum256(cert.Raw))
+				}
+				return ""
+			},
+			"{request_id}": func() string {
+				if id, ok := r.Context().Value(RequestIDCtxKey).(string); ok {
+					return id
+				}
+				return r.Header.Get("X-Request-ID")
+			},
 			"{request}": func() string {
 				dump, err := httputil.DumpRequest(r, false)
 				if err != nil {
@@ -132,6 +184,40 @@ func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Repla
 	return rep
 }
 
+// addrPort returns the port of the network address addr, or
+// empty string if it has none, like the address of a unix socket.
+func addrPort(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// verifiedClientCert returns the client certificate of r, if the
+// client sent one and it was verified, or nil otherwise.
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// subjectAltNames returns the DNS names, email addresses,
+// IP addresses and URIs of cert, in that order.
+func subjectAltNames(cert *x509.Certificate) []string {
+	var names []string
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
 // Replace performs a replacement of values on s and returns
 // the string with the replaced values.
 func (r *replacer) Replace(s string) string {
@@ -148,6 +234,10 @@ func (r *replacer) Replace(s string) string {
 			dur := time.Since(r.responseRecorder.start)
 			return roundDuration(dur).String()
 		}
+		r.replacements["{latency_ms}"] = func() string {
+			dur := time.Since(r.responseRecorder.start)
+			return strconv.FormatInt(int64(dur/time.Millisecond), 10)
+		}
 	}
 
 	// Include custom placeholders, overwriting existing ones if necessary
@@ -175,6 +265,12 @@ func (r *replacer) Replace(s string) string {
 		}
 	}
 
+	// Query parameter replacements - these are looked up when replacing,
+	// so they reflect the request as it is now, e.g. after a rewrite
+	if r.request != nil && strings.Contains(s, queryReplacer) {
+		s = r.replaceQuery(s)
+	}
+
 	// Regular replacements - these are easier because they're case-sensitive
 	for placeholder, getReplacement := range r.replacements {
 		if !strings.Contains(s, placeholder) {
@@ -190,6 +286,34 @@ func (r *replacer) Replace(s string) string {
 	return s
 }
 
+// replaceQuery replaces the query parameter placeholders in s.
+// Replaced values are not searched for more placeholders.
+func (r *replacer) replaceQuery(s string) string {
+	query := r.request.URL.Query()
+	var buf bytes.Buffer
+	for {
+		idxStart := strings.Index(s, queryReplacer)
+		if idxStart < 0 {
+			break
+		}
+		idxEnd := strings.Index(s[idxStart:], "}")
+		if idxEnd < 0 {
+			break
+		}
+		idxEnd += idxStart
+
+		replacement := query.Get(s[idxStart+len(queryReplacer) : idxEnd])
+		if replacement == "" {
+			replacement = r.emptyValue
+		}
+		buf.WriteString(s[:idxStart])
+		buf.WriteString(replacement)
+		s = s[idxEnd+1:]
+	}
+	buf.WriteString(s)
+	return buf.String()
+}
+
 func roundDuration(d time.Duration) time.Duration {
 	if d >= time.Millisecond {
 		return round(d, time.Millisecond)
@@ -228,4 +352,5 @@ func (r *replacer) Set(key, value string) {
 const (
 	timeFormat     = "02/Jan/2006:15:04:05 -0700"
 	headerReplacer = "{>"
+	queryReplacer  = "{?"
 )
@@ -1,8 +1,15 @@
 package httpserver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -112,6 +119,173 @@ func TestReplace(t *testing.T) {
 	}
 }
 
+func TestReplaceTLSAndRequestID(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://localhost", nil)
+	if err != nil {
+		t.Fatal("Request Formation Failed\n")
+	}
+	request.Header.Set("X-Request-ID", "abc123")
+	request.TLS = &tls.ConnectionState{
+		Version:     tls.VersionTLS12,
+		CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	}
+	recordRequest := NewResponseRecorder(httptest.NewRecorder())
+	repl := NewReplacer(request, recordRequest, "-")
+
+	template := "{tls_version} {tls_cipher} {request_id}"
+	expect := "tls1.2 ECDHE-RSA-AES128-GCM-SHA256 abc123"
+	if actual := repl.Replace(template); actual != expect {
+		t.Errorf("Expected '%s', got '%s'", expect, actual)
+	}
+
+	if actual := repl.Replace("{latency_ms}"); actual != "0" {
+		t.Errorf("Expected latency_ms to be 0, got '%s'", actual)
+	}
+
+	// without TLS or a request ID, these are empty
+	request.TLS = nil
+	request.Header.Del("X-Request-ID")
+	repl = NewReplacer(request, recordRequest, "-")
+	if actual := repl.Replace(template); actual != "- - -" {
+		t.Errorf("Expected '- - -', got '%s'", actual)
+	}
+}
+
+func TestReplaceTLSClientSubject(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://localhost", nil)
+	if err != nil {
+		t.Fatal("Request Formation Failed\n")
+	}
+	client := &x509.Certificate{Subject: pkix.Name{CommonName: "api-client", Organization: []string{"Caddy"}}}
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}
+
+	// only verified certificates count
+	repl := NewReplacer(request, nil, "-")
+	if actual := repl.Replace("{tls_client_subject}"); actual != "-" {
+		t.Errorf("Expected '-' for an unverified certificate, got '%s'", actual)
+	}
+
+	request.TLS.VerifiedChains = [][]*x509.Certificate{{client}}
+	repl = NewReplacer(request, nil, "-")
+	if actual, expect := repl.Replace("{tls_client_subject}"), "CN=api-client,O=Caddy"; actual != expect {
+		t.Errorf("Expected '%s', got '%s'", expect, actual)
+	}
+}
+
+func TestReplaceTLSClientCert(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://localhost", nil)
+	if err != nil {
+		t.Fatal("Request Formation Failed\n")
+	}
+	uri, _ := url.Parse("spiffe://example.com/api")
+	client := &x509.Certificate{
+		Raw:            []byte("certificate"),
+		SerialNumber:   big.NewInt(0xabc123),
+		Subject:        pkix.Name{CommonName: "api-client"},
+		DNSNames:       []string{"api.example.com"},
+		EmailAddresses: []string{"api@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.1")},
+		URIs:           []*url.URL{uri},
+	}
+	template := "{tls_client_serial}|{tls_client_san}|{tls_client_fingerprint}"
+
+	// without a verified client certificate, these are empty
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}
+	repl := NewReplacer(request, nil, "")
+	if actual := repl.Replace(template); actual != "||" {
+		t.Errorf("Expected empty values for an unverified certificate, got '%s'", actual)
+	}
+
+	request.TLS.VerifiedChains = [][]*x509.Certificate{{client}}
+	repl = NewReplacer(request, nil, "")
+	expect := "abc123|api.example.com,api@example.com,192.0.2.1,spiffe://example.com/api|" +
+		"03d66dd08835c1ca3f128cceacd1f31ac94163096b20f445ae84285bc0832d72"
+	if actual := repl.Replace(template); actual != expect {
+		t.Errorf("Expected '%s', got '%s'", expect, actual)
+	}
+}
+
+func TestReplaceRemoteIgnoresForwardedFor(t *testing.T) {
+	request, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal("Request Formation Failed\n")
+	}
+	request.RemoteAddr = "192.0.2.10:1234"
+	request.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+	// anyone can send X-Forwarded-For; the realip
+	// middleware decides whether to believe it
+	repl := NewReplacer(request, nil, "-")
+	if actual, expect := repl.Replace("{remote}"), "192.0.2.10"; actual != expect {
+		t.Errorf("Expected '%s', got '%s'", expect, actual)
+	}
+}
+
+func TestReplacePorts(t *testing.T) {
+	tests := []struct {
+		remoteAddr   string
+		localAddr    net.Addr
+		expectRemote string
+		expectLocal  string
+	}{
+		{"192.0.2.10:51234", &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}, "51234", "443"},
+		{"[2001:db8::1]:51234", &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 8080}, "51234", "8080"},
+		{"@", &net.UnixAddr{Name: "/run/caddy.sock", Net: "unix"}, "-", "-"},
+		{"192.0.2.10:51234", nil, "51234", "-"},
+	}
+	for i, test := range tests {
+		request, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal("Request Formation Failed\n")
+		}
+		request.RemoteAddr = test.remoteAddr
+		if test.localAddr != nil {
+			request = request.WithContext(context.WithValue(request.Context(), http.LocalAddrContextKey, test.localAddr))
+		}
+		repl := NewReplacer(request, nil, "-")
+		if actual := repl.Replace("{remote_port}"); actual != test.expectRemote {
+			t.Errorf("Test %d: Expected remote port '%s', got '%s'", i, test.expectRemote, actual)
+		}
+		if actual := repl.Replace("{port}"); actual != test.expectRemote {
+			t.Errorf("Test %d: Expected port '%s', got '%s'", i, test.expectRemote, actual)
+		}
+		if actual := repl.Replace("{local_port}"); actual != test.expectLocal {
+			t.Errorf("Test %d: Expected local port '%s', got '%s'", i, test.expectLocal, actual)
+		}
+	}
+}
+
+func TestReplaceQuery(t *testing.T) {
+	request, err := http.NewRequest("GET", "/?mobile=1&name=caddy&tricky={?mobile}", nil)
+	if err != nil {
+		t.Fatal("Request Formation Failed\n")
+	}
+	repl := NewReplacer(request, nil, "-")
+
+	testCases := []struct {
+		template string
+		expect   string
+	}{
+		{"mobile={?mobile}", "mobile=1"},
+		{"{?name}/{?mobile}", "caddy/1"},
+		{"missing={?missing}", "missing=-"},
+		{"{?tricky}", "{?mobile}"},
+		{"Bad {?mobile placeholder", "Bad {?mobile placeholder"},
+	}
+	for _, c := range testCases {
+		if expected, actual := c.expect, repl.Replace(c.template); expected != actual {
+			t.Errorf("for template '%s', expected '%s', got '%s'", c.template, expected, actual)
+		}
+	}
+
+	// query parameters are looked up when replacing, so
+	// changes to the request, like rewrites, are seen
+	request.URL.RawQuery = "mobile=0"
+	if actual := repl.Replace("{?mobile}"); actual != "0" {
+		t.Errorf("Expected replacement to see the current query, got '%s'", actual)
+	}
+}
+
 func TestSet(t *testing.T) {
 	w := httptest.NewRecorder()
 	recordRequest := NewResponseRecorder(w)
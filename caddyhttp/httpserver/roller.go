@@ -3,6 +3,8 @@ package httpserver
 import (
 	"io"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/mholt/caddy"
 
@@ -12,32 +14,116 @@ import (
 // LogRoller implements a type that provides a rolling logger.
 type LogRoller struct {
 	Filename   string
-	MaxSize    int
-	MaxAge     int
+	MaxSize    int // megabytes
+	MaxAge     int // days to keep backups
+	RotateAge  int // days after which the file is rotated
 	MaxBackups int
+	Compress   bool
 	LocalTime  bool
 }
 
 // GetLogWriter returns an io.Writer that writes to a rolling logger.
+// The logger rotates under a lock, so concurrent writes made while
+// a file is being rotated are not lost.
 func (l LogRoller) GetLogWriter() io.Writer {
-	return &lumberjack.Logger{
+	logger := &lumberjack.Logger{
 		Filename:   l.Filename,
 		MaxSize:    l.MaxSize,
 		MaxAge:     l.MaxAge,
 		MaxBackups: l.MaxBackups,
+		Compress:   l.Compress,
 		LocalTime:  l.LocalTime,
 	}
+	if l.RotateAge > 0 {
+		return &ageRoller{Logger: logger, maxAge: time.Duration(l.RotateAge) * 24 * time.Hour}
+	}
+	return logger
+}
+
+// ageRoller rotates the file of a lumberjack.Logger, which only
+// rotates by size, once it has been written to for maxAge.
+type ageRoller struct {
+	*lumberjack.Logger
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	started time.Time // of the current file
+}
+
+// Write writes p to the file, after rotating it if it is too old.
+func (r *ageRoller) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.started.IsZero() {
+		r.started = now
+	} else if now.Sub(r.started) >= r.maxAge {
+		if err := r.Logger.Rotate(); err != nil {
+			return 0, err
+		}
+		r.started = now
+	}
+	return r.Logger.Write(p)
+}
+
+// IsLogRollerSubdirective returns true if subdir is one of the
+// rotate_* subdirectives that configure a LogRoller.
+func IsLogRollerSubdirective(subdir string) bool {
+	switch subdir {
+	case "rotate_size", "rotate_age", "rotate_keep", "rotate_compress":
+		return true
+	}
+	return false
+}
+
+// ParseRollerSubdirective applies the rotate_* subdirective
+// at the current token of c to l.
+func ParseRollerSubdirective(c *caddy.Controller, l *LogRoller) error {
+	what := c.Val()
+	if what == "rotate_compress" {
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		l.Compress = true
+		return nil
+	}
+
+	if !c.NextArg() {
+		return c.ArgErr()
+	}
+	value, err := strconv.Atoi(c.Val())
+	if err != nil || value < 0 {
+		return c.Errf("%s must be a non-negative integer, got '%s'", what, c.Val())
+	}
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+
+	switch what {
+	case "rotate_size":
+		l.MaxSize = value
+	case "rotate_age":
+		l.RotateAge = value
+	case "rotate_keep":
+		l.MaxBackups = value
+	}
+	return nil
 }
 
 // ParseRoller parses roller contents out of c.
 func ParseRoller(c *caddy.Controller) (*LogRoller, error) {
 	var size, age, keep int
+	var compress bool
 	// This is kind of a hack to support nested blocks:
 	// As we are already in a block: either log or errors,
 	// c.nesting > 0 but, as soon as c meets a }, it thinks
 	// the block is over and return false for c.NextBlock.
 	for c.NextBlock() {
 		what := c.Val()
+		if what == "compress" {
+			compress = true
+			continue
+		}
 		if !c.NextArg() {
 			return nil, c.ArgErr()
 		}
@@ -59,6 +145,7 @@ func ParseRoller(c *caddy.Controller) (*LogRoller, error) {
 		MaxSize:    size,
 		MaxAge:     age,
 		MaxBackups: keep,
+		Compress:   compress,
 		LocalTime:  true,
 	}, nil
 }
@@ -0,0 +1,51 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestGetLogWriterRotateAge(t *testing.T) {
+	if _, ok := (LogRoller{RotateAge: 1}).GetLogWriter().(*ageRoller); !ok {
+		t.Error("Expected a writer that rotates by age for rotate_age")
+	}
+	if _, ok := (LogRoller{MaxAge: 1}).GetLogWriter().(*lumberjack.Logger); !ok {
+		t.Error("Expected a plain lumberjack logger without rotate_age")
+	}
+}
+
+func TestAgeRoller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_roller")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := &lumberjack.Logger{Filename: filepath.Join(dir, "access.log")}
+	defer logger.Close()
+	r := &ageRoller{Logger: logger, maxAge: 50 * time.Millisecond}
+
+	r.Write([]byte("first\n"))
+	r.Write([]byte("second\n"))
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("Expected 1 file before the file got old, got %d", len(files))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	r.Write([]byte("third\n"))
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("Expected the old file to be rotated to a backup, got %d files", len(files))
+	}
+	body, err := ioutil.ReadFile(logger.Filename)
+	if err != nil {
+		t.Fatalf("Failed to read the log file: %v", err)
+	}
+	if got, want := string(body), "third\n"; got != want {
+		t.Errorf("Expected the new file to have '%s', got '%s'", want, got)
+	}
+}
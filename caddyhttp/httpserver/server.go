@@ -2,6 +2,7 @@
 package httpserver
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -24,12 +26,12 @@ import (
 type Server struct {
 	Server      *http.Server
 	quicServer  *h2quic.Server
-	listener    net.Listener
+	listener    *gracefulListener
 	listenerMu  sync.Mutex
 	sites       []*SiteConfig
-	connTimeout time.Duration  // max time to wait for a connection before force stop
-	connWg      sync.WaitGroup // one increment per connection
-	tlsGovChan  chan struct{}  // close to stop the TLS maintenance goroutine
+	connTimeout time.Duration // max time to wait for connections before force stop
+	proxyProto  []*net.IPNet  // networks trusted to send PROXY protocol headers
+	tlsGovChan  chan struct{} // close to stop the TLS maintenance goroutine
 	vhosts      *vhostTrie
 }
 
@@ -42,9 +44,7 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 	s := &Server{
 		Server: &http.Server{
 			Addr: addr,
-			// TODO: Make these values configurable?
-			// ReadTimeout:    2 * time.Minute,
-			// WriteTimeout:   2 * time.Minute,
+			// TODO: Make this value configurable?
 			// MaxHeaderBytes: 1 << 16,
 		},
 		vhosts:      newVHostTrie(),
@@ -52,16 +52,26 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		connTimeout: GracefulTimeout,
 	}
 	s.Server.Handler = s // this is weird, but whatever
-	s.Server.ConnState = func(c net.Conn, cs http.ConnState) {
-		if cs == http.StateIdle {
-			s.listenerMu.Lock()
-			// server stopped, close idle connection
-			if s.listener == nil {
-				c.Close()
-			}
-			s.listenerMu.Unlock()
+
+	// The sites share the listener, so the longest grace period
+	// any of them configured overrides the default; plugins get
+	// to clean up while the connections are drained.
+	var gracePeriod time.Duration
+	for _, site := range group {
+		if site.GracePeriod > gracePeriod {
+			gracePeriod = site.GracePeriod
+		}
+		for _, f := range site.onDrain {
+			s.Server.RegisterOnShutdown(f)
 		}
+		// the sites share the connections too, so a site
+		// trusts the load balancers of the others as well
+		s.proxyProto = append(s.proxyProto, site.ProxyProtocol...)
 	}
+	if gracePeriod > 0 {
+		s.connTimeout = gracePeriod
+	}
+	s.setTimeouts(group)
 
 	// Disable HTTP/2 if desired
 	if !HTTP2 {
@@ -74,14 +84,6 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		s.Server.Handler = s.wrapWithSvcHeaders(s.Server.Handler)
 	}
 
-	// We have to bound our wg with one increment
-	// to prevent a "race condition" that is hard-coded
-	// into sync.WaitGroup.Wait() - basically, an add
-	// with a positive delta must be guaranteed to
-	// occur before Wait() is called on the wg.
-	// In a way, this kind of acts as a safety barrier.
-	s.connWg.Add(1)
-
 	// Set up TLS configuration
 	var tlsConfigs []*caddytls.Config
 	var err error
@@ -97,13 +99,26 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		s.Server.TLSConfig.NextProtos = []string{"h2"}
 	}
 
-	// Compile custom middleware for every site (enables virtual hosting)
+	// Compile custom middleware for every site (enables virtual hosting);
+	// a site bound to several addresses is compiled only once, so its
+	// servers share the middleware
 	for _, site := range group {
-		stack := Handler(staticfiles.FileServer{Root: http.Dir(site.Root), Hide: site.HiddenFiles})
-		for i := len(site.middleware) - 1; i >= 0; i-- {
-			stack = site.middleware[i](stack)
+		if site.middlewareChain == nil {
+			fileServer := staticfiles.FileServer{
+				Root:         http.Dir(site.Root),
+				Hide:         site.HiddenFiles,
+				DisableETags: site.DisableETags,
+				IndexPages:   site.IndexPages,
+			}
+			stack := Handler(fileServer)
+			if rootHasPlaceholders(site.Root) {
+				stack = requestRootFileServer{fileServer}
+			}
+			for i := len(site.middleware) - 1; i >= 0; i-- {
+				stack = site.middleware[i](stack)
+			}
+			site.middlewareChain = stack
 		}
-		site.middlewareChain = stack
 		s.vhosts.Insert(site.Addr.VHost(), site)
 	}
 
@@ -159,12 +174,22 @@ func (s *Server) Serve(ln net.Listener) error {
 		ln = tcpKeepAliveListener{TCPListener: tcpLn}
 	}
 
-	ln = newGracefulListener(ln, &s.connWg)
+	gl := newGracefulListener(ln)
+	ln = gl
 
 	s.listenerMu.Lock()
-	s.listener = ln
+	s.listener = gl
 	s.listenerMu.Unlock()
 
+	if len(s.proxyProto) > 0 {
+		// the header comes before anything else, even TLS
+		timeout := s.Server.ReadHeaderTimeout
+		if timeout == 0 {
+			timeout = proxyHeaderTimeout
+		}
+		ln = proxyProtocolListener{Listener: ln, trusted: s.proxyProto, timeout: timeout}
+	}
+
 	if s.Server.TLSConfig != nil {
 		// Create TLS listener - note that we do not replace s.listener
 		// with this TLS listener; tls.listener is unexported and does
@@ -190,6 +215,9 @@ func (s *Server) Serve(ln net.Listener) error {
 	if QUIC {
 		s.quicServer.Close()
 	}
+	if err == http.ErrServerClosed {
+		err = nil // stopped on purpose
+	}
 	return err
 }
 
@@ -198,6 +226,18 @@ func (s *Server) ServePacket(pc net.PacketConn) error { return nil }
 
 // ServeHTTP is the entry point of all HTTP requests.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, countMetrics := metricsRecorder(w)
+	defer countMetrics()
+
+	// record the response once for all middleware, which
+	// can get the recorder from the context of the request
+	rec, ok := w.(*ResponseRecorder)
+	if !ok {
+		rec = NewResponseRecorder(w)
+		w = rec
+	}
+	r = r.WithContext(context.WithValue(r.Context(), ResponseRecorderCtxKey, rec))
+
 	defer func() {
 		// We absolutely need to be sure we stay alive up here,
 		// even though, in theory, the errors middleware does this.
@@ -254,6 +294,14 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		return 0, nil
 	}
 
+	if vhost.ServerHeaderSet {
+		w = newServerHeaderWriter(w, vhost.ServerHeader)
+	}
+
+	if !clientCertAllowed(vhost, r) {
+		return http.StatusForbidden, nil
+	}
+
 	// trim the path portion of the site address from the beginning of
 	// the URL path, so a request to example.com/foo/blog on the site
 	// defined as example.com/foo appears as /blog instead of /foo/blog.
@@ -264,9 +312,68 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		}
 	}
 
+	if rootHasPlaceholders(vhost.Root) {
+		root, ok := requestRoot(vhost.Root, r)
+		if !ok {
+			return http.StatusBadRequest, nil
+		}
+		r = r.WithContext(context.WithValue(r.Context(), RootCtxKey, root))
+	}
+
 	return vhost.middlewareChain.ServeHTTP(w, r)
 }
 
+// placeholderRegexp matches the placeholders in a site root.
+var placeholderRegexp = regexp.MustCompile(`{[^{}]+}`)
+
+// rootHasPlaceholders returns true if root depends on the request.
+func rootHasPlaceholders(root string) bool {
+	return placeholderRegexp.MatchString(root)
+}
+
+// requestRoot returns root with its placeholders filled in for r.
+// Since requests control what the placeholders expand to, they
+// must not be empty or climb out of their place in the path, or
+// requests could reach files of other sites; if one does, the
+// root is rejected and false is returned.
+func requestRoot(root string, r *http.Request) (string, bool) {
+	repl := NewReplacer(r, nil, "")
+	ok := true
+	expanded := placeholderRegexp.ReplaceAllStringFunc(root, func(placeholder string) string {
+		value := repl.Replace(placeholder)
+		if value == "" {
+			ok = false
+		}
+		for _, elem := range strings.FieldsFunc(value, isPathSeparator) {
+			if elem == ".." {
+				ok = false
+			}
+		}
+		return value
+	})
+	return expanded, ok
+}
+
+func isPathSeparator(c rune) bool {
+	return c == '/' || c == '\\'
+}
+
+// requestRootFileServer serves the files of sites whose root
+// has placeholders, from the root of each request.
+type requestRootFileServer struct {
+	staticfiles.FileServer
+}
+
+// ServeHTTP implements the Handler interface.
+func (fs requestRootFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	root, ok := r.Context().Value(RootCtxKey).(string)
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	fs.Root = http.Dir(root)
+	return fs.FileServer.ServeHTTP(w, r)
+}
+
 // proxyHTTPChallenge solves the ACME HTTP challenge if r is the HTTP
 // request for the challenge. If it is, and if the request has been
 // fulfilled (response written), true is returned; false otherwise.
@@ -285,37 +392,47 @@ func (s *Server) proxyHTTPChallenge(vhost *SiteConfig, w http.ResponseWriter, r
 	return caddytls.HTTPChallengeHandler(w, r, altPort)
 }
 
+// clientCertAllowed reports whether r presented the client
+// certificate that vhost requires, if it requires one. The TLS
+// handshake may be more lenient than the site, since sites on
+// the same listener share its client authentication.
+func clientCertAllowed(vhost *SiteConfig, r *http.Request) bool {
+	if vhost.TLS == nil || !vhost.TLS.Enabled {
+		return true
+	}
+	switch vhost.TLS.ClientAuth {
+	case tls.RequireAnyClientCert:
+		return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+	case tls.RequireAndVerifyClientCert:
+		return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+	}
+	return true
+}
+
 // Address returns the address s was assigned to listen on.
 func (s *Server) Address() string {
 	return s.Server.Addr
 }
 
-// Stop stops s gracefully (or forcefully after timeout) and
-// closes its listener.
-func (s *Server) Stop() (err error) {
-	s.Server.SetKeepAlivesEnabled(false)
-
-	if runtime.GOOS != "windows" {
-		// force connections to close after timeout
-		done := make(chan struct{})
-		go func() {
-			s.connWg.Done() // decrement our initial increment used as a barrier
-			s.connWg.Wait()
-			close(done)
-		}()
-
-		// Wait for remaining connections to finish or
-		// force them all to close after timeout
-		select {
-		case <-time.After(s.connTimeout):
-		case <-done:
-		}
+// Stop stops s gracefully: it stops accepting connections and
+// waits for active requests to finish. Connections still open
+// when the grace period is over, including hijacked ones like
+// websockets, are closed forcefully.
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.connTimeout)
+	defer cancel()
+
+	// Shutdown closes the listener and idle connections, and
+	// waits for the others to become idle; it returns early
+	// with the context's error once the grace period is over
+	err := s.Server.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		err = nil
 	}
 
-	// Close the listener now; this stops the server without delay
 	s.listenerMu.Lock()
 	if s.listener != nil {
-		err = s.listener.Close()
+		s.listener.drain(ctx)
 		s.listener = nil
 	}
 	s.listenerMu.Unlock()
@@ -325,7 +442,7 @@ func (s *Server) Stop() (err error) {
 		close(s.tlsGovChan)
 	}
 
-	return
+	return err
 }
 
 // sanitizePath collapses any ./ ../ /// madness
@@ -365,6 +482,45 @@ func (s *Server) OnStartupComplete() {
 	}
 }
 
+// DefaultTimeouts are the timeouts of servers for which no site
+// configured its own. A client has to send the header of each
+// request, and the next request on a connection, without dawdling,
+// which stops slowloris attacks. Bodies and responses may take as
+// long as they need, so big uploads, downloads and streams work.
+var DefaultTimeouts = Timeouts{
+	ReadHeaderTimeout: 10 * time.Second,
+	IdleTimeout:       2 * time.Minute,
+}
+
+// setTimeouts sets the timeouts of s. The sites in group share s,
+// so of each timeout, the strictest one that any of them set is
+// used, or else the default. Zero, which is no timeout at all, is
+// only used if all of the sites that set the timeout agree on it.
+func (s *Server) setTimeouts(group []*SiteConfig) {
+	strictest := func(def time.Duration, get func(Timeouts) (time.Duration, bool)) time.Duration {
+		d, found := def, false
+		for _, site := range group {
+			v, ok := get(site.Timeouts)
+			if ok && (!found || (v != 0 && (d == 0 || v < d))) {
+				d, found = v, true
+			}
+		}
+		return d
+	}
+	s.Server.ReadTimeout = strictest(DefaultTimeouts.ReadTimeout, func(t Timeouts) (time.Duration, bool) {
+		return t.ReadTimeout, t.ReadTimeoutSet
+	})
+	s.Server.ReadHeaderTimeout = strictest(DefaultTimeouts.ReadHeaderTimeout, func(t Timeouts) (time.Duration, bool) {
+		return t.ReadHeaderTimeout, t.ReadHeaderTimeoutSet
+	})
+	s.Server.WriteTimeout = strictest(DefaultTimeouts.WriteTimeout, func(t Timeouts) (time.Duration, bool) {
+		return t.WriteTimeout, t.WriteTimeoutSet
+	})
+	s.Server.IdleTimeout = strictest(DefaultTimeouts.IdleTimeout, func(t Timeouts) (time.Duration, bool) {
+		return t.IdleTimeout, t.IdleTimeoutSet
+	})
+}
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
 // dead TCP connections (e.g. closing laptop mid-download) eventually
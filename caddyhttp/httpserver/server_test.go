@@ -1,8 +1,20 @@
 package httpserver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 func TestAddress(t *testing.T) {
@@ -13,3 +25,326 @@ func TestAddress(t *testing.T) {
 		t.Errorf("Expected '%s' but got '%s'", want, got)
 	}
 }
+
+func TestClientCertAllowed(t *testing.T) {
+	cert := &x509.Certificate{}
+	none := &tls.ConnectionState{}
+	unverified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+
+	for i, test := range []struct {
+		tls        *caddytls.Config
+		state      *tls.ConnectionState
+		expectPass bool
+	}{
+		{nil, nil, true},
+		{&caddytls.Config{Enabled: true}, none, true},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequestClientCert}, none, true},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.VerifyClientCertIfGiven}, none, true},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAnyClientCert}, none, false},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAnyClientCert}, unverified, true},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAndVerifyClientCert}, nil, false},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAndVerifyClientCert}, none, false},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAndVerifyClientCert}, unverified, false},
+		{&caddytls.Config{Enabled: true, ClientAuth: tls.RequireAndVerifyClientCert}, verified, true},
+	} {
+		r := &http.Request{TLS: test.state}
+		if got := clientCertAllowed(&SiteConfig{TLS: test.tls}, r); got != test.expectPass {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expectPass, got)
+		}
+	}
+}
+
+func TestStopGracefully(t *testing.T) {
+	site := &SiteConfig{TLS: new(caddytls.Config), GracePeriod: 500 * time.Millisecond}
+	drained := make(chan struct{})
+	site.OnDrain(func() { close(drained) })
+
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Creating server: %v", err)
+	}
+	if s.connTimeout != site.GracePeriod {
+		t.Errorf("Expected the site's grace period %v, got %v", site.GracePeriod, s.connTimeout)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go s.Serve(ln)
+
+	// an active request finishes during the drain
+	var body string
+	reqDone := make(chan error)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(b)
+		}
+		reqDone <- err
+	}()
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop() }()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Expected drain hook to be called")
+	}
+	if _, err := net.DialTimeout("tcp", addr, 100*time.Millisecond); err == nil {
+		t.Error("Expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if err := <-reqDone; err != nil || body != "done" {
+		t.Errorf("Expected active request to finish, got body %q and error %v", body, err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Expected no error stopping, got %v", err)
+	}
+}
+
+func TestStopClosesHijackedConns(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{TLS: new(caddytls.Config), GracePeriod: 200 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("Creating server: %v", err)
+	}
+	hijacked := make(chan struct{})
+	s.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijacking: %v", err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+		close(hijacked) // and never close conn, like a stuck stream
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-hijacked
+
+	start := time.Now()
+	if err := s.Stop(); err != nil {
+		t.Errorf("Expected no error stopping, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected Stop to wait for the grace period, returned after %v", elapsed)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Errorf("Expected hijacked connection to be closed, got %v", err)
+	}
+}
+
+func TestListenUnavailableAddress(t *testing.T) {
+	// 192.0.2.0/24 is reserved for documentation, so no
+	// interface should have an address in it
+	s := &Server{Server: &http.Server{Addr: "192.0.2.1:0"}}
+	ln, err := s.Listen()
+	if err == nil {
+		ln.Close()
+		t.Skip("192.0.2.1 is assigned to this machine")
+	}
+	if !strings.Contains(err.Error(), "192.0.2.1") {
+		t.Errorf("Expected error naming the address, got: %v", err)
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{TLS: new(caddytls.Config)}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if s.Server.ReadHeaderTimeout != DefaultTimeouts.ReadHeaderTimeout ||
+		s.Server.IdleTimeout != DefaultTimeouts.IdleTimeout ||
+		s.Server.ReadTimeout != 0 || s.Server.WriteTimeout != 0 {
+		t.Errorf("Expected the default timeouts, got read header %v, read %v, write %v, idle %v",
+			s.Server.ReadHeaderTimeout, s.Server.ReadTimeout, s.Server.WriteTimeout, s.Server.IdleTimeout)
+	}
+
+	// the strictest timeout of the sites sharing the server wins,
+	// and zero only if all the sites that set it agree
+	group := []*SiteConfig{
+		{TLS: new(caddytls.Config), Timeouts: Timeouts{
+			ReadTimeout: 30 * time.Second, ReadTimeoutSet: true,
+			WriteTimeout: 0, WriteTimeoutSet: true,
+			IdleTimeout: 0, IdleTimeoutSet: true,
+		}},
+		{TLS: new(caddytls.Config), Timeouts: Timeouts{
+			ReadTimeout: 20 * time.Second, ReadTimeoutSet: true,
+			WriteTimeout: time.Minute, WriteTimeoutSet: true,
+		}},
+	}
+	s, err = NewServer("127.0.0.1:0", group)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got, want := s.Server.ReadTimeout, 20*time.Second; got != want {
+		t.Errorf("Expected read timeout %v, got %v", want, got)
+	}
+	if got, want := s.Server.WriteTimeout, time.Minute; got != want {
+		t.Errorf("Expected write timeout %v, got %v", want, got)
+	}
+	if got := s.Server.IdleTimeout; got != 0 {
+		t.Errorf("Expected no idle timeout, got %v", got)
+	}
+	if got, want := s.Server.ReadHeaderTimeout, DefaultTimeouts.ReadHeaderTimeout; got != want {
+		t.Errorf("Expected default read header timeout %v, got %v", want, got)
+	}
+}
+
+func TestRequestRoot(t *testing.T) {
+	tests := []struct {
+		root     string
+		host     string
+		expected string
+		ok       bool
+	}{
+		{"/var/www/{hostonly}", "example.com:8080", "/var/www/example.com", true},
+		{"/var/www/{host}/public", "example.com", "/var/www/example.com/public", true},
+		{"../sites/{hostonly}", "example.com", "../sites/example.com", true},
+		{"/var/www/{hostonly}", "..", "", false},
+		{"/var/www/{hostonly}", "a/../../etc", "", false},
+		{"/var/www/{hostonly}", `a\..\..`, "", false},
+		{"/var/www/{>X-Site}", "example.com", "", false}, // empty
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		root, ok := requestRoot(test.root, r)
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected ok to be %v, got %v (root '%s')", i, test.ok, ok, root)
+			continue
+		}
+		if ok && root != test.expected {
+			t.Errorf("Test %d: Expected root '%s', got '%s'", i, test.expected, root)
+		}
+	}
+}
+
+func TestServeRootWithPlaceholders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_root")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, host := range []string{"a.example", "b.example"} {
+		os.Mkdir(filepath.Join(dir, host), 0755)
+		ioutil.WriteFile(filepath.Join(dir, host, "index.html"), []byte("site "+host), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644)
+
+	site := &SiteConfig{
+		Addr: Address{Original: ":0", Port: "0"},
+		Root: filepath.Join(dir, "{hostonly}"),
+		TLS:  new(caddytls.Config),
+	}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, host := range []string{"a.example", "b.example"} {
+		r := httptest.NewRequest("GET", "/index.html", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		status, _ := s.serveHTTP(w, r)
+		if status != 0 && status != http.StatusOK {
+			t.Errorf("%s: Expected file to be served, got status %d", host, status)
+		}
+		if got, want := w.Body.String(), "site "+host; got != want {
+			t.Errorf("%s: Expected body '%s', got '%s'", host, want, got)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/secret", nil)
+	r.Host = ".."
+	status, _ := s.serveHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected root outside of its directory to be rejected with %d, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestServerHeader(t *testing.T) {
+	tests := []struct {
+		value      string
+		set        bool
+		status     int // returned by the middleware
+		expectName string
+		expectSet  bool
+	}{
+		{"", false, 0, "upstream/1.0", true},
+		{"", false, http.StatusNotFound, "Caddy", true},
+		{"Hidden", true, 0, "Hidden", true},
+		{"Hidden", true, http.StatusNotFound, "Hidden", true},
+		{"", true, 0, "", false},
+		{"", true, http.StatusNotFound, "", false},
+	}
+	for i, test := range tests {
+		site := &SiteConfig{TLS: new(caddytls.Config), ServerHeader: test.value, ServerHeaderSet: test.set}
+		s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		status := test.status
+		site.middlewareChain = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if status != 0 {
+				return status, nil
+			}
+			// like a proxied response
+			w.Header().Set("Server", "upstream/1.0")
+			w.Write([]byte("proxied"))
+			return 0, nil
+		})
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		name, ok := w.Header()["Server"]
+		if ok != test.expectSet || (ok && name[0] != test.expectName) {
+			t.Errorf("Test %d: Expected Server header %q (present: %v), got %v", i, test.expectName, test.expectSet, name)
+		}
+	}
+}
+
+func TestServerHeaderWriterInterfaces(t *testing.T) {
+	site := &SiteConfig{TLS: new(caddytls.Config)}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	site.middlewareChain = HandlerFunc(UseOptionalInterfaces)
+
+	fw := &FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	s.ServeHTTP(fw, httptest.NewRequest("GET", "/", nil))
+	if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
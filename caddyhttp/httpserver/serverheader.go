@@ -0,0 +1,94 @@
+package httpserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// serverHeaderWriter sets the Server header of the responses of
+// a site that overrides it right before the status is written, so
+// that it applies to responses from upstream too. If value is
+// empty, the header is removed.
+type serverHeaderWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+// newServerHeaderWriter returns w with its Server header set to
+// value, or removed if value is empty.
+func newServerHeaderWriter(w http.ResponseWriter, value string) *serverHeaderWriter {
+	shw := &serverHeaderWriter{ResponseWriter: w, value: value}
+	// also for responses written to w directly, like the
+	// server's fallback error responses
+	shw.setHeader()
+	return shw
+}
+
+func (shw *serverHeaderWriter) setHeader() {
+	if shw.value == "" {
+		shw.Header().Del("Server")
+	} else {
+		shw.Header().Set("Server", shw.value)
+	}
+}
+
+// WriteHeader sets the Server header and writes status.
+func (shw *serverHeaderWriter) WriteHeader(status int) {
+	if !shw.wroteHeader {
+		shw.wroteHeader = true
+		shw.setHeader()
+	}
+	shw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b, writing the header with status 200 first if needed.
+func (shw *serverHeaderWriter) Write(b []byte) (int, error) {
+	if !shw.wroteHeader {
+		shw.WriteHeader(http.StatusOK)
+	}
+	return shw.ResponseWriter.Write(b)
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (shw *serverHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := shw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// Flush implements http.Flusher. It writes the header, if
+// it wasn't yet, and flushes the underlying ResponseWriter.
+func (shw *serverHeaderWriter) Flush() {
+	if !shw.wroteHeader {
+		shw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := shw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (shw *serverHeaderWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := shw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (shw *serverHeaderWriter) CloseNotify() <-chan bool {
+	if cn, ok := shw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic("not a CloseNotifier")
+}
@@ -1,6 +1,11 @@
 package httpserver
 
-import "github.com/mholt/caddy/caddytls"
+import (
+	"net"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+)
 
 // SiteConfig contains information about a site
 // (also known as a virtual host).
@@ -12,6 +17,10 @@ type SiteConfig struct {
 	// defaults to Addr.Host
 	ListenHost string
 
+	// All the hostnames to bind listeners to, if there
+	// is more than one; ListenHost is the first of them
+	ListenHosts []string
+
 	// TLS configuration
 	TLS *caddytls.Config
 
@@ -21,7 +30,8 @@ type SiteConfig struct {
 	// Compiled middleware stack
 	middlewareChain Handler
 
-	// Directory from which to serve files
+	// Directory from which to serve files; it may
+	// contain placeholders, filled in per request
 	Root string
 
 	// A list of files to hide (for example, the
@@ -30,6 +40,47 @@ type SiteConfig struct {
 	// standardized way of loading files from disk
 	// for a request.
 	HiddenFiles []string
+
+	// The files to serve for directories, in order of
+	// preference; staticfiles.IndexPages if empty
+	IndexPages []string
+
+	// Whether to leave out the ETags of the responses
+	// that Caddy generates itself, like static files
+	DisableETags bool
+
+	// How long to wait for active connections to finish
+	// when the server stops; if zero, GracefulTimeout
+	GracePeriod time.Duration
+
+	// The Server header of the responses of the site,
+	// if ServerHeaderSet; empty to leave it out
+	ServerHeader    string
+	ServerHeaderSet bool
+
+	// Timeouts of the server of the site
+	Timeouts Timeouts
+
+	// Networks of the load balancers trusted to convey
+	// the address of the client with the PROXY protocol
+	ProxyProtocol []*net.IPNet
+
+	// Functions to call when the server starts draining
+	onDrain []func()
+}
+
+// Timeouts holds the timeouts of the HTTP server of a site, which
+// map onto the ones of http.Server. Each is only used if it is set,
+// so that a timeout can be set to zero to turn it off.
+type Timeouts struct {
+	ReadTimeout          time.Duration
+	ReadTimeoutSet       bool
+	ReadHeaderTimeout    time.Duration
+	ReadHeaderTimeoutSet bool
+	WriteTimeout         time.Duration
+	WriteTimeoutSet      bool
+	IdleTimeout          time.Duration
+	IdleTimeoutSet       bool
 }
 
 // AddMiddleware adds a middleware to a site's middleware stack.
@@ -37,6 +88,16 @@ func (s *SiteConfig) AddMiddleware(m Middleware) {
 	s.middleware = append(s.middleware, m)
 }
 
+// OnDrain registers f to be called when the server of the site
+// stops gracefully, right after it stops accepting connections.
+// Each f runs in its own goroutine, and should be done before
+// the grace period is over, when the remaining connections are
+// closed. It is useful to wind down connections that are not
+// served by the HTTP server anymore, such as websockets.
+func (s *SiteConfig) OnDrain(f func()) {
+	s.onDrain = append(s.onDrain, f)
+}
+
 // TLSConfig returns s.TLS.
 func (s SiteConfig) TLSConfig() *caddytls.Config {
 	return s.TLS
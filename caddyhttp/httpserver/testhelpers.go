@@ -0,0 +1,81 @@
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// FullResponseWriter wraps a ResponseWriter so that it also
+// implements the optional ResponseWriter interfaces, and records
+// their use in Calls, so it can be tested whether a wrapping
+// ResponseWriter passes them on.
+//
+// Used primarily for testing but needs to be exported so
+// plugins can use this as a convenience.
+type FullResponseWriter struct {
+	http.ResponseWriter
+	Calls []string
+}
+
+// Hijack implements http.Hijacker.
+func (w *FullResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.Calls = append(w.Calls, "Hijack")
+	return nil, nil, nil
+}
+
+// Flush implements http.Flusher. It flushes the wrapped
+// ResponseWriter if it can.
+func (w *FullResponseWriter) Flush() {
+	w.Calls = append(w.Calls, "Flush")
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Push implements http.Pusher.
+func (w *FullResponseWriter) Push(target string, opts *http.PushOptions) error {
+	w.Calls = append(w.Calls, "Push")
+	return nil
+}
+
+// CloseNotify implements http.CloseNotifier.
+func (w *FullResponseWriter) CloseNotify() <-chan bool {
+	w.Calls = append(w.Calls, "CloseNotify")
+	return make(chan bool)
+}
+
+// UseOptionalInterfaces uses the optional interfaces of w, in
+// the order Hijacker, Flusher, Pusher and CloseNotifier, and
+// fails if w doesn't implement one of them.
+//
+// Used primarily for testing but needs to be exported so
+// plugins can use this as a convenience.
+func UseOptionalInterfaces(w http.ResponseWriter, r *http.Request) (int, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("%T is not a Hijacker", w)
+	}
+	if _, _, err := hj.Hijack(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("%T is not a Flusher", w)
+	}
+	f.Flush()
+	p, ok := w.(http.Pusher)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("%T is not a Pusher", w)
+	}
+	if err := p.Push("/style.css", nil); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	cn, ok := w.(http.CloseNotifier)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("%T is not a CloseNotifier", w)
+	}
+	cn.CloseNotify()
+	return 0, nil
+}
@@ -0,0 +1,28 @@
+package index
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("index", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupIndex,
+	})
+}
+
+// setupIndex sets the files that the site serves for directories,
+// like "index default.aspx home.html"; the first one that exists
+// in a directory is served.
+func setupIndex(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		pages := c.RemainingArgs()
+		if len(pages) == 0 {
+			return c.ArgErr()
+		}
+		config.IndexPages = pages
+	}
+	return nil
+}
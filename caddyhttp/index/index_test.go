@@ -0,0 +1,34 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupIndex(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`index default.aspx`, false, []string{"default.aspx"}},
+		{`index home.html index.html`, false, []string{"home.html", "index.html"}},
+		{"index a.html\nindex b.html", false, []string{"b.html"}},
+		{`index`, true, nil},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupIndex(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if got := httpserver.GetConfig(c).IndexPages; fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: expected index pages %v, got %v", i, test.expected, got)
+		}
+	}
+}
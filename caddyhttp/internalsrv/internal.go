@@ -7,6 +7,10 @@
 package internalsrv
 
 import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"net"
 	"net/http"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -17,6 +21,27 @@ import (
 type Internal struct {
 	Next  httpserver.Handler
 	Paths []string
+
+	// AllowHeaders maps internal paths to a header which lets requests
+	// for them pass, e.g. when set by a trusted proxy in front of this
+	// server. Paths without one are never accessible from the outside.
+	AllowHeaders map[string]AllowHeader
+}
+
+// AllowHeader is a header with a secret value.
+type AllowHeader struct {
+	Name, Value string
+}
+
+// allows returns true if r carries h. The header is removed from r,
+// so the secret isn't passed on, e.g. to a proxy upstream.
+func (h AllowHeader) allows(r *http.Request) bool {
+	value := r.Header.Get(h.Name)
+	if value == "" {
+		return false
+	}
+	r.Header.Del(h.Name)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(h.Value)) == 1
 }
 
 const (
@@ -33,9 +58,13 @@ func isInternalRedirect(w http.ResponseWriter) bool {
 // ServeHTTP implements the httpserver.Handler interface.
 func (i Internal) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 
-	// Internal location requested? -> Not found.
+	// Internal location requested? -> Not found, unless
+	// the request carries the header allowing it.
 	for _, prefix := range i.Paths {
 		if httpserver.Path(r.URL.Path).Matches(prefix) {
+			if h, ok := i.AllowHeaders[prefix]; ok && h.allows(r) {
+				continue
+			}
 			return http.StatusNotFound, nil
 		}
 	}
@@ -94,3 +123,45 @@ func (w internalResponseWriter) Write(b []byte) (int, error) {
 	}
 	return w.ResponseWriter.Write(b)
 }
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w internalResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// Flush implements http.Flusher. Like Write, it is ignored if the
+// response should be redirected to an internal location; otherwise
+// it flushes the underlying ResponseWriter if it can, or panics.
+func (w internalResponseWriter) Flush() {
+	if isInternalRedirect(w) {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Push implements http.Pusher. It simply wraps the underlying
+// ResponseWriter's Push method if there is one, or returns
+// http.ErrNotSupported.
+func (w internalResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (w internalResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic("not a CloseNotifier")
+}
@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
-	"strconv"
 )
 
 const (
@@ -93,6 +94,55 @@ func TestInternal(t *testing.T) {
 	}
 }
 
+func TestInternalAllowHeader(t *testing.T) {
+	im := Internal{
+		Next:  httpserver.HandlerFunc(internalTestHandlerFunc),
+		Paths: []string{"/internal", "/private"},
+		AllowHeaders: map[string]AllowHeader{
+			"/internal": {Name: "X-Internal-Secret", Value: "s3cret"},
+		},
+	}
+
+	tests := []struct {
+		url          string
+		header       string
+		expectedCode int
+		expectedBody string
+	}{
+		{"/internal", "", http.StatusNotFound, ""},
+		{"/internal", "wrong", http.StatusNotFound, ""},
+		{"/internal", "s3cret", 0, "/internal"},
+		{"/internal/data", "s3cret", 0, internalProtectedData},
+		{"/private", "s3cret", http.StatusNotFound, ""},
+		{"/redirect", "", 0, "/internal"},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		if test.header != "" {
+			req.Header.Set("X-Internal-Secret", test.header)
+		}
+
+		rec := httptest.NewRecorder()
+		code, _ := im.ServeHTTP(rec, req)
+
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code %d for %s, but got %d",
+				i, test.expectedCode, test.url, code)
+		}
+		if rec.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body '%s' for %s, but got '%s'",
+				i, test.expectedBody, test.url, rec.Body.String())
+		}
+		if strings.HasPrefix(test.url, "/internal") && req.Header.Get("X-Internal-Secret") != "" {
+			t.Errorf("Test %d: Expected the secret header to be removed from the request", i)
+		}
+	}
+}
+
 func internalTestHandlerFunc(w http.ResponseWriter, r *http.Request) (int, error) {
 	switch r.URL.Path {
 	case "/redirect":
@@ -120,3 +170,17 @@ func internalTestHandlerFunc(w http.ResponseWriter, r *http.Request) (int, error
 
 	return 0, nil
 }
+
+func TestInternalWriterInterfaces(t *testing.T) {
+	im := Internal{
+		Next:  httpserver.HandlerFunc(httpserver.UseOptionalInterfaces),
+		Paths: []string{"/internal"},
+	}
+	fw := &httpserver.FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	if _, err := im.ServeHTTP(fw, httptest.NewRequest("GET", "/public", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(fw.Calls), "[Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
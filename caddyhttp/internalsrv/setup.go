@@ -14,27 +14,43 @@ func init() {
 
 // Internal configures a new Internal middleware instance.
 func setup(c *caddy.Controller) error {
-	paths, err := internalParse(c)
+	paths, allowHeaders, err := internalParse(c)
 	if err != nil {
 		return err
 	}
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Internal{Next: next, Paths: paths}
+		return Internal{Next: next, Paths: paths, AllowHeaders: allowHeaders}
 	})
 
 	return nil
 }
 
-func internalParse(c *caddy.Controller) ([]string, error) {
+func internalParse(c *caddy.Controller) ([]string, map[string]AllowHeader, error) {
 	var paths []string
+	allowHeaders := make(map[string]AllowHeader)
 
 	for c.Next() {
-		if !c.NextArg() {
-			return paths, c.ArgErr()
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return paths, allowHeaders, c.ArgErr()
+		}
+		path := args[0]
+		paths = append(paths, path)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow_header":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return paths, allowHeaders, c.ArgErr()
+				}
+				allowHeaders[path] = AllowHeader{Name: args[0], Value: args[1]}
+			default:
+				return paths, allowHeaders, c.Errf("Unknown internal subdirective '%s'", c.Val())
+			}
 		}
-		paths = append(paths, c.Val())
 	}
 
-	return paths, nil
+	return paths, allowHeaders, nil
 }
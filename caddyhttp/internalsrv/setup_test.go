@@ -45,9 +45,22 @@ func TestInternalParse(t *testing.T) {
 
 		{`internal /internal1
 		  internal /internal2`, false, []string{"/internal1", "/internal2"}},
+
+		{`internal /internal {
+			allow_header X-Internal-Secret s3cret
+		  }`, false, []string{"/internal"}},
+
+		{`internal`, true, nil},
+		{`internal /internal1 /internal2`, true, nil},
+		{`internal /internal {
+			allow_header X-Internal-Secret
+		  }`, true, []string{"/internal"}},
+		{`internal /internal {
+			bogus
+		  }`, true, []string{"/internal"}},
 	}
 	for i, test := range tests {
-		actualInternalPaths, err := internalParse(caddy.NewTestController("http", test.inputInternalPaths))
+		actualInternalPaths, _, err := internalParse(caddy.NewTestController("http", test.inputInternalPaths))
 
 		if err == nil && test.shouldErr {
 			t.Errorf("Test %d didn't error, but it should have", i)
@@ -68,3 +81,20 @@ func TestInternalParse(t *testing.T) {
 	}
 
 }
+
+func TestInternalParseAllowHeader(t *testing.T) {
+	_, allowHeaders, err := internalParse(caddy.NewTestController("http", `internal /public
+		internal /internal {
+			allow_header X-Internal-Secret s3cret
+		}`))
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if _, ok := allowHeaders["/public"]; ok {
+		t.Error("Expected no header to allow /public")
+	}
+	expected := AllowHeader{Name: "X-Internal-Secret", Value: "s3cret"}
+	if allowHeaders["/internal"] != expected {
+		t.Errorf("Expected header %v to allow /internal, got %v", expected, allowHeaders["/internal"])
+	}
+}
@@ -0,0 +1,64 @@
+// Package ipfilter implements the ipfilter directive, which allows
+// or denies requests by the IP address of the client.
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// IPFilter is middleware that rejects the requests to the paths
+// of its rules from clients that aren't allowed to make them.
+type IPFilter struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// Rule allows or denies the clients of requests to paths under
+// Path. A client in Deny is denied, even if it is in Allow too;
+// a client in neither is allowed if DefaultAllow is true.
+type Rule struct {
+	Path         string
+	Allow        []*net.IPNet
+	Deny         []*net.IPNet
+	DefaultAllow bool
+
+	// TrustedProxies are the networks of proxies whose
+	// X-Forwarded-For header tells the client apart.
+	TrustedProxies []*net.IPNet
+}
+
+// BasePath satisfies httpserver.HandlerConfig.
+func (rule Rule) BasePath() string { return rule.Path }
+
+// Match satisfies httpserver.RequestMatcher.
+func (rule Rule) Match(r *http.Request) bool {
+	return httpserver.Path(r.URL.Path).Matches(rule.Path)
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (f IPFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rule, ok := httpserver.ConfigSelector(f.Rules).Select(r).(Rule)
+	if ok && !rule.allowed(httpserver.ForwardedClientIP(r, "X-Forwarded-For", rule.TrustedProxies)) {
+		return http.StatusForbidden, nil
+	}
+	return f.Next.ServeHTTP(w, r)
+}
+
+// allowed returns true if the client with the IP address
+// clientIP is allowed by the rule. Addresses that can't be
+// parsed are only allowed if the rule allows by default.
+func (rule Rule) allowed(clientIP string) bool {
+	if net.ParseIP(clientIP) == nil {
+		return rule.DefaultAllow
+	}
+	if httpserver.IPInNetworks(clientIP, rule.Deny) {
+		return false
+	}
+	if httpserver.IPInNetworks(clientIP, rule.Allow) {
+		return true
+	}
+	return rule.DefaultAllow
+}
@@ -0,0 +1,132 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestIPFilter(t *testing.T) {
+	f := IPFilter{
+		Next: httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{
+			Rule{
+				Path:  "/admin",
+				Allow: networks(t, "10.0.0.0/8", "2001:db8::/32"),
+				Deny:  networks(t, "10.0.0.13/32", "2001:db8:bad::/48"),
+			},
+			Rule{
+				Path:         "/public",
+				Deny:         networks(t, "192.0.2.0/24", "2001:db8:bad::/48"),
+				DefaultAllow: true,
+			},
+		},
+	}
+
+	tests := []struct {
+		path       string
+		remoteAddr string
+		expected   int
+	}{
+		// default deny, as there is an allow list
+		{"/admin", "10.1.2.3:1234", http.StatusOK},
+		{"/admin/users", "10.1.2.3:1234", http.StatusOK},
+		{"/admin", "10.0.0.13:1234", http.StatusForbidden},
+		{"/admin", "172.16.0.1:1234", http.StatusForbidden},
+		{"/admin", "[2001:db8::1]:1234", http.StatusOK},
+		{"/admin", "[2001:db8:bad::1]:1234", http.StatusForbidden},
+		{"/admin", "[::1]:1234", http.StatusForbidden},
+		{"/admin", "[::ffff:10.1.2.3]:1234", http.StatusOK},
+		{"/admin", "garbage", http.StatusForbidden},
+
+		// default allow
+		{"/public", "172.16.0.1:1234", http.StatusOK},
+		{"/public", "192.0.2.7:1234", http.StatusForbidden},
+		{"/public", "[2001:db8::1]:1234", http.StatusOK},
+		{"/public", "[2001:db8:bad::1]:1234", http.StatusForbidden},
+
+		// no rule
+		{"/", "172.16.0.1:1234", http.StatusOK},
+	}
+	for i, test := range tests {
+		if code := serve(f, test.path, test.remoteAddr, ""); code != test.expected {
+			t.Errorf("Test %d: %s from %s: expected %d, got %d", i, test.path, test.remoteAddr, test.expected, code)
+		}
+	}
+}
+
+func TestIPFilterLongestPath(t *testing.T) {
+	f := IPFilter{
+		Next: httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{
+			Rule{Path: "/", Deny: networks(t, "10.0.0.0/8")},
+			Rule{Path: "/admin", Allow: networks(t, "10.0.0.0/8")},
+		},
+	}
+	if code := serve(f, "/", "10.1.2.3:1234", ""); code != http.StatusForbidden {
+		t.Errorf("Expected %d from the site-wide rule, got %d", http.StatusForbidden, code)
+	}
+	if code := serve(f, "/admin", "10.1.2.3:1234", ""); code != http.StatusOK {
+		t.Errorf("Expected %d from the rule of the longer path, got %d", http.StatusOK, code)
+	}
+}
+
+func TestIPFilterTrustedProxies(t *testing.T) {
+	f := IPFilter{
+		Next: httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{Rule{
+			Path:           "/",
+			Allow:          networks(t, "203.0.113.0/24"),
+			TrustedProxies: networks(t, "10.0.0.0/8"),
+		}},
+	}
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		expected   int
+	}{
+		{"10.0.0.1:1234", "203.0.113.5", http.StatusOK},
+		{"10.0.0.1:1234", "203.0.113.5, 10.0.0.2", http.StatusOK},
+		{"10.0.0.1:1234", "198.51.100.1", http.StatusForbidden},
+		{"10.0.0.1:1234", "198.51.100.1, 203.0.113.5", http.StatusOK},
+		{"10.0.0.1:1234", "", http.StatusForbidden},
+		// an untrusted client can't claim to be allowed
+		{"198.51.100.1:1234", "203.0.113.5", http.StatusForbidden},
+	}
+	for i, test := range tests {
+		if code := serve(f, "/", test.remoteAddr, test.xff); code != test.expected {
+			t.Errorf("Test %d: from %s with X-Forwarded-For '%s': expected %d, got %d",
+				i, test.remoteAddr, test.xff, test.expected, code)
+		}
+	}
+}
+
+func serve(f IPFilter, path, remoteAddr, xff string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	code, _ := f.ServeHTTP(httptest.NewRecorder(), req)
+	return code
+}
+
+func networks(t *testing.T, cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Parsing %s: %v", cidr, err)
+		}
+		nets = append(nets, network)
+	}
+	return nets
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) (int, error) {
+	return http.StatusOK, nil
+}
@@ -0,0 +1,113 @@
+package ipfilter
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("ipfilter", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new IPFilter middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := ipFilterParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return IPFilter{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// ipFilterParse parses the ipfilter directives, which are like
+// "ipfilter [path]" with a block:
+//
+//	ipfilter /admin {
+//	    allow   10.0.0.0/8 2001:db8::/32
+//	    deny    10.0.0.13
+//	    default deny
+//	    trusted 192.168.0.0/16
+//	}
+//
+// Clients in neither list are denied by default if there is an
+// allow list, and allowed otherwise.
+func ipFilterParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		var defaultSet bool
+		for c.NextBlock() {
+			switch what := c.Val(); what {
+			case "allow", "deny", "trusted":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return rules, c.Errf("invalid %s address '%s': %v", what, arg, err)
+					}
+					switch what {
+					case "allow":
+						rule.Allow = append(rule.Allow, network)
+					case "deny":
+						rule.Deny = append(rule.Deny, network)
+					case "trusted":
+						rule.TrustedProxies = append(rule.TrustedProxies, network)
+					}
+				}
+			case "default":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				switch c.Val() {
+				case "allow":
+					rule.DefaultAllow = true
+				case "deny":
+					rule.DefaultAllow = false
+				default:
+					return rules, c.Errf("default must be allow or deny, got '%s'", c.Val())
+				}
+				defaultSet = true
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			default:
+				return rules, c.Errf("Unknown ipfilter subdirective '%s'", what)
+			}
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			return rules, c.Err("ipfilter needs addresses to allow or deny")
+		}
+		if !defaultSet {
+			rule.DefaultAllow = len(rule.Allow) == 0
+		}
+
+		for _, other := range rules {
+			if other.BasePath() == rule.Path {
+				return rules, c.Errf("Duplicate ipfilter rule for path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
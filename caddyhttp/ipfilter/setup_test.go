@@ -0,0 +1,134 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `ipfilter /admin {
+		allow 10.0.0.0/8
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(IPFilter)
+	if !ok {
+		t.Fatalf("Expected handler to be type IPFilter, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestIPFilterParse(t *testing.T) {
+	tests := []struct {
+		input        string
+		shouldErr    bool
+		path         string
+		allow        []string
+		deny         []string
+		trusted      []string
+		defaultAllow bool
+	}{
+		{`ipfilter /admin {
+			allow 10.0.0.0/8 2001:db8::/32
+		}`, false, "/admin", []string{"10.0.0.0/8", "2001:db8::/32"}, nil, nil, false},
+		{`ipfilter {
+			deny 192.0.2.1 2001:db8::1
+		}`, false, "/", nil, []string{"192.0.2.1/32", "2001:db8::1/128"}, nil, true},
+		{`ipfilter / {
+			allow 10.0.0.0/8
+			deny 10.0.0.13
+			default allow
+			trusted 192.168.0.0/16
+		}`, false, "/", []string{"10.0.0.0/8"}, []string{"10.0.0.13/32"}, []string{"192.168.0.0/16"}, true},
+		{`ipfilter / {
+			deny 10.0.0.0/8
+			default deny
+		}`, false, "/", nil, []string{"10.0.0.0/8"}, nil, false},
+		{`ipfilter /admin`, true, "", nil, nil, nil, false},
+		{`ipfilter /a /b {
+			allow 10.0.0.1
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow 10.0.0.0/33
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow example.com
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow 10.0.0.1
+			default maybe
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow 10.0.0.1
+			block 10.0.0.2
+		}`, true, "", nil, nil, nil, false},
+		{`ipfilter / {
+			allow 10.0.0.1
+		}
+		ipfilter / {
+			deny 10.0.0.2
+		}`, true, "", nil, nil, nil, false},
+	}
+	for i, test := range tests {
+		rules, err := ipFilterParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != 1 {
+			t.Fatalf("Test %d: Expected 1 rule, got %d", i, len(rules))
+		}
+		rule := rules[0].(Rule)
+		if rule.Path != test.path {
+			t.Errorf("Test %d: Expected path '%s', got '%s'", i, test.path, rule.Path)
+		}
+		for _, list := range []struct {
+			what     string
+			got      []string
+			expected []string
+		}{
+			{"allow", networkStrings(rule.Allow), test.allow},
+			{"deny", networkStrings(rule.Deny), test.deny},
+			{"trusted", networkStrings(rule.TrustedProxies), test.trusted},
+		} {
+			if fmt.Sprint(list.got) != fmt.Sprint(list.expected) {
+				t.Errorf("Test %d: Expected %s %v, got %v", i, list.what, list.expected, list.got)
+			}
+		}
+		if rule.DefaultAllow != test.defaultAllow {
+			t.Errorf("Test %d: Expected DefaultAllow %v, got %v", i, test.defaultAllow, rule.DefaultAllow)
+		}
+	}
+}
+
+func networkStrings(networks []*net.IPNet) []string {
+	var s []string
+	for _, network := range networks {
+		s = append(s, network.String())
+	}
+	return s
+}
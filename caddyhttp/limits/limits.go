@@ -0,0 +1,96 @@
+// Package limits implements the limit directive, which limits
+// the size of request bodies.
+package limits
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Limit is middleware that limits the size of request bodies, so
+// that the handlers after it never read more than allowed.
+type Limit struct {
+	Next       httpserver.Handler
+	BodyLimits []PathLimit
+}
+
+// PathLimit is the maximum size in bytes of the bodies of requests
+// to paths under Path.
+type PathLimit struct {
+	Path  string
+	Limit int64
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (l Limit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	limit, ok := l.bodyLimit(r.URL.Path)
+	if !ok || r.Body == nil {
+		return l.Next.ServeHTTP(w, r)
+	}
+	if r.ContentLength > limit {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	body := &maxBytesReader{ReadCloser: r.Body, remaining: limit}
+	r.Body = body
+	status, err := l.Next.ServeHTTP(w, r)
+	if body.exceeded && status != 0 {
+		// the handler failed because it couldn't read all of
+		// the body, whatever it thinks of the failure
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	return status, err
+}
+
+// bodyLimit returns the limit of the body of requests to
+// urlPath: that of the longest matching path. It returns
+// false if there is no limit for urlPath.
+func (l Limit) bodyLimit(urlPath string) (int64, bool) {
+	var match *PathLimit
+	for i, pl := range l.BodyLimits {
+		if httpserver.Path(urlPath).Matches(pl.Path) && (match == nil || len(pl.Path) > len(match.Path)) {
+			match = &l.BodyLimits[i]
+		}
+	}
+	if match == nil {
+		return 0, false
+	}
+	return match.Limit, true
+}
+
+// ErrBodyTooLarge is returned when reading more of a request
+// body than its limit allows.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// maxBytesReader reads up to remaining bytes of a request body,
+// and fails with ErrBodyTooLarge if there are more. Unlike an
+// io.LimitReader, it doesn't pass a truncated body off as whole.
+type maxBytesReader struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+// Read reads from the body until the limit is exceeded.
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// read one byte more than allowed, to tell a
+	// body right at the limit from one beyond it
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if int64(n) <= r.remaining {
+		r.remaining -= int64(n)
+		return n, err
+	}
+	n = int(r.remaining)
+	r.remaining = 0
+	r.exceeded = true
+	return n, ErrBodyTooLarge
+}
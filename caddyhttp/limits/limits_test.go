@@ -0,0 +1,95 @@
+package limits
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var read string
+	l := Limit{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			body, err := ioutil.ReadAll(r.Body)
+			read = string(body)
+			if err != nil {
+				// like a proxy that couldn't send the whole body
+				return http.StatusBadGateway, err
+			}
+			w.Write(body)
+			return 0, nil
+		}),
+		BodyLimits: []PathLimit{
+			{Path: "/", Limit: 5},
+			{Path: "/upload", Limit: 10},
+		},
+	}
+
+	tests := []struct {
+		path          string
+		body          string
+		knownLength   bool
+		expectedCode  int
+		expectedRead  string
+		expectedWrite string
+	}{
+		{"/", "12345", true, 0, "12345", "12345"},
+		{"/", "12345", false, 0, "12345", "12345"},
+		{"/", "123456", true, http.StatusRequestEntityTooLarge, "", ""},
+		{"/", "123456", false, http.StatusRequestEntityTooLarge, "12345", ""},
+		{"/upload/file", "1234567890", false, 0, "1234567890", "1234567890"},
+		{"/upload/file", "12345678901", false, http.StatusRequestEntityTooLarge, "1234567890", ""},
+	}
+	for i, test := range tests {
+		read = ""
+		req, err := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		if !test.knownLength {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		code, _ := l.ServeHTTP(rec, req)
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, code)
+		}
+		if read != test.expectedRead {
+			t.Errorf("Test %d: Expected handler to read %q, got %q", i, test.expectedRead, read)
+		}
+		if rec.Body.String() != test.expectedWrite {
+			t.Errorf("Test %d: Expected response %q, got %q", i, test.expectedWrite, rec.Body.String())
+		}
+	}
+}
+
+func TestBodyLimitLongestPath(t *testing.T) {
+	l := Limit{BodyLimits: []PathLimit{
+		{Path: "/upload/big", Limit: 100},
+		{Path: "/", Limit: 1},
+		{Path: "/upload", Limit: 10},
+	}}
+	tests := []struct {
+		path     string
+		expected int64
+	}{
+		{"/", 1},
+		{"/index.html", 1},
+		{"/upload", 10},
+		{"/upload/big/file", 100},
+	}
+	for i, test := range tests {
+		if got, ok := l.bodyLimit(test.path); !ok || got != test.expected {
+			t.Errorf("Test %d: Expected limit %d for %s, got %d", i, test.expected, test.path, got)
+		}
+	}
+
+	l = Limit{BodyLimits: []PathLimit{{Path: "/upload", Limit: 10}}}
+	if _, ok := l.bodyLimit("/index.html"); ok {
+		t.Error("Expected no limit outside of the limited paths")
+	}
+}
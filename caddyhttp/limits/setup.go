@@ -0,0 +1,92 @@
+package limits
+
+import (
+	"math"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("limit", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Limit middleware instance.
+func setup(c *caddy.Controller) error {
+	bodyLimits, err := limitParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Limit{Next: next, BodyLimits: bodyLimits}
+	})
+
+	return nil
+}
+
+// limitParse parses the limit directives, which are either on one
+// line, like "limit body /upload 1GB", or in a block of lines like
+// "body /upload 1GB". Without a path, the limit is for all paths.
+func limitParse(c *caddy.Controller) ([]PathLimit, error) {
+	var bodyLimits []PathLimit
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) > 0 {
+			pl, err := parseLimit(c, args)
+			if err != nil {
+				return bodyLimits, err
+			}
+			bodyLimits = append(bodyLimits, pl)
+		}
+		for c.NextBlock() {
+			pl, err := parseLimit(c, append([]string{c.Val()}, c.RemainingArgs()...))
+			if err != nil {
+				return bodyLimits, err
+			}
+			bodyLimits = append(bodyLimits, pl)
+		}
+	}
+
+	if len(bodyLimits) == 0 {
+		return bodyLimits, c.ArgErr()
+	}
+	for i, pl := range bodyLimits {
+		for _, other := range bodyLimits[:i] {
+			if pl.Path == other.Path {
+				return bodyLimits, c.Errf("Duplicate body limit for path '%s'", pl.Path)
+			}
+		}
+	}
+	return bodyLimits, nil
+}
+
+// parseLimit parses the arguments of one limit: the kind, which
+// must be body, an optional path and the size.
+func parseLimit(c *caddy.Controller, args []string) (PathLimit, error) {
+	if args[0] != "body" {
+		return PathLimit{}, c.Errf("Unknown limit '%s'", args[0])
+	}
+	pl := PathLimit{Path: "/"}
+	switch len(args) {
+	case 2:
+	case 3:
+		pl.Path = args[1]
+	default:
+		return pl, c.ArgErr()
+	}
+	size, err := humanize.ParseBytes(args[len(args)-1])
+	if err != nil {
+		return pl, c.Errf("Invalid size '%s': %v", args[len(args)-1], err)
+	}
+	if size == 0 || size > math.MaxInt64 {
+		return pl, c.Errf("Body limit out of range: '%s'", args[len(args)-1])
+	}
+	pl.Limit = int64(size)
+	return pl, nil
+}
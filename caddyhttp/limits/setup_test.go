@@ -0,0 +1,78 @@
+package limits
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `limit body 10MB`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Limit)
+	if !ok {
+		t.Fatalf("Expected handler to be type Limit, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestLimitParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []PathLimit
+	}{
+		{`limit body 10MB`, false, []PathLimit{{"/", 10000000}}},
+		{`limit body 1KiB
+		  limit body /upload 1GiB`, false, []PathLimit{{"/", 1024}, {"/upload", 1 << 30}}},
+		{`limit {
+			body 512
+			body /upload 2MB
+			body /api 64kB
+		}`, false, []PathLimit{{"/", 512}, {"/upload", 2000000}, {"/api", 64000}}},
+		{`limit body /upload 1GB {
+			body 1MB
+		}`, false, []PathLimit{{"/upload", 1000000000}, {"/", 1000000}}},
+		{`limit`, true, nil},
+		{`limit body`, true, nil},
+		{`limit header 1KB`, true, nil},
+		{`limit body /upload 1GB extra`, true, nil},
+		{`limit body lots`, true, nil},
+		{`limit body 0`, true, nil},
+		{`limit body 1MB
+		  limit body 2MB`, true, nil},
+		{`limit {
+			bogus 1MB
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		bodyLimits, err := limitParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(bodyLimits, test.expected) {
+			t.Errorf("Test %d: Expected limits %v, got %v", i, test.expected, bodyLimits)
+		}
+	}
+}
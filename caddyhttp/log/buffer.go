@@ -0,0 +1,99 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+)
+
+// errBufferClosed is returned by writes to a closed bufferedWriter.
+var errBufferClosed = errors.New("log buffer is closed")
+
+// bufferedWriter is an io.Writer that writes to its underlying
+// writer in the background, so that requests don't wait for the
+// disk. It queues up to size writes; lines that queue up while
+// it writes are written together. When the queue is full, writes
+// wait for room, so a slow disk slows down logging instead of
+// losing lines. Writes are written in order.
+type bufferedWriter struct {
+	w     io.Writer
+	queue chan []byte
+	done  chan struct{}
+
+	mu     sync.RWMutex // protects closed, and queue from being closed during a write
+	closed bool
+
+	err error // the first error writing to w; read after done is closed
+}
+
+// newBufferedWriter returns a bufferedWriter that queues up to
+// size writes to w. It must be closed to write the queued ones.
+func newBufferedWriter(w io.Writer, size int) *bufferedWriter {
+	bw := &bufferedWriter{
+		w:     w,
+		queue: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+	go bw.run()
+	return bw
+}
+
+// Write queues p to be written. It waits while the queue is full.
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	bw.mu.RLock()
+	defer bw.mu.RUnlock()
+	if bw.closed {
+		return 0, errBufferClosed
+	}
+	// the caller may reuse p, like log.Logger does
+	bw.queue <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// Close writes the queued writes and stops bw. It returns the
+// first error writing to the underlying writer, if any.
+func (bw *bufferedWriter) Close() error {
+	bw.mu.Lock()
+	if !bw.closed {
+		bw.closed = true
+		close(bw.queue)
+	}
+	bw.mu.Unlock()
+	<-bw.done
+	return bw.err
+}
+
+// run writes the queued writes until the queue is closed,
+// flushing whenever the queue runs empty.
+func (bw *bufferedWriter) run() {
+	defer close(bw.done)
+	out := bufio.NewWriter(bw.w)
+	write := func(p []byte) {
+		if _, err := out.Write(p); err != nil && bw.err == nil {
+			bw.err = err
+		}
+	}
+	flush := func() {
+		if err := out.Flush(); err != nil && bw.err == nil {
+			bw.err = err
+		}
+	}
+	for p := range bw.queue {
+		write(p)
+	drain:
+		for {
+			select {
+			case p, ok := <-bw.queue:
+				if !ok {
+					break drain
+				}
+				write(p)
+			default:
+				break drain
+			}
+		}
+		flush()
+	}
+	flush()
+}
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	bw := newBufferedWriter(&buf, 10)
+	logger := log.New(bw, "", 0)
+	for i := 0; i < 100; i++ {
+		logger.Printf("line %d", i)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Expected no error closing, got %v", err)
+	}
+
+	var expected bytes.Buffer
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&expected, "line %d\n", i)
+	}
+	if buf.String() != expected.String() {
+		t.Errorf("Expected all lines in order, got:\n%s", buf.String())
+	}
+
+	if _, err := bw.Write([]byte("late\n")); err != errBufferClosed {
+		t.Errorf("Expected %v writing after close, got %v", errBufferClosed, err)
+	}
+}
+
+func TestBufferedWriterBackpressure(t *testing.T) {
+	w := &slowWriter{release: make(chan struct{})}
+	bw := newBufferedWriter(w, 2)
+
+	// the writer holds on to what it is writing, and the
+	// queue to two more writes, so the rest have to wait
+	var mu sync.Mutex
+	var queued int
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bw.Write([]byte{byte('0' + i)})
+			mu.Lock()
+			queued++
+			mu.Unlock()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected writes to wait while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(w.release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		mu.Lock()
+		t.Fatalf("Expected writes to finish once there is room, %d of 10 did", queued)
+		mu.Unlock()
+	}
+	bw.Close()
+	if got := w.String(); got != "0123456789" {
+		t.Errorf("Expected '0123456789' to be written, got '%s'", got)
+	}
+}
+
+// slowWriter is an io.Writer that waits for release
+// before each write, like a slow disk.
+type slowWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
@@ -2,10 +2,15 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -28,12 +33,19 @@ type Logger struct {
 func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, rule := range l.Rules {
 		if httpserver.Path(r.URL.Path).Matches(rule.PathScope) {
-			// Record the response
-			responseRecorder := httpserver.NewResponseRecorder(w)
+			// Record the response, unless it is recorded already
+			responseRecorder, ok := w.(*httpserver.ResponseRecorder)
+			if !ok {
+				responseRecorder = httpserver.NewResponseRecorder(w)
+			}
 
 			// Attach the Replacer we'll use so that other middlewares can
 			// set their own placeholders if they want to.
-			rep := httpserver.NewReplacer(r, responseRecorder, CommonLogEmptyValue)
+			emptyValue := CommonLogEmptyValue
+			if rule.Format == JSONLogFormat {
+				emptyValue = ""
+			}
+			rep := httpserver.NewReplacer(r, responseRecorder, emptyValue)
 			responseRecorder.Replacer = rep
 
 			// Bon voyage, request!
@@ -52,8 +64,15 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 				status = 0
 			}
 
-			// Write log entry
-			rule.Log.Println(rep.Replace(rule.Format))
+			// Write log entry, if the rule's conditions allow it
+			if !rule.Condition.MatchWith(rep) {
+				return status, err
+			}
+			if rule.Format == JSONLogFormat {
+				rule.Log.Print(jsonLogEntry(responseRecorder, rep))
+			} else {
+				rule.Log.Println(replaceFormat(rule.Format, rep))
+			}
 
 			return status, err
 		}
@@ -61,6 +80,87 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	return l.Next.ServeHTTP(w, r)
 }
 
+// replaceFormat replaces each placeholder in format using rep,
+// one at a time so that braces in replaced values are left
+// alone. Placeholders rep does not know become empty values.
+func replaceFormat(format string, rep httpserver.Replacer) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(format, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(format[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		buf.WriteString(format[:start])
+		placeholder := format[start:end]
+		if value := rep.Replace(placeholder); value != placeholder {
+			buf.WriteString(value)
+		} else {
+			buf.WriteString(CommonLogEmptyValue)
+		}
+		format = format[end:]
+	}
+	buf.WriteString(format)
+	return buf.String()
+}
+
+// jsonEntry is an access log entry for the JSON log format.
+// Fields without a value are left out.
+type jsonEntry struct {
+	Time       string `json:"ts"`
+	Remote     string `json:"remote,omitempty"`
+	Method     string `json:"method"`
+	Scheme     string `json:"scheme"`
+	Host       string `json:"host,omitempty"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Size       int    `json:"size"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Referer    string `json:"referer,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	TLSVersion string `json:"tls_version,omitempty"`
+	TLSCipher  string `json:"tls_cipher,omitempty"`
+}
+
+// jsonLogEntry returns the JSON log entry for the request
+// recorded by rr as a single line ending in a newline.
+func jsonLogEntry(rr *httpserver.ResponseRecorder, rep httpserver.Replacer) string {
+	latency, _ := strconv.ParseInt(rep.Replace("{latency_ms}"), 10, 64)
+	entry := jsonEntry{
+		Time:       time.Now().Format(time.RFC3339),
+		Remote:     rep.Replace("{remote}"),
+		Method:     rep.Replace("{method}"),
+		Scheme:     rep.Replace("{scheme}"),
+		Host:       rep.Replace("{host}"),
+		URI:        rep.Replace("{uri}"),
+		Proto:      rep.Replace("{proto}"),
+		Status:     rr.Status(),
+		Size:       rr.Size(),
+		LatencyMS:  latency,
+		Referer:    rep.Replace("{>Referer}"),
+		UserAgent:  rep.Replace("{>User-Agent}"),
+		RequestID:  rep.Replace("{request_id}"),
+		TLSVersion: rep.Replace("{tls_version}"),
+		TLSCipher:  rep.Replace("{tls_cipher}"),
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		// all fields are strings and numbers, so this can't happen
+		return "{}\n"
+	}
+	return buf.String()
+}
+
 // Rule configures the logging middleware.
 type Rule struct {
 	PathScope  string
@@ -68,7 +168,10 @@ type Rule struct {
 	Format     string
 	Log        *log.Logger
 	Roller     *httpserver.LogRoller
-	file       *os.File // if logging to a file that needs to be closed
+	Condition  httpserver.IfMatcher // only requests it matches are logged
+	Buffer     int                  // entries to queue and write in the background; 0 writes them right away
+	file       *os.File             // if logging to a file that needs to be closed
+	buffer     *bufferedWriter      // if Buffer is set, once the log is opened
 }
 
 const (
@@ -80,6 +183,8 @@ const (
 	CommonLogEmptyValue = "-"
 	// CombinedLogFormat is the combined log format.
 	CombinedLogFormat = CommonLogFormat + ` "{>Referer}" "{>User-Agent}"`
+	// JSONLogFormat logs each request as a JSON object on its own line.
+	JSONLogFormat = "{json}"
 	// DefaultLogFormat is the default log format.
 	DefaultLogFormat = CommonLogFormat
 )
@@ -2,12 +2,14 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -60,3 +62,126 @@ func TestLoggedStatus(t *testing.T) {
 		t.Errorf("Expected the log entry to contain 'foobar' (custom placeholder), but it didn't: %s", logged)
 	}
 }
+
+func TestLogUnknownPlaceholders(t *testing.T) {
+	var f bytes.Buffer
+	logger := Logger{
+		Rules: []Rule{{
+			PathScope: "/",
+			Format:    "{method} {nonexistent} {latency_ms} {uri}",
+			Log:       log.New(&f, "", 0),
+		}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+	}
+
+	r, err := http.NewRequest("GET", "/a%7Bmethod%7D", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logger.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// braces in replaced values must not be treated as placeholders
+	expected := "GET - 0 /a%7Bmethod%7D\n"
+	if logged := f.String(); logged != expected {
+		t.Errorf("Expected log entry %q, got %q", expected, logged)
+	}
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	var f bytes.Buffer
+	logger := Logger{
+		Rules: []Rule{{
+			PathScope: "/",
+			Format:    JSONLogFormat,
+			Log:       log.New(&f, "", 0),
+		}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("short and stout"))
+			return 0, nil
+		}),
+	}
+
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest("GET", `http://example.com/a"b?q=<x>`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = "1.2.3.4:5678"
+		r.Header.Set("User-Agent", `agent "quoted"`)
+		if _, err := logger.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(f.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %q", len(lines), f.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON object per line, got %q: %v", lines[0], err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"method":     "GET",
+		"uri":        `/a%22b?q=<x>`,
+		"remote":     "1.2.3.4",
+		"host":       "example.com",
+		"status":     float64(http.StatusTeapot),
+		"size":       float64(len("short and stout")),
+		"user_agent": `agent "quoted"`,
+	} {
+		if entry[key] != want {
+			t.Errorf("Expected %s to be %v, got %v", key, want, entry[key])
+		}
+	}
+	for _, key := range []string{"ts", "latency_ms"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("Expected entry to have %s", key)
+		}
+	}
+	if _, ok := entry["referer"]; ok {
+		t.Error("Expected empty referer to be left out")
+	}
+}
+
+func TestConditionalLogging(t *testing.T) {
+	c := caddy.NewTestController("http", `log / access.log {
+		if {status} greater_than 399
+		if {path} starts_with /api
+	}`)
+	rules, err := logParse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f bytes.Buffer
+	rules[0].Format = "{status} {path}"
+	rules[0].Log = log.New(&f, "", 0)
+
+	logger := Logger{
+		Rules: rules,
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/api/missing" || r.URL.Path == "/missing" {
+				return http.StatusNotFound, nil
+			}
+			return http.StatusOK, nil
+		}),
+	}
+
+	for _, path := range []string{"/api/users", "/api/missing", "/missing"} {
+		r, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if expected, logged := "404 /api/missing\n", f.String(); logged != expected {
+		t.Errorf("Expected only %q to be logged, got %q", expected, logged)
+	}
+}
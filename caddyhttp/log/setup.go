@@ -4,6 +4,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/hashicorp/go-syslog"
 	"github.com/mholt/caddy"
@@ -48,15 +49,24 @@ func setup(c *caddy.Controller) error {
 				}
 			}
 
+			if rules[i].Buffer > 0 {
+				rules[i].buffer = newBufferedWriter(writer, rules[i].Buffer)
+				writer = rules[i].buffer
+			}
+
 			rules[i].Log = log.New(writer, "", 0)
 		}
 
 		return nil
 	})
 
-	// When server stops, close any open log files
+	// When server stops, write the buffered entries
+	// and close any open log files
 	c.OnShutdown(func() error {
 		for _, rule := range rules {
+			if rule.buffer != nil {
+				rule.buffer.Close()
+			}
 			if rule.file != nil {
 				rule.file.Close()
 			}
@@ -77,55 +87,106 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 	for c.Next() {
 		args := c.RemainingArgs()
 
+		matcher, err := httpserver.SetupIfMatcher(c)
+		if err != nil {
+			return nil, err
+		}
+		condition := matcher.(httpserver.IfMatcher)
+
 		var logRoller *httpserver.LogRoller
-		if c.NextBlock() {
-			if c.Val() == "rotate" {
+		var format string
+		var buffer int
+		for c.NextBlock() {
+			if httpserver.IfMatcherKeyword(c) {
+				continue
+			}
+			what := c.Val()
+			if httpserver.IsLogRollerSubdirective(what) {
+				if logRoller == nil {
+					logRoller = &httpserver.LogRoller{LocalTime: true}
+				}
+				if err := httpserver.ParseRollerSubdirective(c, logRoller); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if what == "format" {
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				format = logFormat(c.Val())
 				if c.NextArg() {
-					if c.Val() == "{" {
-						var err error
-						logRoller, err = httpserver.ParseRoller(c)
-						if err != nil {
-							return nil, err
-						}
-						// This part doesn't allow having something after the rotate block
-						if c.Next() {
-							if c.Val() != "}" {
-								return nil, c.ArgErr()
-							}
+					return nil, c.ArgErr()
+				}
+				continue
+			}
+			if what == "buffer" {
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n <= 0 {
+					return nil, c.Errf("buffer must be a positive number of entries, got '%s'", c.Val())
+				}
+				buffer = n
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				continue
+			}
+			if what != "rotate" {
+				return nil, c.Errf("unknown log subdirective '%s'", what)
+			}
+			if c.NextArg() {
+				if c.Val() == "{" {
+					var err error
+					logRoller, err = httpserver.ParseRoller(c)
+					if err != nil {
+						return nil, err
+					}
+					// This part doesn't allow having something after the rotate block
+					if c.Next() {
+						if c.Val() != "}" {
+							return nil, c.ArgErr()
 						}
 					}
+					break
 				}
 			}
 		}
 		if len(args) == 0 {
 			// Nothing specified; use defaults
+			if format == "" {
+				format = DefaultLogFormat
+			}
 			rules = append(rules, Rule{
 				PathScope:  "/",
 				OutputFile: DefaultLogFilename,
-				Format:     DefaultLogFormat,
+				Format:     format,
 				Roller:     logRoller,
+				Condition:  condition,
+				Buffer:     buffer,
 			})
 		} else if len(args) == 1 {
 			// Only an output file specified
+			if format == "" {
+				format = DefaultLogFormat
+			}
 			rules = append(rules, Rule{
 				PathScope:  "/",
 				OutputFile: args[0],
-				Format:     DefaultLogFormat,
+				Format:     format,
 				Roller:     logRoller,
+				Condition:  condition,
+				Buffer:     buffer,
 			})
 		} else {
-			// Path scope, output file, and maybe a format specified
-
-			format := DefaultLogFormat
-
-			if len(args) > 2 {
-				switch args[2] {
-				case "{common}":
-					format = CommonLogFormat
-				case "{combined}":
-					format = CombinedLogFormat
-				default:
-					format = args[2]
+			// Path scope, output file, and maybe a format specified;
+			// a format subdirective takes precedence
+			if format == "" {
+				format = DefaultLogFormat
+				if len(args) > 2 {
+					format = logFormat(args[2])
 				}
 			}
 
@@ -134,9 +195,25 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 				OutputFile: args[1],
 				Format:     format,
 				Roller:     logRoller,
+				Condition:  condition,
+				Buffer:     buffer,
 			})
 		}
 	}
 
 	return rules, nil
 }
+
+// logFormat returns the format named by s, or s
+// itself if it is a custom format string.
+func logFormat(s string) string {
+	switch s {
+	case "{common}":
+		return CommonLogFormat
+	case "{combined}":
+		return CombinedLogFormat
+	case "json", "{json}":
+		return JSONLogFormat
+	}
+	return s
+}
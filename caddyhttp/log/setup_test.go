@@ -111,6 +111,84 @@ func TestLogParse(t *testing.T) {
 				LocalTime:  true,
 			},
 		}}},
+		{`log access.log { rotate { size 2 compress } }`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     DefaultLogFormat,
+			Roller: &httpserver.LogRoller{
+				MaxSize:   2,
+				Compress:  true,
+				LocalTime: true,
+			},
+		}}},
+		{`log / access.log {common} {
+			rotate_size 100
+			rotate_age 14
+			rotate_keep 10
+			rotate_compress
+		}`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     CommonLogFormat,
+			Roller: &httpserver.LogRoller{
+				MaxSize:    100,
+				RotateAge:  14,
+				MaxBackups: 10,
+				Compress:   true,
+				LocalTime:  true,
+			},
+		}}},
+		{`log / access.log {
+			format json
+		}`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     JSONLogFormat,
+		}}},
+		{`log /api api.log {json}`, false, []Rule{{
+			PathScope:  "/api",
+			OutputFile: "api.log",
+			Format:     JSONLogFormat,
+		}}},
+		{`log access.log {
+			format {combined}
+		}`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     CombinedLogFormat,
+		}}},
+		{`log access.log {
+			format
+		}`, true, nil},
+		{`log / access.log {
+			if {status} greater_than 399
+			if_op or
+			if {path} starts_with /api
+		}`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     DefaultLogFormat,
+		}}},
+		{`log / access.log {
+			if {status} bigger 399
+		}`, true, nil},
+		{`log access.log { rotate_size big }`, true, nil},
+		{`log access.log { rotate_keep -1 }`, true, nil},
+		{`log access.log { rotate_compress yes }`, true, nil},
+		{`log access.log { rotate_age }`, true, nil},
+		{`log access.log { rotation 10 }`, true, nil},
+		{`log / access.log {
+			buffer 1000
+			format json
+		}`, false, []Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			Format:     JSONLogFormat,
+			Buffer:     1000,
+		}}},
+		{`log access.log { buffer }`, true, nil},
+		{`log access.log { buffer 0 }`, true, nil},
+		{`log access.log { buffer lots }`, true, nil},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("http", test.inputLogRules)
@@ -141,6 +219,10 @@ func TestLogParse(t *testing.T) {
 				t.Errorf("Test %d expected %dth LogRule Format to be  %s  , but got %s",
 					i, j, test.expectedLogRules[j].Format, actualLogRule.Format)
 			}
+			if actualLogRule.Buffer != test.expectedLogRules[j].Buffer {
+				t.Errorf("Test %d expected %dth LogRule Buffer to be %d, but got %d",
+					i, j, test.expectedLogRules[j].Buffer, actualLogRule.Buffer)
+			}
 			if actualLogRule.Roller != nil && test.expectedLogRules[j].Roller == nil || actualLogRule.Roller == nil && test.expectedLogRules[j].Roller != nil {
 				t.Fatalf("Test %d expected %dth LogRule Roller to be %v, but got %v",
 					i, j, test.expectedLogRules[j].Roller, actualLogRule.Roller)
@@ -154,6 +236,10 @@ func TestLogParse(t *testing.T) {
 					t.Fatalf("Test %d expected %dth LogRule Roller MaxAge to be %d, but got %d",
 						i, j, test.expectedLogRules[j].Roller.MaxAge, actualLogRule.Roller.MaxAge)
 				}
+				if actualLogRule.Roller.RotateAge != test.expectedLogRules[j].Roller.RotateAge {
+					t.Fatalf("Test %d expected %dth LogRule Roller RotateAge to be %d, but got %d",
+						i, j, test.expectedLogRules[j].Roller.RotateAge, actualLogRule.Roller.RotateAge)
+				}
 				if actualLogRule.Roller.MaxBackups != test.expectedLogRules[j].Roller.MaxBackups {
 					t.Fatalf("Test %d expected %dth LogRule Roller MaxBackups to be %d, but got %d",
 						i, j, test.expectedLogRules[j].Roller.MaxBackups, actualLogRule.Roller.MaxBackups)
@@ -162,6 +248,10 @@ func TestLogParse(t *testing.T) {
 					t.Fatalf("Test %d expected %dth LogRule Roller MaxSize to be %d, but got %d",
 						i, j, test.expectedLogRules[j].Roller.MaxSize, actualLogRule.Roller.MaxSize)
 				}
+				if actualLogRule.Roller.Compress != test.expectedLogRules[j].Roller.Compress {
+					t.Fatalf("Test %d expected %dth LogRule Roller Compress to be %t, but got %t",
+						i, j, test.expectedLogRules[j].Roller.Compress, actualLogRule.Roller.Compress)
+				}
 				if actualLogRule.Roller.LocalTime != test.expectedLogRules[j].Roller.LocalTime {
 					t.Fatalf("Test %d expected %dth LogRule Roller LocalTime to be %t, but got %t",
 						i, j, test.expectedLogRules[j].Roller.LocalTime, actualLogRule.Roller.LocalTime)
@@ -0,0 +1,51 @@
+// Package maintenance implements the maintenance directive, which
+// answers all requests to a site with a maintenance page.
+package maintenance
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Maintenance is middleware that answers every request with Status
+// and Page, except for the requests of clients in Allow, which are
+// passed on so that the site can be tried out during maintenance.
+type Maintenance struct {
+	Next       httpserver.Handler
+	Status     int
+	Page       []byte // nil to leave the response to the error handling
+	PageType   string // the Content-Type of Page
+	RetryAfter time.Duration
+	Allow      []*net.IPNet
+
+	// TrustedProxies are the networks of proxies whose
+	// X-Forwarded-For header tells the client apart.
+	TrustedProxies []*net.IPNet
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if httpserver.IPInNetworks(httpserver.ForwardedClientIP(r, "X-Forwarded-For", m.TrustedProxies), m.Allow) {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	if m.RetryAfter > 0 {
+		// in whole seconds, rounded up
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((m.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+	// the page must not outlive the maintenance in caches
+	w.Header().Set("Cache-Control", "no-store")
+
+	if m.Page == nil {
+		return m.Status, nil
+	}
+	w.Header().Set("Content-Type", m.PageType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.Page)))
+	w.WriteHeader(m.Status)
+	_, err := w.Write(m.Page)
+	return 0, err
+}
@@ -0,0 +1,101 @@
+package maintenance
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMaintenance(t *testing.T) {
+	m := Maintenance{
+		Next:           httpserver.HandlerFunc(okHandler),
+		Status:         http.StatusServiceUnavailable,
+		Page:           []byte("<h1>Back soon</h1>"),
+		PageType:       "text/html; charset=utf-8",
+		RetryAfter:     90*time.Second + time.Millisecond,
+		Allow:          networks(t, "10.0.0.0/8", "2001:db8::1/128"),
+		TrustedProxies: networks(t, "192.168.0.0/16"),
+	}
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		expectPage bool
+	}{
+		{"203.0.113.5:1234", "", true},
+		{"[2001:db8::2]:1234", "", true},
+		// allowed clients bypass the maintenance page
+		{"10.1.2.3:1234", "", false},
+		{"[2001:db8::1]:1234", "", false},
+		{"192.168.1.1:1234", "10.1.2.3", false},
+		{"192.168.1.1:1234", "203.0.113.5", true},
+		// an untrusted client can't claim to be allowed
+		{"203.0.113.5:1234", "10.1.2.3", true},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		rec := httptest.NewRecorder()
+		code, err := m.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if !test.expectPage {
+			if code != http.StatusOK {
+				t.Errorf("Test %d: Expected the request from %s to be passed on, got status %d", i, test.remoteAddr, code)
+			}
+			continue
+		}
+		if code != 0 || rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Test %d: Expected the page to be written with status %d, got %d (recorded %d)",
+				i, http.StatusServiceUnavailable, code, rec.Code)
+		}
+		if got := rec.Body.String(); got != string(m.Page) {
+			t.Errorf("Test %d: Expected body %q, got %q", i, m.Page, got)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "91" {
+			t.Errorf("Test %d: Expected Retry-After 91, got '%s'", i, got)
+		}
+		if got := rec.Header().Get("Content-Type"); got != m.PageType {
+			t.Errorf("Test %d: Expected Content-Type %s, got '%s'", i, m.PageType, got)
+		}
+	}
+}
+
+func TestMaintenanceWithoutPage(t *testing.T) {
+	m := Maintenance{Next: httpserver.HandlerFunc(okHandler), Status: http.StatusServiceUnavailable}
+	rec := httptest.NewRecorder()
+	code, err := m.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d to be returned for the error handling, got %d", http.StatusServiceUnavailable, code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Expected no Retry-After header, got '%s'", got)
+	}
+}
+
+func networks(t *testing.T, cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Parsing %s: %v", cidr, err)
+		}
+		nets = append(nets, network)
+	}
+	return nets
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) (int, error) {
+	return http.StatusOK, nil
+}
@@ -0,0 +1,133 @@
+package maintenance
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("maintenance", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Maintenance middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	m, err := maintenanceParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		m.Next = next
+		return m
+	})
+
+	return nil
+}
+
+// maintenanceParse parses the maintenance directive, which is like
+// "maintenance [page]" with an optional block:
+//
+//	maintenance /maintenance.html {
+//	    status      503
+//	    retry_after 10m
+//	    allow       10.0.0.0/8 2001:db8::1
+//	    trusted     192.168.0.0/16
+//	}
+//
+// The page is relative to root, and is read now, so that deploying
+// to the site doesn't affect it. The status is 503 by default.
+func maintenanceParse(c *caddy.Controller, root string) (Maintenance, error) {
+	m := Maintenance{Status: http.StatusServiceUnavailable}
+
+	var page string
+	var seen bool
+	for c.Next() {
+		if seen {
+			return m, c.Err("maintenance can only be used once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			page = args[0]
+		default:
+			return m, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch what := c.Val(); what {
+			case "status":
+				if !c.NextArg() {
+					return m, c.ArgErr()
+				}
+				status, err := strconv.Atoi(c.Val())
+				if err != nil || status < 200 || status > 599 {
+					return m, c.Errf("status must be an HTTP status code, got '%s'", c.Val())
+				}
+				m.Status = status
+				if c.NextArg() {
+					return m, c.ArgErr()
+				}
+			case "retry_after":
+				if !c.NextArg() {
+					return m, c.ArgErr()
+				}
+				retryAfter, err := time.ParseDuration(c.Val())
+				if err != nil || retryAfter < 0 {
+					return m, c.Errf("retry_after must be a non-negative duration, got '%s'", c.Val())
+				}
+				m.RetryAfter = retryAfter
+				if c.NextArg() {
+					return m, c.ArgErr()
+				}
+			case "allow", "trusted":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return m, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return m, c.Errf("invalid %s address '%s': %v", what, arg, err)
+					}
+					if what == "allow" {
+						m.Allow = append(m.Allow, network)
+					} else {
+						m.TrustedProxies = append(m.TrustedProxies, network)
+					}
+				}
+			default:
+				return m, c.Errf("Unknown maintenance subdirective '%s'", what)
+			}
+		}
+	}
+
+	if page != "" {
+		page = filepath.Join(root, page)
+		body, err := ioutil.ReadFile(page)
+		if err != nil {
+			return m, c.Errf("Reading maintenance page: %v", err)
+		}
+		m.Page = body
+		m.PageType = mime.TypeByExtension(filepath.Ext(page))
+		if m.PageType == "" {
+			m.PageType = "text/html; charset=utf-8"
+		}
+	}
+
+	return m, nil
+}
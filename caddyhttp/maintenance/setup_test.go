@@ -0,0 +1,127 @@
+package maintenance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `maintenance`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Maintenance)
+	if !ok {
+		t.Fatalf("Expected handler to be type Maintenance, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestMaintenanceParse(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "maintenance.html"), []byte("<h1>Back soon</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input            string
+		shouldErr        bool
+		expectStatus     int
+		expectPage       string
+		expectRetryAfter time.Duration
+		expectAllow      []string
+		expectTrusted    []string
+	}{
+		{`maintenance`, false, 503, "", 0, nil, nil},
+		{`maintenance /maintenance.html`, false, 503, "<h1>Back soon</h1>", 0, nil, nil},
+		{`maintenance maintenance.html {
+			status      502
+			retry_after 10m
+			allow       10.0.0.0/8 2001:db8::1
+			trusted     192.168.0.0/16
+		}`, false, 502, "<h1>Back soon</h1>", 10 * time.Minute, []string{"10.0.0.0/8", "2001:db8::1/128"}, []string{"192.168.0.0/16"}},
+		{`maintenance /missing.html`, true, 0, "", 0, nil, nil},
+		{`maintenance a.html b.html`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			status 99
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			status
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			retry_after soon
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			allow
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			allow example.com
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance {
+			deny 10.0.0.1
+		}`, true, 0, "", 0, nil, nil},
+		{`maintenance
+		maintenance`, true, 0, "", 0, nil, nil},
+	}
+	for i, test := range tests {
+		m, err := maintenanceParse(caddy.NewTestController("http", test.input), root)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if m.Status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, m.Status)
+		}
+		if string(m.Page) != test.expectPage {
+			t.Errorf("Test %d: Expected page %q, got %q", i, test.expectPage, m.Page)
+		}
+		if test.expectPage != "" && m.PageType != "text/html; charset=utf-8" {
+			t.Errorf("Test %d: Expected the page to be HTML, got type '%s'", i, m.PageType)
+		}
+		if m.RetryAfter != test.expectRetryAfter {
+			t.Errorf("Test %d: Expected retry after %v, got %v", i, test.expectRetryAfter, m.RetryAfter)
+		}
+		if got := fmt.Sprint(networkStrings(m.Allow)); got != fmt.Sprint(test.expectAllow) {
+			t.Errorf("Test %d: Expected allow %v, got %v", i, test.expectAllow, got)
+		}
+		if got := fmt.Sprint(networkStrings(m.TrustedProxies)); got != fmt.Sprint(test.expectTrusted) {
+			t.Errorf("Test %d: Expected trusted %v, got %v", i, test.expectTrusted, got)
+		}
+	}
+}
+
+func networkStrings(networks []*net.IPNet) []string {
+	var s []string
+	for _, network := range networks {
+		s = append(s, network.String())
+	}
+	return s
+}
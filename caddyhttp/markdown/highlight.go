@@ -0,0 +1,47 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/russross/blackfriday"
+)
+
+// highlightFormatter writes highlighted code as spans with
+// CSS classes, so sites can style it with any chroma theme.
+var highlightFormatter = html.New(html.WithClasses(true))
+
+// highlightRenderer wraps a renderer to highlight fenced code
+// blocks that name their language. Other code blocks are left
+// to the wrapped renderer.
+type highlightRenderer struct {
+	blackfriday.Renderer
+}
+
+// BlockCode is the code tag callback.
+func (r highlightRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+	lexer := lexers.Get(lang)
+	if lang == "" || lexer == nil {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(text))
+	if err != nil {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := highlightFormatter.Format(&buf, styles.Fallback, iterator); err != nil {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	buf.WriteTo(out)
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -32,6 +31,9 @@ type Markdown struct {
 
 	// The list of index files to try
 	IndexFiles []string
+
+	// Whether to leave out the ETags of rendered pages
+	DisableETags bool
 }
 
 // Config stores markdown middleware configurations.
@@ -57,6 +59,11 @@ type Config struct {
 
 // ServeHTTP implements the http.Handler interface.
 func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		md.Root, md.FileSys = root, http.Dir(root)
+	}
+
 	var cfg *Config
 	for _, c := range md.Configs {
 		if httpserver.Path(r.URL.Path).Matches(c.PathScope) { // not negated
@@ -144,11 +151,7 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(html)), 10))
-	httpserver.SetLastModifiedHeader(w, lastModTime)
-	if r.Method == http.MethodGet {
-		w.Write(html)
-	}
+	httpserver.ServeGeneratedContent(w, r, fpath, lastModTime, html, !md.DisableETags)
 	return http.StatusOK, nil
 }
 
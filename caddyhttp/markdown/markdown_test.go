@@ -97,7 +97,7 @@ func TestMarkdown(t *testing.T) {
 <h1>Header for: Markdown test 1</h1>
 
 Welcome to A Caddy website!
-<h2>Welcome on the blog</h2>
+<h2 id="welcome-on-the-blog">Welcome on the blog</h2>
 
 <p>Body</p>
 
@@ -155,7 +155,7 @@ DocFlags.var_bool true`
 		<script src="/resources/js/default.js"></script>
 	</head>
 	<body>
-		<h2>Welcome on the blog</h2>
+		<h2 id="welcome-on-the-blog">Welcome on the blog</h2>
 
 <p>Body</p>
 
@@ -196,7 +196,7 @@ DocFlags.var_bool true`
 <h1>Header for: first_post</h1>
 
 Welcome to title!
-<h1>Test h1</h1>
+<h1 id="test-h1">Test h1</h1>
 
 </body>
 </html>`
@@ -206,6 +206,70 @@ Welcome to title!
 	}
 }
 
+func TestMarkdownRangeAndConditional(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "caddy_markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	if err := ioutil.WriteFile(filepath.Join(rootDir, "page.md"), []byte("# Title\n\nSome text.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(rootDir, "page.md"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	md := Markdown{
+		Root:    rootDir,
+		FileSys: http.Dir(rootDir),
+		Configs: []*Config{
+			{
+				Renderer:   blackfriday.HtmlRenderer(0, "", ""),
+				PathScope:  "/",
+				Extensions: map[string]struct{}{".md": {}},
+				Template:   GetDefaultTemplate(),
+			},
+		},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			t.Fatalf("Next shouldn't be called")
+			return 0, nil
+		}),
+	}
+
+	req, err := http.NewRequest("GET", "/page.md", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	md.ServeHTTP(rec, req)
+	full := rec.Body.String()
+	if got, want := rec.Header().Get("Last-Modified"), modTime.Format(http.TimeFormat); got != want {
+		t.Errorf("Expected Last-Modified %q, got %q", want, got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Expected Content-Type text/html, got %q", got)
+	}
+
+	req.Header.Set("Range", "bytes=5-")
+	rec = httptest.NewRecorder()
+	md.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("Expected status %d for a range request, got %d", http.StatusPartialContent, rec.Code)
+	}
+	if got, want := rec.Body.String(), full[5:]; got != want {
+		t.Errorf("Expected body %q for the range, got %q", want, got)
+	}
+
+	req.Header.Del("Range")
+	req.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	md.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for an unmodified page, got %d", http.StatusNotModified, rec.Code)
+	}
+}
+
 func equalStrings(s1, s2 string) bool {
 	s1 = strings.TrimSpace(s1)
 	s2 = strings.TrimSpace(s2)
@@ -228,3 +292,64 @@ func setDefaultTemplate(filename string) *template.Template {
 
 	return template.Must(GetDefaultTemplate().Parse(string(buf)))
 }
+
+func TestMarkdownTOC(t *testing.T) {
+	tpl := template.Must(template.New("").Parse(
+		`{{range .TOC}}{{.Level}} {{.Anchor}} {{.Text}}
+{{end}}{{.Doc.body}}`))
+	c := &Config{
+		Renderer: blackfriday.HtmlRenderer(0, "", ""),
+		Template: tpl,
+	}
+
+	input := "# Getting Started\n\n## Install\n\ntext\n\n## Install\n\n### *Caddy* &amp; TLS\n\n## Install-1\n"
+	out, err := c.Markdown("toc", strings.NewReader(input), nil, httpserver.Context{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expectedTOC := `1 getting-started Getting Started
+2 install Install
+2 install-1 Install
+3 caddy-tls Caddy & TLS
+2 install-1-1 Install-1
+`
+	if !strings.HasPrefix(string(out), expectedTOC) {
+		t.Errorf("Expected TOC:\n%s\ngot:\n%s", expectedTOC, out)
+	}
+
+	for _, heading := range []string{
+		`<h1 id="getting-started">Getting Started</h1>`,
+		`<h2 id="install">Install</h2>`,
+		`<h2 id="install-1">Install</h2>`,
+		`<h3 id="caddy-tls"><em>Caddy</em> &amp; TLS</h3>`,
+		`<h2 id="install-1-1">Install-1</h2>`,
+	} {
+		if !strings.Contains(string(out), heading) {
+			t.Errorf("Expected output to contain %s, got:\n%s", heading, out)
+		}
+	}
+}
+
+func TestMarkdownHighlight(t *testing.T) {
+	c := &Config{
+		Renderer: highlightRenderer{blackfriday.HtmlRenderer(0, "", "")},
+		Template: template.Must(template.New("").Parse(`{{.Doc.body}}`)),
+	}
+
+	input := "```go\nfunc main() {}\n```\n\n```nosuchlanguage\nplain <text>\n```\n"
+	out, err := c.Markdown("code", strings.NewReader(input), nil, httpserver.Context{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	body := string(out)
+	if !strings.Contains(body, `class="chroma"`) || !strings.Contains(body, `<span class="kd">func</span>`) {
+		t.Errorf("Expected highlighted Go code, got:\n%s", body)
+	}
+	expected := `<pre><code class="language-nosuchlanguage">plain &lt;text&gt;
+</code></pre>`
+	if !strings.Contains(body, expected) {
+		t.Errorf("Expected unknown language to render plainly as %s, got:\n%s", expected, body)
+	}
+}
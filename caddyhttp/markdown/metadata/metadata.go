@@ -3,6 +3,8 @@ package metadata
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -54,26 +56,52 @@ func (m *Metadata) load(parsedMap map[string]interface{}) {
 	if template, ok := parsedMap["template"]; ok {
 		m.Template, _ = template.(string)
 	}
-	if date, ok := parsedMap["date"].(string); ok {
+	switch date := parsedMap["date"].(type) {
+	case string:
 		for _, layout := range timeLayout {
 			if t, err := time.Parse(layout, date); err == nil {
 				m.Date = t
 				break
 			}
 		}
+	case time.Time:
+		m.Date = date
 	}
 
 	// Store everything as a flag or variable
 	for key, val := range parsedMap {
-		switch v := val.(type) {
-		case bool:
+		if v, ok := val.(bool); ok {
 			m.Flags[key] = v
-		case string:
+		} else if v, ok := variable(val); ok {
 			m.Variables[key] = v
 		}
 	}
 }
 
+// variable returns val as a string for use as a template
+// variable. Lists, such as tags, are joined with commas.
+func variable(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case int, int64, float64:
+		return fmt.Sprint(v), true
+	case time.Time:
+		return v.Format(timeLayout[0]), true
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := variable(item)
+			if !ok {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ", "), true
+	}
+	return "", false
+}
+
 // Parser is a an interface that must be satisfied by each parser
 type Parser interface {
 	// Initialize a parser
@@ -259,3 +259,54 @@ Mycket olika byggnader har man i de nordiska rikena: pyramidformiga, kilformiga,
 		}
 	}
 }
+
+func TestFrontMatterVariables(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"YAML", `---
+title: A title
+date: 2016-08-01 10:20:30
+weight: 3
+tags: [caddy, markdown]
+---
+Page content
+`},
+		{"TOML", `+++
+title = "A title"
+date = 2016-08-01T10:20:30Z
+weight = 3
+tags = ["caddy", "markdown"]
++++
+Page content
+`},
+	}
+
+	for _, test := range tests {
+		p := GetParser([]byte(test.input))
+		if p.Type() != test.name {
+			t.Fatalf("Expected %s parser, got %s", test.name, p.Type())
+		}
+		md := p.Metadata()
+
+		if md.Date.Format("2006-01-02 15:04:05") != "2016-08-01 10:20:30" {
+			t.Errorf("%s: expected date 2016-08-01 10:20:30, got %v", test.name, md.Date)
+		}
+		for key, want := range map[string]string{
+			"title":  "A title",
+			"weight": "3",
+			"tags":   "caddy, markdown",
+		} {
+			if got := md.Variables[key]; got != want {
+				t.Errorf("%s: expected variable %s to be %q, got %q", test.name, key, want, got)
+			}
+		}
+		if _, ok := md.Variables["date"]; !ok {
+			t.Errorf("%s: expected date to be available as a variable", test.name)
+		}
+		if body := strings.TrimSpace(string(p.Markdown())); body != "Page content" {
+			t.Errorf("%s: expected front matter to be stripped from the body, got %q", test.name, body)
+		}
+	}
+}
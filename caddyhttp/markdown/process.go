@@ -46,13 +46,9 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 	markdown := parser.Markdown()
 	mdata := parser.Metadata()
 
-	// process markdown
-	extns := 0
-	extns |= blackfriday.EXTENSION_TABLES
-	extns |= blackfriday.EXTENSION_FENCED_CODE
-	extns |= blackfriday.EXTENSION_STRIKETHROUGH
-	extns |= blackfriday.EXTENSION_DEFINITION_LISTS
-	html := blackfriday.Markdown(markdown, c.Renderer, extns)
+	// process markdown, collecting the headings for the TOC
+	toc := newTOCRenderer(c.Renderer)
+	html := blackfriday.Markdown(markdown, toc, httpserver.MarkdownExtensions)
 
 	// set it as body for template
 	mdata.Variables["body"] = string(html)
@@ -73,5 +69,5 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 		files = append(files, file)
 	}
 
-	return execTemplate(c, mdata, files, ctx)
+	return execTemplate(c, mdata, files, toc.entries, ctx)
 }
@@ -26,10 +26,11 @@ func setup(c *caddy.Controller) error {
 	cfg := httpserver.GetConfig(c)
 
 	md := Markdown{
-		Root:       cfg.Root,
-		FileSys:    http.Dir(cfg.Root),
-		Configs:    mdconfigs,
-		IndexFiles: []string{"index.md"},
+		Root:         cfg.Root,
+		FileSys:      http.Dir(cfg.Root),
+		Configs:      mdconfigs,
+		IndexFiles:   []string{"index.md"},
+		DisableETags: cfg.DisableETags,
 	}
 
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
@@ -122,6 +123,14 @@ func loadParams(c *caddy.Controller, mdc *Config) error {
 			}
 			return nil
 		}
+	case "highlight":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, ok := mdc.Renderer.(highlightRenderer); !ok {
+			mdc.Renderer = highlightRenderer{mdc.Renderer}
+		}
+		return nil
 	case "templatedir":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -151,3 +151,27 @@ func equalTemplates(i, j *template.Template) (bool, string, string) {
 
 	return bytes.Equal(bufi.Bytes(), bufj.Bytes()), string(bufi.Bytes()), string(bufj.Bytes())
 }
+
+func TestMarkdownParseHighlight(t *testing.T) {
+	c := caddy.NewTestController("http", `markdown /docs {
+	highlight
+}
+markdown /blog`)
+	configs, err := markdownParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := configs[0].Renderer.(highlightRenderer); !ok {
+		t.Errorf("Expected highlighting renderer for /docs, got %T", configs[0].Renderer)
+	}
+	if _, ok := configs[1].Renderer.(highlightRenderer); ok {
+		t.Error("Expected /blog not to highlight code")
+	}
+
+	c = caddy.NewTestController("http", `markdown /docs {
+	highlight on
+}`)
+	if _, err := markdownParse(c); err == nil {
+		t.Error("Expected an error for highlight with an argument")
+	}
+}
@@ -17,6 +17,7 @@ type Data struct {
 	Styles   []string
 	Scripts  []string
 	Files    []FileInfo
+	TOC      []TOCEntry
 }
 
 // Include "overrides" the embedded httpserver.Context's Include()
@@ -27,7 +28,7 @@ func (d Data) Include(filename string) (string, error) {
 }
 
 // execTemplate executes a template given a requestPath, template, and metadata
-func execTemplate(c *Config, mdata metadata.Metadata, files []FileInfo, ctx httpserver.Context) ([]byte, error) {
+func execTemplate(c *Config, mdata metadata.Metadata, files []FileInfo, toc []TOCEntry, ctx httpserver.Context) ([]byte, error) {
 	mdData := Data{
 		Context:  ctx,
 		Doc:      mdata.Variables,
@@ -35,6 +36,7 @@ func execTemplate(c *Config, mdata metadata.Metadata, files []FileInfo, ctx http
 		Styles:   c.Styles,
 		Scripts:  c.Scripts,
 		Files:    files,
+		TOC:      toc,
 	}
 
 	b := new(bytes.Buffer)
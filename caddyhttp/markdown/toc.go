@@ -0,0 +1,104 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/russross/blackfriday"
+)
+
+// TOCEntry is a heading of a markdown document, listed in
+// the order it appears. Templates get these as .TOC.
+type TOCEntry struct {
+	Level  int    // 1 through 6
+	Text   string // the heading as plain text
+	Anchor string // the id of the rendered heading
+}
+
+// tocRenderer wraps a renderer to collect the headings of a
+// document and give each rendered heading an id anchor. A new
+// tocRenderer must be used for every document.
+type tocRenderer struct {
+	blackfriday.Renderer
+	entries []TOCEntry
+	anchors map[string]int
+}
+
+func newTOCRenderer(r blackfriday.Renderer) *tocRenderer {
+	return &tocRenderer{Renderer: r, anchors: make(map[string]int)}
+}
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	headingID  = regexp.MustCompile(`^<h[1-6] id="([^"]*)"`)
+	headingTag = regexp.MustCompile(`^<h[1-6]>`)
+)
+
+// Header is the header tag callback. It renders the heading with
+// the wrapped renderer, then records it and adds its anchor.
+func (r *tocRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	var inner string
+	marker := out.Len()
+	r.Renderer.Header(out, func() bool {
+		start := out.Len()
+		ok := text()
+		inner = out.String()[start:]
+		return ok
+	}, level, id)
+	if out.Len() == marker {
+		return // nothing rendered
+	}
+
+	rendered := out.Bytes()[marker:]
+	lead := len(rendered) - len(bytes.TrimLeft(rendered, "\n"))
+	tag := rendered[lead:]
+
+	entry := TOCEntry{
+		Level: level,
+		Text:  html.UnescapeString(htmlTag.ReplaceAllString(inner, "")),
+	}
+	if m := headingID.FindSubmatch(tag); m != nil {
+		// the wrapped renderer already chose an anchor
+		entry.Anchor = string(m[1])
+	} else if loc := headingTag.FindIndex(tag); loc != nil {
+		entry.Anchor = r.uniqueAnchor(slugify(entry.Text))
+		withID := fmt.Sprintf("<h%d id=\"%s\">", level, entry.Anchor)
+		rest := append([]byte(withID), tag[loc[1]:]...)
+		out.Truncate(marker + lead)
+		out.Write(rest)
+	}
+	r.entries = append(r.entries, entry)
+}
+
+// uniqueAnchor returns slug, suffixed with a number if slug was
+// already used by an earlier heading of the document.
+func (r *tocRenderer) uniqueAnchor(slug string) string {
+	if slug == "" {
+		slug = "section"
+	}
+	anchor := slug
+	for {
+		n, used := r.anchors[anchor]
+		if !used {
+			break
+		}
+		r.anchors[anchor] = n + 1
+		anchor = slug + "-" + strconv.Itoa(n+1)
+	}
+	r.anchors[anchor] = 0
+	return anchor
+}
+
+// slugify lowercases s and joins its runs of letters
+// and digits with dashes, for use as an HTML id.
+func slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
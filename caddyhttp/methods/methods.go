@@ -0,0 +1,73 @@
+// Package methods implements the methods directive, which allows
+// only the given HTTP methods for requests to a path.
+package methods
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Methods is middleware that rejects the requests to the paths of
+// its rules with methods that aren't allowed.
+type Methods struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// Rule allows the methods in Methods for requests to paths under
+// Path. Other methods get a 405 Method Not Allowed response, except
+// for OPTIONS, which is answered with the allowed methods, or passed
+// on to the next handler if PassOptions is true.
+type Rule struct {
+	Path        string
+	Methods     []string
+	PassOptions bool
+}
+
+// BasePath satisfies httpserver.HandlerConfig.
+func (rule Rule) BasePath() string { return rule.Path }
+
+// Match satisfies httpserver.RequestMatcher.
+func (rule Rule) Match(r *http.Request) bool {
+	return httpserver.Path(r.URL.Path).Matches(rule.Path)
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Methods) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rule, ok := httpserver.ConfigSelector(m.Rules).Select(r).(Rule)
+	if !ok || rule.allows(r.Method) {
+		return m.Next.ServeHTTP(w, r)
+	}
+	if r.Method == http.MethodOptions {
+		if rule.PassOptions {
+			return m.Next.ServeHTTP(w, r)
+		}
+		w.Header().Set("Allow", rule.allowHeader())
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+	w.Header().Set("Allow", rule.allowHeader())
+	return http.StatusMethodNotAllowed, nil
+}
+
+// allows returns true if method is one of the rule's methods.
+func (rule Rule) allows(method string) bool {
+	for _, m := range rule.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeader returns the value of the Allow header for the
+// rule: its methods and OPTIONS, which is always answered.
+func (rule Rule) allowHeader() string {
+	methods := rule.Methods
+	if !rule.allows(http.MethodOptions) {
+		methods = append(methods[:len(methods):len(methods)], http.MethodOptions)
+	}
+	return strings.Join(methods, ", ")
+}
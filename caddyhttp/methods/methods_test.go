@@ -0,0 +1,77 @@
+package methods
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMethods(t *testing.T) {
+	m := Methods{
+		Next: httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{
+			Rule{Path: "/", Methods: []string{"GET", "HEAD", "POST"}},
+			Rule{Path: "/static", Methods: []string{"GET", "HEAD"}},
+			Rule{Path: "/api", Methods: []string{"GET", "PUT"}, PassOptions: true},
+			Rule{Path: "/dav", Methods: []string{"GET", "OPTIONS"}},
+		},
+	}
+
+	tests := []struct {
+		method      string
+		path        string
+		expected    int
+		expectAllow string
+	}{
+		{"GET", "/", http.StatusOK, ""},
+		{"POST", "/form", http.StatusOK, ""},
+		{"TRACE", "/", http.StatusMethodNotAllowed, "GET, HEAD, POST, OPTIONS"},
+		{"CONNECT", "/", http.StatusMethodNotAllowed, "GET, HEAD, POST, OPTIONS"},
+
+		// the longest path wins
+		{"GET", "/static/app.js", http.StatusOK, ""},
+		{"HEAD", "/static/app.js", http.StatusOK, ""},
+		{"POST", "/static/app.js", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+
+		// OPTIONS is answered, passed on, or allowed like any other method
+		{"OPTIONS", "/static", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/api", http.StatusOK, ""},
+		{"DELETE", "/api", http.StatusMethodNotAllowed, "GET, PUT, OPTIONS"},
+		{"OPTIONS", "/dav", http.StatusOK, ""},
+		{"PUT", "/dav", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rec := httptest.NewRecorder()
+		code, err := m.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expected {
+			t.Errorf("Test %d: %s %s: expected status %d, got %d", i, test.method, test.path, test.expected, code)
+		}
+		if allow := rec.Header().Get("Allow"); allow != test.expectAllow {
+			t.Errorf("Test %d: %s %s: expected Allow '%s', got '%s'", i, test.method, test.path, test.expectAllow, allow)
+		}
+	}
+}
+
+func TestMethodsNoRule(t *testing.T) {
+	m := Methods{
+		Next:  httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{Rule{Path: "/static", Methods: []string{"GET"}}},
+	}
+	code, _ := m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/other", nil))
+	if code != http.StatusOK {
+		t.Errorf("Expected a request to a path without a rule to be passed on, got status %d", code)
+	}
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) (int, error) {
+	return http.StatusOK, nil
+}
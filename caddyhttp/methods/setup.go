@@ -0,0 +1,109 @@
+package methods
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("methods", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Methods middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := methodsParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Methods{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// methodsParse parses the methods directives, which are like
+// "methods [path] method..." with an optional block:
+//
+//	methods /static GET HEAD {
+//	    options pass
+//	}
+//
+// OPTIONS requests are answered with the allowed methods unless
+// "options pass" hands them to the next handler, for example to
+// let a proxied application answer them.
+func methodsParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule.Path = args[0]
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return rules, c.ArgErr()
+		}
+		for _, arg := range args {
+			method := strings.ToUpper(arg)
+			if !validMethod(method) {
+				return rules, c.Errf("Invalid method '%s'", arg)
+			}
+			if !rule.allows(method) {
+				rule.Methods = append(rule.Methods, method)
+			}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "options":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				switch c.Val() {
+				case "answer":
+					rule.PassOptions = false
+				case "pass":
+					rule.PassOptions = true
+				default:
+					return rules, c.Errf("options must be answer or pass, got '%s'", c.Val())
+				}
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			default:
+				return rules, c.Errf("Unknown methods subdirective '%s'", c.Val())
+			}
+		}
+
+		for _, other := range rules {
+			if other.BasePath() == rule.Path {
+				return rules, c.Errf("Duplicate methods rule for path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// validMethod returns true if method is a valid method name,
+// which is a token of upper case letters.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, ch := range method {
+		if ch < 'A' || ch > 'Z' {
+			return false
+		}
+	}
+	return true
+}
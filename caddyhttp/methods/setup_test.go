@@ -0,0 +1,94 @@
+package methods
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `methods /static GET HEAD`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Methods)
+	if !ok {
+		t.Fatalf("Expected handler to be type Methods, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestMethodsParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		path        string
+		methods     []string
+		passOptions bool
+	}{
+		{`methods GET HEAD`, false, "/", []string{"GET", "HEAD"}, false},
+		{`methods /static get head`, false, "/static", []string{"GET", "HEAD"}, false},
+		{`methods / GET GET POST`, false, "/", []string{"GET", "POST"}, false},
+		{`methods /api GET PUT {
+			options pass
+		}`, false, "/api", []string{"GET", "PUT"}, true},
+		{`methods /api GET {
+			options answer
+		}`, false, "/api", []string{"GET"}, false},
+		{`methods`, true, "", nil, false},
+		{`methods /static`, true, "", nil, false},
+		{`methods GET/HEAD`, true, "", nil, false},
+		{`methods / GET {
+			options
+		}`, true, "", nil, false},
+		{`methods / GET {
+			options maybe
+		}`, true, "", nil, false},
+		{`methods / GET {
+			options pass answer
+		}`, true, "", nil, false},
+		{`methods / GET {
+			trace off
+		}`, true, "", nil, false},
+		{`methods / GET
+		methods / POST`, true, "", nil, false},
+	}
+	for i, test := range tests {
+		rules, err := methodsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != 1 {
+			t.Fatalf("Test %d: Expected 1 rule, got %d", i, len(rules))
+		}
+		rule := rules[0].(Rule)
+		if rule.Path != test.path {
+			t.Errorf("Test %d: Expected path '%s', got '%s'", i, test.path, rule.Path)
+		}
+		if fmt.Sprint(rule.Methods) != fmt.Sprint(test.methods) {
+			t.Errorf("Test %d: Expected methods %v, got %v", i, test.methods, rule.Methods)
+		}
+		if rule.PassOptions != test.passOptions {
+			t.Errorf("Test %d: Expected PassOptions %v, got %v", i, test.passOptions, rule.PassOptions)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package metrics implements the metrics directive, which reports
+// the traffic of sites in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request
+// latency histogram buckets if none are configured.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is middleware that measures the requests to a site, and
+// serves the measurements of all sites at Path.
+type Metrics struct {
+	Next httpserver.Handler
+
+	// Host is the host of the site, used as the host label.
+	Host string
+
+	// Path is where the metrics are served. It is empty if the
+	// metrics are served on a separate listener instead.
+	Path string
+
+	// Buckets are the upper bounds of the latency histogram.
+	Buckets []float64
+
+	registry *registry
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if m.Path != "" && httpserver.Path(r.URL.Path).Matches(m.Path) {
+		m.registry.ServeHTTP(w, r)
+		return 0, nil
+	}
+
+	inFlight := m.registry.inFlight(m.Host)
+	atomic.AddInt64(inFlight, 1)
+	defer atomic.AddInt64(inFlight, -1)
+
+	rec, ok := w.(*httpserver.ResponseRecorder)
+	if !ok {
+		rec = httpserver.NewResponseRecorder(w)
+	}
+	start := time.Now()
+	status, err := m.Next.ServeHTTP(rec, r)
+
+	// a status returned instead of written is written by
+	// error handling further up the chain
+	code := status
+	if code == 0 {
+		code = rec.Status()
+	}
+	m.registry.observe(seriesKey{m.Host, methodLabel(r.Method), strconv.Itoa(code)},
+		m.Buckets, time.Since(start).Seconds())
+
+	return status, err
+}
+
+// methodLabel returns method, or OTHER if it is not a standard
+// method, so clients can't make up new time series at will.
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+// seriesKey identifies the time series of requests
+// with the same labels.
+type seriesKey struct {
+	host, method, status string
+}
+
+// series holds the measurements of requests with the same labels.
+type series struct {
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative
+	count   uint64
+	sum     float64
+}
+
+// registry holds the measurements of all sites. It is safe
+// for concurrent use.
+type registry struct {
+	mu     sync.Mutex
+	series map[seriesKey]*series
+	gauges map[string]*int64 // requests in flight, by host
+}
+
+// defaultRegistry is shared by all sites, so every endpoint
+// reports the traffic of the whole process, like Prometheus
+// expects of a single target.
+var defaultRegistry = newRegistry()
+
+func newRegistry() *registry {
+	return &registry{
+		series: make(map[seriesKey]*series),
+		gauges: make(map[string]*int64),
+	}
+}
+
+// inFlight returns the gauge of requests to host in progress.
+func (reg *registry) inFlight(host string) *int64 {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	gauge, ok := reg.gauges[host]
+	if !ok {
+		gauge = new(int64)
+		reg.gauges[host] = gauge
+	}
+	return gauge
+}
+
+// observe records a request that took seconds to serve.
+func (reg *registry) observe(key seriesKey, buckets []float64, seconds float64) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	s, ok := reg.series[key]
+	if !ok {
+		s = &series{buckets: buckets, counts: make([]uint64, len(buckets))}
+		reg.series[key] = s
+	}
+	s.count++
+	s.sum += seconds
+	if i := sort.SearchFloat64s(s.buckets, seconds); i < len(s.buckets) {
+		s.counts[i]++
+	}
+}
+
+// ServeHTTP writes the measurements in the Prometheus text format.
+func (reg *registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	reg.writeTo(w)
+}
+
+// writeTo writes the measurements to w in the Prometheus text format,
+// with the time series in a stable order.
+func (reg *registry) writeTo(w io.Writer) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	keys := make([]seriesKey, 0, len(reg.series))
+	for key := range reg.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	fmt.Fprintln(w, "# HELP caddy_http_requests_total Number of HTTP requests served.")
+	fmt.Fprintln(w, "# TYPE caddy_http_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "caddy_http_requests_total%s %d\n", key.labels(), reg.series[key].count)
+	}
+
+	fmt.Fprintln(w, "# HELP caddy_http_request_duration_seconds Time taken to serve HTTP requests.")
+	fmt.Fprintln(w, "# TYPE caddy_http_request_duration_seconds histogram")
+	for _, key := range keys {
+		s := reg.series[key]
+		labels := key.labels()
+		var cumulative uint64
+		for i, bound := range s.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "caddy_http_request_duration_seconds_bucket%s %d\n",
+				labels[:len(labels)-1]+`,le="`+formatFloat(bound)+`"}`, cumulative)
+		}
+		fmt.Fprintf(w, "caddy_http_request_duration_seconds_bucket%s %d\n",
+			labels[:len(labels)-1]+`,le="+Inf"}`, s.count)
+		fmt.Fprintf(w, "caddy_http_request_duration_seconds_sum%s %s\n", labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "caddy_http_request_duration_seconds_count%s %d\n", labels, s.count)
+	}
+
+	hosts := make([]string, 0, len(reg.gauges))
+	for host := range reg.gauges {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	fmt.Fprintln(w, "# HELP caddy_http_requests_in_flight Number of HTTP requests being served.")
+	fmt.Fprintln(w, "# TYPE caddy_http_requests_in_flight gauge")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "caddy_http_requests_in_flight{host=%s} %d\n",
+			quoteLabel(host), atomic.LoadInt64(reg.gauges[host]))
+	}
+}
+
+// labels returns the labels of key in the exposition format.
+func (key seriesKey) labels() string {
+	return fmt.Sprintf("{host=%s,method=%s,status=%s}",
+		quoteLabel(key.host), quoteLabel(key.method), quoteLabel(key.status))
+}
+
+// labelEscaper escapes label values for the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMetrics(t *testing.T) {
+	m := Metrics{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			switch r.URL.Path {
+			case "/missing":
+				return http.StatusNotFound, nil
+			case "/written":
+				w.WriteHeader(http.StatusTeapot)
+				return 0, nil
+			}
+			return http.StatusOK, nil
+		}),
+		Host:     "example.com",
+		Path:     "/metrics",
+		Buckets:  []float64{0.5, 60},
+		registry: newRegistry(),
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/"},
+		{"GET", "/"},
+		{"POST", "/missing"},
+		{"GET", "/written"},
+		{"BREW", "/"},
+	} {
+		r, err := http.NewRequest(req.method, req.path, nil)
+		if err != nil {
+			t.Fatalf("Could not create HTTP request: %v", err)
+		}
+		if _, err := m.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	r, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	status, err := m.ServeHTTP(rec, r)
+	if err != nil || status != 0 {
+		t.Fatalf("Expected metrics to be served, got status %d and error %v", status, err)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("Expected Content-Type %q, got %q", want, got)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE caddy_http_requests_total counter",
+		`caddy_http_requests_total{host="example.com",method="GET",status="200"} 2`,
+		`caddy_http_requests_total{host="example.com",method="GET",status="418"} 1`,
+		`caddy_http_requests_total{host="example.com",method="OTHER",status="200"} 1`,
+		`caddy_http_requests_total{host="example.com",method="POST",status="404"} 1`,
+		"# TYPE caddy_http_request_duration_seconds histogram",
+		`caddy_http_request_duration_seconds_bucket{host="example.com",method="GET",status="200",le="0.5"} 2`,
+		`caddy_http_request_duration_seconds_bucket{host="example.com",method="GET",status="200",le="60"} 2`,
+		`caddy_http_request_duration_seconds_bucket{host="example.com",method="GET",status="200",le="+Inf"} 2`,
+		`caddy_http_request_duration_seconds_count{host="example.com",method="GET",status="200"} 2`,
+		"# TYPE caddy_http_requests_in_flight gauge",
+		`caddy_http_requests_in_flight{host="example.com"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `path`) || strings.Contains(body, "/metrics") {
+		t.Errorf("Expected the metrics request itself not to be counted, got:\n%s", body)
+	}
+}
+
+func TestMetricsInFlight(t *testing.T) {
+	reg := newRegistry()
+	var inFlight string
+	m := Metrics{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			var sb strings.Builder
+			reg.writeTo(&sb)
+			inFlight = sb.String()
+			return http.StatusOK, nil
+		}),
+		Host:     "example.com",
+		Buckets:  DefaultBuckets,
+		registry: reg,
+	}
+
+	r, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	if status, _ := m.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusOK {
+		t.Errorf("Expected metrics not to be served without a path, got status %d", status)
+	}
+	if want := `caddy_http_requests_in_flight{host="example.com"} 1`; !strings.Contains(inFlight, want) {
+		t.Errorf("Expected %q while serving the request, got:\n%s", want, inFlight)
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	if got, want := quoteLabel("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
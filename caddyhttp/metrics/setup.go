@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("metrics", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new metrics middleware instance.
+func setup(c *caddy.Controller) error {
+	m, listen, err := metricsParse(c)
+	if err != nil {
+		return err
+	}
+	m.Host = httpserver.GetConfig(c).Addr.Host
+	m.registry = defaultRegistry
+	m.registry.inFlight(m.Host) // report the site before its first request
+
+	if listen != "" {
+		c.OnStartup(func() error {
+			return startMetricsServer(listen)
+		})
+		c.OnShutdown(func() error {
+			return stopMetricsServer(listen)
+		})
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		m.Next = next
+		return m
+	})
+
+	return nil
+}
+
+func metricsParse(c *caddy.Controller) (Metrics, string, error) {
+	m := Metrics{Path: defaultMetricsPath, Buckets: DefaultBuckets}
+	var listen string
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			m.Path = args[0]
+		default:
+			return m, "", c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "path":
+				if !c.NextArg() {
+					return m, "", c.ArgErr()
+				}
+				m.Path = c.Val()
+				if c.NextArg() {
+					return m, "", c.ArgErr()
+				}
+			case "buckets":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return m, "", c.ArgErr()
+				}
+				m.Buckets = make([]float64, len(args))
+				for i, arg := range args {
+					bound, err := strconv.ParseFloat(arg, 64)
+					if err != nil {
+						return m, "", c.Errf("invalid bucket '%s'", arg)
+					}
+					if i > 0 && bound <= m.Buckets[i-1] {
+						return m, "", c.Errf("buckets must be in increasing order, but %s follows %s", arg, args[i-1])
+					}
+					m.Buckets[i] = bound
+				}
+			case "listen":
+				if !c.NextArg() {
+					return m, "", c.ArgErr()
+				}
+				listen = c.Val()
+				if _, _, err := net.SplitHostPort(listen); err != nil {
+					return m, "", c.Errf("invalid listen address '%s': %v", listen, err)
+				}
+				if c.NextArg() {
+					return m, "", c.ArgErr()
+				}
+			default:
+				return m, "", c.Errf("Unknown metrics subdirective '%s'", c.Val())
+			}
+		}
+	}
+
+	if listen != "" {
+		// the metrics are only served on the internal listener,
+		// never to the clients of the site
+		m.Path = ""
+	}
+	return m, listen, nil
+}
+
+// metricsServer is a server for the metrics on a separate
+// listener, shared by all sites configured to use its address.
+type metricsServer struct {
+	server   *http.Server
+	listener net.Listener
+	refs     int
+}
+
+// metricsServers are the running metrics servers by address. They
+// are reference counted so that they keep running across restarts,
+// where the new instance starts before the old one shuts down.
+var (
+	metricsServersMu sync.Mutex
+	metricsServers   = make(map[string]*metricsServer)
+)
+
+// startMetricsServer makes sure the metrics are served on addr.
+func startMetricsServer(addr string) error {
+	metricsServersMu.Lock()
+	defer metricsServersMu.Unlock()
+
+	if ms, ok := metricsServers[addr]; ok {
+		ms.refs++
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ms := &metricsServer{server: &http.Server{Handler: defaultRegistry}, listener: ln, refs: 1}
+	metricsServers[addr] = ms
+	go func() {
+		if err := ms.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[ERROR] Serving metrics on %s: %v", addr, err)
+		}
+	}()
+	return nil
+}
+
+// stopMetricsServer releases the metrics server on addr,
+// and closes it once no site uses it anymore.
+func stopMetricsServer(addr string) error {
+	metricsServersMu.Lock()
+	defer metricsServersMu.Unlock()
+
+	ms, ok := metricsServers[addr]
+	if !ok {
+		return nil
+	}
+	ms.refs--
+	if ms.refs > 0 {
+		return nil
+	}
+	delete(metricsServers, addr)
+	return ms.server.Close()
+}
+
+var defaultMetricsPath = "/metrics"
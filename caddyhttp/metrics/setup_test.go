@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `metrics`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Metrics)
+	if !ok {
+		t.Fatalf("Expected handler to be type Metrics, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestMetricsParse(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedPath    string
+		expectedBuckets []float64
+		expectedListen  string
+	}{
+		{`metrics`, false, "/metrics", DefaultBuckets, ""},
+		{`metrics /stats`, false, "/stats", DefaultBuckets, ""},
+		{`metrics {
+			path /stats
+			buckets 0.1 1 10
+		}`, false, "/stats", []float64{0.1, 1, 10}, ""},
+		{`metrics {
+			listen 127.0.0.1:9180
+		}`, false, "", DefaultBuckets, "127.0.0.1:9180"},
+		{`metrics /a /b`, true, "", nil, ""},
+		{`metrics {
+			buckets
+		}`, true, "", nil, ""},
+		{`metrics {
+			buckets 1 x
+		}`, true, "", nil, ""},
+		{`metrics {
+			buckets 1 1
+		}`, true, "", nil, ""},
+		{`metrics {
+			listen 9180
+		}`, true, "", nil, ""},
+		{`metrics {
+			bogus
+		}`, true, "", nil, ""},
+	}
+	for i, test := range tests {
+		m, listen, err := metricsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if m.Path != test.expectedPath {
+			t.Errorf("Test %d: Expected path %q, got %q", i, test.expectedPath, m.Path)
+		}
+		if !reflect.DeepEqual(m.Buckets, test.expectedBuckets) {
+			t.Errorf("Test %d: Expected buckets %v, got %v", i, test.expectedBuckets, m.Buckets)
+		}
+		if listen != test.expectedListen {
+			t.Errorf("Test %d: Expected listen %q, got %q", i, test.expectedListen, listen)
+		}
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+	const addr = "127.0.0.1:0"
+	if err := startMetricsServer(addr); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// a restart starts the new instance before stopping the old one
+	if err := startMetricsServer(addr); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := stopMetricsServer(addr); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	metricsServersMu.Lock()
+	ms, ok := metricsServers[addr]
+	metricsServersMu.Unlock()
+	if !ok || ms.refs != 1 {
+		t.Fatal("Expected the metrics server to keep running while still in use")
+	}
+
+	resp, err := http.Get("http://" + ms.listener.Addr().String() + "/anything")
+	if err != nil {
+		t.Fatalf("Expected metrics to be served, got: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "# TYPE caddy_http_requests_total counter") {
+		t.Errorf("Expected metrics in the response, got:\n%s", body)
+	}
+
+	if err := stopMetricsServer(addr); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := metricsServers[addr]; ok {
+		t.Error("Expected the metrics server to be stopped once unused")
+	}
+}
@@ -3,16 +3,20 @@ package mime
 import (
 	"net/http"
 	"path"
+	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 // Config represent a mime config. Map from extension to mime-type.
+// Extensions are lowercase, and matched regardless of case.
 // Note, this should be safe with concurrent read access, as this is
 // not modified concurrently.
 type Config map[string]string
 
 // Mime sets Content-Type header of requests based on configurations.
+// Since it is set before the request is served, it takes precedence
+// over the type that the static file server would guess.
 type Mime struct {
 	Next    httpserver.Handler
 	Configs Config
@@ -21,7 +25,7 @@ type Mime struct {
 // ServeHTTP implements the httpserver.Handler interface.
 func (e Mime) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// Get a clean /-path, grab the extension
-	ext := path.Ext(path.Clean(r.URL.Path))
+	ext := strings.ToLower(path.Ext(path.Clean(r.URL.Path)))
 
 	if contentType, ok := e.Configs[ext]; ok {
 		w.Header().Set("Content-Type", contentType)
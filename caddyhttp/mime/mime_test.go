@@ -2,11 +2,15 @@ package mime
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
 )
 
 func TestMimeHandler(t *testing.T) {
@@ -67,3 +71,49 @@ func nextFunc(shouldMime bool, contentType string) httpserver.Handler {
 		return 0, nil
 	})
 }
+
+func TestMimeServesStaticFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_mime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"app.wasm", "site.webmanifest", "notes.txt", "LOUD.WASM", "page.html"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := Mime{
+		Next: staticfiles.FileServer{Root: http.Dir(root)},
+		Configs: Config{
+			".wasm":        "application/wasm",
+			".webmanifest": "application/manifest+json",
+			".txt":         "text/x-notes",
+		},
+	}
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/app.wasm", "application/wasm"},
+		{"/site.webmanifest", "application/manifest+json"},
+		{"/notes.txt", "text/x-notes"}, // wins over the standard library
+		{"/LOUD.WASM", "application/wasm"},
+		{"/page.html", "text/html; charset=utf-8"}, // not mapped; guessed
+	}
+	for i, test := range tests {
+		r, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		if _, err := m.ServeHTTP(w, r); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("Test %d: Expected Content-Type %s, got %s", i, test.contentType, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package mime
 
 import (
 	"fmt"
+	"mime"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -38,22 +39,20 @@ func mimeParse(c *caddy.Controller) (Config, error) {
 		args := c.RemainingArgs()
 		switch len(args) {
 		case 2:
-			if err := validateExt(configs, args[0]); err != nil {
+			if err := addMapping(configs, args[0], args[1]); err != nil {
 				return configs, err
 			}
-			configs[args[0]] = args[1]
 		case 1:
 			return configs, c.ArgErr()
 		case 0:
 			for c.NextBlock() {
 				ext := c.Val()
-				if err := validateExt(configs, ext); err != nil {
-					return configs, err
-				}
 				if !c.NextArg() {
 					return configs, c.ArgErr()
 				}
-				configs[ext] = c.Val()
+				if err := addMapping(configs, ext, c.Val()); err != nil {
+					return configs, err
+				}
 			}
 		}
 
@@ -62,6 +61,20 @@ func mimeParse(c *caddy.Controller) (Config, error) {
 	return configs, nil
 }
 
+// addMapping adds the mapping of ext to contentType to configs
+// after checking that both are valid.
+func addMapping(configs Config, ext, contentType string) error {
+	ext = strings.ToLower(ext)
+	if err := validateExt(configs, ext); err != nil {
+		return err
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return fmt.Errorf(`mime: invalid type "%v" for extension "%v": %v`, contentType, ext, err)
+	}
+	configs[ext] = contentType
+	return nil
+}
+
 // validateExt checks for valid file name extension.
 func validateExt(configs Config, ext string) error {
 	if !strings.HasPrefix(ext, ".") {
@@ -1,6 +1,7 @@
 package mime
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -61,3 +62,42 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestMimeParseMappings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Config
+	}{
+		{`mime { .wasm application/wasm  .webmanifest application/manifest+json }`, Config{
+			".wasm":        "application/wasm",
+			".webmanifest": "application/manifest+json",
+		}},
+		{`mime .WASM application/wasm`, Config{".wasm": "application/wasm"}},
+		{`mime {
+			.txt "text/plain; charset=utf-8"
+		}`, Config{".txt": "text/plain; charset=utf-8"}},
+	}
+	for i, test := range tests {
+		m, err := mimeParse(caddy.NewTestController("http", test.input))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, m)
+		}
+	}
+
+	for i, input := range []string{
+		`mime .wasm application/`,
+		`mime .wasm "text/plain; charset"`,
+		`mime {
+			.wasm application/wasm
+			.WASM application/wasm
+		}`,
+	} {
+		if m, err := mimeParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error but found nil %v", i, m)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// BodyReplacement replaces From with To in the bodies of
+// responses. To may contain placeholders.
+type BodyReplacement struct {
+	From string
+	To   string
+}
+
+// createRespBodyRewriteFn returns a function that rewrites the
+// bodies of text responses with replacements. The body is
+// streamed, so the Content-Length of the response is dropped.
+func createRespBodyRewriteFn(replacements []BodyReplacement, replacer httpserver.Replacer) respUpdateFn {
+	return func(resp *http.Response) {
+		if !isTextContent(resp.Header.Get("Content-Type")) {
+			return
+		}
+		if ce := resp.Header.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+			return
+		}
+		resp.Body = newReplaceReader(resp.Body, replacements, replacer)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			resp.Header.Set("ETag", "W/"+etag)
+		}
+	}
+}
+
+// isTextContent returns true if contentType is that of text,
+// which can be rewritten without breaking it.
+func isTextContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml":
+		return true
+	}
+	return false
+}
+
+// replaceReader replaces strings in what it reads from src. It
+// holds back the end of what it read until it knows that no
+// match starts there.
+type replaceReader struct {
+	io.ReadCloser
+	from, to [][]byte
+	maxFrom  int
+	in, out  []byte
+	eof      bool
+}
+
+func newReplaceReader(src io.ReadCloser, replacements []BodyReplacement, replacer httpserver.Replacer) *replaceReader {
+	rr := &replaceReader{ReadCloser: src}
+	for _, r := range replacements {
+		if r.From == "" {
+			continue
+		}
+		rr.from = append(rr.from, []byte(r.From))
+		rr.to = append(rr.to, []byte(replacer.Replace(r.To)))
+		if len(r.From) > rr.maxFrom {
+			rr.maxFrom = len(r.From)
+		}
+	}
+	return rr
+}
+
+// Read implements io.Reader.
+func (rr *replaceReader) Read(p []byte) (int, error) {
+	for len(rr.out) == 0 {
+		if rr.eof && len(rr.in) == 0 {
+			return 0, io.EOF
+		}
+		if !rr.eof {
+			buf := make([]byte, 32*1024)
+			n, err := rr.ReadCloser.Read(buf)
+			rr.in = append(rr.in, buf[:n]...)
+			if err == io.EOF {
+				rr.eof = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		rr.replace()
+	}
+	n := copy(p, rr.out)
+	rr.out = rr.out[n:]
+	return n, nil
+}
+
+// replace moves the input that can't be part of a match
+// anymore to the output, replacing the matches in it.
+func (rr *replaceReader) replace() {
+	for {
+		// a match may start anywhere before safe
+		safe := len(rr.in)
+		if !rr.eof {
+			safe -= rr.maxFrom - 1
+		}
+		if safe <= 0 {
+			return
+		}
+
+		index, match := -1, -1
+		for i, from := range rr.from {
+			if j := bytes.Index(rr.in, from); j >= 0 && (index < 0 || j < index) {
+				index, match = j, i
+			}
+		}
+		if index < 0 || index >= safe {
+			rr.out = append(rr.out, rr.in[:safe]...)
+			rr.in = rr.in[safe:]
+			return
+		}
+		rr.out = append(rr.out, rr.in[:index]...)
+		rr.out = append(rr.out, rr.to[match]...)
+		rr.in = rr.in[index+len(rr.from[match]):]
+	}
+}
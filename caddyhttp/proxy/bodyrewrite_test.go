@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestReplaceReader(t *testing.T) {
+	replacements := []BodyReplacement{
+		{"http://internal:8080", "https://example.com"},
+		{"internal", "public"},
+		{"aa", "b"},
+	}
+	tests := []struct {
+		input, expected string
+	}{
+		{"", ""},
+		{"nothing to see", "nothing to see"},
+		{`<a href="http://internal:8080/x">`, `<a href="https://example.com/x">`},
+		{"http://internal:8080http://internal:8080", "https://example.comhttps://example.com"},
+		{"internal http://internal", "public http://public"},
+		{"aaa", "ba"},
+		{"http://internal:808", "http://public:808"},
+	}
+	replacer := httpserver.NewReplacer(httptest.NewRequest("GET", "/", nil), nil, "")
+	for i, test := range tests {
+		// one byte at a time, so matches span reads
+		src := ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(test.input)))
+		got, err := ioutil.ReadAll(newReplaceReader(src, replacements, replacer))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if string(got) != test.expected {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.expected, got)
+		}
+	}
+}
+
+func TestIsTextContent(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/html; charset=utf-8": true,
+		"text/css":                 true,
+		"application/javascript":   true,
+		"application/json":         true,
+		"application/atom+xml":     true,
+		"image/png":                false,
+		"application/octet-stream": false,
+		"":                         false,
+	} {
+		if got := isTextContent(contentType); got != expected {
+			t.Errorf("Content-Type '%s': expected %v, got %v", contentType, expected, got)
+		}
+	}
+}
+
+func TestResponseBodyRewrite(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("ETag", `"abc"`)
+			w.Write([]byte(`<a href="http://internal:8080/next">next</a>`))
+		case "/gzipped":
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				t.Errorf("Expected the transport to ask for gzip, got Accept-Encoding '%s'", r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("see http://internal:8080"))
+			gz.Close()
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("http://internal:8080"))
+		}
+	}))
+	defer backend.Close()
+
+	upstream := newFakeUpstream(backend.URL, false)
+	upstream.host.BodyReplacements = []BodyReplacement{{"http://internal:8080", "https://{host}"}}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{upstream},
+	}
+
+	tests := []struct {
+		path, expected string
+	}{
+		{"/page", `<a href="https://example.com/next">next</a>`},
+		{"/gzipped", "see https://example.com"},
+		{"/image", "http://internal:8080"}, // binary content is left alone
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://example.com"+test.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("%s: Expected no error, got: %v", test.path, err)
+		}
+		if got := w.Body.String(); got != test.expected {
+			t.Errorf("%s: Expected body '%s', got '%s'", test.path, test.expected, got)
+		}
+		if test.path == "/page" {
+			if cl := w.Header().Get("Content-Length"); cl != "" {
+				t.Errorf("%s: Expected no Content-Length, got '%s'", test.path, cl)
+			}
+			if etag := w.Header().Get("ETag"); etag != `W/"abc"` {
+				t.Errorf("%s: Expected weak ETag, got '%s'", test.path, etag)
+			}
+		}
+	}
+}
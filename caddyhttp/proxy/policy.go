@@ -1,12 +1,16 @@
 package proxy
 
 import (
+	"fmt"
 	"hash/fnv"
 	"math"
 	"math/rand"
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 // HostPool is a collection of UpstreamHosts.
@@ -22,9 +26,11 @@ func init() {
 	RegisterPolicy("least_conn", func() Policy { return &LeastConn{} })
 	RegisterPolicy("round_robin", func() Policy { return &RoundRobin{} })
 	RegisterPolicy("ip_hash", func() Policy { return &IPHash{} })
+	RegisterPolicy("sticky", func() Policy { return &Sticky{Path: "/"} })
 }
 
-// Random is a policy that selects up hosts from a pool at random.
+// Random is a policy that selects up hosts from a pool at random,
+// in proportion to their weights.
 type Random struct{}
 
 // Select selects an up host at random from the specified pool.
@@ -40,11 +46,13 @@ func (r *Random) Select(pool HostPool, request *http.Request) *UpstreamHost {
 			continue
 		}
 
-		// (n % 1 == 0) holds for all n, therefore randHost
+		// the first available host always satisfies
+		// (n % weight < weight), therefore randHost
 		// will always get assigned a value if there is
 		// at least 1 available host
-		count++
-		if (rand.Int() % count) == 0 {
+		weight := host.weight()
+		count += weight
+		if (rand.Int() % count) < weight {
 			randHost = host
 		}
 	}
@@ -66,14 +74,15 @@ func (r *LeastConn) Select(pool HostPool, request *http.Request) *UpstreamHost {
 			continue
 		}
 
-		if host.Conns < leastConn {
-			leastConn = host.Conns
+		conns := atomic.LoadInt64(&host.Conns)
+		if conns < leastConn {
+			leastConn = conns
 			count = 0
 		}
 
 		// Among hosts with same least connections, perform a reservoir
 		// sample: https://en.wikipedia.org/wiki/Reservoir_sampling
-		if host.Conns == leastConn {
+		if conns == leastConn {
 			count++
 			if (rand.Int() % count) == 0 {
 				bestHost = host
@@ -106,7 +115,11 @@ func (r *RoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost
 }
 
 // IPHash is a policy that selects hosts based on hashing the request ip
-type IPHash struct{}
+type IPHash struct {
+	// TrustedProxies are the networks of proxies whose
+	// X-Forwarded-For header is used to find the client ip.
+	TrustedProxies []*net.IPNet
+}
 
 func hash(s string) uint32 {
 	h := fnv.New32a()
@@ -114,25 +127,75 @@ func hash(s string) uint32 {
 	return h.Sum32()
 }
 
-// Select selects an up host from the pool using a round robin ordering scheme.
+// Select selects an up host from the pool by hashing the client ip.
+// The hash is taken over the available hosts only, so a client is
+// always sent to the same host as long as the available hosts don't
+// change.
 func (r *IPHash) Select(pool HostPool, request *http.Request) *UpstreamHost {
-	poolLen := uint32(len(pool))
-	clientIP, _, err := net.SplitHostPort(request.RemoteAddr)
-	if err != nil {
-		clientIP = request.RemoteAddr
-	}
-	hash := hash(clientIP)
-	for {
-		if poolLen == 0 {
-			break
-		}
-		index := hash % poolLen
-		host := pool[index]
+	var available HostPool
+	for _, host := range pool {
 		if host.Available() {
-			return host
+			available = append(available, host)
 		}
-		pool = append(pool[:index], pool[index+1:]...)
-		poolLen--
 	}
-	return nil
+	if len(available) == 0 {
+		return nil
+	}
+	return available[hash(r.clientIP(request))%uint32(len(available))]
+}
+
+// clientIP returns the ip of the client that made request. If the
+// request came from a trusted proxy, the rightmost address in the
+// X-Forwarded-For header that isn't a trusted proxy is used.
+func (r *IPHash) clientIP(request *http.Request) string {
+	return httpserver.ForwardedClientIP(request, "X-Forwarded-For", r.TrustedProxies)
+}
+
+// Sticky is a policy that pins clients to hosts with a cookie, so
+// all requests of a client go to the same host while it is available.
+// Clients without a valid cookie get a host selected by Fallback.
+type Sticky struct {
+	Cookie   string
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	Fallback Policy // defaults to Random
+}
+
+// Select selects the up host named by the request's cookie,
+// or a host selected by the fallback policy if there is none.
+func (r *Sticky) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	if cookie, err := request.Cookie(r.Cookie); err == nil {
+		for _, host := range pool {
+			if host.Available() && stickyValue(host) == cookie.Value {
+				return host
+			}
+		}
+	}
+	if r.Fallback == nil {
+		return (&Random{}).Select(pool, request)
+	}
+	return r.Fallback.Select(pool, request)
+}
+
+// Pin returns the cookie that pins the client of request to host,
+// or nil if the request's cookie already does.
+func (r *Sticky) Pin(request *http.Request, host *UpstreamHost) *http.Cookie {
+	value := stickyValue(host)
+	if cookie, err := request.Cookie(r.Cookie); err == nil && cookie.Value == value {
+		return nil
+	}
+	return &http.Cookie{
+		Name:     r.Cookie,
+		Value:    value,
+		Path:     r.Path,
+		Secure:   r.Secure,
+		HttpOnly: r.HTTPOnly,
+	}
+}
+
+// stickyValue returns the cookie value that names host,
+// without revealing its address to clients.
+func stickyValue(host *UpstreamHost) string {
+	return fmt.Sprintf("%08x", hash(host.Name))
 }
@@ -1,10 +1,16 @@
 package proxy
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
 )
 
 var workableServer *httptest.Server
@@ -169,8 +175,8 @@ func TestIPHashPolicy(t *testing.T) {
 
 	request.RemoteAddr = "172.0.0.2"
 	h = ipHash.Select(pool, request)
-	if h != pool[1] {
-		t.Error("Expected ip hash policy host to be the second host.")
+	if h != pool[2] {
+		t.Error("Expected ip hash policy host to be the third host.")
 	}
 	pool[1].Unhealthy = false
 
@@ -182,8 +188,8 @@ func TestIPHashPolicy(t *testing.T) {
 	}
 	request.RemoteAddr = "172.0.0.4"
 	h = ipHash.Select(pool, request)
-	if h != pool[0] {
-		t.Error("Expected ip hash policy host to be the first host.")
+	if h != pool[1] {
+		t.Error("Expected ip hash policy host to be the second host.")
 	}
 
 	// We should be able to resize the host pool and still be able to predict
@@ -226,3 +232,188 @@ func TestIPHashPolicy(t *testing.T) {
 		t.Error("Expected ip hash policy host to be nil.")
 	}
 }
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected Policy
+	}{
+		{"proxy / localhost:8080 localhost:8081", &Random{}},
+		{"proxy / localhost:8080 localhost:8081 {\n policy random \n}", &Random{}},
+		{"proxy / localhost:8080 localhost:8081 {\n policy least_conn \n}", &LeastConn{}},
+		{"proxy / localhost:8080 localhost:8081 {\n policy round_robin \n}", &RoundRobin{}},
+		{"proxy / localhost:8080 localhost:8081 {\n policy ip_hash \n}", &IPHash{}},
+		{"proxy / localhost:8080 localhost:8081 {\n policy sticky backend \n}", &Sticky{}},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		policy := upstreams[0].(*staticUpstream).Policy
+		if reflect.TypeOf(policy) != reflect.TypeOf(test.expected) {
+			t.Errorf("Test %d: Expected policy %T, got %T", i, test.expected, policy)
+		}
+	}
+
+	_, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / localhost:8080 {\n policy most_conn \n}")))
+	if err == nil {
+		t.Error("Expected error for unknown policy, got nil")
+	}
+}
+
+func TestParseStickyPolicy(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  Sticky
+	}{
+		{"policy sticky backend", false, Sticky{Cookie: "backend", Path: "/"}},
+		{"policy sticky backend path /app secure httponly", false, Sticky{Cookie: "backend", Path: "/app", Secure: true, HTTPOnly: true}},
+		{"policy sticky backend fallback round_robin", false, Sticky{Cookie: "backend", Path: "/", Fallback: &RoundRobin{}}},
+		{"policy sticky", true, Sticky{}},
+		{"policy sticky backend path", true, Sticky{}},
+		{"policy sticky backend fallback sticky", true, Sticky{}},
+		{"policy sticky backend fallback most_conn", true, Sticky{}},
+		{"policy sticky backend expires", true, Sticky{}},
+	}
+	for i, test := range tests {
+		config := "proxy / localhost:8080 {\n " + test.config + " \n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		sticky := upstreams[0].(*staticUpstream).Policy.(*Sticky)
+		if !reflect.DeepEqual(*sticky, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, *sticky)
+		}
+	}
+}
+
+func TestStickyPolicy(t *testing.T) {
+	pool := testPool()
+	sticky := &Sticky{Cookie: "backend", Path: "/", Fallback: &RoundRobin{}}
+
+	// without a cookie, the fallback policy selects the host
+	request, _ := http.NewRequest("GET", "/", nil)
+	h := sticky.Select(pool, request)
+	if h != pool[1] {
+		t.Fatalf("Expected fallback to select second host, got %s", h.Name)
+	}
+	cookie := sticky.Pin(request, h)
+	if cookie == nil {
+		t.Fatal("Expected a cookie to pin the client, got nil")
+	}
+	if cookie.Name != "backend" || cookie.Path != "/" || strings.Contains(cookie.Value, "localhost") {
+		t.Errorf("Unexpected cookie %s", cookie)
+	}
+
+	// with the cookie, the client keeps going to the same host
+	request.AddCookie(cookie)
+	for i := 0; i < 5; i++ {
+		if h := sticky.Select(pool, request); h != pool[1] {
+			t.Fatalf("Expected pinned host to be selected, got %s", h.Name)
+		}
+	}
+	if c := sticky.Pin(request, pool[1]); c != nil {
+		t.Errorf("Expected no new cookie for a pinned client, got %s", c)
+	}
+
+	// when the pinned host is down, another one is pinned instead
+	pool[1].Unhealthy = true
+	h = sticky.Select(pool, request)
+	if h == pool[1] || h == nil {
+		t.Fatalf("Expected another host when the pinned host is down, got %v", h)
+	}
+	if c := sticky.Pin(request, h); c == nil || c.Value == cookie.Value {
+		t.Errorf("Expected a new cookie for the new host, got %v", c)
+	}
+}
+
+func TestIPHashPolicyConsistency(t *testing.T) {
+	pool := testPool()
+	names := make([]string, len(pool))
+	for i, host := range pool {
+		names[i] = host.Name
+	}
+	ipHash := &IPHash{}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	for i := 0; i < 50; i++ {
+		request.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		first := ipHash.Select(pool, request)
+		for j := 0; j < 20; j++ {
+			if h := ipHash.Select(pool, request); h != first {
+				t.Fatalf("Expected %s to always map to %s, got %s", request.RemoteAddr, first.Name, h.Name)
+			}
+		}
+	}
+
+	// downed hosts must be skipped, and the pool left intact
+	pool[1].Unhealthy = true
+	for i := 0; i < 50; i++ {
+		request.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		if h := ipHash.Select(pool, request); h == pool[1] {
+			t.Fatalf("Expected down host to be skipped for %s", request.RemoteAddr)
+		}
+	}
+	for i, host := range pool {
+		if host.Name != names[i] {
+			t.Errorf("Expected pool to be unchanged, host %d is now %s", i, host.Name)
+		}
+	}
+}
+
+func TestIPHashPolicyForwardedFor(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	ipHash := &IPHash{TrustedProxies: []*net.IPNet{trusted}}
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"172.0.0.1:80", "", "172.0.0.1"},
+		{"172.0.0.1:80", "192.168.0.1", "172.0.0.1"}, // untrusted peer
+		{"10.0.0.1:80", "192.168.0.1", "192.168.0.1"},
+		{"10.0.0.1:80", "1.2.3.4, 192.168.0.1, 10.0.0.2", "192.168.0.1"},
+		{"10.0.0.1:80", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:80", "", "10.0.0.1"},
+	}
+	for i, test := range tests {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			request.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if ip := ipHash.clientIP(request); ip != test.expectedIP {
+			t.Errorf("Test %d: Expected client ip %s, got %s", i, test.expectedIP, ip)
+		}
+	}
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / localhost:8080 localhost:8081 {\n trusted_proxies 10.0.0.0/8 ::1 \n policy ip_hash \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if policy := upstreams[0].(*staticUpstream).Policy.(*IPHash); len(policy.TrustedProxies) != 2 {
+		t.Errorf("Expected 2 trusted proxy networks, got %d", len(policy.TrustedProxies))
+	}
+	for i, config := range []string{
+		"proxy / localhost:8080 {\n policy ip_hash \n trusted_proxies 10.0.0.0/33 \n}",
+		"proxy / localhost:8080 {\n policy ip_hash \n trusted_proxies \n}",
+		"proxy / localhost:8080 {\n policy round_robin \n trusted_proxies 10.0.0.0/8 \n}",
+	} {
+		_, err = NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err == nil {
+			t.Errorf("Test %d: Expected error, got nil", i)
+		}
+	}
+}
@@ -2,11 +2,15 @@
 package proxy
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -30,6 +34,18 @@ type Upstream interface {
 	Select(*http.Request) *UpstreamHost
 	// Checks if subpath is not an ignored path
 	AllowedPath(string) bool
+	// How long to keep trying upstream hosts after a failure
+	GetTryDuration() time.Duration
+	// How long to wait between tries
+	GetTryInterval() time.Duration
+	// Checks if a failed request may be sent upstream again
+	CanRetry(*http.Request) bool
+}
+
+// hostPinner is implemented by upstreams that pin clients to the
+// host selected for them, which they do with a response cookie.
+type hostPinner interface {
+	Pin(*http.Request, *UpstreamHost) *http.Cookie
 }
 
 // UpstreamHostDownFunc can be used to customize how Down behaves.
@@ -45,9 +61,16 @@ type UpstreamHost struct {
 	Unhealthy         bool
 	UpstreamHeaders   http.Header
 	DownstreamHeaders http.Header
+	HostHeader        string            // the Host of requests to it, if set; may have placeholders
+	BodyReplacements  []BodyReplacement // applied to text response bodies
 	CheckDown         UpstreamHostDownFunc
 	WithoutPathPrefix string
 	MaxConns          int64
+	Priority          int // hosts with lower values are preferred
+	Weight            int // relative share of requests for the random policy
+
+	failMu  sync.Mutex // guards failGen and changes to Fails
+	failGen int32      // incremented when Fails is reset
 }
 
 // Down checks whether the upstream host is down or not.
@@ -56,14 +79,23 @@ type UpstreamHost struct {
 func (uh *UpstreamHost) Down() bool {
 	if uh.CheckDown == nil {
 		// Default settings
-		return uh.Unhealthy || uh.Fails > 0
+		return uh.Unhealthy || atomic.LoadInt32(&uh.Fails) > 0
 	}
 	return uh.CheckDown(uh)
 }
 
+// weight returns the weight of the host for
+// weighted selection; it is at least 1.
+func (uh *UpstreamHost) weight() int {
+	if uh.Weight < 1 {
+		return 1
+	}
+	return uh.Weight
+}
+
 // Full checks whether the upstream host has reached its maximum connections
 func (uh *UpstreamHost) Full() bool {
-	return uh.MaxConns > 0 && uh.Conns >= uh.MaxConns
+	return uh.MaxConns > 0 && atomic.LoadInt64(&uh.Conns) >= uh.MaxConns
 }
 
 // Available checks whether the upstream host is available for proxying to
@@ -71,10 +103,52 @@ func (uh *UpstreamHost) Available() bool {
 	return !uh.Down() && !uh.Full()
 }
 
-// tryDuration is how long to try upstream hosts; failures result in
-// immediate retries until this duration ends or we get a nil host.
+// fail records a failed request to the upstream host.
+// The failure is forgotten after the host's FailTimeout,
+// unless the failures are reset before then.
+func (uh *UpstreamHost) fail() {
+	timeout := uh.FailTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	uh.failMu.Lock()
+	gen := uh.failGen
+	atomic.AddInt32(&uh.Fails, 1)
+	uh.failMu.Unlock()
+	go func() {
+		time.Sleep(timeout)
+		uh.failMu.Lock()
+		if uh.failGen == gen {
+			atomic.AddInt32(&uh.Fails, -1)
+		}
+		uh.failMu.Unlock()
+	}()
+}
+
+// resetFails forgets all failed requests to the upstream
+// host, so only consecutive failures can take it down.
+func (uh *UpstreamHost) resetFails() {
+	if atomic.LoadInt32(&uh.Fails) == 0 {
+		return
+	}
+	uh.failMu.Lock()
+	uh.failGen++
+	atomic.StoreInt32(&uh.Fails, 0)
+	uh.failMu.Unlock()
+}
+
+// tryDuration is how long to try upstream hosts by default; failures
+// result in retries until this duration ends or we get a nil host.
 var tryDuration = 60 * time.Second
 
+// tryInterval is how long to wait between tries by default.
+var tryInterval = 250 * time.Millisecond
+
+// maxRetryBodySize is the size of the largest request body that
+// is kept in memory so the request can be retried; requests with
+// larger bodies are streamed upstream and never retried.
+var maxRetryBodySize int64 = 1 << 20
+
 // ServeHTTP satisfies the httpserver.Handler interface.
 func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// start by selecting most specific matching upstream config
@@ -86,21 +160,51 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// this replacer is used to fill in header field values
 	replacer := httpserver.NewReplacer(r, nil, "")
 
-	// outreq is the request that makes a roundtrip to the backend
-	outreq := createUpstreamRequest(r)
+	// the request body can only be read once, so it
+	// must be buffered if it may have to be replayed
+	retry := upstream.CanRetry(r)
+	var body []byte
+	if retry && r.Body != nil && r.ContentLength != 0 {
+		if r.ContentLength > maxRetryBodySize {
+			retry = false
+		} else {
+			var err error
+			body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxRetryBodySize+1))
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			if int64(len(body)) > maxRetryBodySize {
+				// too large to keep; send what was read and the rest
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				body, retry = nil, false
+			}
+		}
+	}
 
 	// since Select() should give us "up" hosts, keep retrying
 	// hosts until timeout (or until we get a nil host).
+	var backendErr error
 	start := time.Now()
-	for time.Now().Sub(start) < tryDuration {
+	for {
 		host := upstream.Select(r)
 		if host == nil {
-			return http.StatusBadGateway, errUnreachable
+			return failedStatus(backendErr)
+		}
+		rr, ok := w.(*httpserver.ResponseRecorder)
+		if !ok {
+			rr = httpserver.RequestRecorder(r)
 		}
-		if rr, ok := w.(*httpserver.ResponseRecorder); ok && rr.Replacer != nil {
+		if rr != nil && rr.Replacer != nil {
 			rr.Replacer.Set("upstream", host.Name)
 		}
 
+		// outreq is the request that makes a roundtrip to the backend
+		outreq := createUpstreamRequest(r)
+		if body != nil {
+			outreq.Body = ioutil.NopCloser(bytes.NewReader(body))
+			outreq.ContentLength = int64(len(body))
+		}
+
 		proxy := host.ReverseProxy
 
 		// a backend's name may contain more than just the host,
@@ -130,6 +234,29 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			if hostHeaders, ok := outreq.Header["Host"]; ok && len(hostHeaders) > 0 {
 				outreq.Host = hostHeaders[len(hostHeaders)-1]
 			}
+
+			// the rules may have set hop-by-hop headers; only
+			// those that upgrade the connection are passed on,
+			// and TE if trailers are still accepted
+			trailers := acceptsTrailers(outreq.Header)
+			removeHopHeaders(outreq.Header, requestIsWebsocket(outreq))
+			if trailers {
+				outreq.Header.Set("Te", "trailers")
+			}
+		}
+
+		// the configured Host wins over header rules, like the ones
+		// of transparent; the transport sends outreq.Host, never the
+		// Host header
+		if host.HostHeader != "" {
+			outreq.Host = replacer.Replace(host.HostHeader)
+		}
+
+		// bodies can only be rewritten if they aren't compressed;
+		// without Accept-Encoding from the client, the transport
+		// asks for gzip itself and decompresses the response
+		if len(host.BodyReplacements) > 0 {
+			outreq.Header.Del("Accept-Encoding")
 		}
 
 		// prepare a function that will update response
@@ -138,28 +265,100 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		if host.DownstreamHeaders != nil {
 			downHeaderUpdateFn = createRespHeaderUpdateFn(host.DownstreamHeaders, replacer)
 		}
+		if len(host.BodyReplacements) > 0 {
+			updateFn := downHeaderUpdateFn
+			rewriteFn := createRespBodyRewriteFn(host.BodyReplacements, replacer)
+			downHeaderUpdateFn = func(resp *http.Response) {
+				if updateFn != nil {
+					updateFn(resp)
+				}
+				rewriteFn(resp)
+			}
+		}
+		if pinner, ok := upstream.(hostPinner); ok {
+			if cookie := pinner.Pin(r, host); cookie != nil {
+				updateFn := downHeaderUpdateFn
+				downHeaderUpdateFn = func(resp *http.Response) {
+					if updateFn != nil {
+						updateFn(resp)
+					}
+					resp.Header.Add("Set-Cookie", cookie.String())
+				}
+			}
+		}
 
-		// tell the proxy to serve the request
+		// tell the proxy to serve the request; the connection
+		// count must drop when it completes, even on panic
 		atomic.AddInt64(&host.Conns, 1)
-		backendErr := proxy.ServeHTTP(w, outreq, downHeaderUpdateFn)
-		atomic.AddInt64(&host.Conns, -1)
+		backendErr = func() error {
+			defer atomic.AddInt64(&host.Conns, -1)
+			return proxy.ServeHTTP(w, outreq, downHeaderUpdateFn)
+		}()
 
 		// if no errors, we're done here; otherwise failover
+		httpserver.CountUpstream(host.Name, backendErr == nil)
 		if backendErr == nil {
+			host.resetFails()
 			return 0, nil
 		}
-		timeout := host.FailTimeout
-		if timeout == 0 {
-			timeout = 10 * time.Second
+		host.fail()
+
+		// if the upstream timed out after the request was sent,
+		// it may have been processed, so don't try it again
+		if isTimeout(backendErr) && !isDialError(backendErr) {
+			return http.StatusGatewayTimeout, backendErr
 		}
-		atomic.AddInt32(&host.Fails, 1)
-		go func(host *UpstreamHost, timeout time.Duration) {
-			time.Sleep(timeout)
-			atomic.AddInt32(&host.Fails, -1)
-		}(host, timeout)
+
+		// otherwise try again with the next available
+		// host, unless we've been trying for long enough
+		if !retry || time.Since(start) >= upstream.GetTryDuration() {
+			break
+		}
+		time.Sleep(upstream.GetTryInterval())
 	}
 
-	return http.StatusBadGateway, errUnreachable
+	return failedStatus(backendErr)
+}
+
+// readCloser reads from a Reader and closes a Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// failedStatus returns the status and error with which to fail
+// a request after the last upstream failed with err, if any.
+func failedStatus(err error) (int, error) {
+	if err == nil {
+		return http.StatusBadGateway, errUnreachable
+	}
+	if isTimeout(err) {
+		return http.StatusGatewayTimeout, err
+	}
+	return http.StatusBadGateway, err
+}
+
+// isIdempotent returns true if requests with the given
+// method can safely be sent more than once.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// isTimeout returns true if err is a timeout.
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// isDialError returns true if err happened while
+// connecting to the upstream.
+func isDialError(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
 }
 
 // match finds the best match for a proxy config based
@@ -180,13 +379,19 @@ func (p Proxy) match(r *http.Request) Upstream {
 	return u
 }
 
-// createUpstremRequest shallow-copies r into a new request
-// that can be sent upstream.
+// createUpstremRequest copies r into a new request that can
+// be sent upstream. The URL and header are copied as well,
+// so they can be modified without affecting r or other
+// requests created from it.
 //
 // Derived from reverseproxy.go in the standard Go httputil package.
 func createUpstreamRequest(r *http.Request) *http.Request {
 	outreq := new(http.Request)
-	*outreq = *r // includes shallow copies of maps, but okay
+	*outreq = *r
+	outreq.URL = new(url.URL)
+	*outreq.URL = *r.URL
+	outreq.Header = make(http.Header)
+	copyHeader(outreq.Header, r.Header)
 
 	// Restore URL Path if it has been modified
 	if outreq.URL.RawPath != "" {
@@ -195,19 +400,22 @@ func createUpstreamRequest(r *http.Request) *http.Request {
 
 	// Remove hop-by-hop headers to the backend. Especially
 	// important is "Connection" because we want a persistent
-	// connection, regardless of what the client sent to us. This
-	// is modifying the same underlying map from r (shallow
-	// copied above) so we only copy it if necessary.
-	var copiedHeaders bool
-	for _, h := range hopHeaders {
-		if outreq.Header.Get(h) != "" {
-			if !copiedHeaders {
-				outreq.Header = make(http.Header)
-				copyHeader(outreq.Header, r.Header)
-				copiedHeaders = true
-			}
-			outreq.Header.Del(h)
-		}
+	// connection, regardless of what the client sent to us.
+	// WebSocket handshakes keep the headers that upgrade the
+	// connection, so they work without any configuration.
+	if requestIsWebsocket(r) {
+		removeHopHeaders(outreq.Header, true)
+		outreq.Header.Set("Connection", "Upgrade")
+		outreq.Header.Set("Upgrade", "websocket")
+	} else {
+		removeHopHeaders(outreq.Header, false)
+	}
+
+	// TE is hop-by-hop, but whether the client accepts trailers
+	// matters to backends that send them (e.g. gRPC), and the
+	// proxy passes trailers through
+	if acceptsTrailers(r.Header) {
+		outreq.Header.Set("Te", "trailers")
 	}
 
 	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
@@ -223,22 +431,65 @@ func createUpstreamRequest(r *http.Request) *http.Request {
 	return outreq
 }
 
+// acceptsTrailers returns true if the TE header in h
+// accepts trailers.
+func acceptsTrailers(h http.Header) bool {
+	for _, value := range h["Te"] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeHopHeaders removes the hop-by-hop headers from h, including
+// those listed in its Connection header. If keepUpgrade is true, the
+// headers that upgrade the connection are kept.
+func removeHopHeaders(h http.Header, keepUpgrade bool) {
+	for _, value := range h["Connection"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field != "" && !(keepUpgrade && strings.EqualFold(field, "Upgrade")) {
+				h.Del(field)
+			}
+		}
+	}
+	for _, field := range hopHeaders {
+		if keepUpgrade && (field == "Connection" || field == "Upgrade") {
+			continue
+		}
+		h.Del(field)
+	}
+}
+
 func createRespHeaderUpdateFn(rules http.Header, replacer httpserver.Replacer) respUpdateFn {
 	return func(resp *http.Response) {
 		mutateHeadersByRules(resp.Header, rules, replacer)
 	}
 }
 
+// mutateHeadersByRules applies rules to headers: fields prefixed
+// with "-" are removed first, then unprefixed fields are set to
+// their last value, and finally the values of fields prefixed
+// with "+" are added. Rule values may contain placeholders.
 func mutateHeadersByRules(headers, rules http.Header, repl httpserver.Replacer) {
+	for ruleField := range rules {
+		if strings.HasPrefix(ruleField, "-") {
+			headers.Del(strings.TrimPrefix(ruleField, "-"))
+		}
+	}
+	for ruleField, ruleValues := range rules {
+		if !strings.HasPrefix(ruleField, "+") && !strings.HasPrefix(ruleField, "-") && len(ruleValues) > 0 {
+			headers.Set(ruleField, repl.Replace(ruleValues[len(ruleValues)-1]))
+		}
+	}
 	for ruleField, ruleValues := range rules {
 		if strings.HasPrefix(ruleField, "+") {
 			for _, ruleValue := range ruleValues {
 				headers.Add(strings.TrimPrefix(ruleField, "+"), repl.Replace(ruleValue))
 			}
-		} else if strings.HasPrefix(ruleField, "-") {
-			headers.Del(strings.TrimPrefix(ruleField, "-"))
-		} else if len(ruleValues) > 0 {
-			headers.Set(ruleField, repl.Replace(ruleValues[len(ruleValues)-1]))
 		}
 	}
 }
@@ -3,10 +3,18 @@ package proxy
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -19,6 +27,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 
 	"golang.org/x/net/websocket"
@@ -69,6 +78,224 @@ func TestReverseProxy(t *testing.T) {
 	}
 }
 
+func TestReverseProxyConns(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var upstream *fakeUpstream
+	var connsDuringRequest int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connsDuringRequest = atomic.LoadInt64(&upstream.host.Conns)
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+	upstream = newFakeUpstream(backend.URL, false)
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{upstream},
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	if connsDuringRequest != 1 {
+		t.Errorf("Expected 1 connection while proxying, got %d", connsDuringRequest)
+	}
+	if conns := atomic.LoadInt64(&upstream.host.Conns); conns != 0 {
+		t.Errorf("Expected 0 connections after proxying, got %d", conns)
+	}
+
+	// connections must also be released when the backend fails
+	backend.Close()
+	upstream.host.FailTimeout = 10 * time.Millisecond
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	if conns := atomic.LoadInt64(&upstream.host.Conns); conns != 0 {
+		t.Errorf("Expected 0 connections after failed proxying, got %d", conns)
+	}
+}
+
+func TestReverseProxyResponseHeaderTimeout(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	upstream := newFakeUpstream(backend.URL, false)
+	upstream.host.FailTimeout = 10 * time.Millisecond
+	upstream.host.ReverseProxy.UseTimeouts(0, 10*time.Millisecond)
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{upstream},
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	status, err := p.ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, status)
+	}
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the timed out request to be sent once, got %d", n)
+	}
+}
+
+func TestReverseProxyTransportOptions(t *testing.T) {
+	rp := &ReverseProxy{}
+	rp.UseTimeouts(0, time.Second)
+	rp.UseInsecureTransport()
+	transport, ok := rp.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected an *http.Transport, got %T", rp.Transport)
+	}
+	if transport.ResponseHeaderTimeout != time.Second {
+		t.Errorf("Expected the response header timeout to be kept, got %v", transport.ResponseHeaderTimeout)
+	}
+	if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("Expected the transport to skip verification")
+	}
+}
+
+func TestReverseProxyRetry(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// the broken backend drops the connection after reading the request
+	var brokenRequests int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&brokenRequests, 1)
+		ioutil.ReadAll(r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("Failed to hijack connection: %v", err)
+		}
+		conn.Close()
+	}))
+	defer broken.Close()
+
+	var goodRequests int32
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodRequests, 1)
+		io.Copy(w, r.Body)
+	}))
+	defer good.Close()
+
+	defer func(size int64) { maxRetryBodySize = size }(maxRetryBodySize)
+
+	tests := []struct {
+		method         string
+		options        string
+		maxBodySize    int64
+		chunked        bool
+		expectedStatus int
+		expectedGood   int32
+	}{
+		{"PUT", "", 1 << 20, false, 0, 1},
+		{"POST", "", 1 << 20, false, http.StatusBadGateway, 0},
+		{"POST", "retry_non_idempotent", 1 << 20, false, 0, 1},
+		{"PUT", "try_duration 0", 1 << 20, false, http.StatusBadGateway, 0},
+		{"PUT", "", 14, true, 0, 1},
+		{"PUT", "", 5, false, http.StatusBadGateway, 0},
+		{"PUT", "", 5, true, http.StatusBadGateway, 0},
+	}
+	for i, test := range tests {
+		atomic.StoreInt32(&brokenRequests, 0)
+		atomic.StoreInt32(&goodRequests, 0)
+		maxRetryBodySize = test.maxBodySize
+
+		// round robin tries the second host first
+		config := "proxy / " + good.URL + " " + broken.URL + " {\n policy round_robin \n try_interval 0s \n " + test.options + " \n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: upstreams,
+		}
+
+		r, err := http.NewRequest(test.method, "/", strings.NewReader("Hello, backend"))
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create request: %v", i, err)
+		}
+		if test.chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		status, err := p.ServeHTTP(w, r)
+
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d (error: %v)", i, test.expectedStatus, status, err)
+		}
+		if n := atomic.LoadInt32(&brokenRequests); n != 1 {
+			t.Errorf("Test %d: Expected 1 request to the broken backend, got %d", i, n)
+		}
+		if n := atomic.LoadInt32(&goodRequests); n != test.expectedGood {
+			t.Errorf("Test %d: Expected %d requests to the good backend, got %d", i, test.expectedGood, n)
+		}
+		if test.expectedGood > 0 && w.Body.String() != "Hello, backend" {
+			t.Errorf("Test %d: Expected the request body to be replayed, got response '%s'", i, w.Body.String())
+		}
+	}
+}
+
+func TestReverseProxyStickyCookie(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "app", Value: "1"})
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	config := "proxy / " + backend.URL + " {\n policy sticky backend secure \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: upstreams,
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	cookies := w.Header()["Set-Cookie"]
+	if len(cookies) != 2 || !strings.HasPrefix(cookies[1], "backend=") || !strings.Contains(cookies[1], "Secure") {
+		t.Fatalf("Expected backend's cookie and sticky cookie, got %v", cookies)
+	}
+
+	// a pinned client doesn't get the cookie again
+	r.Header.Set("Cookie", strings.SplitN(cookies[1], ";", 2)[0])
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if cookies := w.Header()["Set-Cookie"]; len(cookies) != 1 {
+		t.Errorf("Expected only backend's cookie, got %v", cookies)
+	}
+}
+
 func TestReverseProxyInsecureSkipVerify(t *testing.T) {
 	log.SetOutput(ioutil.Discard)
 	defer log.SetOutput(os.Stderr)
@@ -100,6 +327,173 @@ func TestReverseProxyInsecureSkipVerify(t *testing.T) {
 	}
 }
 
+func TestReverseProxyCACertificates(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	// the backend's certificate is self-signed, so it is its own CA
+	dir, err := ioutil.TempDir("", "caddy_proxy_ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		block        string
+		expectStatus int
+	}{
+		{"", http.StatusBadGateway},
+		{"ca_certificates " + caFile, http.StatusOK},
+		{"insecure_skip_verify", http.StatusOK},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " {\n" + test.block + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: upstreams,
+		}
+
+		w := httptest.NewRecorder()
+		status, _ := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+	}
+}
+
+func TestReverseProxyClientCertificate(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "caddy_proxy_mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a self-signed client certificate, which the backend trusts
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "caddy"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var clientName string
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte("Hello, client"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	backend.StartTLS()
+	defer backend.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		block        string
+		expectStatus int
+	}{
+		{"ca_certificates " + caFile, http.StatusBadGateway},
+		{"ca_certificates " + caFile + "\ntls_client_cert " + certFile + "\ntls_client_key " + keyFile, http.StatusOK},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " {\n" + test.block + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: upstreams,
+		}
+
+		clientName = ""
+		w := httptest.NewRecorder()
+		status, _ := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if status == http.StatusOK && clientName != "caddy" {
+			t.Errorf("Test %d: Expected the backend to see client certificate 'caddy', got '%s'", i, clientName)
+		}
+
+		// the health check presents the certificate too
+		u := upstreams[0].(*staticUpstream)
+		u.HealthCheck.Path = "/"
+		u.healthCheck()
+		if healthy := !u.Hosts[0].Unhealthy; healthy != (test.expectStatus == http.StatusOK) {
+			t.Errorf("Test %d: Expected the host to be healthy to be %v, got %v", i, test.expectStatus == http.StatusOK, healthy)
+		}
+	}
+
+	// both files are needed, and must be a keypair
+	for i, block := range []string{
+		"tls_client_cert " + certFile,
+		"tls_client_key " + keyFile,
+		"tls_client_cert " + certFile + "\ntls_client_key " + caFile,
+		"tls_client_cert " + filepath.Join(dir, "missing.crt") + "\ntls_client_key " + keyFile,
+		"tls_client_cert",
+	} {
+		config := "proxy / " + backend.URL + " {\n" + block + "\n}"
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config))); err == nil {
+			t.Errorf("Bad config %d: Expected an error, got nil", i)
+		}
+	}
+}
+
 func TestWebSocketReverseProxyServeHTTPHandler(t *testing.T) {
 	// No-op websocket backend simply allows the WS connection to be
 	// accepted then it will be immediately closed. Perfect for testing.
@@ -182,6 +576,54 @@ func TestWebSocketReverseProxyFromWSClient(t *testing.T) {
 	}
 }
 
+func TestWebSocketReverseProxyWithoutPreset(t *testing.T) {
+	wsEcho := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer wsEcho.Close()
+
+	// a plain proxy, without the websocket preset
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+wsEcho.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	// the timeouts of the server must not cut off the
+	// upgraded connection
+	echoProxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+	echoProxy.Config.ReadTimeout = 100 * time.Millisecond
+	echoProxy.Config.WriteTimeout = 100 * time.Millisecond
+	echoProxy.Start()
+	defer echoProxy.Close()
+
+	url := strings.Replace(echoProxy.URL, "http://", "ws://", 1)
+	ws, err := websocket.Dial(url, "", echoProxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, msg := range []string{"first", "after a pause"} {
+		if msg != "first" {
+			time.Sleep(250 * time.Millisecond)
+		}
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			t.Fatalf("Sending '%s' failed: %v", msg, err)
+		}
+		var actualMsg string
+		if err := websocket.Message.Receive(ws, &actualMsg); err != nil {
+			t.Fatalf("Receiving '%s' failed: %v", msg, err)
+		}
+		if actualMsg != msg {
+			t.Errorf("Expected '%s' but got '%s' instead", msg, actualMsg)
+		}
+	}
+}
+
 func TestUnixSocketProxy(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -437,6 +879,63 @@ func TestUpstreamHeadersUpdate(t *testing.T) {
 
 }
 
+func TestUpstreamHeadersHopByHop(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var actualHeaders http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualHeaders = r.Header
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	upstream := newFakeUpstream(backend.URL, false)
+	upstream.host.UpstreamHeaders = http.Header{
+		"X-Forwarded-Proto":   {"{scheme}"},
+		"X-Internal-Auth":     {"secret"},
+		"-Cookie":             {""},
+		"Keep-Alive":          {"timeout=5"},
+		"Proxy-Authorization": {"{>Proxy-Authorization}"},
+		"-Merge-Me":           {""},
+		"+Merge-Me":           {"Added"},
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{upstream},
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	r.Header.Set("Cookie", "session=1")
+	r.Header.Set("Connection", "X-Hop")
+	r.Header.Set("X-Hop", "hop")
+	r.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	r.Header.Set("Merge-Me", "Initial")
+
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := map[string]string{
+		"X-Forwarded-Proto":   "http",
+		"X-Internal-Auth":     "secret",
+		"Merge-Me":            "Added",
+		"Cookie":              "",
+		"Keep-Alive":          "",
+		"Proxy-Authorization": "",
+		"X-Hop":               "",
+	}
+	for field, value := range expected {
+		if got := strings.Join(actualHeaders[field], ", "); got != value {
+			t.Errorf("Expected upstream header %s to be '%s', got '%s'", field, value, got)
+		}
+	}
+	if r.Header.Get("Cookie") != "session=1" || r.Header.Get("Merge-Me") != "Initial" {
+		t.Errorf("Expected the client request headers to be left alone, got %v", r.Header)
+	}
+}
+
 func TestDownstreamHeadersUpdate(t *testing.T) {
 	log.SetOutput(ioutil.Discard)
 	defer log.SetOutput(os.Stderr)
@@ -534,6 +1033,147 @@ func newMultiHostTestProxy() *Proxy {
 	return p
 }
 
+func TestReverseProxyTrailers(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var te string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		te = r.Header.Get("Te")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte("message"))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}))
+	defer backend.Close()
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{newFakeUpstream(backend.URL, false)},
+	}
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+	defer frontend.Close()
+
+	req, err := http.NewRequest("GET", frontend.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Te", "trailers")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+
+	if string(body) != "message" {
+		t.Errorf("Expected body 'message', got '%s'", body)
+	}
+	if te != "trailers" {
+		t.Errorf("Expected TE: trailers to be passed upstream, got '%s'", te)
+	}
+	if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected announced trailer Grpc-Status to be '0', got '%s'", got)
+	}
+	if got := res.Trailer.Get("Grpc-Message"); got != "done" {
+		t.Errorf("Expected unannounced trailer Grpc-Message to be 'done', got '%s'", got)
+	}
+}
+
+func TestReverseProxyTrailersWithHeaderRules(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var te string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		te = r.Header.Get("Te")
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		block    string
+		expectTE string
+	}{
+		{"transparent", "trailers"},
+		{"header_upstream X-Foo bar", "trailers"},
+		{"header_upstream -Te \"\"", ""},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " {\n" + test.block + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: upstreams,
+		}
+
+		te = ""
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Te", "trailers")
+		p.ServeHTTP(httptest.NewRecorder(), r)
+		if te != test.expectTE {
+			t.Errorf("Test %d: Expected TE '%s' upstream, got '%s'", i, test.expectTE, te)
+		}
+	}
+}
+
+func TestReverseProxyServerSentEvents(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	received := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: hello\n\n"))
+		w.(http.Flusher).Flush()
+		// keep the stream open until the client got the event
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{newFakeUpstream(backend.URL, false)},
+	}
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+	defer frontend.Close()
+
+	line := make(chan string, 1)
+	go func() {
+		res, err := http.Get(frontend.URL)
+		if err != nil {
+			line <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		l, _ := bufio.NewReader(res.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		close(received)
+		if l != "data: hello\n" {
+			t.Errorf("Expected the event to be streamed, got %q", l)
+		}
+	case <-time.After(2 * time.Second):
+		close(received)
+		t.Error("Expected the event to be flushed before the stream ended")
+	}
+}
+
 func TestMultiReverseProxyFromClient(t *testing.T) {
 	p := newMultiHostTestProxy()
 
@@ -656,6 +1296,49 @@ func TestHostHeaderReplacedUsingForward(t *testing.T) {
 	}
 }
 
+func TestHostHeaderOption(t *testing.T) {
+	var requestHost string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestHost = r.Host
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		block      string
+		expectHost string
+	}{
+		{"host_header backend.internal", "backend.internal"},
+		{"host_header {host}", "test.com"},
+		{"host_header {>X-Backend}.internal", "blue.internal"},
+		// it wins over the Host of other rules, in any order
+		{"transparent\nhost_header backend.internal", "backend.internal"},
+		{"host_header backend.internal\ntransparent", "backend.internal"},
+		{"host_header backend.internal\nheader_upstream Host other.internal", "backend.internal"},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " {\n" + test.block + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{
+			Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+			Upstreams: upstreams,
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = "test.com"
+		r.Header.Set("X-Backend", "blue")
+		requestHost = ""
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if requestHost != test.expectHost {
+			t.Errorf("Test %d: Expected the upstream to get Host %s, got %s", i, test.expectHost, requestHost)
+		}
+	}
+}
+
 func TestBasicAuth(t *testing.T) {
 	basicAuthTestcase(t, nil, nil)
 	basicAuthTestcase(t, nil, url.UserPassword("username", "password"))
@@ -768,6 +1451,10 @@ func (u *fakeUpstream) AllowedPath(requestPath string) bool {
 	return true
 }
 
+func (u *fakeUpstream) GetTryDuration() time.Duration { return tryDuration }
+func (u *fakeUpstream) GetTryInterval() time.Duration { return 0 }
+func (u *fakeUpstream) CanRetry(r *http.Request) bool { return true }
+
 // newWebSocketTestProxy returns a test proxy that will
 // redirect to the specified backendAddr. The function
 // also sets up the rules/environment for testing WebSocket
@@ -810,6 +1497,10 @@ func (u *fakeWsUpstream) AllowedPath(requestPath string) bool {
 	return true
 }
 
+func (u *fakeWsUpstream) GetTryDuration() time.Duration { return tryDuration }
+func (u *fakeWsUpstream) GetTryInterval() time.Duration { return 0 }
+func (u *fakeWsUpstream) CanRetry(r *http.Request) bool { return true }
+
 // recorderHijacker is a ResponseRecorder that can
 // be hijacked.
 type recorderHijacker struct {
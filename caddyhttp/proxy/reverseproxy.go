@@ -13,7 +13,9 @@ package proxy
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -49,7 +51,10 @@ type ReverseProxy struct {
 	// FlushInterval specifies the flush interval
 	// to flush to the client while copying the
 	// response body.
-	// If zero, no periodic flushing is done.
+	// If zero, no periodic flushing is done; if
+	// negative, every write is flushed right away.
+	// Server-sent events are always flushed right
+	// away.
 	FlushInterval time.Duration
 }
 
@@ -117,7 +122,7 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int) *
 			req.URL.Path = strings.TrimPrefix(req.URL.Path, without)
 		}
 	}
-	rp := &ReverseProxy{Director: director, FlushInterval: 250 * time.Millisecond} // flushing good for streaming & server-sent events
+	rp := &ReverseProxy{Director: director, FlushInterval: defaultFlushInterval} // flushing good for streaming & server-sent events
 	if target.Scheme == "unix" {
 		rp.Transport = &http.Transport{
 			Dial: socketDial(target.String()),
@@ -148,6 +153,67 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int) *
 // when it is OK for upstream to be using a bad certificate,
 // since this transport skips verification.
 func (rp *ReverseProxy) UseInsecureTransport() {
+	if config := rp.tlsClientConfig(); config != nil {
+		config.InsecureSkipVerify = true
+	}
+}
+
+// UseRootCAs makes the transport of rp verify the certificates of
+// HTTPS upstreams with the certificate authorities in pool, instead
+// of the ones of the system.
+func (rp *ReverseProxy) UseRootCAs(pool *x509.CertPool) {
+	if config := rp.tlsClientConfig(); config != nil {
+		config.RootCAs = pool
+	}
+}
+
+// UseClientCertificate makes the transport of rp present cert
+// to HTTPS upstreams that ask for a client certificate.
+func (rp *ReverseProxy) UseClientCertificate(cert tls.Certificate) {
+	if config := rp.tlsClientConfig(); config != nil {
+		config.Certificates = []tls.Certificate{cert}
+	}
+}
+
+// tlsClientConfig returns the TLS config of the transport of
+// rp, creating them as needed, or nil if the transport isn't
+// an *http.Transport.
+func (rp *ReverseProxy) tlsClientConfig() *tls.Config {
+	transport := rp.transport()
+	if transport == nil {
+		return nil
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = new(tls.Config)
+	}
+	return transport.TLSClientConfig
+}
+
+// UseTimeouts sets the timeouts of the transport used for proxy
+// requests: dialTimeout bounds how long connecting to the upstream
+// may take, and responseHeaderTimeout bounds how long to wait for
+// the response headers once the request is written. Zero values
+// leave the corresponding timeout as it is.
+func (rp *ReverseProxy) UseTimeouts(dialTimeout, responseHeaderTimeout time.Duration) {
+	transport := rp.transport()
+	if transport == nil {
+		return
+	}
+	if dialTimeout > 0 {
+		transport.Dial = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).Dial
+	}
+	if responseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = responseHeaderTimeout
+	}
+}
+
+// transport returns the transport of rp, creating the default
+// one if rp has none yet, or nil if the transport of rp isn't
+// an *http.Transport.
+func (rp *ReverseProxy) transport() *http.Transport {
 	if rp.Transport == nil {
 		rp.Transport = &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -155,12 +221,12 @@ func (rp *ReverseProxy) UseInsecureTransport() {
 				Timeout:   30 * time.Second,
 				KeepAlive: 30 * time.Second,
 			}).Dial,
-			TLSHandshakeTimeout: 10 * time.Second,
-			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
 		}
-	} else if transport, ok := rp.Transport.(*http.Transport); ok {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	transport, _ := rp.Transport.(*http.Transport)
+	return transport
 }
 
 // ServeHTTP serves the proxied request to the upstream by performing a roundtrip.
@@ -177,6 +243,9 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 	outreq.Proto = "HTTP/1.1"
 	outreq.ProtoMajor = 1
 	outreq.ProtoMinor = 1
+	// the upstream connection may be reused even if the client
+	// asked to close its own; the transport still closes it if
+	// the upstream responds with Connection: close
 	outreq.Close = false
 
 	res, err := transport.RoundTrip(outreq)
@@ -194,12 +263,16 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 			return nil
 		}
 
-		conn, _, err := hj.Hijack()
+		conn, brw, err := hj.Hijack()
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
 
+		// the connection is no longer HTTP, so the timeouts of the
+		// server don't apply; it stays open as long as it is used
+		conn.SetDeadline(time.Time{})
+
 		var backendConn net.Conn
 		if hj, ok := transport.(*connHijackerTransport); ok {
 			backendConn = hj.Conn
@@ -216,32 +289,97 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		}
 		defer backendConn.Close()
 
+		// the client may have sent frames right after its
+		// handshake, which the server read already
+		if brw != nil && brw.Reader.Buffered() > 0 {
+			buffered, _ := brw.Reader.Peek(brw.Reader.Buffered())
+			if _, err := backendConn.Write(buffered); err != nil {
+				return err
+			}
+		}
+
+		// splice the connections until either side is done;
+		// closing both then ends the other direction too
+		errc := make(chan error, 2)
+		go func() {
+			_, err := io.Copy(backendConn, conn) // write tcp stream to backend.
+			errc <- err
+		}()
 		go func() {
-			io.Copy(backendConn, conn) // write tcp stream to backend.
+			_, err := io.Copy(conn, backendConn) // read tcp stream from backend.
+			errc <- err
 		}()
-		io.Copy(conn, backendConn) // read tcp stream from backend.
+		<-errc
 	} else {
 		defer res.Body.Close()
 		for _, h := range hopHeaders {
 			res.Header.Del(h)
 		}
 		copyHeader(rw.Header(), res.Header)
+
+		// announce the trailers, which must be done in the header
+		announcedTrailers := len(res.Trailer)
+		if announcedTrailers > 0 {
+			trailerKeys := make([]string, 0, len(res.Trailer))
+			for k := range res.Trailer {
+				trailerKeys = append(trailerKeys, k)
+			}
+			rw.Header().Add("Trailer", strings.Join(trailerKeys, ", "))
+		}
+
 		rw.WriteHeader(res.StatusCode)
-		rp.copyResponse(rw, res.Body)
+		if announcedTrailers > 0 {
+			// trailers can only follow a chunked body, so send the
+			// header now, before the body is known to be short
+			if f, ok := rw.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		rp.copyResponse(rw, res.Body, rp.flushInterval(res))
+
+		// the values of the trailers are known once the body is
+		// read; set them on the header to send them as trailers,
+		// prefixed if they weren't announced
+		if len(res.Trailer) == announcedTrailers {
+			copyHeader(rw.Header(), res.Trailer)
+		} else {
+			for k, vv := range res.Trailer {
+				for _, v := range vv {
+					rw.Header().Add(http.TrailerPrefix+k, v)
+				}
+			}
+		}
 	}
 
 	return nil
 }
 
-func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
+// defaultFlushInterval is how often the response body is
+// flushed to the client by default while it is copied.
+const defaultFlushInterval = 250 * time.Millisecond
+
+// flushInterval returns the interval at which to flush the body
+// of res to the client. Server-sent events are flushed right away,
+// since a client waits for each event as it is sent.
+func (rp *ReverseProxy) flushInterval(res *http.Response) time.Duration {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return -1
+	}
+	return rp.FlushInterval
+}
+
+func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader, flushInterval time.Duration) {
 	buf := bufferPool.Get()
 	defer bufferPool.Put(buf)
 
-	if rp.FlushInterval != 0 {
-		if wf, ok := dst.(writeFlusher); ok {
+	if wf, ok := dst.(writeFlusher); ok {
+		if flushInterval < 0 {
+			dst = immediateFlushWriter{wf}
+		} else if flushInterval > 0 {
 			mlw := &maxLatencyWriter{
 				dst:     wf,
-				latency: rp.FlushInterval,
+				latency: flushInterval,
 				done:    make(chan bool),
 			}
 			go mlw.flushLoop()
@@ -268,7 +406,7 @@ var hopHeaders = []string{
 	"Proxy-Authenticate",
 	"Proxy-Authorization",
 	"Te", // canonicalized version of "TE"
-	"Trailers",
+	"Trailer",
 	"Transfer-Encoding",
 	"Upgrade",
 }
@@ -382,3 +520,14 @@ func (m *maxLatencyWriter) flushLoop() {
 }
 
 func (m *maxLatencyWriter) stop() { m.done <- true }
+
+// immediateFlushWriter flushes after every write.
+type immediateFlushWriter struct {
+	dst writeFlusher
+}
+
+func (w immediateFlushWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.dst.Flush()
+	return n, err
+}
@@ -1,42 +1,77 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
+// maxHealthCheckBody is how much of a health check response
+// body is read when looking for the expected body.
+const maxHealthCheckBody = 64 * 1024
+
 var (
 	supportedPolicies            = make(map[string]func() Policy)
 	warnedProxyHeaderDeprecation bool // TODO: Temporary, until proxy_header is removed entirely
+
+	// lookupSRV resolves SRV records; it is a variable so tests can replace it.
+	lookupSRV = net.LookupSRV
 )
 
 type staticUpstream struct {
 	from               string
 	upstreamHeaders    http.Header
 	downstreamHeaders  http.Header
+	hostHeader         string
+	bodyReplacements   []BodyReplacement
 	Hosts              HostPool
+	hostsMu            sync.RWMutex // guards Hosts when they are resolved from SRV records
+	srvNames           []string
+	SRVInterval        time.Duration
 	Policy             Policy
 	KeepAlive          int
 	insecureSkipVerify bool
+	trustedProxies     []*net.IPNet   // whose X-Forwarded-For the ip_hash policy uses
+	rootCAs            *x509.CertPool // to verify upstreams with, if not the system's
+	clientCertFile     string
+	clientKeyFile      string
+	clientCert         *tls.Certificate  // presented to upstreams that ask for one
+	transport          http.RoundTripper // shared by hosts, so they share idle connections
 
 	FailTimeout time.Duration
 	MaxFails    int32
 	MaxConns    int64
+
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	FlushInterval         time.Duration
+
+	TryDuration        time.Duration
+	TryInterval        time.Duration
+	RetryNonIdempotent bool
+
 	HealthCheck struct {
-		Client   http.Client
-		Path     string
-		Interval time.Duration
-		Timeout  time.Duration
+		Client       http.Client
+		Path         string
+		Interval     time.Duration
+		Timeout      time.Duration
+		ExpectStatus int
+		ExpectBody   string
 	}
 	WithoutPathPrefix string
 	IgnoredSubPaths   []string
@@ -57,6 +92,10 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 			MaxFails:          1,
 			MaxConns:          0,
 			KeepAlive:         http.DefaultMaxIdleConnsPerHost,
+			TryDuration:       tryDuration,
+			TryInterval:       tryInterval,
+			SRVInterval:       30 * time.Second,
+			FlushInterval:     defaultFlushInterval,
 		}
 
 		if !c.Args(&upstream.from) {
@@ -90,17 +129,57 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 			}
 		}
 
-		if len(to) == 0 {
-			return upstreams, c.ArgErr()
+		if len(upstream.trustedProxies) > 0 {
+			ipHash, ok := upstream.Policy.(*IPHash)
+			if !ok {
+				return upstreams, c.Err("trusted_proxies is only used by the ip_hash policy")
+			}
+			ipHash.TrustedProxies = upstream.trustedProxies
 		}
 
-		upstream.Hosts = make([]*UpstreamHost, len(to))
-		for i, host := range to {
-			uh, err := upstream.NewHost(host)
+		// the client certificate is loaded now, so that a bad
+		// one keeps the config from loading
+		if upstream.clientCertFile != "" || upstream.clientKeyFile != "" {
+			if upstream.clientCertFile == "" || upstream.clientKeyFile == "" {
+				return upstreams, c.Err("tls_client_cert and tls_client_key must be used together")
+			}
+			cert, err := tls.LoadX509KeyPair(upstream.clientCertFile, upstream.clientKeyFile)
 			if err != nil {
-				return upstreams, err
+				return upstreams, c.Errf("loading upstream client certificate: %v", err)
+			}
+			upstream.clientCert = &cert
+		}
+
+		// SRV names are resolved to hosts instead of being hosts
+		var static []string
+		for _, host := range to {
+			if strings.HasPrefix(host, "srv://") {
+				upstream.srvNames = append(upstream.srvNames, strings.TrimPrefix(host, "srv://"))
+			} else {
+				static = append(static, host)
+			}
+		}
+		if len(upstream.srvNames) > 0 && len(static) > 0 {
+			return upstreams, c.Err("srv:// upstreams cannot be mixed with other upstreams")
+		}
+
+		if len(upstream.srvNames) > 0 {
+			if err := upstream.resolveSRV(); err != nil {
+				return upstreams, c.Errf("resolving SRV upstreams: %v", err)
+			}
+			go upstream.SRVWorker(nil)
+		} else {
+			if len(static) == 0 {
+				return upstreams, c.ArgErr()
+			}
+			upstream.Hosts = make([]*UpstreamHost, len(static))
+			for i, host := range static {
+				uh, err := upstream.NewHost(host)
+				if err != nil {
+					return upstreams, err
+				}
+				upstream.Hosts[i] = uh
 			}
-			upstream.Hosts[i] = uh
 		}
 
 		if upstream.HealthCheck.Path != "" {
@@ -123,6 +202,20 @@ func (u *staticUpstream) From() string {
 	return u.from
 }
 
+func (u *staticUpstream) GetTryDuration() time.Duration {
+	return u.TryDuration
+}
+
+func (u *staticUpstream) GetTryInterval() time.Duration {
+	return u.TryInterval
+}
+
+// CanRetry returns true if r may be sent upstream again after
+// a failure: it must be idempotent, unless configured otherwise.
+func (u *staticUpstream) CanRetry(r *http.Request) bool {
+	return u.TryDuration > 0 && (u.RetryNonIdempotent || isIdempotent(r.Method))
+}
+
 func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 	if !strings.HasPrefix(host, "http") &&
 		!strings.HasPrefix(host, "unix:") {
@@ -136,12 +229,14 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		Unhealthy:         false,
 		UpstreamHeaders:   u.upstreamHeaders,
 		DownstreamHeaders: u.downstreamHeaders,
+		HostHeader:        u.hostHeader,
+		BodyReplacements:  u.bodyReplacements,
 		CheckDown: func(u *staticUpstream) UpstreamHostDownFunc {
 			return func(uh *UpstreamHost) bool {
 				if uh.Unhealthy {
 					return true
 				}
-				if uh.Fails >= u.MaxFails &&
+				if atomic.LoadInt32(&uh.Fails) >= u.MaxFails &&
 					u.MaxFails != 0 {
 					return true
 				}
@@ -158,9 +253,32 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 	}
 
 	uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix, u.KeepAlive)
+	uh.ReverseProxy.FlushInterval = u.FlushInterval
+	if baseURL.Scheme != "unix" && u.transport != nil {
+		// the transport is configured already by the first host;
+		// a unix socket host keeps its own, since it dials the socket
+		uh.ReverseProxy.Transport = u.transport
+		return uh, nil
+	}
 	if u.insecureSkipVerify {
 		uh.ReverseProxy.UseInsecureTransport()
 	}
+	if u.rootCAs != nil {
+		uh.ReverseProxy.UseRootCAs(u.rootCAs)
+	}
+	if u.clientCert != nil {
+		uh.ReverseProxy.UseClientCertificate(*u.clientCert)
+	}
+	if u.DialTimeout > 0 || u.ResponseHeaderTimeout > 0 {
+		dialTimeout := u.DialTimeout
+		if baseURL.Scheme == "unix" {
+			dialTimeout = 0 // keep the socket dialer
+		}
+		uh.ReverseProxy.UseTimeouts(dialTimeout, u.ResponseHeaderTimeout)
+	}
+	if baseURL.Scheme != "unix" {
+		u.transport = uh.ReverseProxy.Transport
+	}
 
 	return uh, nil
 }
@@ -220,6 +338,23 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return c.ArgErr()
 		}
 		u.Policy = policyCreateFunc()
+		if sticky, ok := u.Policy.(*Sticky); ok {
+			if err := parseSticky(c, sticky); err != nil {
+				return err
+			}
+		}
+	case "trusted_proxies":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, arg := range args {
+			network, err := httpserver.ParseNetwork(arg)
+			if err != nil {
+				return c.Errf("invalid trusted proxy network '%s': %v", arg, err)
+			}
+			u.trustedProxies = append(u.trustedProxies, network)
+		}
 	case "fail_timeout":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -228,6 +363,9 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 		if err != nil {
 			return err
 		}
+		if dur < 0 {
+			return c.Errf("fail_timeout must not be negative, got '%s'", c.Val())
+		}
 		u.FailTimeout = dur
 	case "max_fails":
 		if !c.NextArg() {
@@ -237,6 +375,9 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 		if err != nil {
 			return err
 		}
+		if n < 0 {
+			return c.Errf("max_fails must not be negative, got '%d'", n)
+		}
 		u.MaxFails = int32(n)
 	case "max_conns":
 		if !c.NextArg() {
@@ -280,6 +421,90 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return err
 		}
 		u.HealthCheck.Timeout = dur
+	case "health_check_expect_status":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		status, err := strconv.Atoi(c.Val())
+		if err != nil {
+			return err
+		}
+		if status < 100 || status > 599 {
+			return c.Errf("invalid health_check_expect_status '%d'", status)
+		}
+		u.HealthCheck.ExpectStatus = status
+	case "health_check_expect_body":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u.HealthCheck.ExpectBody = c.Val()
+	case "dial_timeout", "response_header_timeout":
+		what := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Errf("%s must be positive, got '%s'", what, c.Val())
+		}
+		if what == "dial_timeout" {
+			u.DialTimeout = dur
+		} else {
+			u.ResponseHeaderTimeout = dur
+		}
+	case "flush_interval":
+		// flush_interval is how often to flush the response body
+		// to the client while it is copied, 0 to never flush, or
+		// -1 to flush every write right away
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() == "-1" {
+			u.FlushInterval = -1
+			break
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return c.Errf("flush_interval must be -1 or not negative, got '%s'", c.Val())
+		}
+		u.FlushInterval = dur
+	case "try_duration", "try_interval":
+		what := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return c.Errf("%s must not be negative, got '%s'", what, c.Val())
+		}
+		if what == "try_duration" {
+			u.TryDuration = dur
+		} else {
+			u.TryInterval = dur
+		}
+	case "retry_non_idempotent":
+		u.RetryNonIdempotent = true
+	case "srv_interval":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Errf("srv_interval must be positive, got '%s'", c.Val())
+		}
+		u.SRVInterval = dur
 	case "proxy_header": // TODO: deprecate this shortly after 0.9
 		if !warnedProxyHeaderDeprecation {
 			fmt.Println("WARNING: proxy_header is deprecated and will be removed soon; use header_upstream instead.")
@@ -298,6 +523,25 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return c.ArgErr()
 		}
 		u.downstreamHeaders.Add(header, value)
+	case "host_header":
+		// the same as "header_upstream Host value", except
+		// that it wins over other rules for the Host header
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u.hostHeader = c.Val()
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "response_body_rewrite":
+		var from, to string
+		if !c.Args(&from, &to) {
+			return c.ArgErr()
+		}
+		if from == "" {
+			return c.Err("response_body_rewrite needs a string to replace")
+		}
+		u.bodyReplacements = append(u.bodyReplacements, BodyReplacement{From: from, To: to})
 	case "transparent":
 		u.upstreamHeaders.Add("Host", "{host}")
 		u.upstreamHeaders.Add("X-Real-IP", "{remote}")
@@ -319,7 +563,42 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 		u.IgnoredSubPaths = ignoredPaths
 	case "insecure_skip_verify":
 		u.insecureSkipVerify = true
+		log.Printf("[WARNING] proxy %s: insecure_skip_verify is set; certificates of HTTPS upstreams are not verified", u.from)
+	case "tls_client_cert", "tls_client_key":
+		what := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if what == "tls_client_cert" {
+			u.clientCertFile = c.Val()
+		} else {
+			u.clientKeyFile = c.Val()
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "ca_certificates":
+		files := c.RemainingArgs()
+		if len(files) == 0 {
+			return c.ArgErr()
+		}
+		if u.rootCAs == nil {
+			u.rootCAs = x509.NewCertPool()
+		}
+		for _, file := range files {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return c.Errf("reading CA certificates: %v", err)
+			}
+			if !u.rootCAs.AppendCertsFromPEM(pem) {
+				return c.Errf("no CA certificates found in %s", file)
+			}
+		}
 	case "keepalive":
+		// keepalive is the number of idle connections kept open to
+		// each host, or 0 to close connections after every request.
+		// Whether a client sends Connection: close has no effect on
+		// them, because it only applies to the client's connection.
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
@@ -337,19 +616,97 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 	return nil
 }
 
+// parseSticky parses the arguments of the sticky policy:
+//
+//	policy sticky <cookie> [path <path>] [secure] [httponly] [fallback <policy>]
+func parseSticky(c *caddyfile.Dispenser, sticky *Sticky) error {
+	if !c.NextArg() {
+		return c.ArgErr()
+	}
+	sticky.Cookie = c.Val()
+	args := c.RemainingArgs()
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "path":
+			if i+1 >= len(args) {
+				return c.ArgErr()
+			}
+			i++
+			sticky.Path = args[i]
+		case "secure":
+			sticky.Secure = true
+		case "httponly":
+			sticky.HTTPOnly = true
+		case "fallback":
+			if i+1 >= len(args) {
+				return c.ArgErr()
+			}
+			i++
+			policyCreateFunc, ok := supportedPolicies[args[i]]
+			if !ok || args[i] == "sticky" {
+				return c.Errf("invalid fallback policy '%s'", args[i])
+			}
+			sticky.Fallback = policyCreateFunc()
+		default:
+			return c.Errf("unknown sticky option '%s'", args[i])
+		}
+	}
+	return nil
+}
+
+// Pin pins the client of r to host if the upstream's policy
+// pins clients to hosts; see Sticky.
+func (u *staticUpstream) Pin(r *http.Request, host *UpstreamHost) *http.Cookie {
+	if pinner, ok := u.Policy.(hostPinner); ok {
+		return pinner.Pin(r, host)
+	}
+	return nil
+}
+
 func (u *staticUpstream) healthCheck() {
-	for _, host := range u.Hosts {
+	for _, host := range u.hosts() {
+		// check through the transport the host is proxied with, so
+		// the check connects the way the proxied requests do
+		client := u.HealthCheck.Client
 		hostURL := host.Name + u.HealthCheck.Path
-		if r, err := u.HealthCheck.Client.Get(hostURL); err == nil {
+		if host.ReverseProxy != nil && host.ReverseProxy.Transport != nil {
+			client.Transport = host.ReverseProxy.Transport
+			if strings.HasPrefix(host.Name, "unix:") {
+				// the transport dials the socket whatever the host
+				hostURL = "http://socket" + u.HealthCheck.Path
+			}
+		}
+		if r, err := client.Get(hostURL); err == nil {
+			host.Unhealthy = !u.healthy(r)
 			io.Copy(ioutil.Discard, r.Body)
 			r.Body.Close()
-			host.Unhealthy = r.StatusCode < 200 || r.StatusCode >= 400
 		} else {
 			host.Unhealthy = true
 		}
 	}
 }
 
+// healthy returns true if r is the response of a healthy host:
+// its status must be the expected status, or any status below
+// 400 if none is configured, and its body must contain the
+// expected body, if any. Only the beginning of the body is read.
+func (u *staticUpstream) healthy(r *http.Response) bool {
+	if u.HealthCheck.ExpectStatus != 0 {
+		if r.StatusCode != u.HealthCheck.ExpectStatus {
+			return false
+		}
+	} else if r.StatusCode < 200 || r.StatusCode >= 400 {
+		return false
+	}
+	if u.HealthCheck.ExpectBody != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxHealthCheckBody))
+		if err != nil || !strings.Contains(string(body), u.HealthCheck.ExpectBody) {
+			return false
+		}
+	}
+	return true
+}
+
 func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 	ticker := time.NewTicker(u.HealthCheck.Interval)
 	u.healthCheck()
@@ -365,8 +722,88 @@ func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 	}
 }
 
+// hosts returns the current pool of hosts.
+func (u *staticUpstream) hosts() HostPool {
+	u.hostsMu.RLock()
+	defer u.hostsMu.RUnlock()
+	return u.Hosts
+}
+
+// resolveSRV looks up the SRV records of the upstream and replaces
+// its hosts with their targets. Targets that were already hosts keep
+// their state, so their health and failures are not forgotten; hosts
+// that are no longer targets get no new requests, but the requests
+// already using them complete normally.
+//
+// Targets are proxied to over HTTPS if the service name starts
+// with "_https.", and over HTTP otherwise.
+func (u *staticUpstream) resolveSRV() error {
+	current := make(map[string]*UpstreamHost)
+	for _, host := range u.hosts() {
+		current[host.Name] = host
+	}
+
+	var pool HostPool
+	seen := make(map[string]bool)
+	for _, name := range u.srvNames {
+		_, addrs, err := lookupSRV("", "", name)
+		if err != nil {
+			return err
+		}
+		scheme := "http://"
+		if strings.HasPrefix(name, "_https.") {
+			scheme = "https://"
+		}
+		for _, addr := range addrs {
+			target := strings.TrimSuffix(addr.Target, ".")
+			hostName := scheme + net.JoinHostPort(target, strconv.Itoa(int(addr.Port)))
+			if seen[hostName] {
+				continue
+			}
+			seen[hostName] = true
+
+			// hosts are in use concurrently, so a host whose record
+			// changed is replaced rather than modified
+			host, ok := current[hostName]
+			if !ok || host.Priority != int(addr.Priority) || host.Weight != int(addr.Weight) {
+				host, err = u.NewHost(hostName)
+				if err != nil {
+					return err
+				}
+				host.Priority = int(addr.Priority)
+				host.Weight = int(addr.Weight)
+			}
+			pool = append(pool, host)
+		}
+	}
+
+	u.hostsMu.Lock()
+	u.Hosts = pool
+	u.hostsMu.Unlock()
+	return nil
+}
+
+// SRVWorker resolves the SRV records of the upstream every
+// SRVInterval, so hosts can join and leave the pool without
+// a restart. The Go resolver does not expose record TTLs,
+// so the interval is configured instead.
+func (u *staticUpstream) SRVWorker(stop chan struct{}) {
+	ticker := time.NewTicker(u.SRVInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := u.resolveSRV(); err != nil {
+				log.Printf("[ERROR] proxy: resolving SRV upstreams for %s: %v", u.from, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
-	pool := u.Hosts
+	pool := preferredHosts(u.hosts())
 	if len(pool) == 1 {
 		if !pool[0].Available() {
 			return nil
@@ -397,3 +834,31 @@ func (u *staticUpstream) AllowedPath(requestPath string) bool {
 	}
 	return true
 }
+
+// preferredHosts returns the hosts in pool that have the best
+// (lowest) priority among the available hosts, so that hosts
+// with worse priorities are only used as fallbacks.
+func preferredHosts(pool HostPool) HostPool {
+	best, found, mixed := 0, false, false
+	for _, host := range pool {
+		if !host.Available() {
+			continue
+		}
+		if !found || host.Priority < best {
+			mixed = found
+			best, found = host.Priority, true
+		} else if host.Priority != best {
+			mixed = true
+		}
+	}
+	if !mixed {
+		return pool
+	}
+	var preferred HostPool
+	for _, host := range pool {
+		if host.Priority == best {
+			preferred = append(preferred, host)
+		}
+	}
+	return preferred
+}
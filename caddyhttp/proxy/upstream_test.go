@@ -1,11 +1,21 @@
 package proxy
 
 import (
-	"github.com/mholt/caddy/caddyfile"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func TestNewHost(t *testing.T) {
@@ -64,6 +74,47 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+func TestHealthCheckExpect(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/busy" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("status: OK"))
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		path            string
+		expectStatus    int
+		expectBody      string
+		expectedHealthy bool
+	}{
+		{"/", 0, "", true},
+		{"/busy", 0, "", true},
+		{"/", 200, "", true},
+		{"/busy", 200, "", false},
+		{"/busy", 204, "", true},
+		{"/", 0, "OK", true},
+		{"/", 0, "FAIL", false},
+		{"/", 200, "OK", true},
+		{"/busy", 204, "OK", false},
+	}
+	for i, test := range tests {
+		upstream := &staticUpstream{
+			Hosts:    HostPool{{Name: backend.URL}},
+			MaxFails: 1,
+		}
+		upstream.HealthCheck.Path = test.path
+		upstream.HealthCheck.ExpectStatus = test.expectStatus
+		upstream.HealthCheck.ExpectBody = test.expectBody
+		upstream.healthCheck()
+		if healthy := !upstream.Hosts[0].Unhealthy; healthy != test.expectedHealthy {
+			t.Errorf("Test %d: Expected healthy to be %v, got %v", i, test.expectedHealthy, healthy)
+		}
+	}
+}
+
 func TestSelect(t *testing.T) {
 	upstream := &staticUpstream{
 		from:        "",
@@ -225,3 +276,591 @@ func TestParseBlock(t *testing.T) {
 		}
 	}
 }
+
+func TestHostFails(t *testing.T) {
+	upstream := &staticUpstream{
+		FailTimeout: 50 * time.Millisecond,
+		MaxFails:    2,
+	}
+	uh, err := upstream.NewHost("example.com")
+	if err != nil {
+		t.Fatal("Expected no error")
+	}
+
+	uh.fail()
+	if uh.Down() {
+		t.Error("Expected host not to be down after 1 of 2 max fails")
+	}
+	uh.fail()
+	if !uh.Down() {
+		t.Error("Expected host to be down after 2 of 2 max fails")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if uh.Down() {
+		t.Error("Expected host to be up again after fail timeout")
+	}
+
+	// a success resets the count of consecutive failures
+	uh.fail()
+	uh.resetFails()
+	uh.fail()
+	if uh.Down() {
+		t.Error("Expected host not to be down after failures were reset")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if fails := atomic.LoadInt32(&uh.Fails); fails != 0 {
+		t.Errorf("Expected 0 fails after fail timeout, got %d", fails)
+	}
+}
+
+func TestParseBlockFails(t *testing.T) {
+	tests := []struct {
+		config              string
+		shouldErr           bool
+		expectedMaxFails    int32
+		expectedFailTimeout time.Duration
+	}{
+		{"proxy / localhost:8080", false, 1, 10 * time.Second},
+		{"proxy / localhost:8080 {\n max_fails 3 \n fail_timeout 30s \n}", false, 3, 30 * time.Second},
+		{"proxy / localhost:8080 {\n max_fails 0 \n}", false, 0, 10 * time.Second},
+		{"proxy / localhost:8080 {\n max_fails -1 \n}", true, 0, 0},
+		{"proxy / localhost:8080 {\n max_fails many \n}", true, 0, 0},
+		{"proxy / localhost:8080 {\n fail_timeout -5s \n}", true, 0, 0},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if u.MaxFails != test.expectedMaxFails {
+			t.Errorf("Test %d: Expected MaxFails %d, got %d", i, test.expectedMaxFails, u.MaxFails)
+		}
+		if u.FailTimeout != test.expectedFailTimeout {
+			t.Errorf("Test %d: Expected FailTimeout %v, got %v", i, test.expectedFailTimeout, u.FailTimeout)
+		}
+	}
+}
+
+func TestParseBlockTimeouts(t *testing.T) {
+	tests := []struct {
+		config                        string
+		shouldErr                     bool
+		expectedDialTimeout           time.Duration
+		expectedResponseHeaderTimeout time.Duration
+	}{
+		{"proxy / localhost:8080", false, 0, 0},
+		{"proxy / localhost:8080 {\n dial_timeout 5s \n}", false, 5 * time.Second, 0},
+		{"proxy / localhost:8080 {\n response_header_timeout 1m \n}", false, 0, time.Minute},
+		{"proxy / localhost:8080 {\n dial_timeout 2s \n response_header_timeout 30s \n}", false, 2 * time.Second, 30 * time.Second},
+		{"proxy / localhost:8080 {\n dial_timeout \n}", true, 0, 0},
+		{"proxy / localhost:8080 {\n dial_timeout soon \n}", true, 0, 0},
+		{"proxy / localhost:8080 {\n response_header_timeout 0s \n}", true, 0, 0},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if u.DialTimeout != test.expectedDialTimeout {
+			t.Errorf("Test %d: Expected DialTimeout %v, got %v", i, test.expectedDialTimeout, u.DialTimeout)
+		}
+		if u.ResponseHeaderTimeout != test.expectedResponseHeaderTimeout {
+			t.Errorf("Test %d: Expected ResponseHeaderTimeout %v, got %v", i, test.expectedResponseHeaderTimeout, u.ResponseHeaderTimeout)
+		}
+	}
+}
+
+func TestParseBlockFlushInterval(t *testing.T) {
+	tests := []struct {
+		config                string
+		shouldErr             bool
+		expectedFlushInterval time.Duration
+	}{
+		{"proxy / localhost:8080", false, 250 * time.Millisecond},
+		{"proxy / localhost:8080 {\n flush_interval 100ms \n}", false, 100 * time.Millisecond},
+		{"proxy / localhost:8080 {\n flush_interval -1 \n}", false, -1},
+		{"proxy / localhost:8080 {\n flush_interval 0 \n}", false, 0},
+		{"proxy / localhost:8080 {\n flush_interval -1s \n}", true, 0},
+		{"proxy / localhost:8080 {\n flush_interval often \n}", true, 0},
+		{"proxy / localhost:8080 {\n flush_interval \n}", true, 0},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if u.FlushInterval != test.expectedFlushInterval {
+			t.Errorf("Test %d: Expected FlushInterval %v, got %v", i, test.expectedFlushInterval, u.FlushInterval)
+		}
+		host := u.Select(httptest.NewRequest("GET", "/", nil))
+		if got := host.ReverseProxy.FlushInterval; got != test.expectedFlushInterval {
+			t.Errorf("Test %d: Expected the reverse proxy to flush every %v, got %v", i, test.expectedFlushInterval, got)
+		}
+	}
+}
+
+func TestParseBlockHostHeader(t *testing.T) {
+	tests := []struct {
+		config             string
+		shouldErr          bool
+		expectedHostHeader string
+	}{
+		{"proxy / localhost:8080", false, ""},
+		{"proxy / localhost:8080 {\n host_header backend.internal \n}", false, "backend.internal"},
+		{"proxy / localhost:8080 {\n host_header {host} \n}", false, "{host}"},
+		{"proxy / localhost:8080 {\n host_header \n}", true, ""},
+		{"proxy / localhost:8080 {\n host_header a.internal b.internal \n}", true, ""},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		host := upstreams[0].Select(httptest.NewRequest("GET", "/", nil))
+		if host.HostHeader != test.expectedHostHeader {
+			t.Errorf("Test %d: Expected HostHeader '%s', got '%s'", i, test.expectedHostHeader, host.HostHeader)
+		}
+	}
+}
+
+func TestParseBlockCACertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_proxy_ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend := httptest.NewTLSServer(http.NotFoundHandler())
+	backend.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expectCAs bool
+	}{
+		{"proxy / https://localhost:8443", false, false},
+		{"proxy / https://localhost:8443 {\n ca_certificates " + caFile + " \n}", false, true},
+		{"proxy / https://localhost:8443 {\n ca_certificates " + caFile + " " + caFile + " \n}", false, true},
+		{"proxy / https://localhost:8443 {\n ca_certificates \n}", true, false},
+		{"proxy / https://localhost:8443 {\n ca_certificates " + filepath.Join(dir, "missing.pem") + " \n}", true, false},
+		{"proxy / https://localhost:8443 {\n ca_certificates " + notPEM + " \n}", true, false},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		host := upstreams[0].Select(httptest.NewRequest("GET", "/", nil))
+		var rootCAs bool
+		if transport, ok := host.ReverseProxy.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+			rootCAs = transport.TLSClientConfig.RootCAs != nil
+		}
+		if rootCAs != test.expectCAs {
+			t.Errorf("Test %d: Expected the transport to have its own CAs to be %v, got %v", i, test.expectCAs, rootCAs)
+		}
+	}
+}
+
+func TestParseBlockRetries(t *testing.T) {
+	tests := []struct {
+		config                     string
+		shouldErr                  bool
+		expectedTryDuration        time.Duration
+		expectedTryInterval        time.Duration
+		expectedRetryNonIdempotent bool
+	}{
+		{"proxy / localhost:8080", false, tryDuration, tryInterval, false},
+		{"proxy / localhost:8080 {\n try_duration 5s \n try_interval 1s \n}", false, 5 * time.Second, time.Second, false},
+		{"proxy / localhost:8080 {\n try_duration 0 \n}", false, 0, tryInterval, false},
+		{"proxy / localhost:8080 {\n retry_non_idempotent \n}", false, tryDuration, tryInterval, true},
+		{"proxy / localhost:8080 {\n try_duration -1s \n}", true, 0, 0, false},
+		{"proxy / localhost:8080 {\n try_interval \n}", true, 0, 0, false},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if u.TryDuration != test.expectedTryDuration {
+			t.Errorf("Test %d: Expected TryDuration %v, got %v", i, test.expectedTryDuration, u.TryDuration)
+		}
+		if u.TryInterval != test.expectedTryInterval {
+			t.Errorf("Test %d: Expected TryInterval %v, got %v", i, test.expectedTryInterval, u.TryInterval)
+		}
+		if u.RetryNonIdempotent != test.expectedRetryNonIdempotent {
+			t.Errorf("Test %d: Expected RetryNonIdempotent %v, got %v", i, test.expectedRetryNonIdempotent, u.RetryNonIdempotent)
+		}
+	}
+}
+
+func TestParseBlockResponseBodyRewrite(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  []BodyReplacement
+	}{
+		{"proxy / localhost:8080", false, nil},
+		{"proxy / localhost:8080 {\n response_body_rewrite http://internal:8080 https://{host} \n}", false,
+			[]BodyReplacement{{"http://internal:8080", "https://{host}"}}},
+		{"proxy / localhost:8080 {\n response_body_rewrite a b \n response_body_rewrite c \"\" \n}", false,
+			[]BodyReplacement{{"a", "b"}, {"c", ""}}},
+		{"proxy / localhost:8080 {\n response_body_rewrite a \n}", true, nil},
+		{"proxy / localhost:8080 {\n response_body_rewrite \"\" b \n}", true, nil},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if !reflect.DeepEqual(u.bodyReplacements, test.expected) {
+			t.Errorf("Test %d: Expected body replacements %v, got %v", i, test.expected, u.bodyReplacements)
+		}
+		if host := u.Hosts[0]; !reflect.DeepEqual(host.BodyReplacements, test.expected) {
+			t.Errorf("Test %d: Expected host body replacements %v, got %v", i, test.expected, host.BodyReplacements)
+		}
+	}
+}
+
+func TestSRVUpstreams(t *testing.T) {
+	records := map[string][]*net.SRV{
+		"_http._tcp.service.local": {
+			{Target: "a.service.local.", Port: 8080, Priority: 10, Weight: 1},
+			{Target: "b.service.local.", Port: 8080, Priority: 10, Weight: 1},
+		},
+	}
+	defer func(orig func(string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = orig
+	}(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		addrs, ok := records[name]
+		if !ok {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name}
+		}
+		return name, addrs, nil
+	}
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / srv://_http._tcp.service.local {\n srv_interval 1h \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	if u.SRVInterval != time.Hour {
+		t.Errorf("Expected SRVInterval %v, got %v", time.Hour, u.SRVInterval)
+	}
+	hosts := u.hosts()
+	if len(hosts) != 2 || hosts[0].Name != "http://a.service.local:8080" || hosts[1].Name != "http://b.service.local:8080" {
+		t.Fatalf("Expected hosts a and b, got %v", hosts)
+	}
+	a := hosts[0]
+
+	// b is removed, c is added and a keeps its state
+	records["_http._tcp.service.local"] = []*net.SRV{
+		{Target: "a.service.local.", Port: 8080, Priority: 10, Weight: 1},
+		{Target: "c.service.local.", Port: 9090, Priority: 20, Weight: 1},
+	}
+	if err := u.resolveSRV(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	hosts = u.hosts()
+	if len(hosts) != 2 || hosts[0] != a || hosts[1].Name != "http://c.service.local:9090" {
+		t.Fatalf("Expected hosts a and c, got %v", hosts)
+	}
+
+	// c has a worse priority, so it is only used when a is down
+	for i := 0; i < 10; i++ {
+		if host := u.Select(nil); host != a {
+			t.Fatalf("Expected host a to be selected, got %v", host)
+		}
+	}
+	a.Unhealthy = true
+	if host := u.Select(nil); host != hosts[1] {
+		t.Errorf("Expected host c to be selected when a is down, got %v", host)
+	}
+
+	// a failed lookup keeps the previous hosts
+	delete(records, "_http._tcp.service.local")
+	if err := u.resolveSRV(); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+	if len(u.hosts()) != 2 {
+		t.Errorf("Expected previous hosts to be kept, got %v", u.hosts())
+	}
+
+	for i, config := range []string{
+		"proxy / srv://_http._tcp.missing.local",
+		"proxy / srv://_http._tcp.service.local localhost:8080",
+		"proxy / localhost:8080 {\n srv_interval 0s \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config))); err == nil {
+			t.Errorf("Test %d: Expected error, got nil", i)
+		}
+	}
+}
+
+func TestParseBlockHealthCheckExpect(t *testing.T) {
+	tests := []struct {
+		config               string
+		shouldErr            bool
+		expectedExpectStatus int
+		expectedExpectBody   string
+	}{
+		{"health_check /health", false, 0, ""},
+		{"health_check /health\n health_check_expect_status 204", false, 204, ""},
+		{"health_check /health\n health_check_expect_body \"all good\"", false, 0, "all good"},
+		{"health_check_expect_status 200\n health_check_expect_body OK", false, 200, "OK"},
+		{"health_check_expect_status", true, 0, ""},
+		{"health_check_expect_status ok", true, 0, ""},
+		{"health_check_expect_status 999", true, 0, ""},
+		{"health_check_expect_body", true, 0, ""},
+	}
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() && err == nil {
+			err = parseBlock(&c, &u)
+		}
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if u.HealthCheck.ExpectStatus != test.expectedExpectStatus {
+			t.Errorf("Test %d: Expected ExpectStatus %d, got %d", i, test.expectedExpectStatus, u.HealthCheck.ExpectStatus)
+		}
+		if u.HealthCheck.ExpectBody != test.expectedExpectBody {
+			t.Errorf("Test %d: Expected ExpectBody %q, got %q", i, test.expectedExpectBody, u.HealthCheck.ExpectBody)
+		}
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	var conns int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, client"))
+	}))
+	backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	tests := []struct {
+		keepalive     string
+		expectedConns int32
+	}{
+		{"keepalive 10", 1},
+		{"keepalive 0", 5},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " " + backend.URL + "/other {\n " + test.keepalive + " \n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		u := upstreams[0].(*staticUpstream)
+		if u.Hosts[0].ReverseProxy.Transport != u.Hosts[1].ReverseProxy.Transport {
+			t.Errorf("Test %d: Expected hosts of an upstream to share a transport", i)
+		}
+
+		atomic.StoreInt32(&conns, 0)
+		p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+		for j := 0; j < 5; j++ {
+			r, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("Test %d: Failed to create request: %v", i, err)
+			}
+			r.Header.Set("Connection", "close")
+			p.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		if n := atomic.LoadInt32(&conns); n != test.expectedConns {
+			t.Errorf("Test %d: Expected %d connections to the backend, got %d", i, test.expectedConns, n)
+		}
+	}
+
+	// separate upstreams don't share transports
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy /a localhost:8080 {\n keepalive 10 \n}\nproxy /b localhost:8080 {\n keepalive 10 \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if upstreams[0].(*staticUpstream).transport == upstreams[1].(*staticUpstream).transport {
+		t.Error("Expected separate upstreams to have separate transports")
+	}
+}
+
+func TestSharedTransport(t *testing.T) {
+	config := "proxy / localhost:8080 localhost:8081 unix:/tmp/caddy_test.sock {\n insecure_skip_verify \n response_header_timeout 5s \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	if u.transport == nil {
+		t.Fatal("Expected the upstream to have a transport")
+	}
+	for i, host := range u.Hosts[:2] {
+		if host.ReverseProxy.Transport != u.transport {
+			t.Errorf("Host %d: Expected the transport of the upstream", i)
+		}
+	}
+	socket := u.Hosts[2].ReverseProxy.Transport
+	if socket == u.transport {
+		t.Error("Expected the unix socket host to have a transport of its own")
+	}
+
+	// options apply to the shared transport and the socket's alike
+	for i, rt := range []http.RoundTripper{u.transport, socket} {
+		transport := rt.(*http.Transport)
+		if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+			t.Errorf("Transport %d: Expected it to skip verification", i)
+		}
+		if transport.ResponseHeaderTimeout != 5*time.Second {
+			t.Errorf("Transport %d: Expected response header timeout 5s, got %v", i, transport.ResponseHeaderTimeout)
+		}
+	}
+}
+
+func TestHealthCheckTransport(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+
+	// the certificate of the backend can't be verified, so the
+	// check only passes through the insecure transport of the hosts
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\n insecure_skip_verify \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	u.HealthCheck.Path = "/"
+	u.healthCheck()
+	if u.Hosts[0].Unhealthy {
+		t.Error("Expected the host to be checked through its insecure transport")
+	}
+
+	// a unix socket host is checked through the transport that dials
+	// the socket; here it dials the backend instead
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer plain.Close()
+	u = &staticUpstream{
+		Hosts: HostPool{{
+			Name: "unix:/tmp/caddy_test.sock",
+			ReverseProxy: &ReverseProxy{Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.Dial("tcp", plain.Listener.Addr().String())
+				},
+			}},
+		}},
+		MaxFails: 1,
+	}
+	u.HealthCheck.Path = "/"
+	u.healthCheck()
+	if u.Hosts[0].Unhealthy {
+		t.Error("Expected the unix socket host to be checked through its transport")
+	}
+}
+
+func TestCACertificatesTransport(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+
+	// the backend's certificate is self-signed, so it is its own CA
+	dir, err := ioutil.TempDir("", "caddy_proxy_ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := "proxy / " + backend.URL + " localhost:8081 unix:/tmp/caddy_test.sock {\n ca_certificates " + caFile + " \n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	for i, host := range u.Hosts {
+		transport := host.ReverseProxy.Transport.(*http.Transport)
+		if transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil {
+			t.Errorf("Host %d: Expected the transport to verify with the CA certificates", i)
+		}
+	}
+
+	// the health check verifies the backend with them too
+	u.Hosts = u.Hosts[:1]
+	u.HealthCheck.Path = "/"
+	u.healthCheck()
+	if u.Hosts[0].Unhealthy {
+		t.Error("Expected the host to be verified with the CA certificates in the health check")
+	}
+}
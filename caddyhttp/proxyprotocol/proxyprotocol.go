@@ -0,0 +1,37 @@
+// Package proxyprotocol implements the proxy_protocol directive,
+// which accepts the PROXY protocol from trusted load balancers.
+package proxyprotocol
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("proxy_protocol", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupProxyProtocol,
+	})
+}
+
+// setupProxyProtocol sets the networks of the load balancers that
+// may send a PROXY protocol header on the connections they open to
+// the site, like "proxy_protocol 10.0.0.0/8 fd00::/8". The address
+// in the header then becomes the remote address of the requests.
+func setupProxyProtocol(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		cidrs := c.RemainingArgs()
+		if len(cidrs) == 0 {
+			return c.ArgErr()
+		}
+		for _, cidr := range cidrs {
+			network, err := httpserver.ParseNetwork(cidr)
+			if err != nil {
+				return c.Errf("invalid trusted network '%s': %v", cidr, err)
+			}
+			config.ProxyProtocol = append(config.ProxyProtocol, network)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package proxyprotocol
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupProxyProtocol(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`proxy_protocol 10.0.0.0/8`, false, []string{"10.0.0.0/8"}},
+		{`proxy_protocol 10.0.0.0/8 fd00::/8`, false, []string{"10.0.0.0/8", "fd00::/8"}},
+		{"proxy_protocol 10.0.0.0/8\nproxy_protocol 192.168.1.1/32", false, []string{"10.0.0.0/8", "192.168.1.1/32"}},
+		{`proxy_protocol`, true, nil},
+		{`proxy_protocol 10.0.0.1 fd00::1`, false, []string{"10.0.0.1/32", "fd00::1/128"}},
+		{`proxy_protocol 10.0.0.0/33`, true, nil},
+		{`proxy_protocol everyone`, true, nil},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupProxyProtocol(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		var got []string
+		for _, network := range httpserver.GetConfig(c).ProxyProtocol {
+			got = append(got, network.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: expected trusted networks %v, got %v", i, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Package push implements HTTP/2 server push, of resources
+// configured per path or listed as preload links in responses.
+package push
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Push is middleware that pushes resources to HTTP/2 clients
+// along with the responses they need them for.
+type Push struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule lists the resources to push along with responses
+// for requests matching Path.
+type Rule struct {
+	Path      string
+	Resources []string
+}
+
+// pushedHeader marks the requests of pushed resources, so
+// that they don't push anything themselves.
+const pushedHeader = "X-Caddy-Pushed"
+
+// pushedRequestHeaders are the headers of a request that are
+// passed on to the requests of the resources pushed for it.
+var pushedRequestHeaders = []string{
+	"Accept-Encoding",
+	"Accept-Language",
+	"Cache-Control",
+	"Cookie",
+	"User-Agent",
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (p Push) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	pusher, ok := w.(http.Pusher)
+	if !ok || r.ProtoMajor < 2 || r.Method != http.MethodGet || r.Header.Get(pushedHeader) != "" {
+		return p.Next.ServeHTTP(w, r)
+	}
+
+	pw := &pushWriter{ResponseWriter: w, pusher: pusher, request: r}
+	for _, rule := range p.Rules {
+		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			for _, resource := range rule.Resources {
+				if !pw.push(resource) {
+					// not supported after all, or the client
+					// doesn't want pushes; don't bother it more
+					return p.Next.ServeHTTP(w, r)
+				}
+			}
+		}
+	}
+
+	return p.Next.ServeHTTP(pw, r)
+}
+
+// pushWriter pushes the resources listed as preload links
+// in a response right before its header is written.
+type pushWriter struct {
+	http.ResponseWriter
+	pusher      http.Pusher
+	request     *http.Request
+	pushed      map[string]struct{}
+	digests     []cacheDigest
+	wroteHeader bool
+}
+
+// push pushes target, unless it was pushed already or the cache
+// digest of the client says that it has it. It returns false if
+// the client can't take pushes at all.
+func (pw *pushWriter) push(target string) bool {
+	if _, ok := pw.pushed[target]; ok {
+		return true
+	}
+	if pw.pushed == nil {
+		pw.pushed = make(map[string]struct{})
+		pw.digests = parseCacheDigests(pw.request.Header["Cache-Digest"])
+	}
+	pw.pushed[target] = struct{}{}
+
+	key := targetURL(pw.request, target)
+	for _, digest := range pw.digests {
+		if digest.contains(key) {
+			return true
+		}
+	}
+
+	header := make(http.Header)
+	for _, name := range pushedRequestHeaders {
+		if values, ok := pw.request.Header[name]; ok {
+			header[name] = values
+		}
+	}
+	header.Set(pushedHeader, "1")
+	err := pw.pusher.Push(target, &http.PushOptions{Header: header})
+	return err != http.ErrNotSupported
+}
+
+// WriteHeader pushes the preload links in the header
+// of the response and writes status.
+func (pw *pushWriter) WriteHeader(status int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+	for _, target := range preloadLinks(pw.Header()["Link"]) {
+		if !pw.push(target) {
+			break
+		}
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b, writing the header with status 200 first if needed.
+func (pw *pushWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Push implements http.Pusher, so that handlers further
+// down the chain can push resources themselves.
+func (pw *pushWriter) Push(target string, opts *http.PushOptions) error {
+	return pw.pusher.Push(target, opts)
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (pw *pushWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := pw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// Flush implements http.Flusher. It writes the header, if
+// it wasn't yet, and flushes the underlying ResponseWriter.
+func (pw *pushWriter) Flush() {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic("not a Flusher") // should be recovered at the beginning of middleware stack
+	}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (pw *pushWriter) CloseNotify() <-chan bool {
+	if cn, ok := pw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic("not a CloseNotifier")
+}
+
+// preloadLinks returns the paths of the resources listed with
+// rel=preload in the Link header values links. Links to other
+// hosts and links with the nopush parameter are left out.
+func preloadLinks(links []string) []string {
+	var targets []string
+	for _, line := range links {
+		for _, link := range strings.Split(line, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(target, "</") || strings.HasPrefix(target, "<//") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			var preload, nopush bool
+			for _, param := range params[1:] {
+				name, value := param, ""
+				if i := strings.Index(param, "="); i >= 0 {
+					name, value = param[:i], strings.Trim(strings.TrimSpace(param[i+1:]), `"`)
+				}
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "rel":
+					for _, rel := range strings.Fields(value) {
+						if strings.EqualFold(rel, "preload") {
+							preload = true
+						}
+					}
+				case "nopush":
+					nopush = true
+				}
+			}
+			if preload && !nopush {
+				targets = append(targets, target[1:len(target)-1])
+			}
+		}
+	}
+	return targets
+}
+
+// targetURL returns the URL of target on the site that r is for,
+// which identifies it in cache digests.
+func targetURL(r *http.Request, target string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + target
+}
+
+// cacheDigest is a digest of the URLs that a client has in its
+// cache, sent in a Cache-Digest header: a Golomb-coded set of
+// truncated SHA-256 hashes of the URLs.
+type cacheDigest struct {
+	n, p uint // log2 of the number of entries and of the inverse false positive rate
+	data []byte
+}
+
+// parseCacheDigests parses the Cache-Digest header values. Digests
+// of fresh responses that don't include validators are the only
+// ones that can be checked without knowing the ETags of resources.
+func parseCacheDigests(values []string) []cacheDigest {
+	var digests []cacheDigest
+	for _, line := range values {
+		for _, value := range strings.Split(line, ",") {
+			params := strings.Split(value, ";")
+			usable := true
+			for _, flag := range params[1:] {
+				switch strings.ToLower(strings.TrimSpace(flag)) {
+				case "validators", "stale":
+					usable = false
+				}
+			}
+			data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(params[0]), "="))
+			if !usable || err != nil || len(data) < 2 {
+				continue
+			}
+			d := cacheDigest{n: uint(data[0] >> 3), p: uint(data[0]&7<<2 | data[1]>>6), data: data}
+			if d.n+d.p > 62 {
+				continue
+			}
+			digests = append(digests, d)
+		}
+	}
+	return digests
+}
+
+// contains returns true if url is in the digest
+// (or is a false positive).
+func (d cacheDigest) contains(url string) bool {
+	sum := sha256.Sum256([]byte(url))
+	hash := binary.BigEndian.Uint64(sum[:8]) >> (64 - d.n - d.p)
+
+	bits := bitReader{data: d.data, pos: 10} // skip n and p
+	c := int64(-1)
+	for {
+		var q uint64
+		for {
+			bit, ok := bits.read(1)
+			if !ok {
+				return false
+			}
+			if bit == 1 {
+				break
+			}
+			q++
+		}
+		r, ok := bits.read(d.p)
+		if !ok {
+			return false
+		}
+		c += int64(q<<d.p|r) + 1
+		if uint64(c) == hash {
+			return true
+		}
+		if uint64(c) > hash {
+			return false
+		}
+	}
+}
+
+// bitReader reads the bits of data, most significant first.
+type bitReader struct {
+	data []byte
+	pos  uint
+}
+
+// read returns the next n bits as a number, and false
+// if there aren't as many left.
+func (b *bitReader) read(n uint) (uint64, bool) {
+	if b.pos+n > uint(len(b.data))*8 {
+		return 0, false
+	}
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		bit := b.data[b.pos/8] >> (7 - b.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		b.pos++
+	}
+	return v, true
+}
@@ -0,0 +1,186 @@
+package push
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// pushRecorder is a ResponseRecorder that records pushes.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushes  []string
+	headers []http.Header
+	err     error
+}
+
+func (pr *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	if pr.err != nil {
+		return pr.err
+	}
+	pr.pushes = append(pr.pushes, target)
+	pr.headers = append(pr.headers, opts.Header)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	p := Push{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/linked.html" {
+				w.Header().Add("Link", "</css/linked.css>; rel=preload; as=style, </js/nopush.js>; rel=preload; nopush")
+				w.Header().Add("Link", `<https://cdn.example.com/x.js>; rel=preload, </img/a.png>; rel="prefetch", </fonts/a.woff>; rel="preload"`)
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("hello"))
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Path: "/index.html", Resources: []string{"/css/app.css", "/js/app.js"}},
+		},
+	}
+
+	tests := []struct {
+		path       string
+		protoMajor int
+		header     http.Header
+		pushErr    error
+		expected   []string
+	}{
+		{"/index.html", 2, nil, nil, []string{"/css/app.css", "/js/app.js"}},
+		{"/index.html", 1, nil, nil, nil},
+		{"/other.html", 2, nil, nil, nil},
+		{"/linked.html", 2, nil, nil, []string{"/css/linked.css", "/fonts/a.woff"}},
+		{"/index.html", 2, http.Header{pushedHeader: {"1"}}, nil, nil},
+		{"/index.html", 2, nil, http.ErrNotSupported, nil},
+		{"/index.html", 2, http.Header{"Cache-Digest": {cacheDigestFor("http://example.com/css/app.css")}}, nil, []string{"/js/app.js"}},
+		{"/index.html", 2, http.Header{"Cache-Digest": {cacheDigestFor("http://example.com/css/app.css") + "; validators"}}, nil, []string{"/css/app.css", "/js/app.js"}},
+	}
+	for i, test := range tests {
+		r, err := http.NewRequest("GET", "http://example.com"+test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		r.ProtoMajor = test.protoMajor
+		for k, v := range test.header {
+			r.Header[k] = v
+		}
+		w := &pushRecorder{ResponseRecorder: httptest.NewRecorder(), err: test.pushErr}
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if !reflect.DeepEqual(w.pushes, test.expected) {
+			t.Errorf("Test %d: Expected pushes %v, got %v", i, test.expected, w.pushes)
+		}
+		if w.Body.String() != "hello" {
+			t.Errorf("Test %d: Expected the response to be written, got %q", i, w.Body.String())
+		}
+	}
+}
+
+func TestPushHeaders(t *testing.T) {
+	p := Push{
+		Next:  httpserver.EmptyNext,
+		Rules: []Rule{{Path: "/", Resources: []string{"/app.css"}}},
+	}
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	r.ProtoMajor = 2
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Authorization", "Basic c2VjcmV0")
+	w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	p.ServeHTTP(w, r)
+
+	if len(w.headers) != 1 {
+		t.Fatalf("Expected 1 push, got %d", len(w.headers))
+	}
+	expected := http.Header{"Accept-Encoding": {"gzip"}, pushedHeader: {"1"}}
+	if !reflect.DeepEqual(w.headers[0], expected) {
+		t.Errorf("Expected push headers %v, got %v", expected, w.headers[0])
+	}
+}
+
+func TestPushWriterInterfaces(t *testing.T) {
+	p := Push{
+		Next:  httpserver.HandlerFunc(httpserver.UseOptionalInterfaces),
+		Rules: []Rule{{Path: "/", Resources: []string{"/css/app.css"}}},
+	}
+	fw := &httpserver.FullResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.ProtoMajor = 2
+	if _, err := p.ServeHTTP(fw, req); err != nil {
+		t.Fatal(err)
+	}
+	// the first push is the configured resource
+	if got, want := fmt.Sprint(fw.Calls), "[Push Hijack Flush Push CloseNotify]"; got != want {
+		t.Errorf("Expected the calls to reach the underlying writer: %s, got %s", want, got)
+	}
+}
+
+func TestCacheDigestContains(t *testing.T) {
+	urls := []string{"https://example.com/a.css", "https://example.com/b.js", "https://example.com/c.png"}
+	digests := parseCacheDigests([]string{cacheDigestFor(urls...)})
+	if len(digests) != 1 {
+		t.Fatalf("Expected 1 digest, got %d", len(digests))
+	}
+	for _, url := range urls {
+		if !digests[0].contains(url) {
+			t.Errorf("Expected digest to contain %s", url)
+		}
+	}
+	if digests[0].contains("https://example.com/d.html") {
+		t.Error("Expected digest not to contain https://example.com/d.html")
+	}
+	if got := parseCacheDigests([]string{"!!!", "AA; stale"}); len(got) != 0 {
+		t.Errorf("Expected invalid and stale digests to be ignored, got %v", got)
+	}
+}
+
+// cacheDigestFor encodes a Cache-Digest header value for urls,
+// with a false positive probability of 1/2^8.
+func cacheDigestFor(urls ...string) string {
+	const p = 8
+	var n uint
+	for 1<<n < len(urls) {
+		n++
+	}
+	var hashes []uint64
+	for _, url := range urls {
+		sum := sha256.Sum256([]byte(url))
+		hashes = append(hashes, binary.BigEndian.Uint64(sum[:8])>>(64-n-p))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	var bits []byte
+	writeBits := func(v uint64, width uint) {
+		for i := int(width) - 1; i >= 0; i-- {
+			bits = append(bits, byte(v>>uint(i)&1))
+		}
+	}
+	writeBits(uint64(n), 5)
+	writeBits(p, 5)
+	c := int64(-1)
+	for _, h := range hashes {
+		d := uint64(int64(h) - c - 1)
+		for q := d >> p; q > 0; q-- {
+			bits = append(bits, 0)
+		}
+		bits = append(bits, 1)
+		writeBits(d&(1<<p-1), p)
+		c = int64(h)
+	}
+	data := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		data[i/8] |= bit << (7 - uint(i)%8)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
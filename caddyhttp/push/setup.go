@@ -0,0 +1,66 @@
+package push
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("push", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Push middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := pushParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Push{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// pushParse parses the push directives. Without arguments, push
+// only pushes the preload links of responses; otherwise the first
+// argument is a path, and the others, or the lines of the block
+// after it, are the resources to push for requests matching it.
+func pushParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			if c.NextBlock() {
+				return rules, c.ArgErr()
+			}
+			continue
+		}
+
+		rule := Rule{Path: args[0]}
+		resources := args[1:]
+		for c.NextBlock() {
+			resources = append(resources, c.Val())
+			resources = append(resources, c.RemainingArgs()...)
+		}
+		if len(resources) == 0 {
+			return rules, c.Errf("No resources to push for '%s'", rule.Path)
+		}
+		for _, resource := range resources {
+			if !strings.HasPrefix(resource, "/") {
+				return rules, c.Errf("Resource to push must be a path on this site, got '%s'", resource)
+			}
+		}
+		rule.Resources = resources
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,76 @@
+package push
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `push /index.html /css/app.css`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Push)
+	if !ok {
+		t.Fatalf("Expected handler to be type Push, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestPushParse(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedRules []Rule
+	}{
+		{`push`, false, nil},
+		{`push /index.html /css/app.css /js/app.js`, false, []Rule{
+			{Path: "/index.html", Resources: []string{"/css/app.css", "/js/app.js"}},
+		}},
+		{`push /index.html /css/app.css {
+			/js/app.js
+			/img/a.png /img/b.png
+		}
+		push /blog /css/blog.css`, false, []Rule{
+			{Path: "/index.html", Resources: []string{"/css/app.css", "/js/app.js", "/img/a.png", "/img/b.png"}},
+			{Path: "/blog", Resources: []string{"/css/blog.css"}},
+		}},
+		{`push /index.html`, true, nil},
+		{`push /index.html app.css`, true, nil},
+		{`push /index.html {
+			https://example.com/app.css
+		}`, true, nil},
+		{`push {
+			/css/app.css
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		rules, err := pushParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expectedRules) {
+			t.Errorf("Test %d: Expected rules %v, got %v", i, test.expectedRules, rules)
+		}
+	}
+}
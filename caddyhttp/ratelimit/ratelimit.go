@@ -0,0 +1,139 @@
+// Package ratelimit implements the ratelimit directive, which
+// limits the rate of requests per client.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RateLimit is middleware that limits how many requests each
+// client may make to the paths of its rules.
+type RateLimit struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// Rule limits the requests to paths under Path to Rate per Per,
+// for each client, with bursts of up to Burst requests.
+type Rule struct {
+	Path  string
+	Rate  int
+	Per   time.Duration
+	Burst int
+
+	// TrustedProxies are the networks of proxies whose
+	// X-Forwarded-For header tells the client apart.
+	TrustedProxies []*net.IPNet
+
+	buckets *buckets
+}
+
+// BasePath satisfies httpserver.HandlerConfig.
+func (r Rule) BasePath() string { return r.Path }
+
+// Match satisfies httpserver.RequestMatcher.
+func (r Rule) Match(req *http.Request) bool {
+	return httpserver.Path(req.URL.Path).Matches(r.Path)
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (rl RateLimit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := httpserver.ConfigSelector(rl.Rules).Select(r)
+	if cfg == nil {
+		return rl.Next.ServeHTTP(w, r)
+	}
+	rule := cfg.(Rule)
+
+	client := httpserver.ForwardedClientIP(r, "X-Forwarded-For", rule.TrustedProxies)
+	if ok, retryAfter := rule.buckets.take(client, now()); !ok {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		return http.StatusTooManyRequests, nil
+	}
+	return rl.Next.ServeHTTP(w, r)
+}
+
+// now returns the current time; tests may replace it.
+var now = time.Now
+
+// sweepInterval is how often buckets that are full are dropped.
+// A full bucket is no different from one that doesn't exist yet,
+// so this bounds the memory of clients that went away.
+const sweepInterval = time.Minute
+
+// buckets are the token buckets of the clients of a rule,
+// refilled at rate tokens per second up to burst tokens.
+// They are safe for concurrent use.
+type buckets struct {
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+	byClient  map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket holds the tokens of a client as of when it was last
+// used. The tokens it gained since are added when it is used.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBuckets(rate int, per time.Duration, burst int) *buckets {
+	return &buckets{
+		rate:     float64(rate) / per.Seconds(),
+		burst:    float64(burst),
+		byClient: make(map[string]*bucket),
+	}
+}
+
+// take takes a token from the bucket of client at time t. If
+// there is none, it returns false and how long until there is.
+func (bs *buckets) take(client string, t time.Time) (bool, time.Duration) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if t.Sub(bs.lastSweep) >= sweepInterval {
+		bs.sweep(t)
+	}
+
+	b, ok := bs.byClient[client]
+	if !ok {
+		b = &bucket{tokens: bs.burst, last: t}
+		bs.byClient[client] = b
+	}
+	b.tokens = bs.refill(b, t)
+	b.last = t
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / bs.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill returns the tokens of b at time t.
+func (bs *buckets) refill(b *bucket, t time.Time) float64 {
+	elapsed := t.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(bs.burst, b.tokens+elapsed*bs.rate)
+}
+
+// sweep drops the buckets that are full at time t.
+func (bs *buckets) sweep(t time.Time) {
+	for client, b := range bs.byClient {
+		if bs.refill(b, t) >= bs.burst {
+			delete(bs.byClient, client)
+		}
+	}
+	bs.lastSweep = t
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRateLimitBurst(t *testing.T) {
+	start := time.Now()
+	defer func() { now = time.Now }()
+	now = func() time.Time { return start }
+
+	rl := RateLimit{
+		Next:  httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{Rule{Path: "/api", Rate: 1, Per: time.Second, Burst: 3, buckets: newBuckets(1, time.Second, 3)}},
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := serve(t, rl, "/api/x", "10.0.0.1:1234", ""); code != http.StatusOK {
+			t.Fatalf("Request %d within burst: expected %d, got %d", i, http.StatusOK, code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/x", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	code, _ := rl.ServeHTTP(rec, req)
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("Request over burst: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got '%s'", got)
+	}
+
+	// other clients and other paths are not limited
+	if code := serve(t, rl, "/api/x", "10.0.0.2:1234", ""); code != http.StatusOK {
+		t.Errorf("Other client: expected %d, got %d", http.StatusOK, code)
+	}
+	if code := serve(t, rl, "/static", "10.0.0.1:1234", ""); code != http.StatusOK {
+		t.Errorf("Other path: expected %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	current := time.Now()
+	defer func() { now = time.Now }()
+	now = func() time.Time { return current }
+
+	rl := RateLimit{
+		Next:  httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{Rule{Path: "/", Rate: 2, Per: time.Second, Burst: 2, buckets: newBuckets(2, time.Second, 2)}},
+	}
+
+	for i := 0; i < 2; i++ {
+		serve(t, rl, "/", "10.0.0.1:1234", "")
+	}
+	if code := serve(t, rl, "/", "10.0.0.1:1234", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected %d once empty, got %d", http.StatusTooManyRequests, code)
+	}
+
+	current = current.Add(500 * time.Millisecond)
+	if code := serve(t, rl, "/", "10.0.0.1:1234", ""); code != http.StatusOK {
+		t.Errorf("Expected %d after one token refilled, got %d", http.StatusOK, code)
+	}
+	if code := serve(t, rl, "/", "10.0.0.1:1234", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d after using the refilled token, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// a long pause refills no more than the burst
+	current = current.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if code := serve(t, rl, "/", "10.0.0.1:1234", ""); code != http.StatusOK {
+			t.Errorf("Request %d after refill: expected %d, got %d", i, http.StatusOK, code)
+		}
+	}
+	if code := serve(t, rl, "/", "10.0.0.1:1234", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d beyond the burst, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestRateLimitTrustedProxies(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	rl := RateLimit{
+		Next: httpserver.HandlerFunc(okHandler),
+		Rules: []httpserver.HandlerConfig{Rule{Path: "/", Rate: 1, Per: time.Minute, Burst: 1,
+			TrustedProxies: []*net.IPNet{proxies}, buckets: newBuckets(1, time.Minute, 1)}},
+	}
+
+	if code := serve(t, rl, "/", "10.0.0.1:1234", "203.0.113.1"); code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, code)
+	}
+	if code := serve(t, rl, "/", "10.0.0.1:1234", "203.0.113.2"); code != http.StatusOK {
+		t.Errorf("Other client behind the proxy: expected %d, got %d", http.StatusOK, code)
+	}
+	if code := serve(t, rl, "/", "10.0.0.2:1234", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Same client through another proxy: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+	// untrusted peers can't dodge the limit with a made up header
+	serve(t, rl, "/", "192.0.2.1:1234", "203.0.113.3")
+	if code := serve(t, rl, "/", "192.0.2.1:1234", "203.0.113.4"); code != http.StatusTooManyRequests {
+		t.Errorf("Untrusted peer: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestBucketsSweep(t *testing.T) {
+	bs := newBuckets(1, time.Second, 2)
+	start := time.Now()
+	bs.take("a", start)
+	bs.take("b", start.Add(sweepInterval-time.Second))
+	bs.take("b", start.Add(sweepInterval-time.Second))
+
+	// when sweeping, "a" is full again but "b" is not
+	bs.take("c", start.Add(sweepInterval))
+	if _, ok := bs.byClient["a"]; ok {
+		t.Error("Expected full bucket of a to be swept")
+	}
+	if _, ok := bs.byClient["b"]; !ok {
+		t.Error("Expected bucket of b to be kept")
+	}
+	if _, ok := bs.byClient["c"]; !ok {
+		t.Error("Expected bucket of c to be kept")
+	}
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return http.StatusOK, nil
+}
+
+func serve(t *testing.T, rl RateLimit, path, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	code, err := rl.ServeHTTP(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return code
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("ratelimit", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new RateLimit middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := rateLimitParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return RateLimit{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// rateLimitParse parses the ratelimit directives, each of which is
+// like "ratelimit /login 5 1m", which allows 5 requests per minute
+// to /login for each client. The block may set the burst, which is
+// the rate by default, and the networks of trusted proxies.
+func rateLimitParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 3 {
+			return rules, c.ArgErr()
+		}
+		rule := Rule{Path: args[0]}
+		rate, err := strconv.Atoi(args[1])
+		if err != nil || rate <= 0 {
+			return rules, c.Errf("Rate must be a positive number of requests, got '%s'", args[1])
+		}
+		rule.Rate, rule.Burst = rate, rate
+		rule.Per, err = time.ParseDuration(args[2])
+		if err != nil || rule.Per <= 0 {
+			return rules, c.Errf("Invalid interval '%s'", args[2])
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "burst":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				burst, err := strconv.Atoi(c.Val())
+				if err != nil || burst <= 0 {
+					return rules, c.Errf("Burst must be a positive number of requests, got '%s'", c.Val())
+				}
+				rule.Burst = burst
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			case "trusted":
+				cidrs := c.RemainingArgs()
+				if len(cidrs) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, cidr := range cidrs {
+					network, err := httpserver.ParseNetwork(cidr)
+					if err != nil {
+						return rules, c.Errf("invalid trusted proxy network '%s': %v", cidr, err)
+					}
+					rule.TrustedProxies = append(rule.TrustedProxies, network)
+				}
+			default:
+				return rules, c.Errf("Unknown ratelimit subdirective '%s'", c.Val())
+			}
+		}
+
+		rule.buckets = newBuckets(rule.Rate, rule.Per, rule.Burst)
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
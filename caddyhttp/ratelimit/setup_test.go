@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `ratelimit /login 5 1m`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(RateLimit)
+	if !ok {
+		t.Fatalf("Expected handler to be type RateLimit, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestRateLimitParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`ratelimit /login 5 1m`, false, []Rule{{Path: "/login", Rate: 5, Per: time.Minute, Burst: 5}}},
+		{`ratelimit / 100 1s {
+			burst 200
+		}
+		ratelimit /api 10 1h`, false, []Rule{
+			{Path: "/", Rate: 100, Per: time.Second, Burst: 200},
+			{Path: "/api", Rate: 10, Per: time.Hour, Burst: 10},
+		}},
+		{`ratelimit / 1 1s {
+			trusted 10.0.0.0/8 fd00::/8 192.0.2.1
+		}`, false, []Rule{{Path: "/", Rate: 1, Per: time.Second, Burst: 1, TrustedProxies: make([]*net.IPNet, 3)}}},
+		{`ratelimit`, true, nil},
+		{`ratelimit / 5`, true, nil},
+		{`ratelimit / 5 1m 10`, true, nil},
+		{`ratelimit / many 1m`, true, nil},
+		{`ratelimit / 0 1m`, true, nil},
+		{`ratelimit / 5 soon`, true, nil},
+		{`ratelimit / 5 0s`, true, nil},
+		{`ratelimit / 5 1m {
+			burst
+		}`, true, nil},
+		{`ratelimit / 5 1m {
+			burst -1
+		}`, true, nil},
+		{`ratelimit / 5 1m {
+			trusted 10.0.0.0/33
+		}`, true, nil},
+		{`ratelimit / 5 1m {
+			bogus
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		rules, err := rateLimitParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != len(test.expected) {
+			t.Fatalf("Test %d: Expected %d rules, got %d", i, len(test.expected), len(rules))
+		}
+		for j, cfg := range rules {
+			rule := cfg.(Rule)
+			want := test.expected[j]
+			if rule.Path != want.Path || rule.Rate != want.Rate || rule.Per != want.Per || rule.Burst != want.Burst {
+				t.Errorf("Test %d, rule %d: Expected %s %d/%v burst %d, got %s %d/%v burst %d", i, j,
+					want.Path, want.Rate, want.Per, want.Burst, rule.Path, rule.Rate, rule.Per, rule.Burst)
+			}
+			if len(rule.TrustedProxies) != len(want.TrustedProxies) {
+				t.Errorf("Test %d, rule %d: Expected %d trusted proxy networks, got %d",
+					i, j, len(want.TrustedProxies), len(rule.TrustedProxies))
+			}
+			if rule.buckets == nil {
+				t.Errorf("Test %d, rule %d: Expected buckets to be set up", i, j)
+			}
+		}
+	}
+}
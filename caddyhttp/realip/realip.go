@@ -0,0 +1,37 @@
+// Package realip implements the realip directive, which restores
+// the address of the client for requests that arrive through
+// trusted proxies or load balancers.
+package realip
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RealIP is middleware that replaces the remote address of requests
+// from trusted proxies with the client address they forwarded. Later
+// handlers, the {remote} placeholder and the logs all see the client.
+type RealIP struct {
+	Next httpserver.Handler
+
+	// Header lists the addresses a request was forwarded
+	// for, in X-Forwarded-For format.
+	Header string
+
+	// From are the networks of the trusted proxies. Requests
+	// from any other peer are left alone.
+	From []*net.IPNet
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (rip RealIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err == nil {
+		if ip := httpserver.ForwardedClientIP(r, rip.Header, rip.From); ip != host {
+			r.RemoteAddr = net.JoinHostPort(ip, port)
+		}
+	}
+	return rip.Next.ServeHTTP(w, r)
+}
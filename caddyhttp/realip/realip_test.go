@@ -0,0 +1,86 @@
+package realip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRealIP(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	_, local, _ := net.ParseCIDR("192.168.0.0/16")
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		// untrusted peers can't pick their address
+		{"1.2.3.4:80", []string{"5.6.7.8"}, "1.2.3.4:80"},
+		{"10.0.0.1:80", nil, "10.0.0.1:80"},
+		{"10.0.0.1:80", []string{"5.6.7.8"}, "5.6.7.8:80"},
+		// the rightmost untrusted address is the client; anything
+		// left of it was sent by the client and could be spoofed
+		{"10.0.0.1:80", []string{"1.2.3.4, 5.6.7.8, 192.168.0.1"}, "5.6.7.8:80"},
+		{"10.0.0.1:80", []string{"1.2.3.4", "5.6.7.8, 10.0.0.2"}, "5.6.7.8:80"},
+		{"10.0.0.1:80", []string{"192.168.0.2, 10.0.0.2"}, "192.168.0.2:80"},
+		{"10.0.0.1:80", []string{"2001:db8::1"}, "[2001:db8::1]:80"},
+		{"10.0.0.1:80", []string{"5.6.7.8, garbage, 10.0.0.2"}, "10.0.0.2:80"},
+		{"10.0.0.1:80", []string{"unknown"}, "10.0.0.1:80"},
+	}
+
+	for i, test := range tests {
+		var remoteAddr string
+		rip := RealIP{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				remoteAddr = r.RemoteAddr
+				return 0, nil
+			}),
+			Header: "X-Forwarded-For",
+			From:   []*net.IPNet{private, local},
+		}
+
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.RemoteAddr = test.remoteAddr
+		for _, fwd := range test.forwardedFor {
+			req.Header.Add("X-Forwarded-For", fwd)
+		}
+
+		rip.ServeHTTP(httptest.NewRecorder(), req)
+		if remoteAddr != test.expected {
+			t.Errorf("Test %d: expected remote address %s, got %s", i, test.expected, remoteAddr)
+		}
+	}
+}
+
+func TestRealIPCustomHeader(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	var remoteAddr string
+	rip := RealIP{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			remoteAddr = r.RemoteAddr
+			return 0, nil
+		}),
+		Header: "X-Real-IP",
+		From:   []*net.IPNet{private},
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	req.RemoteAddr = "10.0.0.1:80"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Real-IP", "5.6.7.8")
+
+	rip.ServeHTTP(httptest.NewRecorder(), req)
+	if expected := "5.6.7.8:80"; remoteAddr != expected {
+		t.Errorf("Expected remote address %s, got %s", expected, remoteAddr)
+	}
+}
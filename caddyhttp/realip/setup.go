@@ -0,0 +1,78 @@
+package realip
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("realip", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new realip middleware instance.
+func setup(c *caddy.Controller) error {
+	rip, err := realIPParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		rip.Next = next
+		return rip
+	})
+
+	return nil
+}
+
+func realIPParse(c *caddy.Controller) (RealIP, error) {
+	rip := RealIP{Header: "X-Forwarded-For"}
+
+	for c.Next() {
+		if err := addNetworks(c, &rip, c.RemainingArgs()); err != nil {
+			return rip, err
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "from":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return rip, c.ArgErr()
+				}
+				if err := addNetworks(c, &rip, args); err != nil {
+					return rip, err
+				}
+			case "header":
+				if !c.NextArg() {
+					return rip, c.ArgErr()
+				}
+				rip.Header = c.Val()
+				if c.NextArg() {
+					return rip, c.ArgErr()
+				}
+			default:
+				return rip, c.Errf("Unknown realip subdirective '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(rip.From) == 0 {
+		return rip, c.Err("realip needs at least one trusted proxy network")
+	}
+	return rip, nil
+}
+
+// addNetworks parses each of args as a CIDR range or a single
+// ip address and adds it to the trusted networks of rip.
+func addNetworks(c *caddy.Controller, rip *RealIP, args []string) error {
+	for _, arg := range args {
+		network, err := httpserver.ParseNetwork(arg)
+		if err != nil {
+			return c.Errf("invalid trusted proxy network '%s': %v", arg, err)
+		}
+		rip.From = append(rip.From, network)
+	}
+	return nil
+}
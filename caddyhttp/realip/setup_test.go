@@ -0,0 +1,91 @@
+package realip
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `realip 10.0.0.0/8`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, but had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(RealIP)
+	if !ok {
+		t.Fatalf("Expected handler to be type RealIP, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestRealIPParse(t *testing.T) {
+	tests := []struct {
+		input          string
+		shouldErr      bool
+		expectedHeader string
+		expectedFrom   []string
+	}{
+		{`realip 10.0.0.0/8 192.168.0.0/16`, false, "X-Forwarded-For", []string{"10.0.0.0/8", "192.168.0.0/16"}},
+		{`realip 10.0.0.1 ::1`, false, "X-Forwarded-For", []string{"10.0.0.1/32", "::1/128"}},
+		{`realip {
+			from 10.0.0.0/8
+			from 172.16.0.0/12 fd00::/8
+			header X-Real-IP
+		}`, false, "X-Real-IP", []string{"10.0.0.0/8", "172.16.0.0/12", "fd00::/8"}},
+		{`realip 10.0.0.0/8 {
+			header X-Real-IP
+		}`, false, "X-Real-IP", []string{"10.0.0.0/8"}},
+		{`realip`, true, "", nil},
+		{`realip {
+			header X-Real-IP
+		}`, true, "", nil},
+		{`realip 10.0.0.0/33`, true, "", nil},
+		{`realip example.com`, true, "", nil},
+		{`realip {
+			from
+		}`, true, "", nil},
+		{`realip 10.0.0.0/8 {
+			header
+		}`, true, "", nil},
+		{`realip 10.0.0.0/8 {
+			header A B
+		}`, true, "", nil},
+		{`realip 10.0.0.0/8 {
+			trust everyone
+		}`, true, "", nil},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		rip, err := realIPParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if rip.Header != test.expectedHeader {
+			t.Errorf("Test %d: expected header %s, got %s", i, test.expectedHeader, rip.Header)
+		}
+		if len(rip.From) != len(test.expectedFrom) {
+			t.Fatalf("Test %d: expected %d networks, got %d", i, len(test.expectedFrom), len(rip.From))
+		}
+		for j, network := range rip.From {
+			if network.String() != test.expectedFrom[j] {
+				t.Errorf("Test %d: expected network %d to be %s, got %s", i, j, test.expectedFrom[j], network)
+			}
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"net/url"
+	"regexp"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -19,8 +21,26 @@ type Redirect struct {
 // ServeHTTP implements the httpserver.Handler interface.
 func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, rule := range rd.Rules {
-		if (rule.FromPath == "/" || r.URL.Path == rule.FromPath) && schemeMatches(rule, r) && rule.Match(r) {
-			to := httpserver.NewReplacer(r, nil, "").Replace(rule.To)
+		var match []int
+		if rule.FromRegexp != nil {
+			match = rule.FromRegexp.FindStringSubmatchIndex(r.URL.Path)
+			if match == nil {
+				continue
+			}
+		} else if rule.FromPath != "/" && r.URL.Path != rule.FromPath {
+			continue
+		}
+		if schemeMatches(rule, r) && rule.Match(r) {
+			to := rule.To
+			if match != nil {
+				// substitute capture groups, like $1 or ${name}, before
+				// the placeholders, so a $ in what they expand to is kept
+				to = string(rule.FromRegexp.ExpandString(nil, to, r.URL.Path, match))
+			}
+			to = httpserver.NewReplacer(r, nil, "").Replace(to)
+			if !rule.DropQuery {
+				to = withQuery(to, r.URL.RawQuery)
+			}
 			if rule.Meta {
 				safeTo := html.EscapeString(to)
 				fmt.Fprintf(w, metaRedir, safeTo, safeTo)
@@ -33,16 +53,50 @@ func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	return rd.Next.ServeHTTP(w, r)
 }
 
+// withQuery adds the query string query to the target to. If to has
+// a query string of its own, the two are merged, with the parameters
+// of to taking precedence.
+func withQuery(to, query string) string {
+	if query == "" {
+		return to
+	}
+	u, err := url.Parse(to)
+	if err != nil {
+		return to
+	}
+	if u.RawQuery == query {
+		return to // e.g. a target of {uri}
+	}
+	if u.RawQuery == "" {
+		u.RawQuery = query
+		return u.String()
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return to
+	}
+	for key, vals := range u.Query() {
+		values[key] = vals
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
 func schemeMatches(rule Rule, req *http.Request) bool {
 	return (rule.FromScheme == "https" && req.TLS != nil) ||
 		(rule.FromScheme != "https" && req.TLS == nil)
 }
 
-// Rule describes an HTTP redirect rule.
+// Rule describes an HTTP redirect rule. If FromRegexp is set,
+// it is matched against the request path instead of FromPath,
+// and To may refer to its capture groups. The query string of
+// the request is kept, unless DropQuery is true.
 type Rule struct {
 	FromScheme, FromPath, To string
+	FromRegexp               *regexp.Regexp
 	Code                     int
 	Meta                     bool
+	DropQuery                bool
 	httpserver.RequestMatcher
 }
 
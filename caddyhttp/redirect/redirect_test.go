@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -22,7 +23,7 @@ func TestRedirect(t *testing.T) {
 		{"http://localhost/a", "/b", http.StatusTemporaryRedirect},
 		{"http://localhost/aa", "", http.StatusOK},
 		{"http://localhost/", "", http.StatusOK},
-		{"http://localhost/a?foo=bar", "/b", http.StatusTemporaryRedirect},
+		{"http://localhost/a?foo=bar", "/b?foo=bar", http.StatusTemporaryRedirect},
 		{"http://localhost/asdf?foo=bar", "", http.StatusOK},
 		{"http://localhost/foo#bar", "", http.StatusOK},
 		{"http://localhost/a#foo", "/b", http.StatusTemporaryRedirect},
@@ -152,3 +153,82 @@ func TestMetaRedirect(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexpRedirect(t *testing.T) {
+	re := Redirect{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{FromRegexp: regexp.MustCompile(`^/blog/2019/(.*)$`), To: "/posts/$1", Code: http.StatusMovedPermanently, RequestMatcher: httpserver.IfMatcher{}},
+			{FromRegexp: regexp.MustCompile(`^/u/(?P<user>[a-z]+)$`), To: "https://{host}/users/${user}", Code: http.StatusFound, RequestMatcher: httpserver.IfMatcher{}},
+			{FromRegexp: regexp.MustCompile(`^/s/(.*)$`), To: "/find/$1?{query}", Code: http.StatusFound, DropQuery: true, RequestMatcher: httpserver.IfMatcher{}},
+		},
+	}
+
+	for i, test := range []struct {
+		from             string
+		expectedLocation string
+		expectedCode     int
+	}{
+		{"http://localhost/blog/2019/hello-world", "/posts/hello-world", http.StatusMovedPermanently},
+		{"http://localhost/blog/2019/", "/posts/", http.StatusMovedPermanently},
+		{"http://localhost/blog/2020/hello-world", "", http.StatusOK},
+		{"http://localhost/u/alice", "https://localhost/users/alice", http.StatusFound},
+		{"http://localhost/u/Alice", "", http.StatusOK},
+		{"http://localhost/s/go?$1", "/find/go?$1", http.StatusFound}, // placeholders are not expanded again
+	} {
+		req, err := http.NewRequest("GET", test.from, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Location"); got != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location header to be %q but was %q", i, test.expectedLocation, got)
+		}
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestRedirectQuery(t *testing.T) {
+	re := Redirect{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{FromPath: "/keep", To: "/new", Code: http.StatusMovedPermanently, RequestMatcher: httpserver.IfMatcher{}},
+			{FromPath: "/merge", To: "/new?a=target&c=3", Code: http.StatusMovedPermanently, RequestMatcher: httpserver.IfMatcher{}},
+			{FromPath: "/drop", To: "/new", Code: http.StatusMovedPermanently, DropQuery: true, RequestMatcher: httpserver.IfMatcher{}},
+			{FromPath: "/uri", To: "https://example.com{uri}", Code: http.StatusMovedPermanently, RequestMatcher: httpserver.IfMatcher{}},
+		},
+	}
+
+	for i, test := range []struct {
+		from             string
+		expectedLocation string
+	}{
+		{"http://localhost/keep?utm_source=x&b=2", "/new?utm_source=x&b=2"},
+		{"http://localhost/keep", "/new"},
+		{"http://localhost/merge?a=source&b=2", "/new?a=target&b=2&c=3"},
+		{"http://localhost/merge", "/new?a=target&c=3"},
+		{"http://localhost/drop?utm_source=x", "/new"},
+		{"http://localhost/uri?z=1&a=2", "https://example.com/uri?z=1&a=2"},
+	} {
+		req, err := http.NewRequest("GET", test.from, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Location"); got != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location header to be %q but was %q", i, test.expectedLocation, got)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package redirect
 
 import (
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -45,6 +47,16 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 			to   string
 			code = defaultCode
 		)
+
+		// A regexp 'from' must always be specified
+		isRegexp := len(args) > 0 && args[0] == "regexp"
+		if isRegexp {
+			args = args[1:]
+			if len(args) < 2 {
+				return c.ArgErr()
+			}
+		}
+
 		switch len(args) {
 		case 1:
 			// To specified (catch-all redirect)
@@ -66,6 +78,18 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 
 		rule.FromPath = from
 		rule.To = to
+		if strings.HasSuffix(to, "?") {
+			// a trailing ? drops the query string of the request
+			rule.To = strings.TrimSuffix(to, "?")
+			rule.DropQuery = true
+		}
+		if isRegexp {
+			re, err := regexp.Compile(from)
+			if err != nil {
+				return c.Errf("Invalid redirect regexp '%s': %v", from, err)
+			}
+			rule.FromRegexp = re
+		}
 		if code == "meta" {
 			rule.Meta = true
 			code = defaultCode
@@ -2,6 +2,7 @@ package redirect
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -65,6 +66,25 @@ func TestSetup(t *testing.T) {
 				matcher, _ := httpserver.SetupIfMatcher(c)
 				return matcher.(httpserver.IfMatcher)
 			}()}}},
+
+		// test case #13 tests the recognition of a regexp redirection in a non-block statement
+		{"redir regexp ^/blog/2019/(.*)$ /posts/$1 302", false, []Rule{{FromPath: "^/blog/2019/(.*)$", To: "/posts/$1", Code: 302,
+			FromRegexp: regexp.MustCompile("^/blog/2019/(.*)$"), RequestMatcher: httpserver.IfMatcher{}}}},
+
+		// test case #14 tests the recognition of regexp and literal redirections in a block statement
+		{"redir {\n regexp ^/a/(?P<name>.+) /b/${name}\n /c /d\n}", false, []Rule{
+			{FromPath: "^/a/(?P<name>.+)", To: "/b/${name}", Code: 301,
+				FromRegexp: regexp.MustCompile("^/a/(?P<name>.+)"), RequestMatcher: httpserver.IfMatcher{}},
+			{FromPath: "/c", To: "/d", Code: 301, RequestMatcher: httpserver.IfMatcher{}}}},
+
+		// test case #15 tests the detection of an invalid regexp
+		{"redir regexp ^/blog/(.*$ /posts/$1", true, []Rule{{}}},
+
+		// test case #16 tests the detection of a regexp redirection without a 'to' value
+		{"redir regexp ^/blog/(.*)$", true, []Rule{{}}},
+
+		// test case #17 tests that a trailing ? on the 'to' value drops the query string
+		{"redir /old /new?", false, []Rule{{FromPath: "/old", To: "/new", Code: 301, DropQuery: true, RequestMatcher: httpserver.IfMatcher{}}}},
 	} {
 		c := caddy.NewTestController("http", test.input)
 		err := setup(c)
@@ -86,6 +106,12 @@ func TestSetup(t *testing.T) {
 			if recievedRule.Code != test.expectedRules[i].Code {
 				t.Errorf("Test case #%d.%d expected a HTTP status code of %d, but recieved a code of %d", j, i, test.expectedRules[i].Code, recievedRule.Code)
 			}
+			if fmt.Sprint(recievedRule.FromRegexp) != fmt.Sprint(test.expectedRules[i].FromRegexp) {
+				t.Errorf("Test case #%d.%d expected a from regexp of %v, but recieved %v", j, i, test.expectedRules[i].FromRegexp, recievedRule.FromRegexp)
+			}
+			if recievedRule.DropQuery != test.expectedRules[i].DropQuery {
+				t.Errorf("Test case #%d.%d expected DropQuery to be %t, but was %t", j, i, test.expectedRules[i].DropQuery, recievedRule.DropQuery)
+			}
 			if gotMatcher, expectMatcher := fmt.Sprint(recievedRule.RequestMatcher), fmt.Sprint(test.expectedRules[i].RequestMatcher); gotMatcher != expectMatcher {
 				t.Errorf("Test case #%d.%d expected a Matcher %s, but recieved a Matcher %s", j, i, expectMatcher, gotMatcher)
 			}
@@ -0,0 +1,71 @@
+// Package requestid implements the requestid directive, which gives
+// every request a unique ID for tracing it through logs and proxies.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// maxIDLength is the longest incoming request ID that is reused.
+const maxIDLength = 128
+
+// RequestID is middleware that makes sure every request has an ID.
+// An ID sent by the client (or a proxy in front of Caddy) in Header
+// is reused; otherwise a random one is generated. The ID is stored
+// in the request context, where the {request_id} placeholder finds
+// it, and in Header of the request, so the proxy passes it upstream.
+type RequestID struct {
+	Next   httpserver.Handler
+	Header string
+
+	// Echo sets Header on the response too.
+	Echo bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (rid RequestID) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	id := r.Header.Get(rid.Header)
+	if !validID(id) {
+		var err error
+		id, err = newID()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		r.Header.Set(rid.Header, id)
+	}
+	if rid.Echo {
+		w.Header().Set(rid.Header, id)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.RequestIDCtxKey, id))
+	return rid.Next.ServeHTTP(w, r)
+}
+
+// validID returns true if id can be reused as is. IDs end up in
+// logs and headers, so only short, printable ones are accepted.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a random (version 4) UUID.
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
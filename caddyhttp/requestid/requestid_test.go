@@ -0,0 +1,107 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		incoming string
+		reused   bool
+	}{
+		{"", false},
+		{"abc123", true},
+		{"contains space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", maxIDLength), true},
+		{strings.Repeat("a", maxIDLength+1), false},
+	}
+
+	for i, test := range tests {
+		var placeholder, upstream string
+		rid := RequestID{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				placeholder = httpserver.NewReplacer(r, nil, "").Replace("{request_id}")
+				upstream = r.Header.Get("X-Request-ID")
+				return 0, nil
+			}),
+			Header: "X-Request-ID",
+			Echo:   true,
+		}
+
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		if test.incoming != "" {
+			req.Header["X-Request-Id"] = []string{test.incoming}
+		}
+		rec := httptest.NewRecorder()
+		rid.ServeHTTP(rec, req)
+
+		if test.reused && placeholder != test.incoming {
+			t.Errorf("Test %d: expected incoming ID to be reused, got '%s'", i, placeholder)
+		}
+		if !test.reused && !uuidPattern.MatchString(placeholder) {
+			t.Errorf("Test %d: expected a generated ID, got '%s'", i, placeholder)
+		}
+		if upstream != placeholder {
+			t.Errorf("Test %d: expected request header to carry '%s', got '%s'", i, placeholder, upstream)
+		}
+		if got := rec.Header().Get("X-Request-ID"); got != placeholder {
+			t.Errorf("Test %d: expected response header '%s', got '%s'", i, placeholder, got)
+		}
+	}
+}
+
+func TestRequestIDCustomHeader(t *testing.T) {
+	var placeholder string
+	rid := RequestID{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			placeholder = httpserver.NewReplacer(r, nil, "").Replace("{request_id}")
+			return 0, nil
+		}),
+		Header: "X-Trace",
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	req.Header.Set("X-Trace", "trace-1")
+	req.Header.Set("X-Request-ID", "ignored")
+	rec := httptest.NewRecorder()
+	rid.ServeHTTP(rec, req)
+
+	if placeholder != "trace-1" {
+		t.Errorf("Expected ID from the configured header, got '%s'", placeholder)
+	}
+	if got := rec.Header().Get("X-Trace"); got != "" {
+		t.Errorf("Expected no response header without echo, got '%s'", got)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := newID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidPattern.MatchString(id) {
+			t.Errorf("Expected a version 4 UUID, got '%s'", id)
+		}
+		if seen[id] {
+			t.Errorf("Got duplicate ID '%s'", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,56 @@
+package requestid
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("requestid", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new requestid middleware instance.
+func setup(c *caddy.Controller) error {
+	rid, err := requestIDParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		rid.Next = next
+		return rid
+	})
+
+	return nil
+}
+
+func requestIDParse(c *caddy.Controller) (RequestID, error) {
+	rid := RequestID{Header: "X-Request-ID"}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rid.Header = args[0]
+		default:
+			return rid, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "echo":
+				if c.NextArg() {
+					return rid, c.ArgErr()
+				}
+				rid.Echo = true
+			default:
+				return rid, c.Errf("Unknown requestid subdirective '%s'", c.Val())
+			}
+		}
+	}
+
+	return rid, nil
+}
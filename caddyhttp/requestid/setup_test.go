@@ -0,0 +1,69 @@
+package requestid
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `requestid`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, but had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(RequestID)
+	if !ok {
+		t.Fatalf("Expected handler to be type RequestID, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestRequestIDParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  RequestID
+	}{
+		{`requestid`, false, RequestID{Header: "X-Request-ID"}},
+		{`requestid X-Trace-ID`, false, RequestID{Header: "X-Trace-ID"}},
+		{`requestid {
+			echo
+		}`, false, RequestID{Header: "X-Request-ID", Echo: true}},
+		{`requestid X-Trace-ID {
+			echo
+		}`, false, RequestID{Header: "X-Trace-ID", Echo: true}},
+		{`requestid A B`, true, RequestID{}},
+		{`requestid {
+			echo yes
+		}`, true, RequestID{}},
+		{`requestid {
+			generate
+		}`, true, RequestID{}},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		rid, err := requestIDParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if rid.Header != test.expected.Header || rid.Echo != test.expected.Echo {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, rid)
+		}
+	}
+}
@@ -36,6 +36,11 @@ type Rewrite struct {
 
 // ServeHTTP implements the httpserver.Handler interface.
 func (rw Rewrite) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		rw.FileSys = http.Dir(root)
+	}
+
 	if rule := httpserver.ConfigSelector(rw.Rules).Select(r); rule != nil {
 		switch result := rule.(Rule).Rewrite(rw.FileSys, r); result {
 		case RewriteStatus:
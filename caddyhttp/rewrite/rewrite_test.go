@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -157,6 +158,56 @@ func TestRewrite(t *testing.T) {
 	}
 }
 
+func TestConditionalRewrite(t *testing.T) {
+	// the second directive sees the query set by the first one
+	configs := []string{
+		`rewrite {
+			if {>X-Device} is mobile
+			to /m{path}?view=mobile
+		}`,
+		`rewrite {
+			if {?view} is mobile
+			if {>X-Beta} is on
+			if_op or
+			to /v2{path}?{query}
+		}`,
+	}
+	var next httpserver.Handler = httpserver.HandlerFunc(urlPrinter)
+	for i := len(configs) - 1; i >= 0; i-- {
+		rules, err := rewriteParse(caddy.NewTestController("http", configs[i]))
+		if err != nil {
+			t.Fatalf("Config %d: unexpected error: %v", i, err)
+		}
+		next = Rewrite{Next: next, Rules: rules, FileSys: http.Dir(".")}
+	}
+
+	tests := []struct {
+		url      string
+		headers  map[string]string
+		expectTo string
+	}{
+		{"/page", nil, "/page"},
+		{"/page", map[string]string{"X-Device": "mobile"}, "/v2/m/page?view=mobile"},
+		{"/page", map[string]string{"X-Beta": "on"}, "/v2/page"},
+		{"/page?view=mobile", nil, "/v2/page?view=mobile"},
+		{"/page?view=desktop", map[string]string{"X-Device": "tablet"}, "/page?view=desktop"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: could not create request: %v", i, err)
+		}
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != test.expectTo {
+			t.Errorf("Test %d: expected URL to be '%s' but was '%s'", i, test.expectTo, got)
+		}
+	}
+}
+
 func urlPrinter(w http.ResponseWriter, r *http.Request) (int, error) {
 	fmt.Fprint(w, r.URL.String())
 	return 0, nil
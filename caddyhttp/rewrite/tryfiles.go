@@ -0,0 +1,76 @@
+package rewrite
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("try_files", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupTryFiles,
+	})
+}
+
+// TryFilesRule rewrites requests to the first of its candidate
+// paths that exists, or to the last one if none does. This lets
+// single-page apps fall back to their index for unknown paths.
+type TryFilesRule struct {
+	Candidates []string
+}
+
+// BasePath satisfies httpserver.Config
+func (t TryFilesRule) BasePath() string { return "/" }
+
+// Match satisfies httpserver.Config
+func (t TryFilesRule) Match(r *http.Request) bool { return true }
+
+// Rewrite rewrites the internal location of the current request.
+// The last candidate is used even if it doesn't exist, so there
+// is nothing to try again if it is missing.
+func (t TryFilesRule) Rewrite(fs http.FileSystem, r *http.Request) Result {
+	return To(fs, r, strings.Join(t.Candidates, " "), newReplacer(r))
+}
+
+// setupTryFiles configures a new Rewrite middleware instance
+// for the try_files directive, like "try_files {path} /index.html".
+func setupTryFiles(c *caddy.Controller) error {
+	rule, err := tryFilesParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Rewrite{
+			Next:    next,
+			FileSys: http.Dir(cfg.Root),
+			Rules:   []httpserver.HandlerConfig{rule},
+		}
+	})
+
+	return nil
+}
+
+func tryFilesParse(c *caddy.Controller) (TryFilesRule, error) {
+	var rule TryFilesRule
+
+	for c.Next() {
+		if len(rule.Candidates) > 0 {
+			return rule, c.Err("try_files can only be used once per site")
+		}
+		rule.Candidates = c.RemainingArgs()
+		if len(rule.Candidates) == 0 {
+			return rule, c.ArgErr()
+		}
+		if c.NextBlock() {
+			return rule, c.ArgErr()
+		}
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,108 @@
+package rewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupTryFiles(t *testing.T) {
+	c := caddy.NewTestController("http", `try_files {path} /index.html`)
+	err := setupTryFiles(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Rewrite)
+	if !ok {
+		t.Fatalf("Expected handler to be type Rewrite, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestTryFilesParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`try_files {path} {path}/ /index.html`, false, []string{"{path}", "{path}/", "/index.html"}},
+		{`try_files /index.html`, false, []string{"/index.html"}},
+		{`try_files`, true, nil},
+		{`try_files {path} {
+			/index.html
+		}`, true, nil},
+		{`try_files {path} /index.html
+		  try_files /other.html`, true, nil},
+	}
+	for i, test := range tests {
+		rule, err := tryFilesParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rule.Candidates, test.expected) {
+			t.Errorf("Test %d: Expected candidates %v, got %v", i, test.expected, rule.Candidates)
+		}
+	}
+}
+
+func TestTryFiles(t *testing.T) {
+	rw := Rewrite{
+		Next:    httpserver.HandlerFunc(urlPrinter),
+		FileSys: http.Dir("testdata"),
+		Rules:   []httpserver.HandlerConfig{TryFilesRule{[]string{"{path}", "{path}/", "/index.html"}}},
+	}
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/testfile", "/testfile"},
+		{"/testdir", "/testdir/"},
+		{"/app/route", "/index.html"},
+		{"/app/route?page=2", "/index.html?page=2"},
+		{"/index.html", "/index.html"}, // missing fallback is passed on
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		rec := httptest.NewRecorder()
+		rw.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected URL '%s', got '%s'", i, test.expected, got)
+		}
+	}
+}
+
+func TestTryFilesRequestRoot(t *testing.T) {
+	rw := Rewrite{
+		Next:    httpserver.HandlerFunc(urlPrinter),
+		FileSys: http.Dir("{host}"),
+		Rules:   []httpserver.HandlerConfig{TryFilesRule{[]string{"{path}", "/index.html"}}},
+	}
+	req := httptest.NewRequest("GET", "/testfile", nil)
+	req = req.WithContext(context.WithValue(req.Context(), httpserver.RootCtxKey, "testdata"))
+	rec := httptest.NewRecorder()
+	rw.ServeHTTP(rec, req)
+	if got, want := rec.Body.String(), "/testfile"; got != want {
+		t.Errorf("Expected URL '%s' from the root of the request, got '%s'", want, got)
+	}
+}
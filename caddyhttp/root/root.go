@@ -3,6 +3,7 @@ package root
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -25,6 +26,11 @@ func setupRoot(c *caddy.Controller) error {
 		config.Root = c.Val()
 	}
 
+	// A root with placeholders is only known per request
+	if strings.Contains(config.Root, "{") {
+		return nil
+	}
+
 	// Check if root path exists
 	_, err := os.Stat(config.Root)
 	if err != nil {
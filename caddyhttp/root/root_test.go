@@ -48,6 +48,9 @@ func TestRoot(t *testing.T) {
 		{
 			fmt.Sprintf(`root %s`, existingDirPath), false, existingDirPath, "",
 		},
+		{
+			`root /var/www/{hostonly}`, false, "/var/www/{hostonly}", "",
+		},
 		// negative
 		{
 			`root `, true, "", parseErrContent,
@@ -0,0 +1,31 @@
+package serverheader
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("server_header", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupServerHeader,
+	})
+}
+
+// setupServerHeader sets the Server header of all the responses
+// of the site, including proxied ones, or removes it if the value
+// is empty, like:
+//
+//	server_header ""
+func setupServerHeader(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		var value string
+		if !c.Args(&value) || c.NextArg() {
+			return c.ArgErr()
+		}
+		config.ServerHeader = value
+		config.ServerHeaderSet = true
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package serverheader
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupServerHeader(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expected    string
+		expectedSet bool
+	}{
+		{`server_header MyServer`, false, "MyServer", true},
+		{`server_header "My Server/1.0"`, false, "My Server/1.0", true},
+		{`server_header ""`, false, "", true},
+		{`server_header`, true, "", false},
+		{`server_header a b`, true, "", false},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupServerHeader(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		cfg := httpserver.GetConfig(c)
+		if cfg.ServerHeader != test.expected || cfg.ServerHeaderSet != test.expectedSet {
+			t.Errorf("Test %d: expected Server header %q (set: %v), got %q (set: %v)",
+				i, test.expected, test.expectedSet, cfg.ServerHeader, cfg.ServerHeaderSet)
+		}
+	}
+}
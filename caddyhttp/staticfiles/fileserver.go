@@ -3,6 +3,7 @@ package staticfiles
 import (
 	"fmt"
 	"math/rand"
+	"mime"
 	"net/http"
 	"os"
 	"path"
@@ -29,6 +30,13 @@ type FileServer struct {
 
 	// List of files to treat as "Not Found"
 	Hide []string
+
+	// Whether to leave out the ETag header
+	DisableETags bool
+
+	// Files to serve for a directory, the first one
+	// that exists; IndexPages if empty
+	IndexPages []string
 }
 
 // ServeHTTP serves static files for r according to fs's configuration.
@@ -94,7 +102,11 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name stri
 
 	// use contents of an index file, if present, for directory
 	if d.IsDir() {
-		for _, indexPage := range IndexPages {
+		indexPages := fs.IndexPages
+		if len(indexPages) == 0 {
+			indexPages = IndexPages
+		}
+		for _, indexPage := range indexPages {
 			index := strings.TrimSuffix(name, "/") + "/" + indexPage
 			ff, err := fs.Root.Open(index)
 			if err == nil {
@@ -122,10 +134,31 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name stri
 		return http.StatusNotFound, nil
 	}
 
-	// Experimental ETag header
-	e := fmt.Sprintf(`W/"%x-%x"`, d.ModTime().Unix(), d.Size())
-	w.Header().Set("ETag", e)
+	// Serve a sibling that was compressed ahead of time instead,
+	// if the client accepts its encoding
+	if encoding, ok := r.Context().Value(PrecompressedCtxKey).(string); ok {
+		if cf, cd, ok := fs.precompressed(name, encoding); ok {
+			defer cf.Close()
+			ctype := mime.TypeByExtension(path.Ext(name))
+			if ctype == "" {
+				ctype = "application/octet-stream"
+			}
+			w.Header().Set("Content-Type", ctype)
+			w.Header().Set("Content-Encoding", encoding)
+			w.Header().Add("Vary", "Accept-Encoding")
+			f, d = cf, cd
+		}
+	}
+
+	// The ETag is weak, since a file could change without
+	// changing its size within the resolution of its mod time
+	if !fs.DisableETags {
+		e := fmt.Sprintf(`W/"%x-%x"`, d.ModTime().Unix(), d.Size())
+		w.Header().Set("ETag", e)
+	}
 
+	// ServeContent handles conditional requests (If-Modified-Since,
+	// If-None-Match, etc.) and ranges, and sets Last-Modified.
 	// Note: Errors generated by ServeContent are written immediately
 	// to the response. This usually only happens if seeking fails (rare).
 	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
@@ -133,6 +166,25 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name stri
 	return http.StatusOK, nil
 }
 
+// precompressed opens the sibling of the file name that is
+// compressed with encoding, if there is one and it is not hidden.
+func (fs FileServer) precompressed(name, encoding string) (http.File, os.FileInfo, bool) {
+	ext, ok := precompressedExts[encoding]
+	if !ok {
+		return nil, nil, false
+	}
+	f, err := fs.Root.Open(name + ext)
+	if err != nil {
+		return nil, nil, false
+	}
+	d, err := f.Stat()
+	if err != nil || d.IsDir() || fs.isHidden(d) {
+		f.Close()
+		return nil, nil, false
+	}
+	return f, d, true
+}
+
 // isHidden checks if file with FileInfo d is on hide list.
 func (fs FileServer) isHidden(d os.FileInfo) bool {
 	// If the file is supposed to be hidden, return a 404
@@ -159,6 +211,20 @@ func Redirect(w http.ResponseWriter, r *http.Request, newPath string, statusCode
 	http.Redirect(w, r, newPath, statusCode)
 }
 
+// PrecompressedCtxKey is the context key for the encoding, such
+// as "gzip" or "br", in which files that were compressed ahead of
+// time may be served. It is set by the gzip and brotli middleware.
+const PrecompressedCtxKey ctxKey = "precompressed"
+
+type ctxKey string
+
+// precompressedExts maps each encoding to the file
+// extension of files compressed with it.
+var precompressedExts = map[string]string{
+	"gzip": ".gz",
+	"br":   ".br",
+}
+
 // IndexPages is a list of pages that may be understood as
 // the "index" files to directories.
 var IndexPages = []string{
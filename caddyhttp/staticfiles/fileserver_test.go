@@ -1,7 +1,9 @@
 package staticfiles
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -193,6 +195,185 @@ func TestServeHTTP(t *testing.T) {
 
 }
 
+func TestServeHTTPPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_precompressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"app.js":       "plain",
+		"app.js.gz":    "gzipped",
+		"app.js.br":    "brotli",
+		"style.css":    "plain css",
+		"secret.js":    "plain secret",
+		"secret.js.gz": "gzipped secret",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileserver := FileServer{Root: http.Dir(dir), Hide: []string{"/secret.js.gz"}}
+
+	tests := []struct {
+		url, encoding string
+		expectBody    string
+		expectCE      string
+	}{
+		{"/app.js", "", "plain", ""},
+		{"/app.js", "gzip", "gzipped", "gzip"},
+		{"/app.js", "br", "brotli", "br"},
+		{"/app.js", "deflate", "plain", ""},
+		{"/style.css", "gzip", "plain css", ""},
+		{"/secret.js", "gzip", "plain secret", ""},
+	}
+	for i, test := range tests {
+		request := httptest.NewRequest("GET", test.url, nil)
+		if test.encoding != "" {
+			request = request.WithContext(context.WithValue(request.Context(), PrecompressedCtxKey, test.encoding))
+		}
+		responseRecorder := httptest.NewRecorder()
+		fileserver.ServeHTTP(responseRecorder, request)
+		if got := responseRecorder.Body.String(); got != test.expectBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectBody, got)
+		}
+		if got := responseRecorder.Header().Get("Content-Encoding"); got != test.expectCE {
+			t.Errorf("Test %d: Expected Content-Encoding %q, got %q", i, test.expectCE, got)
+		}
+		if test.expectCE != "" {
+			if got := responseRecorder.Header().Get("Content-Type"); !strings.Contains(got, "javascript") {
+				t.Errorf("Test %d: Expected the Content-Type of the uncompressed file, got %q", i, got)
+			}
+		}
+	}
+}
+
+// TestServeHTTPETags covers conditional requests with ETags,
+// and turning them off.
+func TestServeHTTPETags(t *testing.T) {
+	beforeServeHTTPTest(t)
+	defer afterServeHTTPTest(t)
+
+	fileserver := FileServer{Root: http.Dir(testWebRoot)}
+
+	request, err := http.NewRequest("GET", "https://foo/file1.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("If-None-Match", `W/"1e240-13"`)
+	responseRecorder := httptest.NewRecorder()
+	fileserver.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for a matching ETag, found %d", http.StatusNotModified, responseRecorder.Code)
+	}
+
+	request.Header.Set("If-None-Match", `W/"1e240-14"`)
+	responseRecorder = httptest.NewRecorder()
+	fileserver.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("Expected status %d for a different ETag, found %d", http.StatusOK, responseRecorder.Code)
+	}
+
+	fileserver.DisableETags = true
+	responseRecorder = httptest.NewRecorder()
+	fileserver.ServeHTTP(responseRecorder, request)
+	if etag := responseRecorder.Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected no ETag when turned off, found %s", etag)
+	}
+}
+
+// TestServeHTTPConditional covers conditional requests by
+// modification time, and range requests.
+func TestServeHTTPConditional(t *testing.T) {
+	beforeServeHTTPTest(t)
+	defer afterServeHTTPTest(t)
+
+	modTime := time.Date(2016, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(testWebRoot, "file1.html"), modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	fileserver := FileServer{Root: http.Dir(testWebRoot)}
+
+	tests := []struct {
+		header         string
+		value          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"", "", http.StatusOK, "<h1>file1.html</h1>"},
+		{"If-Modified-Since", modTime.Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"If-Modified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "<h1>file1.html</h1>"},
+		{"If-Unmodified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusPreconditionFailed, ""},
+		{"Range", "bytes=4-8", http.StatusPartialContent, "file1"},
+		{"Range", "bytes=100-", http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+	for i, test := range tests {
+		request := httptest.NewRequest("GET", "/file1.html", nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.value)
+		}
+		responseRecorder := httptest.NewRecorder()
+		fileserver.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, found %d", i, test.expectedStatus, responseRecorder.Code)
+		}
+		if test.expectedBody != "" && responseRecorder.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, found %q", i, test.expectedBody, responseRecorder.Body.String())
+		}
+		if test.expectedStatus == http.StatusNotModified && responseRecorder.Body.Len() > 0 {
+			t.Errorf("Test %d: Expected no body when not modified, found %q", i, responseRecorder.Body.String())
+		}
+		if test.expectedStatus == http.StatusOK {
+			if got, want := responseRecorder.Header().Get("Last-Modified"), modTime.Format(http.TimeFormat); got != want {
+				t.Errorf("Test %d: Expected Last-Modified %s, found %s", i, want, got)
+			}
+			if got := responseRecorder.Header().Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Test %d: Expected Accept-Ranges bytes, found %s", i, got)
+			}
+		}
+	}
+}
+
+// TestServeHTTPIndexPages covers serving custom index files.
+func TestServeHTTPIndexPages(t *testing.T) {
+	beforeServeHTTPTest(t)
+	defer afterServeHTTPTest(t)
+
+	homeDir := filepath.Join(testWebRoot, "dirwithhome")
+	if err := os.Mkdir(homeDir, os.ModePerm); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(homeDir, "home.html"), []byte("<h1>dirwithhome/home.html</h1>"), os.ModePerm); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	fileserver := FileServer{Root: http.Dir(testWebRoot), IndexPages: []string{"default.aspx", "home.html"}}
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/dirwithhome/", http.StatusOK, "<h1>dirwithhome/home.html</h1>"},
+		// index.html isn't a candidate anymore
+		{"/dirwithindex/", http.StatusNotFound, ""},
+	}
+	for i, test := range tests {
+		responseRecorder := httptest.NewRecorder()
+		status, err := fileserver.ServeHTTP(responseRecorder, httptest.NewRequest("GET", test.url, nil))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, found %d", i, test.expectedStatus, status)
+		}
+		if responseRecorder.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, found %q", i, test.expectedBody, responseRecorder.Body.String())
+		}
+	}
+}
+
 // beforeServeHTTPTest creates a test directory with the structure, defined in the variable testFiles
 func beforeServeHTTPTest(t *testing.T) {
 	// make the root test dir
@@ -24,9 +24,10 @@ func setup(c *caddy.Controller) error {
 	cfg := httpserver.GetConfig(c)
 
 	tmpls := Templates{
-		Rules:   rules,
-		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		Rules:        rules,
+		Root:         cfg.Root,
+		FileSys:      http.Dir(cfg.Root),
+		DisableETags: cfg.DisableETags,
 	}
 
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
@@ -67,10 +68,10 @@ func templatesParse(c *caddy.Controller) ([]Rule, error) {
 					}
 					rule.Extensions = args
 
-				case "between":
+				case "delims", "between":
 					args := c.RemainingArgs()
 					if len(args) != 2 {
-						return nil, c.ArgErr()
+						return nil, c.Errf("%s requires an opening and a closing delimiter, got %d argument(s)", c.Val(), len(args))
 					}
 					rule.Delims[0] = args[0]
 					rule.Delims[1] = args[1]
@@ -80,6 +80,19 @@ func TestTemplatesParse(t *testing.T) {
 			Extensions: []string{".html"},
 			Delims:     [2]string{"{%", "%}"},
 		}}},
+		{`templates {
+				delims "[[" "]]"
+			}`, false, []Rule{{
+			Path:       defaultTemplatePath,
+			Extensions: defaultTemplateExtensions,
+			Delims:     [2]string{"[[", "]]"},
+		}}},
+		{`templates {
+				delims "[["
+			}`, true, nil},
+		{`templates {
+				delims "[[" "]]" "extra"
+			}`, true, nil},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("http", test.inputTemplateConfig)
@@ -102,6 +115,10 @@ func TestTemplatesParse(t *testing.T) {
 			if fmt.Sprint(actualTemplateConfig.Extensions) != fmt.Sprint(test.expectedTemplateConfig[j].Extensions) {
 				t.Errorf("Expected %v to be the  Extensions , but got %v instead", test.expectedTemplateConfig[j].Extensions, actualTemplateConfig.Extensions)
 			}
+			if actualTemplateConfig.Delims != test.expectedTemplateConfig[j].Delims {
+				t.Errorf("Test %d expected %dth Template Config Delims to be %v, but got %v",
+					i, j, test.expectedTemplateConfig[j].Delims, actualTemplateConfig.Delims)
+			}
 		}
 	}
 
@@ -4,17 +4,26 @@ package templates
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"text/template"
+	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/russross/blackfriday"
 )
 
 // ServeHTTP implements the httpserver.Handler interface.
 func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// a root with placeholders is filled in for each request
+	if root, ok := r.Context().Value(httpserver.RootCtxKey).(string); ok {
+		t.Root, t.FileSys = root, http.Dir(root)
+	}
+
 	for _, rule := range t.Rules {
 		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
 			continue
@@ -36,7 +45,10 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 
 				// New template
 				templateName := filepath.Base(fpath)
-				tpl := template.New(templateName)
+				tpl := template.New(templateName).Funcs(template.FuncMap{
+					"include":  includeFunc(t.FileSys, ctx, rule.Delims),
+					"markdown": markdown,
+				})
 
 				// Set delims
 				if rule.Delims != [2]string{} {
@@ -62,12 +74,12 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 					return http.StatusInternalServerError, err
 				}
 
-				templateInfo, err := os.Stat(templatePath)
-				if err == nil {
-					// add the Last-Modified header if we were able to read the stamp
-					httpserver.SetLastModifiedHeader(w, templateInfo.ModTime())
+				// use the mod time of the template, if we were able to read it
+				var modTime time.Time
+				if templateInfo, err := os.Stat(templatePath); err == nil {
+					modTime = templateInfo.ModTime()
 				}
-				buf.WriteTo(w)
+				httpserver.ServeGeneratedContent(w, r, templateName, modTime, buf.Bytes(), !t.DisableETags)
 
 				return http.StatusOK, nil
 			}
@@ -77,12 +89,75 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	return t.Next.ServeHTTP(w, r)
 }
 
+// maxIncludeDepth is how deeply templates may be nested with
+// include before execution fails, so a file that includes
+// itself doesn't recurse forever.
+const maxIncludeDepth = 10
+
+// includeFunc returns the template function "include", which reads
+// filename relative to the site root in fs, then parses and executes
+// it with ctx, the same context as the including template. Included
+// files use the same delimiters and may include other files.
+func includeFunc(fs http.FileSystem, ctx interface{}, delims [2]string) func(string) (string, error) {
+	var depth int
+	var include func(string) (string, error)
+	include = func(filename string) (string, error) {
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("including %s: maximum include depth of %d exceeded", filename, maxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+
+		file, err := fs.Open(filename)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		body, err := ioutil.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+
+		tpl := template.New(filename).Funcs(template.FuncMap{
+			"include":  include,
+			"markdown": markdown,
+		})
+		if delims != [2]string{} {
+			tpl.Delims(delims[0], delims[1])
+		}
+		tpl, err = tpl.Parse(string(body))
+		if err != nil {
+			return "", err
+		}
+
+		var buf bytes.Buffer
+		err = tpl.Execute(&buf, ctx)
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	return include
+}
+
+// markdown renders s to HTML with the same extensions as the
+// markdown middleware. Since s may come from the request, raw
+// HTML is dropped and links to unsafe protocols are not rendered.
+// Templates use text/template, so the result is never escaped.
+func markdown(s string) string {
+	flags := blackfriday.HTML_SKIP_HTML | blackfriday.HTML_SKIP_STYLE | blackfriday.HTML_SAFELINK
+	renderer := blackfriday.HtmlRenderer(flags, "", "")
+	return string(blackfriday.Markdown([]byte(s), renderer, httpserver.MarkdownExtensions))
+}
+
 // Templates is middleware to render templated files as the HTTP response.
 type Templates struct {
-	Next    httpserver.Handler
-	Rules   []Rule
-	Root    string
-	FileSys http.FileSystem
+	Next         httpserver.Handler
+	Rules        []Rule
+	Root         string
+	FileSys      http.FileSystem
+	DisableETags bool
 }
 
 // Rule represents a template rule. A template will only execute
@@ -3,6 +3,7 @@ package templates
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -136,3 +137,162 @@ func TestTemplates(t *testing.T) {
 		t.Fatalf("Test: the expected body %v is different from the response one: %v", expectedBody, respBody)
 	}
 }
+
+func TestTemplatesInclude(t *testing.T) {
+	tmpl := Templates{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{
+				Extensions: []string{".html"},
+				IndexFiles: []string{"index.html"},
+				Path:       "/",
+			},
+		},
+		Root:    "./testdata",
+		FileSys: http.Dir("./testdata"),
+	}
+
+	req, err := http.NewRequest("GET", "/partial.html", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+
+	status, err := tmpl.ServeHTTP(rec, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	expectedBody := `<!DOCTYPE html><html><head><title>/partial.html</title></head><body><nav><h1>Header title</h1>
+</nav></body></html>
+`
+	if respBody := rec.Body.String(); respBody != expectedBody {
+		t.Errorf("Expected body %q, got %q", expectedBody, respBody)
+	}
+
+	// a file that includes itself must stop at the depth limit
+	req, err = http.NewRequest("GET", "/recursive.html", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec = httptest.NewRecorder()
+
+	status, err = tmpl.ServeHTTP(rec, req)
+	if status != http.StatusInternalServerError {
+		t.Errorf("Expected status %d for recursive include, got %d", http.StatusInternalServerError, status)
+	}
+	if err == nil || !strings.Contains(err.Error(), "maximum include depth") {
+		t.Errorf("Expected include depth error, got: %v", err)
+	}
+}
+
+func TestTemplatesMarkdown(t *testing.T) {
+	tmpl := Templates{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{
+				Extensions: []string{".html"},
+				IndexFiles: []string{"index.html"},
+				Path:       "/",
+			},
+		},
+		Root:    "./testdata",
+		FileSys: http.Dir("./testdata"),
+	}
+
+	req, err := http.NewRequest("GET", "/markdown.html", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+
+	status, err := tmpl.ServeHTTP(rec, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+
+	respBody := rec.Body.String()
+	for _, want := range []string{"<h1>Title</h1>", "<em>text</em>"} {
+		if !strings.Contains(respBody, want) {
+			t.Errorf("Expected body to contain %q, got %q", want, respBody)
+		}
+	}
+	for _, unwanted := range []string{"<script>", "javascript:"} {
+		if strings.Contains(respBody, unwanted) {
+			t.Errorf("Expected body not to contain %q, got %q", unwanted, respBody)
+		}
+	}
+}
+
+func TestTemplatesRangeAndConditional(t *testing.T) {
+	tmpl := Templates{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{
+				Extensions: []string{".html"},
+				IndexFiles: []string{"index.html"},
+				Path:       "/",
+			},
+		},
+		Root:    "./testdata",
+		FileSys: http.Dir("./testdata"),
+	}
+
+	req, err := http.NewRequest("GET", "/partial.html", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	tmpl.ServeHTTP(rec, req)
+	full := rec.Body.String()
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag for the rendered template")
+	}
+	if rec.Header().Get("Last-Modified") == "" {
+		t.Error("Expected a Last-Modified header for the rendered template")
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Expected Content-Type text/html, got %q", got)
+	}
+
+	req.Header.Set("Range", "bytes=0-14")
+	rec = httptest.NewRecorder()
+	tmpl.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("Expected status %d for a range request, got %d", http.StatusPartialContent, rec.Code)
+	}
+	if got, want := rec.Body.String(), full[:15]; got != want {
+		t.Errorf("Expected body %q for the range, got %q", want, got)
+	}
+
+	req.Header.Del("Range")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	tmpl.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for a matching ETag, got %d", http.StatusNotModified, rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected no body for a matching ETag, got %q", rec.Body.String())
+	}
+
+	tmpl.DisableETags = true
+	req.Header.Del("If-None-Match")
+	rec = httptest.NewRecorder()
+	tmpl.ServeHTTP(rec, req)
+	if etag := rec.Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected no ETag when turned off, got %s", etag)
+	}
+}
@@ -0,0 +1,103 @@
+package timeouts
+
+import (
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("timeouts", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupTimeouts,
+	})
+}
+
+// setupTimeouts configures the timeouts of the server of the site.
+// A single argument sets all of them at once; the block sets them
+// one by one:
+//
+//	timeouts {
+//	    read      10s  # reading the request header
+//	    read_body 30s  # reading the whole request, with its body
+//	    write     30s  # writing the response
+//	    idle      2m   # waiting for the next request
+//	}
+//
+// A timeout of "none" (or 0) turns the timeout off. The ones that
+// aren't set keep their defaults, httpserver.DefaultTimeouts.
+func setupTimeouts(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			d, err := parseTimeout(c, args[0])
+			if err != nil {
+				return err
+			}
+			setTimeout(&config.Timeouts, "read", d)
+			setTimeout(&config.Timeouts, "read_body", d)
+			setTimeout(&config.Timeouts, "write", d)
+			setTimeout(&config.Timeouts, "idle", d)
+		default:
+			return c.ArgErr()
+		}
+
+		set := len(args) == 1
+		for c.NextBlock() {
+			set = true
+			kind := c.Val()
+			var value string
+			if !c.Args(&value) || c.NextArg() {
+				return c.ArgErr()
+			}
+			d, err := parseTimeout(c, value)
+			if err != nil {
+				return err
+			}
+			if !setTimeout(&config.Timeouts, kind, d) {
+				return c.Errf("Unknown timeout '%s'", kind)
+			}
+		}
+		if !set {
+			return c.ArgErr()
+		}
+	}
+	return nil
+}
+
+// parseTimeout parses value as a duration, or as none.
+func parseTimeout(c *caddy.Controller, value string) (time.Duration, error) {
+	if value == "none" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, c.Errf("invalid timeout '%s': %v", value, err)
+	}
+	if d < 0 {
+		return 0, c.Errf("timeout must not be negative, got %s", value)
+	}
+	return d, nil
+}
+
+// setTimeout sets the timeout called kind in t to d. It
+// returns false if there is no timeout called kind.
+func setTimeout(t *httpserver.Timeouts, kind string, d time.Duration) bool {
+	switch kind {
+	case "read":
+		t.ReadHeaderTimeout, t.ReadHeaderTimeoutSet = d, true
+	case "read_body":
+		t.ReadTimeout, t.ReadTimeoutSet = d, true
+	case "write":
+		t.WriteTimeout, t.WriteTimeoutSet = d, true
+	case "idle":
+		t.IdleTimeout, t.IdleTimeoutSet = d, true
+	default:
+		return false
+	}
+	return true
+}
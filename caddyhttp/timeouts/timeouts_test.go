@@ -0,0 +1,69 @@
+package timeouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupTimeouts(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.Timeouts
+	}{
+		{`timeouts {
+			read 10s
+			read_body 30s
+			write 30s
+			idle 120s
+		}`, false, httpserver.Timeouts{
+			ReadHeaderTimeout: 10 * time.Second, ReadHeaderTimeoutSet: true,
+			ReadTimeout: 30 * time.Second, ReadTimeoutSet: true,
+			WriteTimeout: 30 * time.Second, WriteTimeoutSet: true,
+			IdleTimeout: 2 * time.Minute, IdleTimeoutSet: true,
+		}},
+		{`timeouts {
+			write none
+		}`, false, httpserver.Timeouts{WriteTimeoutSet: true}},
+		{`timeouts 1m`, false, httpserver.Timeouts{
+			ReadHeaderTimeout: time.Minute, ReadHeaderTimeoutSet: true,
+			ReadTimeout: time.Minute, ReadTimeoutSet: true,
+			WriteTimeout: time.Minute, WriteTimeoutSet: true,
+			IdleTimeout: time.Minute, IdleTimeoutSet: true,
+		}},
+		{`timeouts none`, false, httpserver.Timeouts{
+			ReadHeaderTimeoutSet: true, ReadTimeoutSet: true, WriteTimeoutSet: true, IdleTimeoutSet: true,
+		}},
+		{`timeouts`, true, httpserver.Timeouts{}},
+		{`timeouts 1m 2m`, true, httpserver.Timeouts{}},
+		{`timeouts forever`, true, httpserver.Timeouts{}},
+		{`timeouts -1s`, true, httpserver.Timeouts{}},
+		{`timeouts {
+			read
+		}`, true, httpserver.Timeouts{}},
+		{`timeouts {
+			read 10s 20s
+		}`, true, httpserver.Timeouts{}},
+		{`timeouts {
+			header 10s
+		}`, true, httpserver.Timeouts{}},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		err := setupTimeouts(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if got := httpserver.GetConfig(c).Timeouts; got != test.expected {
+			t.Errorf("Test %d: expected timeouts %+v, got %+v", i, test.expected, got)
+		}
+	}
+}
@@ -69,12 +69,10 @@ func getCertificate(name string) (cert Certificate, matched, defaulted bool) {
 		return
 	}
 
-	// try replacing labels in the name with wildcards until we get a match
-	labels := strings.Split(name, ".")
-	for i := range labels {
-		labels[i] = "*"
-		candidate := strings.Join(labels, ".")
-		if cert, ok = certCache[candidate]; ok {
+	// try a wildcard certificate; a wildcard only stands for the
+	// leftmost label, so "a.b.example.com" doesn't match "*.example.com"
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok = certCache["*"+name[i:]]; ok {
 			matched = true
 			return
 		}
@@ -99,11 +97,10 @@ func CacheManagedCertificate(domain string, cfg *Config) (Certificate, error) {
 	if err != nil {
 		return Certificate{}, err
 	}
-	cert, err := makeCertificate(siteData.Cert, siteData.Key)
+	cert, err := makeCertificate(siteData.Cert, siteData.Key, cfg)
 	if err != nil {
 		return cert, err
 	}
-	cert.Config = cfg
 	cacheCertificate(cert)
 	return cert, nil
 }
@@ -114,8 +111,8 @@ func CacheManagedCertificate(domain string, cfg *Config) (Certificate, error) {
 // false.
 //
 // This function is safe for concurrent use.
-func cacheUnmanagedCertificatePEMFile(certFile, keyFile string) error {
-	cert, err := makeCertificateFromDisk(certFile, keyFile)
+func cacheUnmanagedCertificatePEMFile(certFile, keyFile string, cfg *Config) error {
+	cert, err := makeCertificateFromDisk(certFile, keyFile, cfg)
 	if err != nil {
 		return err
 	}
@@ -127,8 +124,8 @@ func cacheUnmanagedCertificatePEMFile(certFile, keyFile string) error {
 // of the certificate and key, then caches it in memory.
 //
 // This function is safe for concurrent use.
-func cacheUnmanagedCertificatePEMBytes(certBytes, keyBytes []byte) error {
-	cert, err := makeCertificate(certBytes, keyBytes)
+func cacheUnmanagedCertificatePEMBytes(certBytes, keyBytes []byte, cfg *Config) error {
+	cert, err := makeCertificate(certBytes, keyBytes, cfg)
 	if err != nil {
 		return err
 	}
@@ -140,7 +137,7 @@ func cacheUnmanagedCertificatePEMBytes(certBytes, keyBytes []byte) error {
 // certificate and key files. It fills out all the fields in
 // the certificate except for the Managed and OnDemand flags.
 // (It is up to the caller to set those.)
-func makeCertificateFromDisk(certFile, keyFile string) (Certificate, error) {
+func makeCertificateFromDisk(certFile, keyFile string, cfg *Config) (Certificate, error) {
 	certPEMBlock, err := ioutil.ReadFile(certFile)
 	if err != nil {
 		return Certificate{}, err
@@ -149,15 +146,15 @@ func makeCertificateFromDisk(certFile, keyFile string) (Certificate, error) {
 	if err != nil {
 		return Certificate{}, err
 	}
-	return makeCertificate(certPEMBlock, keyPEMBlock)
+	return makeCertificate(certPEMBlock, keyPEMBlock, cfg)
 }
 
 // makeCertificate turns a certificate PEM bundle and a key PEM block into
-// a Certificate, with OCSP and other relevant metadata tagged with it,
-// except for the OnDemand and Managed flags. It is up to the caller to
+// a Certificate for cfg, with OCSP and other relevant metadata tagged with
+// it, except for the OnDemand and Managed flags. It is up to the caller to
 // set those properties.
-func makeCertificate(certPEMBlock, keyPEMBlock []byte) (Certificate, error) {
-	var cert Certificate
+func makeCertificate(certPEMBlock, keyPEMBlock []byte, cfg *Config) (Certificate, error) {
+	cert := Certificate{Config: cfg}
 
 	// Convert to a tls.Certificate
 	tlsCert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
@@ -1,6 +1,12 @@
 package caddytls
 
-import "testing"
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
 
 func TestUnexportedGetCertificate(t *testing.T) {
 	defer func() { certCache = make(map[string]Certificate) }()
@@ -35,6 +41,41 @@ func TestUnexportedGetCertificate(t *testing.T) {
 	}
 }
 
+func TestGetCertificateWildcard(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+
+	certCache["*.example.com"] = Certificate{Names: []string{"*.example.com"}}
+	certCache["exact.example.com"] = Certificate{Names: []string{"exact.example.com"}}
+	certCache["*.sub.example.com"] = Certificate{Names: []string{"*.sub.example.com"}}
+
+	for i, test := range []struct {
+		name   string
+		expect string // empty if no certificate matches
+	}{
+		{"exact.example.com", "exact.example.com"},
+		{"Other.Example.com", "*.example.com"},
+		{"sub.example.com", "*.example.com"},
+		{"a.sub.example.com", "*.sub.example.com"},
+		{"a.b.example.com", ""}, // a wildcard only covers one label
+		{"a.b.sub.example.com", ""},
+		{"example.com", ""},
+		{".example.com", ""},
+		{"example.org", ""},
+	} {
+		cert, matched, _ := getCertificate(test.name)
+		if test.expect == "" {
+			if matched {
+				t.Errorf("Test %d: Expected no certificate for %s, got %v", i, test.name, cert.Names)
+			}
+			continue
+		}
+		if !matched || cert.Names[0] != test.expect {
+			t.Errorf("Test %d: Expected certificate %s for %s, got %v (matched=%v)",
+				i, test.expect, test.name, cert.Names, matched)
+		}
+	}
+}
+
 func TestCacheCertificate(t *testing.T) {
 	defer func() { certCache = make(map[string]Certificate) }()
 
@@ -57,3 +98,47 @@ func TestCacheCertificate(t *testing.T) {
 		t.Error("Expected second cert to NOT be cached as default, but it was")
 	}
 }
+
+func TestGetCertificateOCSPStapling(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+	defer func(orig func([]byte) ([]byte, *ocsp.Response, error)) { getOCSPForCert = orig }(getOCSPForCert)
+
+	var fetched int
+	getOCSPForCert = func([]byte) ([]byte, *ocsp.Response, error) {
+		fetched++
+		return nil, nil, errors.New("no responder")
+	}
+
+	for i, disabled := range []bool{true, false} {
+		certCache = make(map[string]Certificate)
+		fetched = 0
+
+		cfg := &Config{Enabled: true, Hostname: "localhost", Manual: true, DisableOCSPStapling: disabled}
+		if err := cacheUnmanagedCertificatePEMFile(certFile, keyFile, cfg); err != nil {
+			t.Fatalf("Test %d: Loading certificate: %v", i, err)
+		}
+		tlsConfig, err := MakeTLSConfig([]*Config{cfg})
+		if err != nil {
+			t.Fatalf("Test %d: MakeTLSConfig: %v", i, err)
+		}
+		cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+		if err != nil {
+			t.Fatalf("Test %d: GetCertificate: %v", i, err)
+		}
+		if len(cert.OCSPStaple) != 0 {
+			t.Errorf("Test %d: Expected no OCSP staple, got %d bytes", i, len(cert.OCSPStaple))
+		}
+		if disabled && fetched != 0 {
+			t.Errorf("Test %d: Expected no OCSP request with stapling disabled, got %d", i, fetched)
+		}
+		if !disabled && fetched != 1 {
+			t.Errorf("Test %d: Expected one OCSP request with stapling enabled, got %d", i, fetched)
+		}
+
+		// maintenance leaves the certificate alone too
+		UpdateOCSPStaples()
+		if disabled && fetched != 0 {
+			t.Errorf("Test %d: Expected no OCSP request from maintenance, got %d", i, fetched)
+		}
+	}
+}
@@ -33,8 +33,13 @@ var newACMEClient = func(config *Config, allowPrompts bool) (*ACMEClient, error)
 		return nil, err
 	}
 
-	// Look up or create the LE user account
-	leUser, err := getUser(storage, config.ACMEEmail)
+	// Look up or create the LE user account; each email has
+	// its own, and configs without an email use the default
+	email := config.ACMEEmail
+	if email == "" {
+		email = getEmail(storage, allowPrompts)
+	}
+	leUser, err := getUser(storage, email)
 	if err != nil {
 		return nil, err
 	}
@@ -39,9 +39,23 @@ type Config struct {
 	// Whether to prefer server cipher suites
 	PreferServerCipherSuites bool
 
+	// The list of elliptic curves to use, in order
+	// of preference; Go's defaults if empty
+	CurvePreferences []tls.CurveID
+
 	// Client authentication policy
 	ClientAuth tls.ClientAuthType
 
+	// Whether to skip getting OCSP responses for
+	// certificates of this config and stapling them
+	DisableOCSPStapling bool
+
+	// Whether to skip redirecting HTTP to HTTPS on port
+	// 80 when the config is managed, e.g. because TLS is
+	// terminated in front of the server, which serves
+	// plain HTTP to it on a site of its own
+	DisableHTTPRedirect bool
+
 	// List of client CA certificates to allow, if
 	// client authentication is enabled
 	ClientCerts []string
@@ -71,7 +85,8 @@ type Config struct {
 	SelfSigned bool
 
 	// The endpoint of the directory for the ACME
-	// CA we are to use
+	// CA we are to use, set with the ca subdirective;
+	// DefaultCAUrl is used if it is empty
 	CAUrl string
 
 	// The host (ONLY the host, not port) to listen
@@ -92,7 +107,8 @@ type Config struct {
 	// The email address to use when creating or
 	// using an ACME account (fun fact: if this
 	// is set to "off" then this config will not
-	// qualify for managed TLS)
+	// qualify for managed TLS); DefaultEmail is
+	// used if it is empty
 	ACMEEmail string
 
 	// The type of key to use when generating
@@ -121,6 +137,17 @@ type OnDemandState struct {
 	// Based on max_certs in tls config, it specifies the
 	// maximum number of certificates that can be issued.
 	MaxObtain int32
+
+	// Based on allow in tls config, the only hostnames that
+	// can be issued certificates, if any are set. The leftmost
+	// label of a name may be a wildcard.
+	AllowedNames []string
+
+	// Based on ask in tls config, a URL that is asked whether
+	// a hostname may be issued a certificate, given as the
+	// "domain" query parameter. Only a 2xx status allows it.
+	// Its answers are remembered for a minute.
+	AskURL string
 }
 
 // ObtainCert obtains a certificate for c.Hostname, as long as a certificate
@@ -155,10 +182,6 @@ func (c *Config) obtainCertName(name string, allowPrompts bool) error {
 		}
 	}()
 
-	if c.ACMEEmail == "" {
-		c.ACMEEmail = getEmail(storage, allowPrompts)
-	}
-
 	client, err := newACMEClient(c, allowPrompts)
 	if err != nil {
 		return err
@@ -299,6 +322,7 @@ func MakeTLSConfig(configs []*Config) (*tls.Config, error) {
 
 	config := new(tls.Config)
 	ciphersAdded := make(map[uint16]struct{})
+	curvesAdded := make(map[tls.CurveID]struct{})
 	configMap := make(configGroup)
 
 	for i, cfg := range configs {
@@ -333,6 +357,14 @@ func MakeTLSConfig(configs []*Config) (*tls.Config, error) {
 			}
 		}
 
+		// Union curves
+		for _, curve := range cfg.CurvePreferences {
+			if _, ok := curvesAdded[curve]; !ok {
+				curvesAdded[curve] = struct{}{}
+				config.CurvePreferences = append(config.CurvePreferences, curve)
+			}
+		}
+
 		// Can't resolve conflicting PreferServerCipherSuites settings
 		if i > 0 && cfg.PreferServerCipherSuites != configs[i-1].PreferServerCipherSuites {
 			return nil, fmt.Errorf("cannot both use PreferServerCipherSuites and not use it")
@@ -394,6 +426,14 @@ func MakeTLSConfig(configs []*Config) (*tls.Config, error) {
 			}
 		}
 		config.ClientCAs = pool
+
+		// A client without a certificate is let through the handshake,
+		// so the sites that require one can answer with 403 Forbidden
+		// instead of an opaque handshake failure. Certificates that
+		// are given must still verify.
+		if config.ClientAuth == tls.RequireAndVerifyClientCert {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
 	}
 
 	// Associate the GetCertificate callback, or almost nothing we just did will work
@@ -432,6 +472,9 @@ func SetDefaultTLSParams(config *Config) {
 	}
 	if config.ProtocolMaxVersion == 0 {
 		config.ProtocolMaxVersion = tls.VersionTLS12
+		if config.ProtocolMinVersion > config.ProtocolMaxVersion {
+			config.ProtocolMaxVersion = config.ProtocolMinVersion
+		}
 	}
 
 	// Prefer server cipher suites
@@ -453,6 +496,29 @@ var supportedProtocols = map[string]uint16{
 	"tls1.0": tls.VersionTLS10,
 	"tls1.1": tls.VersionTLS11,
 	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+// ProtocolName returns the Caddyfile name of TLS version v,
+// such as "tls1.2".
+func ProtocolName(v uint16) string {
+	for name, version := range supportedProtocols {
+		if version == v {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// CipherName returns the Caddyfile name of cipher suite id,
+// or the standard name for suites that can't be configured.
+func CipherName(id uint16) string {
+	for name, cipher := range supportedCiphersMap {
+		if cipher == id {
+			return name
+		}
+	}
+	return tls.CipherSuiteName(id)
 }
 
 // Map of supported ciphers, used only for parsing config.
@@ -480,6 +546,14 @@ var supportedCiphersMap = map[string]uint16{
 	"RSA-3DES-EDE-CBC-SHA":          tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
 }
 
+// Map of supported elliptic curves, used only for parsing config.
+var supportedCurvesMap = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
 // List of supported cipher suites in descending order of preference.
 // Ordering is very important! Getting the wrong order will break
 // mainstream clients, especially with HTTP/2.
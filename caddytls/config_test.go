@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"net/url"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -29,6 +30,41 @@ func TestMakeTLSConfig(t *testing.T) {
 	}
 }
 
+func TestMakeTLSConfigCurves(t *testing.T) {
+	// curves of all configs are kept in order, without duplicates
+	configs := []*Config{
+		{Enabled: true, Hostname: "a", CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256}},
+		{Enabled: true, Hostname: "b", CurvePreferences: []tls.CurveID{tls.CurveP384, tls.X25519}},
+	}
+	result, err := MakeTLSConfig(configs)
+	if err != nil {
+		t.Fatalf("Did not expect an error, but got %v", err)
+	}
+	expected := []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	if !reflect.DeepEqual(result.CurvePreferences, expected) {
+		t.Errorf("Expected curves %v, got %v", expected, result.CurvePreferences)
+	}
+}
+
+func TestMakeTLSConfigClientAuth(t *testing.T) {
+	// the strictest client auth wins, but clients without
+	// a certificate are rejected over HTTP instead
+	configs := []*Config{
+		{Enabled: true, Hostname: "a", ClientAuth: tls.RequestClientCert},
+		{Enabled: true, Hostname: "b", ClientAuth: tls.RequireAndVerifyClientCert},
+	}
+	result, err := MakeTLSConfig(configs)
+	if err != nil {
+		t.Fatalf("Did not expect an error, but got %v", err)
+	}
+	if got, want := result.ClientAuth, tls.VerifyClientCertIfGiven; got != want {
+		t.Errorf("Expected client auth to be %v, got %v", want, got)
+	}
+	if result.ClientCAs == nil {
+		t.Error("Expected a client CA pool")
+	}
+}
+
 func TestStorageForNoURL(t *testing.T) {
 	c := &Config{}
 	if _, err := c.StorageFor(""); err == nil {
@@ -70,6 +106,29 @@ func TestStorageForDefault(t *testing.T) {
 	}
 }
 
+func TestStorageForCAPath(t *testing.T) {
+	c := &Config{}
+	for i, test := range []struct {
+		caURL  string
+		expect string
+	}{
+		{"https://acme-v01.api.letsencrypt.org/directory", "acme-v01.api.letsencrypt.org"},
+		{"https://acme-staging.api.letsencrypt.org/directory", "acme-staging.api.letsencrypt.org"},
+		{"https://example.com", "example.com"},
+		{"https://example.com/", "example.com"},
+		{"https://ca.example.com/acme/acme/directory", "ca.example.com-acme-acme"},
+		{"https://ca.example.com/acme/other/directory", "ca.example.com-acme-other"},
+	} {
+		s, err := c.StorageFor(test.caURL)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if got, want := string(s.(FileStorage)), filepath.Join(storageBasePath, test.expect); got != want {
+			t.Errorf("Test %d: Expected storage in %s, got %s", i, want, got)
+		}
+	}
+}
+
 func TestStorageForCustom(t *testing.T) {
 	storage := fakeStorage("fake")
 	c := &Config{
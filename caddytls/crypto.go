@@ -64,14 +64,22 @@ func savePrivateKey(key crypto.PrivateKey) ([]byte, error) {
 	return pem.EncodeToMemory(&pemKey), nil
 }
 
+// getOCSPForCert gets the OCSP response for a PEM-encoded certificate
+// bundle from its issuer's OCSP responder.
+var getOCSPForCert = acme.GetOCSPForCert
+
 // stapleOCSP staples OCSP information to cert for hostname name.
 // If you have it handy, you should pass in the PEM-encoded certificate
 // bundle; otherwise the DER-encoded cert will have to be PEM-encoded.
 // If you don't have the PEM blocks already, just pass in nil.
 //
 // Errors here are not necessarily fatal, it could just be that the
-// certificate doesn't have an issuer URL.
+// certificate doesn't have an issuer URL. Nothing is done if stapling
+// is disabled for the certificate's config.
 func stapleOCSP(cert *Certificate, pemBundle []byte) error {
+	if cert.Config != nil && cert.Config.DisableOCSPStapling {
+		return nil
+	}
 	if pemBundle == nil {
 		// The function in the acme package that gets OCSP requires a PEM-encoded cert
 		bundle := new(bytes.Buffer)
@@ -112,7 +120,7 @@ func stapleOCSP(cert *Certificate, pemBundle []byte) error {
 	// If we couldn't get a fresh staple by reading the cache,
 	// then we need to request it from the OCSP responder
 	if ocspResp == nil || len(ocspBytes) == 0 {
-		ocspBytes, ocspResp, ocspErr = acme.GetOCSPForCert(pemBundle)
+		ocspBytes, ocspResp, ocspErr = getOCSPForCert(pemBundle)
 		if ocspErr != nil {
 			// An error here is not a problem because a certificate may simply
 			// not contain a link to an OCSP server. But we should log it anyway.
@@ -18,7 +18,19 @@ var storageBasePath = filepath.Join(caddy.AssetsPath(), "acme")
 // there is no error. This can be used by "middleware" implementations that
 // may want to proxy the disk storage.
 func FileStorageCreator(caURL *url.URL) (Storage, error) {
-	return FileStorage(filepath.Join(storageBasePath, caURL.Host)), nil
+	return FileStorage(filepath.Join(storageBasePath, caStorageName(caURL))), nil
+}
+
+// caStorageName returns the name of the folder for the CA with the
+// directory at caURL. It is the host, followed by the path if it is
+// more than "/directory", so that CAs that share a host, like the
+// provisioners of a private CA, don't share accounts.
+func caStorageName(caURL *url.URL) string {
+	path := strings.Trim(strings.TrimSuffix(caURL.Path, "/directory"), "/")
+	if path == "" {
+		return caURL.Host
+	}
+	return caURL.Host + "-" + strings.Replace(path, "/", "-", -1)
 }
 
 // FileStorage is a root directory and facilitates forming file paths derived
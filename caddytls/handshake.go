@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -110,6 +112,12 @@ func (cg configGroup) getCertDuringHandshake(name string, loadIfNecessary, obtai
 				return cert, errors.New("hostname '" + name + "' does not qualify for certificate")
 			}
 
+			// and be allowed by the user
+			err = onDemandAllowed(name, cfg)
+			if err != nil {
+				return Certificate{}, err
+			}
+
 			// Obtain certificate from the CA
 			return cg.obtainOnDemandCertificate(name, cfg)
 		}
@@ -155,6 +163,90 @@ func (cg configGroup) checkLimitsForObtainingNewCerts(name string, cfg *Config)
 	return nil
 }
 
+// onDemandAskClient is used to ask the ask URL of a config
+// whether a hostname may be issued a certificate.
+var onDemandAskClient = &http.Client{Timeout: 10 * time.Second}
+
+// onDemandAllowed checks name against the allowed names and the ask
+// URL of cfg, if set. If a non-nil error is returned, do not issue a
+// new certificate for name.
+func onDemandAllowed(name string, cfg *Config) error {
+	if len(cfg.OnDemandState.AllowedNames) > 0 {
+		var allowed bool
+		for _, pattern := range cfg.OnDemandState.AllowedNames {
+			if nameMatches(name, pattern) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s: not an allowed name for on-demand certificates", name)
+		}
+	}
+
+	if cfg.OnDemandState.AskURL != "" {
+		status, err := onDemandAsk(name, cfg.OnDemandState.AskURL)
+		if err != nil {
+			return err
+		}
+		if status < 200 || status > 299 {
+			return fmt.Errorf("%s: certificate not allowed by %s (status %d)",
+				name, cfg.OnDemandState.AskURL, status)
+		}
+	}
+
+	return nil
+}
+
+// onDemandAsk asks rawURL whether name may be issued a certificate
+// and returns the status of its answer. Answers are remembered for
+// a little while, so handshakes for the same name don't ask again.
+func onDemandAsk(name, rawURL string) (int, error) {
+	key := rawURL + " " + name
+	onDemandAnswersMu.RLock()
+	status, ok := onDemandAnswers[key]
+	onDemandAnswersMu.RUnlock()
+	if ok {
+		return status, nil
+	}
+
+	askURL, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("%s: parsing ask URL: %v", name, err)
+	}
+	qs := askURL.Query()
+	qs.Set("domain", name)
+	askURL.RawQuery = qs.Encode()
+
+	resp, err := onDemandAskClient.Get(askURL.String())
+	if err != nil {
+		return 0, fmt.Errorf("%s: asking %s: %v", name, rawURL, err)
+	}
+	resp.Body.Close()
+
+	onDemandAnswersMu.Lock()
+	onDemandAnswers[key] = resp.StatusCode
+	go func(key string) {
+		time.Sleep(onDemandAnswerTTL)
+		onDemandAnswersMu.Lock()
+		delete(onDemandAnswers, key)
+		onDemandAnswersMu.Unlock()
+	}(key)
+	onDemandAnswersMu.Unlock()
+	return resp.StatusCode, nil
+}
+
+// nameMatches returns true if name matches pattern, which may
+// have a wildcard for its leftmost label, like "*.example.com".
+func nameMatches(name, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		i := strings.Index(name, ".")
+		return i > 0 && name[i:] == pattern[1:]
+	}
+	return name == pattern
+}
+
 // obtainOnDemandCertificate obtains a certificate for name for the given
 // name. If another goroutine has already started obtaining a cert for
 // name, it will wait and use what the other goroutine obtained.
@@ -293,6 +385,15 @@ var obtainCertWaitChansMu sync.Mutex
 var failedIssuance = make(map[string]time.Time)
 var failedIssuanceMu sync.RWMutex
 
+// onDemandAnswers is a set of recent answers of ask URLs, keyed by
+// the URL and the name asked about. They are removed after
+// onDemandAnswerTTL. Errors reaching a URL are not remembered.
+var onDemandAnswers = make(map[string]int)
+var onDemandAnswersMu sync.RWMutex
+
+// onDemandAnswerTTL is how long an answer of an ask URL is used.
+const onDemandAnswerTTL = time.Minute
+
 // lastIssueTime records when we last obtained a certificate successfully.
 // If this value is recent, do not make any on-demand certificate requests.
 var lastIssueTime time.Time
@@ -3,6 +3,8 @@ package caddytls
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -54,3 +56,85 @@ func TestGetCertificate(t *testing.T) {
 		t.Errorf("Expected default cert with no matches, got: %v", cert)
 	}
 }
+
+func TestOnDemandAllowed(t *testing.T) {
+	var asked []string
+	ask := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := r.URL.Query().Get("domain")
+		asked = append(asked, domain)
+		if domain != "customer.com" && domain != "sub.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ask.Close()
+
+	for i, test := range []struct {
+		name        string
+		allowed     []string
+		askURL      string
+		expectAllow bool
+		expectAsked bool
+	}{
+		{"anything.com", nil, "", true, false},
+		{"example.com", []string{"example.com"}, "", true, false},
+		{"other.com", []string{"example.com"}, "", false, false},
+		{"sub.example.com", []string{"*.example.com"}, "", true, false},
+		{"a.sub.example.com", []string{"*.example.com"}, "", false, false},
+		{"example.com", []string{"*.example.com"}, "", false, false},
+		{"customer.com", nil, ask.URL, true, true},
+		{"stranger.com", nil, ask.URL + "?token=x", false, true},
+		{"other.example.com", []string{"*.example.com"}, ask.URL, false, true},
+		{"other.com", []string{"*.example.com"}, ask.URL, false, false},
+		{"sub.example.com", []string{"*.example.com"}, ask.URL, true, true},
+	} {
+		asked = nil
+		cfg := &Config{OnDemandState: OnDemandState{AllowedNames: test.allowed, AskURL: test.askURL}}
+		err := onDemandAllowed(test.name, cfg)
+		if test.expectAllow && err != nil {
+			t.Errorf("Test %d: Expected %s to be allowed, got: %v", i, test.name, err)
+		}
+		if !test.expectAllow && err == nil {
+			t.Errorf("Test %d: Expected %s not to be allowed", i, test.name)
+		}
+		if test.expectAsked && (len(asked) != 1 || asked[0] != test.name) {
+			t.Errorf("Test %d: Expected ask URL to be asked about %s, got %v", i, test.name, asked)
+		}
+		if !test.expectAsked && len(asked) != 0 {
+			t.Errorf("Test %d: Expected ask URL not to be asked, got %v", i, asked)
+		}
+	}
+}
+
+func TestOnDemandAskRemembered(t *testing.T) {
+	asked := make(map[string]int)
+	ask := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := r.URL.Query().Get("domain")
+		asked[domain]++
+		if domain != "customer.com" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ask.Close()
+
+	cfg := &Config{OnDemandState: OnDemandState{AskURL: ask.URL}}
+	for i := 0; i < 3; i++ {
+		if err := onDemandAllowed("customer.com", cfg); err != nil {
+			t.Errorf("Attempt %d: Expected customer.com to be allowed, got: %v", i, err)
+		}
+		if err := onDemandAllowed("stranger.com", cfg); err == nil {
+			t.Errorf("Attempt %d: Expected stranger.com not to be allowed", i)
+		}
+	}
+	for _, name := range []string{"customer.com", "stranger.com"} {
+		if asked[name] != 1 {
+			t.Errorf("Expected ask URL to be asked about %s once, got %d", name, asked[name])
+		}
+	}
+
+	// another ask URL has its own answers
+	other := &Config{OnDemandState: OnDemandState{AskURL: ask.URL + "?token=x"}}
+	onDemandAllowed("customer.com", other)
+	if asked["customer.com"] != 2 {
+		t.Errorf("Expected another ask URL to be asked again, got %d asks", asked["customer.com"])
+	}
+}
@@ -1,10 +1,13 @@
 package caddytls
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mholt/caddy"
@@ -25,10 +28,15 @@ const (
 	// RenewDurationBefore is how long before expiration to renew certificates.
 	RenewDurationBefore = (24 * time.Hour) * 30
 
-	// OCSPInterval is how often to check if OCSP stapling needs updating.
-	OCSPInterval = 1 * time.Hour
+	// CertDirInterval is how often to check directories of
+	// loaded certificates for changed files.
+	CertDirInterval = 1 * time.Minute
 )
 
+// OCSPInterval is how often to check if OCSP stapling needs updating.
+// Changes take effect within a minute.
+var OCSPInterval = 1 * time.Hour
+
 // maintainAssets is a permanently-blocking function
 // that loops indefinitely and, on a regular schedule, checks
 // certificates for expiration and initiates a renewal of certs
@@ -41,7 +49,11 @@ const (
 // after itself and unblock. (Not that you HAVE to stop it...)
 func maintainAssets(stopChan chan struct{}) {
 	renewalTicker := time.NewTicker(RenewInterval)
-	ocspTicker := time.NewTicker(OCSPInterval)
+	// OCSPInterval may be changed after this starts,
+	// so it is checked against on a finer ticker
+	ocspTicker := time.NewTicker(time.Minute)
+	lastOCSPCheck := time.Now()
+	certDirTicker := time.NewTicker(CertDirInterval)
 
 	for {
 		select {
@@ -50,19 +62,86 @@ func maintainAssets(stopChan chan struct{}) {
 			RenewManagedCertificates(false)
 			log.Println("[INFO] Done checking certificates")
 		case <-ocspTicker.C:
+			if time.Since(lastOCSPCheck) < OCSPInterval {
+				continue
+			}
+			lastOCSPCheck = time.Now()
 			log.Println("[INFO] Scanning for stale OCSP staples")
 			UpdateOCSPStaples()
 			DeleteOldStapleFiles()
 			log.Println("[INFO] Done checking OCSP staples")
+		case <-certDirTicker.C:
+			ReloadCertDirs()
 		case <-stopChan:
 			renewalTicker.Stop()
 			ocspTicker.Stop()
+			certDirTicker.Stop()
 			log.Println("[INFO] Stopped background maintenance routine")
 			return
 		}
 	}
 }
 
+// certDir is a directory of certificates that were loaded with
+// the load subdirective. It remembers the modification times of
+// its files to tell when they change.
+type certDir struct {
+	config   *Config
+	modTimes map[string]time.Time
+}
+
+var (
+	// certDirs maps watched directories to their state.
+	certDirs   = make(map[string]*certDir)
+	certDirsMu sync.Mutex
+)
+
+// loadFile loads the certificate and key bundled in the PEM file at
+// path, which info describes, and caches the certificate.
+func (d *certDir) loadFile(path string, info os.FileInfo) error {
+	// remember the file even if it is broken, so it
+	// is only loaded again once it changes again
+	d.modTimes[path] = info.ModTime()
+
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	certPEMBytes, keyPEMBytes, err := splitPEMBundle(bundle)
+	if err != nil {
+		return err
+	}
+	err = cacheUnmanagedCertificatePEMBytes(certPEMBytes, keyPEMBytes, d.config)
+	if err != nil {
+		return fmt.Errorf("failed to load cert and key: %v", err)
+	}
+	log.Printf("[INFO] Successfully loaded TLS assets from %s", path)
+	return nil
+}
+
+// ReloadCertDirs loads the files of directories given to the load
+// subdirective again if they were added or changed since they were
+// last loaded. Their certificates replace the cached ones, so new
+// handshakes use them; established connections are not affected.
+func ReloadCertDirs() {
+	certDirsMu.Lock()
+	defer certDirsMu.Unlock()
+	for dir, d := range certDirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".pem") {
+				return nil
+			}
+			if last, ok := d.modTimes[path]; ok && last.Equal(info.ModTime()) {
+				return nil
+			}
+			if err := d.loadFile(path, info); err != nil {
+				log.Printf("[ERROR] Reloading TLS assets from %s: %v", path, err)
+			}
+			return nil
+		})
+	}
+}
+
 // RenewManagedCertificates renews managed certificates.
 func RenewManagedCertificates(allowPrompts bool) (err error) {
 	var renewed, deleted []Certificate
@@ -190,8 +269,9 @@ func UpdateOCSPStaples() {
 			visited[n] = struct{}{}
 		}
 
-		// no point in updating OCSP for expired certificates
-		if time.Now().After(cert.NotAfter) {
+		// no point in updating OCSP for expired certificates,
+		// or for certificates that shouldn't be stapled
+		if time.Now().After(cert.NotAfter) || cert.Config.DisableOCSPStapling {
 			continue
 		}
 
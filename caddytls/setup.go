@@ -4,13 +4,15 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 )
@@ -75,13 +77,17 @@ func setupTLS(c *caddy.Controller) error {
 				config.KeyType = value
 			case "protocols":
 				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return c.ArgErr()
+				}
 				if len(args) == 1 {
 					value, ok := supportedProtocols[strings.ToLower(args[0])]
 					if !ok {
 						return c.Errf("Wrong protocol name or protocol not supported: '%s'", args[0])
 					}
 
-					config.ProtocolMinVersion, config.ProtocolMaxVersion = value, value
+					// only the minimum; the maximum gets its default
+					config.ProtocolMinVersion = value
 				} else {
 					value, ok := supportedProtocols[strings.ToLower(args[0])]
 					if !ok {
@@ -98,13 +104,29 @@ func setupTLS(c *caddy.Controller) error {
 					}
 				}
 			case "ciphers":
-				for c.NextArg() {
-					value, ok := supportedCiphersMap[strings.ToUpper(c.Val())]
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					value, ok := supportedCiphersMap[strings.ToUpper(arg)]
 					if !ok {
-						return c.Errf("Wrong cipher name or cipher not supported: '%s'", c.Val())
+						return c.Errf("Wrong cipher name or cipher not supported: '%s'", arg)
 					}
 					config.Ciphers = append(config.Ciphers, value)
 				}
+			case "curves":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, arg := range args {
+					value, ok := supportedCurvesMap[strings.ToUpper(arg)]
+					if !ok {
+						return c.Errf("Wrong curve name or curve not supported: '%s'", arg)
+					}
+					config.CurvePreferences = append(config.CurvePreferences, value)
+				}
 			case "clients":
 				clientCertList := c.RemainingArgs()
 				if len(clientCertList) == 0 {
@@ -121,6 +143,8 @@ func setupTLS(c *caddy.Controller) error {
 					mustProvideCA = false
 				case "verify_if_given":
 					config.ClientAuth = tls.VerifyClientCertIfGiven
+				case "require_and_verify":
+					config.ClientAuth = tls.RequireAndVerifyClientCert
 				default:
 					config.ClientAuth = tls.RequireAndVerifyClientCert
 					listStart = 0
@@ -136,6 +160,74 @@ func setupTLS(c *caddy.Controller) error {
 			case "max_certs":
 				c.Args(&maxCerts)
 				config.OnDemand = true
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, name := range args {
+					config.OnDemandState.AllowedNames = append(config.OnDemandState.AllowedNames, strings.ToLower(name))
+				}
+				config.OnDemand = true
+			case "ask":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				rawURL := c.Val()
+				askURL, err := url.Parse(rawURL)
+				if err != nil || (askURL.Scheme != "http" && askURL.Scheme != "https") || askURL.Host == "" {
+					return c.Errf("ask must be an http or https URL, got '%s'", rawURL)
+				}
+				if c.NextArg() {
+					return c.ArgErr()
+				}
+				config.OnDemandState.AskURL = rawURL
+				config.OnDemand = true
+			case "email":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				config.ACMEEmail = strings.ToLower(args[0])
+			case "ca":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				rawURL := c.Val()
+				caURL, err := url.Parse(rawURL)
+				if err != nil || (caURL.Scheme != "http" && caURL.Scheme != "https") || caURL.Host == "" {
+					return c.Errf("ca must be an http or https URL, got '%s'", rawURL)
+				}
+				if c.NextArg() {
+					return c.ArgErr()
+				}
+				config.CAUrl = rawURL
+			case "ocsp_stapling":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				switch args[0] {
+				case "on":
+					config.DisableOCSPStapling = false
+				case "off":
+					config.DisableOCSPStapling = true
+				default:
+					return c.Errf("ocsp_stapling must be 'on' or 'off', got '%s'", args[0])
+				}
+			case "redir":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				switch args[0] {
+				case "on":
+					config.DisableHTTPRedirect = false
+				case "off":
+					config.DisableHTTPRedirect = true
+				default:
+					return c.Errf("redir must be 'on' or 'off', got '%s'", args[0])
+				}
 			case "dns":
 				args := c.RemainingArgs()
 				if len(args) != 1 {
@@ -143,7 +235,8 @@ func setupTLS(c *caddy.Controller) error {
 				}
 				dnsProvName := args[0]
 				if _, ok := dnsProviders[dnsProvName]; !ok {
-					return c.Errf("Unsupported DNS provider '%s'", args[0])
+					return c.Errf("Unsupported DNS provider '%s' (plugged in: %s)",
+						args[0], strings.Join(DNSProviderNames(), ", "))
 				}
 				config.DNSProvider = args[0]
 			default:
@@ -172,7 +265,7 @@ func setupTLS(c *caddy.Controller) error {
 
 		// load a single certificate and key, if specified
 		if certificateFile != "" && keyFile != "" {
-			err := cacheUnmanagedCertificatePEMFile(certificateFile, keyFile)
+			err := cacheUnmanagedCertificatePEMFile(certificateFile, keyFile, config)
 			if err != nil {
 				return c.Errf("Unable to load certificate and key files for '%s': %v", c.Key, err)
 			}
@@ -181,17 +274,27 @@ func setupTLS(c *caddy.Controller) error {
 
 		// load a directory of certificates, if specified
 		if loadDir != "" {
-			err := loadCertsInDir(c, loadDir)
+			err := loadCertsInDir(c, loadDir, config)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	// the ACME client only speaks ACMEv1, over which CAs don't
+	// issue wildcard certificates, so they must be supplied
+	if strings.Contains(config.Hostname, "*") && !config.Manual && !config.OnDemand && !config.SelfSigned {
+		return c.Errf("Can't obtain a wildcard certificate for '%s'; use 'tls cert key' or 'load' with a certificate for it", config.Hostname)
+	}
+
 	SetDefaultTLSParams(config)
 
 	// generate self-signed cert if needed
 	if config.SelfSigned {
+		if !localHostname(config.Hostname) {
+			log.Printf("[WARNING] Using a self-signed certificate for %s, which is not a local name; "+
+				"clients will not trust it, so it should only be used for local development", config.Hostname)
+		}
 		err := makeSelfSignedCert(config)
 		if err != nil {
 			return fmt.Errorf("self-signed: %v", err)
@@ -207,76 +310,84 @@ func setupTLS(c *caddy.Controller) error {
 // be bundled into the same file:
 // https://cbonte.github.io/haproxy-dconv/configuration-1.5.html#5.1-crt
 //
+// The directory is watched afterwards, so changed or added files
+// are loaded again; see ReloadCertDirs.
+//
 // This function may write to the log as it walks the directory tree.
-func loadCertsInDir(c *caddy.Controller, dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+func loadCertsInDir(c *caddy.Controller, dir string, config *Config) error {
+	watched := &certDir{config: config, modTimes: make(map[string]time.Time)}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			log.Printf("[WARNING] Unable to traverse into %s; skipping", path)
 			return nil
 		}
-		if info.IsDir() {
+		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".pem") {
 			return nil
 		}
-		if strings.HasSuffix(strings.ToLower(info.Name()), ".pem") {
-			certBuilder, keyBuilder := new(bytes.Buffer), new(bytes.Buffer)
-			var foundKey bool // use only the first key in the file
+		if err := watched.loadFile(path, info); err != nil {
+			return c.Errf("%s: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-			bundle, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
+	certDirsMu.Lock()
+	certDirs[dir] = watched
+	certDirsMu.Unlock()
+	return nil
+}
 
-			for {
-				// Decode next block so we can see what type it is
-				var derBlock *pem.Block
-				derBlock, bundle = pem.Decode(bundle)
-				if derBlock == nil {
-					break
-				}
+// splitPEMBundle separates the certificate chain and the private
+// key of a PEM bundle. Only the first key in the bundle is used.
+func splitPEMBundle(bundle []byte) (certPEMBytes, keyPEMBytes []byte, err error) {
+	certBuilder, keyBuilder := new(bytes.Buffer), new(bytes.Buffer)
+	var foundKey bool // use only the first key in the file
 
-				if derBlock.Type == "CERTIFICATE" {
-					// Re-encode certificate as PEM, appending to certificate chain
-					pem.Encode(certBuilder, derBlock)
-				} else if derBlock.Type == "EC PARAMETERS" {
-					// EC keys generated from openssl can be composed of two blocks:
-					// parameters and key (parameter block should come first)
-					if !foundKey {
-						// Encode parameters
-						pem.Encode(keyBuilder, derBlock)
+	for {
+		// Decode next block so we can see what type it is
+		var derBlock *pem.Block
+		derBlock, bundle = pem.Decode(bundle)
+		if derBlock == nil {
+			break
+		}
 
-						// Key must immediately follow
-						derBlock, bundle = pem.Decode(bundle)
-						if derBlock == nil || derBlock.Type != "EC PRIVATE KEY" {
-							return c.Errf("%s: expected elliptic private key to immediately follow EC parameters", path)
-						}
-						pem.Encode(keyBuilder, derBlock)
-						foundKey = true
-					}
-				} else if derBlock.Type == "PRIVATE KEY" || strings.HasSuffix(derBlock.Type, " PRIVATE KEY") {
-					// RSA key
-					if !foundKey {
-						pem.Encode(keyBuilder, derBlock)
-						foundKey = true
-					}
-				} else {
-					return c.Errf("%s: unrecognized PEM block type: %s", path, derBlock.Type)
-				}
-			}
+		if derBlock.Type == "CERTIFICATE" {
+			// Re-encode certificate as PEM, appending to certificate chain
+			pem.Encode(certBuilder, derBlock)
+		} else if derBlock.Type == "EC PARAMETERS" {
+			// EC keys generated from openssl can be composed of two blocks:
+			// parameters and key (parameter block should come first)
+			if !foundKey {
+				// Encode parameters
+				pem.Encode(keyBuilder, derBlock)
 
-			certPEMBytes, keyPEMBytes := certBuilder.Bytes(), keyBuilder.Bytes()
-			if len(certPEMBytes) == 0 {
-				return c.Errf("%s: failed to parse PEM data", path)
-			}
-			if len(keyPEMBytes) == 0 {
-				return c.Errf("%s: no private key block found", path)
+				// Key must immediately follow
+				derBlock, bundle = pem.Decode(bundle)
+				if derBlock == nil || derBlock.Type != "EC PRIVATE KEY" {
+					return nil, nil, errors.New("expected elliptic private key to immediately follow EC parameters")
+				}
+				pem.Encode(keyBuilder, derBlock)
+				foundKey = true
 			}
-
-			err = cacheUnmanagedCertificatePEMBytes(certPEMBytes, keyPEMBytes)
-			if err != nil {
-				return c.Errf("%s: failed to load cert and key for '%s': %v", path, c.Key, err)
+		} else if derBlock.Type == "PRIVATE KEY" || strings.HasSuffix(derBlock.Type, " PRIVATE KEY") {
+			// RSA key
+			if !foundKey {
+				pem.Encode(keyBuilder, derBlock)
+				foundKey = true
 			}
-			log.Printf("[INFO] Successfully loaded TLS assets from %s", path)
+		} else {
+			return nil, nil, fmt.Errorf("unrecognized PEM block type: %s", derBlock.Type)
 		}
-		return nil
-	})
+	}
+
+	certPEMBytes, keyPEMBytes = certBuilder.Bytes(), keyBuilder.Bytes()
+	if len(certPEMBytes) == 0 {
+		return nil, nil, errors.New("failed to parse PEM data")
+	}
+	if len(keyPEMBytes) == 0 {
+		return nil, nil, errors.New("no private key block found")
+	}
+	return certPEMBytes, keyPEMBytes, nil
 }
@@ -1,11 +1,23 @@
 package caddytls
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/xenolf/lego/acme"
@@ -124,6 +136,45 @@ func TestSetupParseWithOptionalParams(t *testing.T) {
 	if len(cfg.Ciphers)-1 != 3 {
 		t.Errorf("Expected 3 Ciphers (not including TLS_FALLBACK_SCSV), got %v", len(cfg.Ciphers)-1)
 	}
+
+	// the order of the ciphers is kept
+	expectedCiphers := []uint16{
+		tls.TLS_FALLBACK_SCSV,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}
+	if !reflect.DeepEqual(cfg.Ciphers, expectedCiphers) {
+		t.Errorf("Expected ciphers %v, got %v", expectedCiphers, cfg.Ciphers)
+	}
+}
+
+func TestSetupParseWithCurves(t *testing.T) {
+	params := `tls {
+            curves x25519 P256
+        }`
+	cfg := new(Config)
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	c := caddy.NewTestController("", params)
+
+	err := setupTLS(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	expectedCurves := []tls.CurveID{tls.X25519, tls.CurveP256}
+	if !reflect.DeepEqual(cfg.CurvePreferences, expectedCurves) {
+		t.Errorf("Expected curves %v, got %v", expectedCurves, cfg.CurvePreferences)
+	}
+
+	// without curves, Go's defaults are used
+	cfg = new(Config)
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	if err := setupTLS(caddy.NewTestController("", `tls `+certFile+` `+keyFile)); err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if cfg.CurvePreferences != nil {
+		t.Errorf("Expected no curve preferences, got %v", cfg.CurvePreferences)
+	}
 }
 
 func TestSetupDefaultWithOptionalParams(t *testing.T) {
@@ -168,6 +219,23 @@ func TestSetupParseWithWrongOptionalParams(t *testing.T) {
 		t.Errorf("Expected errors, but no error returned")
 	}
 
+	// Test curves wrong params
+	for _, params := range []string{`tls {
+			curves P192
+		}`, `tls {
+			curves
+		}`, `tls {
+			ciphers
+		}`} {
+		cfg = new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c = caddy.NewTestController("", params)
+		err = setupTLS(c)
+		if err == nil {
+			t.Errorf("Expected errors for %s, but no error returned", params)
+		}
+	}
+
 	// Test key_type wrong params
 	params = `tls {
 			key_type ab123
@@ -218,6 +286,12 @@ func TestSetupParseWithClientAuth(t *testing.T) {
 		{`tls ` + certFile + ` ` + keyFile + ` {
 			clients verify_if_given
 		}`, tls.VerifyClientCertIfGiven, true, noCAs},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients require_and_verify client_ca.crt client2_ca.crt
+		}`, tls.RequireAndVerifyClientCert, false, twoCAs},
+		{`tls ` + certFile + ` ` + keyFile + ` {
+			clients require_and_verify
+		}`, tls.RequireAndVerifyClientCert, true, noCAs},
 	} {
 		cfg := new(Config)
 		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
@@ -269,6 +343,250 @@ func TestSetupParseWithKeyType(t *testing.T) {
 	}
 }
 
+func TestSetupParseWithOCSPStapling(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectStapling bool
+	}{
+		{"", false, true},
+		{"ocsp_stapling on", false, true},
+		{"ocsp_stapling off", false, false},
+		{"ocsp_stapling", true, false},
+		{"ocsp_stapling maybe", true, false},
+		{"ocsp_stapling off on", true, false},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls `+certFile+` `+keyFile+` {
+			`+test.input+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if cfg.DisableOCSPStapling == test.expectStapling {
+			t.Errorf("Test %d: Expected stapling to be %v, but DisableOCSPStapling was %v",
+				i, test.expectStapling, cfg.DisableOCSPStapling)
+		}
+	}
+}
+
+func TestSetupParseWithEmail(t *testing.T) {
+	for i, test := range []struct {
+		input       string
+		shouldErr   bool
+		expectEmail string
+	}{
+		{"tls {\n}", true, ""},
+		{"tls {\nemail you@brand.com\n}", false, "you@brand.com"},
+		{"tls {\nemail You@Brand.com\n}", false, "you@brand.com"},
+		{"tls other@brand.com {\nemail you@brand.com\n}", false, "you@brand.com"},
+		{"tls other@brand.com", false, "other@brand.com"},
+		{"tls {\nemail\n}", true, ""},
+		{"tls {\nemail a@brand.com b@brand.com\n}", true, ""},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		err := setupTLS(caddy.NewTestController("", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if cfg.ACMEEmail != test.expectEmail {
+			t.Errorf("Test %d: Expected email %s, got %s", i, test.expectEmail, cfg.ACMEEmail)
+		}
+	}
+}
+
+func TestSetupParseWithCA(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expectCA  string
+	}{
+		{"ca https://acme-staging.api.letsencrypt.org/directory", false, "https://acme-staging.api.letsencrypt.org/directory"},
+		{"ca http://localhost:9000/acme/acme/directory", false, "http://localhost:9000/acme/acme/directory"},
+		{"ca", true, ""},
+		{"ca acme-staging.api.letsencrypt.org/directory", true, ""},
+		{"ca ftp://example.com/directory", true, ""},
+		{"ca https://a.example.com https://b.example.com", true, ""},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls {
+			`+test.input+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if cfg.CAUrl != test.expectCA {
+			t.Errorf("Test %d: Expected CA URL %s, got %s", i, test.expectCA, cfg.CAUrl)
+		}
+	}
+}
+
+func TestSetupParseWithRedir(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectRedirect bool
+	}{
+		{"", false, true},
+		{"redir on", false, true},
+		{"redir off", false, false},
+		{"redir", true, false},
+		{"redir maybe", true, false},
+		{"redir off on", true, false},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls `+certFile+` `+keyFile+` {
+			`+test.input+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if cfg.DisableHTTPRedirect == test.expectRedirect {
+			t.Errorf("Test %d: Expected redirect to be %v, but DisableHTTPRedirect was %v",
+				i, test.expectRedirect, cfg.DisableHTTPRedirect)
+		}
+	}
+}
+
+func TestSetupParseWithDNSProvider(t *testing.T) {
+	defer delete(dnsProviders, "testdns")
+	RegisterDNSProvider("testdns", func(credentials ...string) (acme.ChallengeProvider, error) {
+		return nil, nil
+	})
+
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectProvider string
+	}{
+		{"dns testdns", false, "testdns"},
+		{"dns", true, ""},
+		{"dns testdns extra", true, ""},
+		{"dns nosuchdns", true, ""},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls {
+			`+test.input+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if cfg.DNSProvider != test.expectProvider {
+			t.Errorf("Test %d: Expected DNS provider '%s', got '%s'", i, test.expectProvider, cfg.DNSProvider)
+		}
+	}
+}
+
+func TestSetupParseWildcard(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+	defer delete(dnsProviders, "wildcarddns")
+	RegisterDNSProvider("wildcarddns", func(credentials ...string) (acme.ChallengeProvider, error) {
+		return nil, nil
+	})
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`tls foo@example.com`, true},
+		{"tls {\n dns wildcarddns\n}", true},
+		{`tls ` + certFile + ` ` + keyFile, false},
+		{"tls {\n max_certs 10\n}", false},
+		{`tls self_signed`, false},
+		{`tls off`, false},
+	} {
+		cfg := &Config{Hostname: "*.example.com"}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		err := setupTLS(caddy.NewTestController("", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected an error for a managed wildcard site, but didn't get one", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+	}
+}
+
+func TestSetupParseWithOnDemandPolicy(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectAllowed []string
+		expectAsk     string
+	}{
+		{"allow example.com *.Example.net", false, []string{"example.com", "*.example.net"}, ""},
+		{"ask https://auth.local/check?key=1", false, nil, "https://auth.local/check?key=1"},
+		{"allow", true, nil, ""},
+		{"ask", true, nil, ""},
+		{"ask /check", true, nil, ""},
+		{"ask ftp://auth.local", true, nil, ""},
+		{"ask http://a http://b", true, nil, ""},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls {
+			`+test.input+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but didn't get one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if !cfg.OnDemand {
+			t.Errorf("Test %d: Expected on-demand TLS to be enabled", i)
+		}
+		if !reflect.DeepEqual(cfg.OnDemandState.AllowedNames, test.expectAllowed) {
+			t.Errorf("Test %d: Expected allowed names %v, got %v", i, test.expectAllowed, cfg.OnDemandState.AllowedNames)
+		}
+		if cfg.OnDemandState.AskURL != test.expectAsk {
+			t.Errorf("Test %d: Expected ask URL '%s', got '%s'", i, test.expectAsk, cfg.OnDemandState.AskURL)
+		}
+	}
+}
+
 func TestSetupParseWithOneTLSProtocol(t *testing.T) {
 	params := `tls {
             protocols tls1.2
@@ -291,6 +609,49 @@ func TestSetupParseWithOneTLSProtocol(t *testing.T) {
 	}
 }
 
+func TestSetupParseTLSProtocols(t *testing.T) {
+	for i, test := range []struct {
+		protocols string
+		shouldErr bool
+		min, max  uint16
+	}{
+		// one version is the minimum; the maximum is the default
+		{"tls1.0", false, tls.VersionTLS10, tls.VersionTLS12},
+		{"tls1.1", false, tls.VersionTLS11, tls.VersionTLS12},
+		{"tls1.2", false, tls.VersionTLS12, tls.VersionTLS12},
+		{"tls1.3", false, tls.VersionTLS13, tls.VersionTLS13},
+		{"TLS1.2", false, tls.VersionTLS12, tls.VersionTLS12},
+		{"tls1.0 tls1.1", false, tls.VersionTLS10, tls.VersionTLS11},
+		{"tls1.2 tls1.3", false, tls.VersionTLS12, tls.VersionTLS13},
+		{"tls1.3 tls1.3", false, tls.VersionTLS13, tls.VersionTLS13},
+		{"tls1.3 tls1.2", true, 0, 0},
+		{"ssl3.0", true, 0, 0},
+		{"tls1.2 tls1.4", true, 0, 0},
+		{"", true, 0, 0},
+		{"tls1.0 tls1.1 tls1.2", true, 0, 0},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		c := caddy.NewTestController("", `tls `+certFile+` `+keyFile+` {
+			protocols `+test.protocols+`
+		}`)
+		err := setupTLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d (%s): Expected an error, but didn't get one", i, test.protocols)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d (%s): Expected no errors, got: %v", i, test.protocols, err)
+		}
+		if cfg.ProtocolMinVersion != test.min || cfg.ProtocolMaxVersion != test.max {
+			t.Errorf("Test %d (%s): Expected versions %#x-%#x, got %#x-%#x",
+				i, test.protocols, test.min, test.max, cfg.ProtocolMinVersion, cfg.ProtocolMaxVersion)
+		}
+	}
+}
+
 const (
 	certFile = "test_cert.pem"
 	keyFile  = "test_key.pem"
@@ -318,3 +679,123 @@ AwEHoUQDQgAEs22MtnG79K1mvIyjEO9GLx7BFD0tBbGnwQ0VPsuCxC6IeVuXbQDL
 SiVQvFZ6lUszTlczNxVkpEfqrM6xAupB7g==
 -----END EC PRIVATE KEY-----
 `)
+
+func TestLoadCertsInDirReload(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+	defer func() { certDirs = make(map[string]*certDir) }()
+
+	dir, err := ioutil.TempDir("", "caddytls-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundleFile := filepath.Join(dir, "site.pem")
+
+	writeBundle := func(serial int64, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "reload.example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     []string{"reload.example.com"},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+		if err := ioutil.WriteFile(bundleFile, bundle, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(bundleFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	servedSerial := func() int64 {
+		cert, _, _ := getCertificate("reload.example.com")
+		if len(cert.Certificate.Certificate) == 0 {
+			t.Fatal("No certificate cached for reload.example.com")
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+
+	cfg := &Config{Enabled: true, Manual: true, DisableOCSPStapling: true}
+	start := time.Now().Add(-time.Minute)
+	writeBundle(1, start)
+	if err := loadCertsInDir(caddy.NewTestController("", "tls"), dir, cfg); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if serial := servedSerial(); serial != 1 {
+		t.Errorf("Expected serial 1 after loading, got %d", serial)
+	}
+
+	// unchanged files are not loaded again
+	certCacheMu.Lock()
+	delete(certCache, "reload.example.com")
+	certCacheMu.Unlock()
+	ReloadCertDirs()
+	if _, matched, _ := getCertificate("reload.example.com"); matched {
+		t.Error("Expected unchanged file not to be loaded again")
+	}
+
+	// changed files replace the cached certificate
+	writeBundle(2, start.Add(time.Second))
+	ReloadCertDirs()
+	if serial := servedSerial(); serial != 2 {
+		t.Errorf("Expected serial 2 after the file changed, got %d", serial)
+	}
+
+	// broken files keep the last good certificate
+	if err := ioutil.WriteFile(bundleFile, []byte("not a bundle"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ReloadCertDirs()
+	if serial := servedSerial(); serial != 2 {
+		t.Errorf("Expected serial 2 after a broken update, got %d", serial)
+	}
+}
+
+func TestSetupParseSelfSigned(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	for i, test := range []struct {
+		hostname   string
+		expectWarn bool
+	}{
+		{"localhost", false},
+		{"app.test", false},
+		{"example.com", true},
+	} {
+		logBuf.Reset()
+		cfg := &Config{Hostname: test.hostname}
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		if err := setupTLS(caddy.NewTestController("", `tls self_signed`)); err != nil {
+			t.Fatalf("Test %d: Expected no errors, got: %v", i, err)
+		}
+		if !cfg.SelfSigned {
+			t.Errorf("Test %d: Expected config to be self-signed", i)
+		}
+		if _, matched, _ := getCertificate(test.hostname); !matched {
+			t.Errorf("Test %d: Expected a certificate to be cached for %s", i, test.hostname)
+		}
+		if warned := strings.Contains(logBuf.String(), "[WARNING]"); warned != test.expectWarn {
+			t.Errorf("Test %d: Expected warning to be %v, got log: %s", i, test.expectWarn, logBuf.String())
+		}
+	}
+}
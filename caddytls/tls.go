@@ -17,6 +17,7 @@ package caddytls
 import (
 	"encoding/json"
 	"net"
+	"sort"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -46,6 +47,33 @@ func HostQualifies(hostname string) bool {
 		net.ParseIP(hostname) == nil
 }
 
+// localHostname returns true if hostname can only refer to the
+// local machine or network, like localhost, a .localhost, .local
+// or .test name, a name without dots, or a loopback or private
+// IP address.
+func localHostname(hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if ip := net.ParseIP(hostname); ip != nil {
+		return ip.IsLoopback() || privateIP(ip) || ip.IsUnspecified()
+	}
+	return hostname == "localhost" ||
+		strings.HasSuffix(hostname, ".localhost") ||
+		strings.HasSuffix(hostname, ".local") ||
+		strings.HasSuffix(hostname, ".test") ||
+		!strings.Contains(hostname, ".")
+}
+
+// privateIP returns true if ip is in one of the private networks
+// of RFC 1918 or is an IPv6 unique local address (RFC 4193).
+func privateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4[0] == 10 ||
+			(ip4[0] == 172 && ip4[1]&0xf0 == 16) ||
+			(ip4[0] == 192 && ip4[1] == 168)
+	}
+	return len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc
+}
+
 // saveCertResource saves the certificate resource to disk. This
 // includes the certificate file itself, the private key, and the
 // metadata file.
@@ -141,7 +169,11 @@ func QualifiesForManagedTLS(c ConfigHolder) bool {
 }
 
 // DNSProviderConstructor is a function that takes credentials and
-// returns a type that can solve the ACME DNS challenges.
+// returns a type that can solve the ACME DNS challenges. Caddy
+// calls it without credentials, so it should read them from the
+// environment. The provider creates the TXT record, and removes
+// it in CleanUp once the challenge is done; waiting for the record
+// to propagate is up to the ACME client.
 type DNSProviderConstructor func(credentials ...string) (acme.ChallengeProvider, error)
 
 // dnsProviders is the list of DNS providers that have been plugged in.
@@ -153,6 +185,17 @@ func RegisterDNSProvider(name string, provider DNSProviderConstructor) {
 	caddy.RegisterPlugin("tls.dns."+name, caddy.Plugin{})
 }
 
+// DNSProviderNames returns the sorted names of the
+// DNS providers that have been plugged in.
+func DNSProviderNames() []string {
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 var (
 	// DefaultEmail represents the Let's Encrypt account email to use if none provided.
 	DefaultEmail string
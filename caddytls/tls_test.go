@@ -152,3 +152,57 @@ func TestExistingCertAndKey(t *testing.T) {
 		t.Errorf("Expected %v to have existing cert and key, but it did NOT", domain)
 	}
 }
+
+func TestRegisterDNSProvider(t *testing.T) {
+	defer func() {
+		delete(dnsProviders, "testdns2")
+		delete(dnsProviders, "testdns1")
+	}()
+	noop := func(credentials ...string) (acme.ChallengeProvider, error) { return nil, nil }
+	RegisterDNSProvider("testdns2", noop)
+	RegisterDNSProvider("testdns1", noop)
+
+	var found []string
+	for _, name := range DNSProviderNames() {
+		if name == "testdns1" || name == "testdns2" {
+			found = append(found, name)
+		}
+	}
+	if len(found) != 2 || found[0] != "testdns1" || found[1] != "testdns2" {
+		t.Errorf("Expected registered providers in sorted order, got %v", found)
+	}
+}
+
+func TestLocalHostname(t *testing.T) {
+	for i, test := range []struct {
+		host   string
+		expect bool
+	}{
+		{"", true},
+		{"localhost", true},
+		{"LocalHost", true},
+		{"app.localhost", true},
+		{"printer.local", true},
+		{"myapp.test", true},
+		{"devbox", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"192.168.1.10", true},
+		{"10.0.0.5", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"fd12:3456::1", true},
+		{"172.32.0.1", false},
+		{"192.169.0.1", false},
+		{"fe80::1", false},
+		{"example.com", false},
+		{"localhost.example.com", false},
+		{"local.example.com", false},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	} {
+		if got := localHostname(test.host); got != test.expect {
+			t.Errorf("Test %d: Expected localHostname(%q) to be %v, got %v", i, test.host, test.expect, got)
+		}
+	}
+}